@@ -0,0 +1,761 @@
+// Package asm is a two-pass assembler for Intel 8080 source. It accepts the
+// syntax of the Intel 8080 assembler: labels, ORG, EQU, SET, DB, DW, DS and
+// END, expressions with $ and hex, octal, binary and character literals,
+// MACRO and ENDM with LOCAL labels and EXITM, REPT, IF, ELSE and ENDIF, and
+// INCLUDE.
+//
+// Sources using CSEG, DSEG, PUBLIC or EXTRN are relocatable: their code and
+// data segments start at zero and Object turns them into modules for the
+// linker of package obj. ASEG goes back to absolute addresses.
+package asm
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"8080emu/isa"
+	"8080emu/obj"
+)
+
+// Error is an error found at a line of the source
+type Error struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// ErrorList is every error found while assembling, sorted by file and line
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	var msgs []string
+	for _, e := range l {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Symbol is a label, a name defined by EQU or SET, or an EXTRN. Value is an
+// offset in Seg.
+type Symbol struct {
+	Name   string
+	Value  uint16
+	Seg    obj.Segment
+	Public bool
+	File   string
+	Line   int
+
+	seq   int  // the statement that defined it, see statement.seq
+	set   bool // defined by SET, so it can be defined again
+	label bool // an address rather than a constant
+}
+
+// Fragment is a run of bytes assembled at consecutive addresses of a segment
+type Fragment struct {
+	Seg  obj.Segment
+	Addr uint16
+	Data []byte
+}
+
+// ListLine is a line of the listing: the source line and what it assembled to
+type ListLine struct {
+	File  string
+	Line  int
+	Seg   obj.Segment
+	Addr  uint16
+	Data  []byte
+	Text  string
+	Code  bool // Addr is meaningful: the line is an instruction or data
+	Macro bool // the line comes from a macro expansion
+}
+
+// Program is the result of assembling a source
+type Program struct {
+	Fragments []Fragment
+	Symbols   map[string]*Symbol
+	Listing   []ListLine
+	Relocs    []obj.Reloc
+	CodeSize  uint16
+	DataSize  uint16
+	Entry     uint16 // the address given to END, zero when there is none
+	EntrySeg  obj.Segment
+
+	hasEntry bool
+}
+
+// statement is a source line split into its fields
+type statement struct {
+	file  string
+	line  int
+	text  string
+	label string
+	op    string // upper case
+	args  []string
+	rest  string // the operands as written, for macro arguments
+	macro string // the macro the line comes from, if any
+	seq   int    // counts the statements of a pass, the same in both passes
+}
+
+// AssembleFile reads and assembles the source at path
+func AssembleFile(path string) (*Program, error) {
+	var src, err = os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Assemble(path, src)
+}
+
+// Assemble assembles src. name is used in the error messages and listing,
+// and files included by src are looked up relative to it. The error, when
+// not nil, is an ErrorList.
+func Assemble(name string, src []byte) (*Program, error) {
+	var a = assembler{
+		prog:  &Program{Symbols: map[string]*Symbol{}},
+		files: map[string][]string{name: splitLines(src)},
+	}
+
+	a.run(name)
+	if len(a.errs) > 0 {
+		// The second pass and the PUBLIC checks find errors after the
+		// first pass, anywhere in the source
+		sort.SliceStable(a.errs, func(i, j int) bool {
+			var x, y = a.errs[i], a.errs[j]
+			return x.File < y.File || x.File == y.File && x.Line < y.Line
+		})
+		return nil, a.errs
+	}
+	return a.prog, nil
+}
+
+func splitLines(src []byte) []string {
+	var text = strings.TrimSuffix(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n")
+	return strings.Split(text, "\n")
+}
+
+type assembler struct {
+	pass    int
+	pc      uint16
+	seg     obj.Segment
+	pcs     [3]uint16 // the location counters of the segments not in use
+	full    [3]bool   // the segments whose location counter reached 10000H
+	ended   bool
+	seq     int
+	errs    ErrorList
+	prog    *Program
+	pending []pendingEqu // EQUs that could not be resolved in the first pass
+
+	files     map[string][]string // sources read so far, by path
+	including []string            // the files being read, innermost last
+	macros    map[string]*macro
+	expanding int // depth of macro expansion
+	locals    int // counts the LOCAL labels made so far
+
+	publics []*statement // the PUBLIC statements, checked at the end
+}
+
+type pendingEqu struct {
+	st     *statement
+	dollar value
+}
+
+func (a *assembler) run(name string) {
+	for a.pass = 1; a.pass <= 2; a.pass++ {
+		a.pc, a.ended, a.seq, a.locals = 0, false, 0, 0
+		a.seg, a.pcs, a.full = obj.Absolute, [3]uint16{}, [3]bool{}
+		a.prog.CodeSize, a.prog.DataSize = 0, 0
+		a.macros = map[string]*macro{}
+		a.publics = nil
+		a.source(name, a.files[name])
+
+		if a.pass == 1 {
+			a.resolvePending()
+		}
+	}
+	a.markPublics()
+}
+
+// markPublics makes public the symbols named by PUBLIC
+func (a *assembler) markPublics() {
+	for _, st := range a.publics {
+		for _, name := range st.args {
+			var sym, ok = a.prog.Symbols[strings.ToUpper(name)]
+			switch {
+			case !ok:
+				a.report(st, "undefined symbol %s", name)
+			case sym.Seg == obj.External:
+				a.report(st, "%s is an EXTRN", sym.Name)
+			default:
+				sym.Public = true
+			}
+		}
+	}
+}
+
+// dollar is the value of $
+func (a *assembler) dollar() value {
+	return value{n: int(a.pc), seg: a.seg}
+}
+
+// segment switches to the location counter of seg
+func (a *assembler) segment(seg obj.Segment) {
+	a.pcs[a.seg] = a.pc
+	a.seg, a.pc = seg, a.pcs[seg]
+}
+
+// grow records the size reached by the segment in use
+func (a *assembler) grow() {
+	switch {
+	case a.seg == obj.Code && a.pc > a.prog.CodeSize:
+		a.prog.CodeSize = a.pc
+	case a.seg == obj.Data && a.pc > a.prog.DataSize:
+		a.prog.DataSize = a.pc
+	}
+}
+
+// resolvePending evaluates the EQUs that used names defined after them until
+// no more can be resolved. Whatever is left is reported by the second pass.
+func (a *assembler) resolvePending() {
+	for progress := true; progress; {
+		progress = false
+		var left []pendingEqu
+		for _, p := range a.pending {
+			var v, err = a.eval(p.st, p.st.args[0], p.dollar)
+			if err != nil {
+				left = append(left, p)
+				continue
+			}
+			a.define(p.st, p.st.label, v)
+			progress = true
+		}
+		a.pending = left
+	}
+}
+
+// errorf reports an error found in the second pass. The first pass finds
+// the same errors, so they are not reported twice.
+func (a *assembler) errorf(st *statement, format string, args ...interface{}) {
+	if a.pass != 1 {
+		a.report(st, format, args...)
+	}
+}
+
+// report records an error whatever the pass
+func (a *assembler) report(st *statement, format string, args ...interface{}) {
+	var msg = fmt.Sprintf(format, args...)
+	if st.macro != "" {
+		msg = "in macro " + st.macro + ": " + msg
+	}
+	a.errs = append(a.errs, &Error{File: st.file, Line: st.line, Msg: msg})
+}
+
+// eval evaluates expr with $ at dollar
+func (a *assembler) eval(st *statement, expr string, dollar value) (value, error) {
+	return eval(expr, dollar, func(name string) (value, error) {
+		var sym, ok = a.prog.Symbols[name]
+		if !ok {
+			return value{}, &undefinedError{name}
+		}
+		var v = value{n: int(sym.Value), seg: sym.Seg}
+		if sym.Seg == obj.External {
+			v.ext = name
+		}
+		return v, nil
+	})
+}
+
+// value evaluates expr, reporting errors in the second pass. In the first pass
+// undefined symbols are fine as only the sizes matter.
+func (a *assembler) value(st *statement, expr string) value {
+	var v, err = a.eval(st, expr, a.dollar())
+	if err != nil {
+		a.errorf(st, "%v", err)
+	}
+	return v
+}
+
+// absolute evaluates an expression that must not be relocatable
+func (a *assembler) absolute(st *statement, expr string) uint16 {
+	var v = a.value(st, expr)
+	if v.relocatable() {
+		a.errorf(st, "%s is relocatable", expr)
+	}
+	return uint16(v.n)
+}
+
+// define sets name to v. Names may only be defined once, except with SET,
+// and must keep the value they got in the first pass.
+func (a *assembler) define(st *statement, name string, v value) {
+	if v.part != obj.Word {
+		a.errorf(st, "%s can not be a byte of a relocatable value", name)
+		v.part = obj.Word
+	}
+
+	var sym, ok = a.prog.Symbols[name]
+	switch {
+	case !ok || st.op == "SET" && sym.set:
+		a.prog.Symbols[name] = &Symbol{
+			Name: name, Value: uint16(v.n), Seg: v.seg, File: st.file, Line: st.line,
+			seq: st.seq, set: st.op == "SET", label: st.op != "EQU" && st.op != "SET",
+		}
+	case sym.seq != st.seq:
+		if a.pass == 1 {
+			a.report(st, "%s already defined at %s:%d", name, sym.File, sym.Line)
+		}
+	case sym.Value != uint16(v.n) || sym.Seg != v.seg:
+		a.errorf(st, "phase error: %s is %04XH, was %04XH in the first pass", name, v.n, sym.Value)
+	}
+}
+
+func (a *assembler) statement(st *statement) {
+	var start = a.pc
+	var data []byte
+	var reserved int // the bytes skipped by DS
+	var code = st.op != ""
+
+	if st.label != "" && st.op != "EQU" && st.op != "SET" {
+		a.define(st, st.label, a.dollar())
+		code = true
+	}
+
+	switch st.op {
+	case "":
+	case "ORG":
+		if a.wantArgs(st, 1) {
+			a.pc = a.needed(st, st.args[0])
+			start = a.pc
+			a.full[a.seg] = false
+		}
+	case "ASEG", "CSEG", "DSEG":
+		if a.wantArgs(st, 0) {
+			a.segment(map[string]obj.Segment{"ASEG": obj.Absolute, "CSEG": obj.Code, "DSEG": obj.Data}[st.op])
+			start = a.pc
+		}
+	case "PUBLIC":
+		code = false
+		if a.pass == 2 {
+			a.publics = append(a.publics, st)
+		}
+	case "EXTRN":
+		code = false
+		for _, name := range st.args {
+			if !a.isName(strings.ToUpper(name)) {
+				a.errorf(st, "bad name %s", name)
+				continue
+			}
+			var ext = strings.ToUpper(name)
+			a.define(st, ext, value{seg: obj.External, ext: ext})
+		}
+	case "EQU", "SET":
+		code = false
+		if st.label == "" {
+			a.errorf(st, "%s needs a name", st.op)
+		} else if a.wantArgs(st, 1) {
+			var v, err = a.eval(st, st.args[0], a.dollar())
+			if _, undefined := err.(*undefinedError); undefined && a.pass == 1 && st.op == "EQU" {
+				a.pending = append(a.pending, pendingEqu{st, a.dollar()})
+			} else if err != nil {
+				a.errorf(st, "%v", err)
+			} else {
+				a.define(st, st.label, v)
+			}
+		}
+	case "DB":
+		a.wantSome(st)
+		data = a.db(st)
+	case "DW":
+		a.wantSome(st)
+		for _, arg := range st.args {
+			var v = a.word(st, arg, a.pc+uint16(len(data)))
+			data = append(data, byte(v), byte(v>>8))
+		}
+	case "DS":
+		if a.wantArgs(st, 1) {
+			reserved = int(a.needed(st, st.args[0]))
+		}
+	case "END":
+		code = false
+		a.ended = true
+		if len(st.args) > 0 {
+			var v = a.value(st, st.args[0])
+			if v.seg == obj.External || v.part != obj.Word {
+				a.errorf(st, "the entry point must be in this module")
+			}
+			a.prog.Entry, a.prog.EntrySeg, a.prog.hasEntry = uint16(v.n), v.seg, true
+		}
+	default:
+		data = a.instruction(st)
+	}
+
+	a.emit(start, data)
+	a.advance(st, start, len(data)+reserved)
+	a.grow()
+	if a.pass == 2 {
+		a.prog.Listing = append(a.prog.Listing, ListLine{
+			File: st.file, Line: st.line, Seg: a.seg, Addr: start, Data: data, Text: st.text, Code: code,
+			Macro: st.macro != "",
+		})
+	}
+}
+
+// needed evaluates an expression that must be known in the first pass, as
+// it moves the location counter. It may only be relocatable in the segment
+// in use.
+func (a *assembler) needed(st *statement, expr string) uint16 {
+	var v, err = a.eval(st, expr, a.dollar())
+	var _, undefined = err.(*undefinedError)
+	if undefined && a.pass == 1 {
+		a.report(st, "%v: it must be defined before this line", err)
+	} else if err != nil && !undefined {
+		a.errorf(st, "%v", err)
+	} else if err == nil && v.relocatable() && !v.sameBase(a.dollar()) {
+		a.errorf(st, "%s is relocatable", expr)
+	}
+	return uint16(v.n)
+}
+
+// advance moves the location counter past the size bytes of st from start.
+// It may reach 10000H at the end of a statement, but not go past it.
+func (a *assembler) advance(st *statement, start uint16, size int) {
+	if size == 0 {
+		return
+	}
+	var end = int(start) + size
+	if a.full[a.seg] || end > 0x10000 {
+		a.errorf(st, "%s runs past 0FFFFH", st.op)
+	}
+	a.full[a.seg] = end == 0x10000
+	a.pc = uint16(end)
+}
+
+func (a *assembler) wantSome(st *statement) {
+	if len(st.args) == 0 {
+		a.errorf(st, "%s takes at least 1 operand", st.op)
+	}
+}
+
+func (a *assembler) wantArgs(st *statement, n int) bool {
+	if len(st.args) != n {
+		a.errorf(st, "%s takes %d operand(s), got %d", st.op, n, len(st.args))
+		return false
+	}
+	return true
+}
+
+// emit places data at start in the second pass
+func (a *assembler) emit(start uint16, data []byte) {
+	if a.pass != 2 || len(data) == 0 {
+		return
+	}
+
+	var frags = a.prog.Fragments
+	if n := len(frags); n > 0 && frags[n-1].Seg == a.seg && frags[n-1].Addr+uint16(len(frags[n-1].Data)) == start {
+		frags[n-1].Data = append(frags[n-1].Data, data...)
+		return
+	}
+	a.prog.Fragments = append(frags, Fragment{Seg: a.seg, Addr: start, Data: append([]byte(nil), data...)})
+}
+
+// relocate records that the kind part of v is stored at addr
+func (a *assembler) relocate(v value, addr uint16, kind obj.RelocKind) {
+	if a.pass != 2 || !v.relocatable() {
+		return
+	}
+	a.prog.Relocs = append(a.prog.Relocs, obj.Reloc{
+		Seg: a.seg, Addr: addr, Kind: kind, Base: v.seg, Symbol: v.ext, Addend: uint16(v.n),
+	})
+}
+
+func (a *assembler) db(st *statement) []byte {
+	var data []byte
+	for _, arg := range st.args {
+		if len(arg) > 1 && (arg[0] == '\'' || arg[0] == '"') {
+			if str, n, err := unquote(arg); err == nil && n == len(arg) {
+				data = append(data, str...)
+				continue
+			}
+		}
+		data = append(data, a.byteValue(st, arg, a.pc+uint16(len(data))))
+	}
+	return data
+}
+
+// word evaluates an expression stored in two bytes at addr
+func (a *assembler) word(st *statement, expr string, addr uint16) uint16 {
+	var v = a.value(st, expr)
+	if v.part != obj.Word {
+		a.errorf(st, "%s is a byte of a relocatable value", expr)
+	}
+	a.relocate(v, addr, obj.Word)
+	return uint16(v.n)
+}
+
+// byteValue evaluates an expression stored in a byte at addr. Negative
+// values are allowed, and relocatable values need HIGH or LOW.
+func (a *assembler) byteValue(st *statement, expr string, addr uint16) byte {
+	var v = a.value(st, expr)
+	switch {
+	case v.part == obj.High:
+		a.relocate(v, addr, obj.High)
+		return byte(v.n >> 8)
+	case v.part == obj.Low:
+		a.relocate(v, addr, obj.Low)
+	case v.relocatable():
+		a.errorf(st, "relocatable value %s does not fit in a byte", expr)
+	case v.n > 0xff && v.n < 0xff00:
+		a.errorf(st, "value %04XH does not fit in a byte", v.n)
+	}
+	return byte(v.n)
+}
+
+// instruction encodes the instruction of st
+func (a *assembler) instruction(st *statement) []byte {
+	var forms, ok = instructions[st.op]
+	if !ok {
+		a.errorf(st, "unknown instruction %s", st.op)
+		return nil
+	}
+
+	// Every form of a mnemonic has the same shape, registers come first
+	var nregs, size = forms.regs, forms.size
+	var nargs = nregs
+	if size > 1 {
+		nargs++
+	}
+	if len(st.args) != nargs {
+		a.errorf(st, "%s takes %d operand(s), got %d", st.op, nargs, len(st.args))
+		return make([]byte, size)
+	}
+
+	var key = st.op
+	for i := 0; i < nregs; i++ {
+		var reg = strings.ToUpper(st.args[i])
+		if st.op == "RST" {
+			var n = a.absolute(st, st.args[i])
+			if n > 7 {
+				a.errorf(st, "RST takes 0 to 7, got %d", n)
+			}
+			reg = fmt.Sprint(n & 7)
+		}
+		key += " " + reg
+	}
+
+	var code, found = forms.codes[key]
+	if !found {
+		a.errorf(st, "bad operands for %s: %s", st.op, strings.Join(st.args[:nregs], ", "))
+	}
+
+	var data = []byte{code}
+	switch size {
+	case 2:
+		data = append(data, a.byteValue(st, st.args[nregs], a.pc+1))
+	case 3:
+		var v = a.word(st, st.args[nregs], a.pc+1)
+		data = append(data, byte(v), byte(v>>8))
+	}
+	return data
+}
+
+// forms are the opcodes of a mnemonic keyed by "MNEMONIC REG REG"
+type forms struct {
+	regs  int
+	size  int
+	codes map[string]byte
+}
+
+var instructions = map[string]*forms{}
+
+var registerNames = map[isa.Operand]string{
+	isa.RegA:   "A",
+	isa.RegB:   "B",
+	isa.RegC:   "C",
+	isa.RegD:   "D",
+	isa.RegE:   "E",
+	isa.RegH:   "H",
+	isa.RegL:   "L",
+	isa.RegM:   "M",
+	isa.RegSp:  "SP",
+	isa.Reg0:   "0",
+	isa.Reg1:   "1",
+	isa.Reg2:   "2",
+	isa.Reg3:   "3",
+	isa.Reg4:   "4",
+	isa.Reg5:   "5",
+	isa.Reg6:   "6",
+	isa.Reg7:   "7",
+	isa.RegPsw: "PSW",
+}
+
+func init() {
+	for code, op := range isa.Opcodes {
+		if op.Size == 0 || op.Mnemonic == "NOP" && code != 0 {
+			continue
+		}
+
+		var f, ok = instructions[op.Mnemonic]
+		if !ok {
+			f = &forms{size: int(op.Size), codes: map[string]byte{}}
+			instructions[op.Mnemonic] = f
+		}
+
+		var key = op.Mnemonic
+		var regs = 0
+		for _, o := range []isa.Operand{op.FirstOp, op.OperandLow} {
+			if o.IsRegister() {
+				key += " " + registerNames[o]
+				regs++
+			}
+		}
+		f.regs = regs
+		f.codes[key] = byte(code)
+	}
+}
+
+// directives can not be used as labels without a colon
+var directives = map[string]bool{
+	"ORG": true, "EQU": true, "SET": true, "DB": true, "DW": true, "DS": true, "END": true,
+	"MACRO": true, "ENDM": true, "LOCAL": true, "EXITM": true, "REPT": true,
+	"IF": true, "ELSE": true, "ENDIF": true, "INCLUDE": true,
+	"ASEG": true, "CSEG": true, "DSEG": true, "PUBLIC": true, "EXTRN": true,
+}
+
+// isOp tells if name is an instruction, a directive or a macro
+func (a *assembler) isOp(name string) bool {
+	var upper = strings.ToUpper(name)
+	return instructions[upper] != nil || directives[upper] || a.macros[upper] != nil
+}
+
+// parseLine splits a source line into label, operation and operands
+func (a *assembler) parseLine(text string) (*statement, error) {
+	var st = &statement{}
+	var line = strings.TrimRight(stripComment(text), " \t")
+	var rest = strings.TrimLeft(line, " \t")
+	var atColumn0 = len(rest) == len(line)
+
+	var first, after = splitWord(rest)
+	if first == "" && rest != "" {
+		return nil, fmt.Errorf("unexpected %q", rest)
+	}
+
+	switch {
+	case strings.HasPrefix(after, ":"):
+		st.label = strings.ToUpper(first)
+		first, after = splitWord(strings.TrimLeft(after[1:], " \t"))
+	case first != "" && isEquate(after):
+		st.label = strings.ToUpper(first)
+		first, after = splitWord(strings.TrimLeft(after, " \t"))
+	case first != "" && atColumn0 && !a.isOp(first):
+		st.label = strings.ToUpper(first)
+		first, after = splitWord(strings.TrimLeft(after, " \t"))
+	}
+
+	if st.label != "" && !a.isName(st.label) {
+		return nil, fmt.Errorf("bad label %s", st.label)
+	}
+
+	st.op = strings.ToUpper(first)
+	st.rest = strings.TrimSpace(after)
+	var args, err = splitArgs(after)
+	st.args = args
+	return st, err
+}
+
+// isEquate tells if the rest of a line starts with EQU, SET or MACRO, so the
+// word before it is a name
+func isEquate(rest string) bool {
+	var word, _ = splitWord(strings.TrimLeft(rest, " \t"))
+	word = strings.ToUpper(word)
+	return word == "EQU" || word == "SET" || word == "MACRO"
+}
+
+func (a *assembler) isName(s string) bool {
+	if !isIdentStart(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isIdentChar(s[i]) {
+			return false
+		}
+	}
+	return !words[s] && !a.isOp(s)
+}
+
+// splitWord returns the identifier at the start of s and what follows it
+func splitWord(s string) (string, string) {
+	var i = 0
+	for i < len(s) && isIdentChar(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// stripComment removes a ; comment that is not inside quotes
+func stripComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote != 0 && s[i] == quote:
+			quote = 0
+		case quote != 0:
+		case s[i] == '\'' || s[i] == '"':
+			quote = s[i]
+		case s[i] == ';':
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// splitArgs splits operands on the commas outside quotes and parentheses
+func splitArgs(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	var args []string
+	var quote byte
+	var depth, start int
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote != 0 && s[i] == quote:
+			quote = 0
+		case quote != 0:
+		case s[i] == '\'' || s[i] == '"':
+			quote = s[i]
+		case s[i] == '(':
+			depth++
+		case s[i] == ')':
+			depth--
+		case s[i] == ',' && depth == 0:
+			args = append(args, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated string")
+	}
+	args = append(args, strings.TrimSpace(s[start:]))
+
+	for _, arg := range args {
+		if arg == "" {
+			return nil, fmt.Errorf("empty operand")
+		}
+	}
+	return args, nil
+}
+
+// SortedSymbols returns the symbols of p sorted by name
+func (p *Program) SortedSymbols() []*Symbol {
+	var syms []*Symbol
+	for _, s := range p.Symbols {
+		syms = append(syms, s)
+	}
+	sort.Slice(syms, func(i, j int) bool { return syms[i].Name < syms[j].Name })
+	return syms
+}
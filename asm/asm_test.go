@@ -0,0 +1,147 @@
+package asm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func assemble(t *testing.T, src string) *Program {
+	t.Helper()
+	var prog, err = Assemble("test.asm", []byte(src))
+	if err != nil {
+		t.Fatalf("Assemble: %v", err)
+	}
+	return prog
+}
+
+func TestAssemble(t *testing.T) {
+	var table = []struct {
+		src string
+		exp []byte
+	}{
+		{"NOP", []byte{0x00}},
+		{"MOV B,C", []byte{0x41}},
+		{"mov a, m", []byte{0x7e}},
+		{"MVI M,0FFH", []byte{0x36, 0xff}},
+		{"MVI A,-1", []byte{0x3e, 0xff}},
+		{"LXI SP,1234H", []byte{0x31, 0x34, 0x12}},
+		{"LDAX D", []byte{0x1a}},
+		{"PUSH PSW", []byte{0xf5}},
+		{"POP B", []byte{0xc1}},
+		{"RST 7", []byte{0xff}},
+		{"JMP $", []byte{0xc3, 0x00, 0x00}},
+		{"JNZ $+3", []byte{0xc2, 0x03, 0x00}},
+		{"STA 2000H", []byte{0x32, 0x00, 0x20}},
+		{"OUT 10H", []byte{0xd3, 0x10}},
+		{"CPI 'A'", []byte{0xfe, 0x41}},
+		{"HLT", []byte{0x76}},
+		{"DB 1,2,'AB',\"C;D\"", []byte{1, 2, 'A', 'B', 'C', ';', 'D'}},
+		{"DB 'It''s'", []byte{'I', 't', '\'', 's'}},
+		{"DB 'A'+80H", []byte{0xc1}},
+		{"DW 1234H,'AB'", []byte{0x34, 0x12, 0x42, 0x41}},
+		{"LABEL: DB LABEL+1 ; comment", []byte{0x01}},
+	}
+
+	for _, test := range table {
+		var prog = assemble(t, test.src)
+		var _, image = prog.Binary()
+		if !bytes.Equal(image, test.exp) {
+			t.Errorf("%q = % x, expected % x", test.src, image, test.exp)
+		}
+	}
+}
+
+func TestLabelsAndEquates(t *testing.T) {
+	var prog = assemble(t, `
+COUNT	EQU	LAST-FIRST	; forward references
+SIZE	EQU	COUNT*2
+	ORG	100H
+FIRST:	JMP	NEXT
+NEXT	MVI	B,SIZE		; label without a colon
+	DS	4
+LAST:
+N	SET	1
+N	SET	N+1
+	DB	N
+	END	FIRST
+`)
+
+	var expected = map[string]uint16{
+		"COUNT": 9, "SIZE": 18, "FIRST": 0x100, "NEXT": 0x103, "LAST": 0x109, "N": 2,
+	}
+	for name, v := range expected {
+		if sym, ok := prog.Symbols[name]; !ok {
+			t.Errorf("%s is not defined", name)
+		} else if sym.Value != v {
+			t.Errorf("%s = %04x, expected %04x", name, sym.Value, v)
+		}
+	}
+
+	var org, image = prog.Binary()
+	var exp = []byte{0xc3, 0x03, 0x01, 0x06, 18, 0, 0, 0, 0, 2}
+	if org != 0x100 || !bytes.Equal(image, exp) {
+		t.Errorf("Binary() = %04x % x, expected 0100 % x", org, image, exp)
+	}
+	if prog.Entry != 0x100 {
+		t.Errorf("Entry = %04x, expected 0100", prog.Entry)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	var _, err = Assemble("bad.asm", []byte(`	NOP
+	MOV A
+	MVI A,100H
+	FOO
+LOOP:	NOP
+LOOP:	NOP
+	JMP NOWHERE
+	ORG LATER
+LATER:	DB 'ABC
+	RST 8
+	LXI Q,0
+	DB
+	ORG 0FFFEH
+	DS 2
+	NOP
+	ORG 0FFFFH
+	DW 0
+`))
+	if err == nil {
+		t.Fatalf("Assemble did not fail")
+	}
+
+	var expected = []string{
+		"bad.asm:2: MOV takes 2 operand(s), got 1",
+		"bad.asm:3: value 0100H does not fit in a byte",
+		"bad.asm:4: unknown instruction FOO",
+		"bad.asm:6: LOOP already defined at bad.asm:5",
+		"bad.asm:7: undefined symbol NOWHERE",
+		"bad.asm:8: undefined symbol LATER: it must be defined before this line",
+		"bad.asm:9: unterminated string",
+		"bad.asm:10: RST takes 0 to 7, got 8",
+		"bad.asm:11: bad operands for LXI: Q",
+		"bad.asm:12: DB takes at least 1 operand",
+		"bad.asm:15: NOP runs past 0FFFFH",
+		"bad.asm:17: DW runs past 0FFFFH",
+	}
+
+	var list = err.(ErrorList)
+	var got []string
+	for _, e := range list {
+		got = append(got, e.Error())
+	}
+	for _, e := range expected {
+		if !strings.Contains(err.Error(), e) {
+			t.Errorf("missing error %q in:\n%s", e, strings.Join(got, "\n"))
+		}
+	}
+	for i := 1; i < len(list); i++ {
+		if list[i].Line < list[i-1].Line {
+			t.Errorf("line %d reported after line %d", list[i].Line, list[i-1].Line)
+		}
+	}
+	if len(list) != len(expected) {
+		t.Errorf("got %d errors, expected %d:\n%s", len(list), len(expected), strings.Join(got, "\n"))
+	}
+}
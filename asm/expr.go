@@ -0,0 +1,492 @@
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"8080emu/obj"
+)
+
+type tokKind int
+
+const (
+	tEOF    tokKind = iota
+	tNum            // numeric or character literal, value in val
+	tIdent          // symbol or word operator
+	tStr            // quoted string longer than two characters
+	tOp             // + - * / ( ) = <> < <= > >=
+	tDollar         // location counter
+)
+
+type token struct {
+	kind tokKind
+	text string
+	val  int
+}
+
+// undefinedError is returned when an expression uses a symbol that has not
+// been defined yet. The first pass tolerates it for forward references.
+type undefinedError struct {
+	name string
+}
+
+func (e *undefinedError) Error() string {
+	return fmt.Sprintf("undefined symbol %s", e.name)
+}
+
+// words are the operators written as names, in upper case
+var words = map[string]bool{
+	"MOD": true, "SHL": true, "SHR": true, "NOT": true, "AND": true, "OR": true, "XOR": true,
+	"HIGH": true, "LOW": true, "EQ": true, "NE": true, "LT": true, "LE": true, "GT": true, "GE": true,
+}
+
+func isIdentStart(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c == '_' || c == '?' || c == '@' || c == '.'
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// tokenize splits an expression into tokens
+func tokenize(s string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(s); {
+		var c = s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c >= '0' && c <= '9':
+			var j = i
+			for j < len(s) && isIdentChar(s[j]) {
+				j++
+			}
+			var v, err = parseNumber(s[i:j])
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, token{kind: tNum, text: s[i:j], val: v})
+			i = j
+		case c == '$' && i+1 < len(s) && isHexDigit(s[i+1]):
+			var j = i + 1
+			for j < len(s) && isHexDigit(s[j]) {
+				j++
+			}
+			var v, err = strconv.ParseUint(s[i+1:j], 16, 16)
+			if err != nil {
+				return nil, fmt.Errorf("bad hex number %s", s[i:j])
+			}
+			toks = append(toks, token{kind: tNum, text: s[i:j], val: int(v)})
+			i = j
+		case c == '$':
+			toks = append(toks, token{kind: tDollar, text: "$"})
+			i++
+		case isIdentStart(c):
+			var j = i
+			for j < len(s) && isIdentChar(s[j]) {
+				j++
+			}
+			toks = append(toks, token{kind: tIdent, text: strings.ToUpper(s[i:j])})
+			i = j
+		case c == '\'' || c == '"':
+			var str, n, err = unquote(s[i:])
+			if err != nil {
+				return nil, err
+			}
+			i += n
+			switch len(str) {
+			case 1:
+				toks = append(toks, token{kind: tNum, text: s[i-n : i], val: int(str[0])})
+			case 2:
+				toks = append(toks, token{kind: tNum, text: s[i-n : i], val: int(str[0])<<8 | int(str[1])})
+			default:
+				toks = append(toks, token{kind: tStr, text: str})
+			}
+		case c == '<' || c == '>':
+			var op = s[i : i+1]
+			if i+1 < len(s) && (s[i+1] == '=' || c == '<' && s[i+1] == '>') {
+				op = s[i : i+2]
+			}
+			toks = append(toks, token{kind: tOp, text: op})
+			i += len(op)
+		case strings.IndexByte("+-*/()=", c) >= 0:
+			toks = append(toks, token{kind: tOp, text: s[i : i+1]})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+
+	return append(toks, token{kind: tEOF}), nil
+}
+
+// parseNumber reads a number with an optional radix suffix:
+// H hex, D decimal, O or Q octal and B binary
+func parseNumber(s string) (int, error) {
+	var base = 10
+	var digits = strings.ToUpper(s)
+	var suffix = true
+	switch digits[len(digits)-1] {
+	case 'H':
+		base = 16
+	case 'O', 'Q':
+		base = 8
+	case 'B':
+		base = 2
+	case 'D':
+		base = 10
+	default:
+		suffix = false
+	}
+	if suffix {
+		digits = digits[:len(digits)-1]
+	}
+
+	var v, err = strconv.ParseUint(digits, base, 16)
+	if err != nil {
+		return 0, fmt.Errorf("bad number %s", s)
+	}
+	return int(v), nil
+}
+
+// unquote reads the quoted string at the start of s. A quote is written
+// twice inside the string. It returns the contents and the number of bytes
+// consumed from s.
+func unquote(s string) (string, int, error) {
+	var quote = s[0]
+	var out strings.Builder
+	for i := 1; i < len(s); i++ {
+		if s[i] != quote {
+			out.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == quote {
+			out.WriteByte(quote)
+			i++
+			continue
+		}
+		return out.String(), i + 1, nil
+	}
+
+	return "", 0, fmt.Errorf("unterminated string %s", s)
+}
+
+// value is the result of an expression. A relocatable value is an offset from
+// the start of a segment, or from an external symbol, that the linker adds
+// the address of the segment or symbol to.
+type value struct {
+	n    int
+	seg  obj.Segment   // Absolute for plain numbers
+	ext  string        // the symbol when seg is External
+	part obj.RelocKind // Low or High once LOW or HIGH took a byte of it
+}
+
+func (v value) relocatable() bool {
+	return v.seg != obj.Absolute
+}
+
+// sameBase tells if the difference of v and w is a plain number
+func (v value) sameBase(w value) bool {
+	return v.seg == w.seg && v.ext == w.ext && v.part == obj.Word && w.part == obj.Word
+}
+
+// parser evaluates an expression with the precedence of the Intel assembler,
+// from lowest to highest:
+//
+//	OR XOR
+//	AND
+//	NOT
+//	EQ NE LT LE GT GE (also = <> < <= > >=)
+//	+ -
+//	* / MOD SHL SHR
+//	unary + - HIGH LOW
+//
+// All arithmetic is done on 16 bits and relations are 0FFFFH when true.
+// Relocatable values can only be added to or subtracted from, compared with
+// values of the same segment, and split by HIGH and LOW.
+type parser struct {
+	toks   []token
+	pos    int
+	lookup func(name string) (value, error)
+	dollar value
+}
+
+// eval evaluates expr. lookup resolves symbols and dollar is the value of $.
+func eval(expr string, dollar value, lookup func(name string) (value, error)) (value, error) {
+	var toks, err = tokenize(expr)
+	if err != nil {
+		return value{}, err
+	}
+	if toks[0].kind == tEOF {
+		return value{}, fmt.Errorf("missing expression")
+	}
+
+	var p = parser{toks: toks, lookup: lookup, dollar: dollar}
+	v, err := p.or()
+	if err != nil {
+		return value{}, err
+	}
+	if p.peek().kind != tEOF {
+		return value{}, fmt.Errorf("unexpected %s in expression", p.peek().text)
+	}
+	v.n &= 0xffff
+	return v, nil
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+// accept consumes the next token if it is one of ops
+func (p *parser) accept(ops ...string) (string, bool) {
+	var t = p.peek()
+	if t.kind != tOp && (t.kind != tIdent || !words[t.text]) {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+// absolute fails when one of the operands of op is relocatable
+func absolute(op string, operands ...value) error {
+	for _, v := range operands {
+		if v.relocatable() {
+			return fmt.Errorf("relocatable value used with %s", op)
+		}
+	}
+	return nil
+}
+
+func (p *parser) or() (value, error) {
+	var x, err = p.and()
+	for err == nil {
+		var op, ok = p.accept("OR", "XOR")
+		if !ok {
+			break
+		}
+		var y value
+		if y, err = p.and(); err == nil {
+			err = absolute(op, x, y)
+			if op == "OR" {
+				x.n |= y.n
+			} else {
+				x.n ^= y.n
+			}
+		}
+	}
+	x.n &= 0xffff
+	return x, err
+}
+
+func (p *parser) and() (value, error) {
+	var x, err = p.not()
+	for err == nil {
+		if _, ok := p.accept("AND"); !ok {
+			break
+		}
+		var y value
+		if y, err = p.not(); err == nil {
+			err = absolute("AND", x, y)
+			x.n &= y.n
+		}
+	}
+	x.n &= 0xffff
+	return x, err
+}
+
+func (p *parser) not() (value, error) {
+	if _, ok := p.accept("NOT"); ok {
+		var x, err = p.not()
+		if err == nil {
+			err = absolute("NOT", x)
+		}
+		x.n = ^x.n & 0xffff
+		return x, err
+	}
+	return p.relation()
+}
+
+func (p *parser) relation() (value, error) {
+	var x, err = p.sum()
+	if err != nil {
+		return value{}, err
+	}
+
+	var op, ok = p.accept("EQ", "NE", "LT", "LE", "GT", "GE", "=", "<>", "<", "<=", ">", ">=")
+	if !ok {
+		return x, nil
+	}
+	y, err := p.sum()
+	if err != nil {
+		return value{}, err
+	}
+	if !x.sameBase(y) {
+		return value{}, fmt.Errorf("%s compares values of different segments", op)
+	}
+
+	var result bool
+	switch op {
+	case "EQ", "=":
+		result = x.n == y.n
+	case "NE", "<>":
+		result = x.n != y.n
+	case "LT", "<":
+		result = x.n < y.n
+	case "LE", "<=":
+		result = x.n <= y.n
+	case "GT", ">":
+		result = x.n > y.n
+	case "GE", ">=":
+		result = x.n >= y.n
+	}
+	if result {
+		return value{n: 0xffff}, nil
+	}
+	return value{}, nil
+}
+
+func (p *parser) sum() (value, error) {
+	var x, err = p.product()
+	for err == nil {
+		var op, ok = p.accept("+", "-")
+		if !ok {
+			break
+		}
+		var y value
+		if y, err = p.product(); err != nil {
+			break
+		}
+		if x.part != obj.Word || y.part != obj.Word {
+			return value{}, fmt.Errorf("%s on a byte of a relocatable value", op)
+		}
+
+		switch {
+		case op == "+" && x.relocatable() && y.relocatable():
+			return value{}, fmt.Errorf("+ of two relocatable values")
+		case op == "+":
+			if y.relocatable() {
+				x.seg, x.ext = y.seg, y.ext
+			}
+			x.n = (x.n + y.n) & 0xffff
+		case y.relocatable() && !x.sameBase(y):
+			return value{}, fmt.Errorf("- of a relocatable value from another segment")
+		case y.relocatable():
+			x = value{n: (x.n - y.n) & 0xffff}
+		default:
+			x.n = (x.n - y.n) & 0xffff
+		}
+	}
+	return x, err
+}
+
+func (p *parser) product() (value, error) {
+	var x, err = p.unary()
+	for err == nil {
+		var op, ok = p.accept("*", "/", "MOD", "SHL", "SHR")
+		if !ok {
+			break
+		}
+		var y value
+		if y, err = p.unary(); err != nil {
+			break
+		}
+		if err = absolute(op, x, y); err != nil {
+			break
+		}
+		switch op {
+		case "*":
+			x.n = (x.n * y.n) & 0xffff
+		case "/", "MOD":
+			if y.n == 0 {
+				return value{}, fmt.Errorf("division by zero")
+			}
+			if op == "/" {
+				x.n /= y.n
+			} else {
+				x.n %= y.n
+			}
+		case "SHL":
+			x.n = (x.n << uint(y.n&0x1f)) & 0xffff
+		case "SHR":
+			x.n >>= uint(y.n & 0x1f)
+		}
+	}
+	return x, err
+}
+
+func (p *parser) unary() (value, error) {
+	var op, ok = p.accept("+", "-", "HIGH", "LOW")
+	if !ok {
+		return p.primary()
+	}
+
+	var x, err = p.unary()
+	if err != nil {
+		return value{}, err
+	}
+	if x.relocatable() {
+		switch {
+		case op == "+":
+		case op == "-" || x.part != obj.Word:
+			return value{}, fmt.Errorf("relocatable value used with %s", op)
+		case op == "HIGH":
+			x.part = obj.High
+		case op == "LOW":
+			x.part = obj.Low
+		}
+		return x, nil
+	}
+
+	switch op {
+	case "-":
+		x.n = -x.n & 0xffff
+	case "HIGH":
+		x.n >>= 8
+	case "LOW":
+		x.n &= 0xff
+	}
+	return x, nil
+}
+
+func (p *parser) primary() (value, error) {
+	var t = p.peek()
+	p.pos++
+
+	switch t.kind {
+	case tNum:
+		return value{n: t.val}, nil
+	case tDollar:
+		return p.dollar, nil
+	case tIdent:
+		if words[t.text] {
+			return value{}, fmt.Errorf("unexpected %s in expression", t.text)
+		}
+		return p.lookup(t.text)
+	case tStr:
+		return value{}, fmt.Errorf("string '%s' used as a number", t.text)
+	case tOp:
+		if t.text == "(" {
+			var x, err = p.or()
+			if err != nil {
+				return value{}, err
+			}
+			if _, ok := p.accept(")"); !ok {
+				return value{}, fmt.Errorf("missing )")
+			}
+			return x, nil
+		}
+		return value{}, fmt.Errorf("unexpected %s in expression", t.text)
+	}
+
+	return value{}, fmt.Errorf("missing operand")
+}
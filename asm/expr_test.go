@@ -0,0 +1,155 @@
+package asm
+
+import (
+	"testing"
+
+	"8080emu/obj"
+)
+
+func TestEval(t *testing.T) {
+	var symbols = map[string]uint16{"FIVE": 5, "BUF": 0x2000}
+	var lookup = func(name string) (value, error) {
+		if v, ok := symbols[name]; ok {
+			return value{n: int(v)}, nil
+		}
+		return value{}, &undefinedError{name}
+	}
+
+	var table = []struct {
+		expr string
+		exp  uint16
+	}{
+		{"10", 10},
+		{"10D", 10},
+		{"0FFH", 0xff},
+		{"0ffh", 0xff},
+		{"$1F", 0x1f},
+		{"377O", 0xff},
+		{"377Q", 0xff},
+		{"1010B", 10},
+		{"'A'", 0x41},
+		{"'AB'", 0x4142},
+		{"''''", 0x27},
+		{"$", 0x100},
+		{"$+3", 0x103},
+		{"five", 5},
+		{"BUF+FIVE*2", 0x200a},
+		{"(BUF+FIVE)*2", 0x400a},
+		{"-1", 0xffff},
+		{"0-1", 0xffff},
+		{"HIGH BUF", 0x20},
+		{"LOW (BUF+1)", 0x01},
+		{"17 MOD 5", 2},
+		{"1 SHL 4", 16},
+		{"100H SHR 4", 16},
+		{"NOT 0", 0xffff},
+		{"0F0H AND 3CH", 0x30},
+		{"0F0H OR 0FH", 0xff},
+		{"0FFH XOR 0FH", 0xf0},
+		{"FIVE EQ 5", 0xffff},
+		{"FIVE NE 5", 0},
+		{"FIVE = 5", 0xffff},
+		{"FIVE < 6 AND FIVE > 4", 0xffff},
+		{"FIVE <= 4", 0},
+		{"1 + 2 EQ 3", 0xffff},
+	}
+
+	for _, test := range table {
+		var v, err = eval(test.expr, value{n: 0x100}, lookup)
+		if err != nil {
+			t.Errorf("eval(%q): %v", test.expr, err)
+		} else if v != (value{n: int(test.exp)}) {
+			t.Errorf("eval(%q) = %+v, expected %04x", test.expr, v, test.exp)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	var lookup = func(name string) (value, error) {
+		return value{}, &undefinedError{name}
+	}
+
+	var table = []string{
+		"",
+		"1 +",
+		"(1",
+		"1)",
+		"12G",
+		"1 / 0",
+		"'ABC'",
+		"'A",
+		"UNKNOWN",
+		"AND 1",
+		"1 # 2",
+	}
+
+	for _, expr := range table {
+		if _, err := eval(expr, value{}, lookup); err == nil {
+			t.Errorf("eval(%q) did not fail", expr)
+		}
+	}
+
+	if _, err := eval("LATER", value{}, lookup); err == nil {
+		t.Errorf("eval(LATER) did not fail")
+	} else if _, ok := err.(*undefinedError); !ok {
+		t.Errorf("eval(LATER) = %v, expected an undefinedError", err)
+	}
+}
+
+func TestEvalRelocatable(t *testing.T) {
+	var symbols = map[string]value{
+		"START": {n: 0x10, seg: obj.Code},
+		"END":   {n: 0x30, seg: obj.Code},
+		"BUF":   {n: 0x04, seg: obj.Data},
+		"PUTS":  {seg: obj.External, ext: "PUTS"},
+		"FIVE":  {n: 5},
+	}
+	var lookup = func(name string) (value, error) {
+		return symbols[name], nil
+	}
+
+	var table = []struct {
+		expr string
+		exp  value
+	}{
+		{"START", value{n: 0x10, seg: obj.Code}},
+		{"START+FIVE", value{n: 0x15, seg: obj.Code}},
+		{"FIVE+START-1", value{n: 0x14, seg: obj.Code}},
+		{"END-START", value{n: 0x20}},
+		{"(END-START)/2", value{n: 0x10}},
+		{"END GT START", value{n: 0xffff}},
+		{"PUTS+2", value{n: 2, seg: obj.External, ext: "PUTS"}},
+		{"HIGH (BUF+1)", value{n: 5, seg: obj.Data, part: obj.High}},
+		{"LOW BUF", value{n: 4, seg: obj.Data, part: obj.Low}},
+		{"$-START", value{n: 0x10}},
+		{"HIGH (FIVE*100H)", value{n: 5}},
+	}
+
+	for _, test := range table {
+		var v, err = eval(test.expr, value{n: 0x20, seg: obj.Code}, lookup)
+		if err != nil {
+			t.Errorf("eval(%q): %v", test.expr, err)
+		} else if v != test.exp {
+			t.Errorf("eval(%q) = %+v, expected %+v", test.expr, v, test.exp)
+		}
+	}
+
+	var errors = []string{
+		"START+END",
+		"START*2",
+		"-START",
+		"BUF-START",
+		"START-PUTS",
+		"START AND 0FFH",
+		"NOT BUF",
+		"HIGH BUF+1",
+		"HIGH LOW BUF",
+		"BUF EQ START",
+	}
+
+	for _, expr := range errors {
+		if v, err := eval(expr, value{}, lookup); err == nil {
+			t.Errorf("eval(%q) = %+v, expected an error", expr, v)
+		}
+	}
+}
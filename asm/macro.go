@@ -0,0 +1,397 @@
+package asm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxExpansion bounds the nesting of macros and includes, so a macro calling
+// itself fails instead of running out of memory
+const maxExpansion = 32
+
+// macro is a MACRO ... ENDM definition
+type macro struct {
+	name   string
+	params []string // upper case
+	body   []string
+}
+
+// cond is an open IF block
+type cond struct {
+	st       *statement
+	active   bool // the lines are assembled
+	outer    bool // the enclosing block is assembled
+	seenElse bool
+}
+
+// source assembles the lines of file, expanding includes, macros, REPT
+// blocks and conditionals
+func (a *assembler) source(file string, lines []string) {
+	a.including = append(a.including, file)
+	a.block(lines, func(st *statement, i int) {
+		st.file, st.line = file, i+1
+	})
+	a.including = a.including[:len(a.including)-1]
+}
+
+// block assembles lines. locate sets where the statement made from lines[i]
+// comes from. It returns false when EXITM ended it early.
+func (a *assembler) block(lines []string, locate func(st *statement, i int)) bool {
+	var conds []cond
+	var active = func() bool {
+		return len(conds) == 0 || conds[len(conds)-1].active
+	}
+
+	for i := 0; i < len(lines) && !a.ended; i++ {
+		var st, err = a.parseLine(lines[i])
+		if err != nil {
+			st = &statement{}
+		}
+		st.text = lines[i]
+		locate(st, i)
+
+		switch {
+		case err != nil:
+			if active() {
+				a.errorf(st, "%v", err)
+			}
+			continue
+		case st.op == "IF":
+			var c = cond{st: st, outer: active()}
+			if c.outer && a.wantArgs(st, 1) {
+				// as in ASM and MAC only bit 0 counts: NOT 1 is false
+				c.active = a.needed(st, st.args[0])&1 != 0
+			}
+			conds = append(conds, c)
+			a.listOnly(st, c.outer)
+			continue
+		case st.op == "ELSE" || st.op == "ENDIF":
+			if len(conds) == 0 {
+				a.errorf(st, "%s without IF", st.op)
+				continue
+			}
+			var c = &conds[len(conds)-1]
+			a.listOnly(st, c.outer)
+			if st.op == "ENDIF" {
+				conds = conds[:len(conds)-1]
+			} else if c.seenElse {
+				a.errorf(st, "ELSE after ELSE")
+			} else {
+				c.active, c.seenElse = c.outer && !c.active, true
+			}
+			continue
+		case !active():
+			if st.op == "MACRO" || st.op == "REPT" {
+				i = a.skipBody(st, lines, i)
+			}
+			continue
+		}
+
+		st.seq = a.seq
+		a.seq++
+
+		switch st.op {
+		case "MACRO":
+			var end = a.skipBody(st, lines, i)
+			a.defineMacro(st, lines[i+1:end])
+			for j := i; j <= end && j < len(lines); j++ {
+				var body = &statement{text: lines[j]}
+				locate(body, j)
+				body.macro = st.macro
+				a.listOnly(body, true)
+			}
+			i = end
+		case "REPT":
+			var end = a.skipBody(st, lines, i)
+			var n uint16
+			if a.wantArgs(st, 1) {
+				n = a.needed(st, st.args[0])
+			}
+			a.listOnly(st, true)
+			for j := 0; j < int(n); j++ {
+				if !a.block(lines[i+1:end], func(inner *statement, k int) {
+					locate(inner, i+1+k)
+				}) {
+					return false
+				}
+			}
+			i = end
+		case "ENDM":
+			a.errorf(st, "ENDM without MACRO or REPT")
+		case "LOCAL":
+			a.errorf(st, "LOCAL outside of a macro")
+		case "EXITM":
+			if a.expanding == 0 {
+				a.errorf(st, "EXITM outside of a macro")
+				continue
+			}
+			a.listOnly(st, true)
+			return false
+		case "INCLUDE":
+			a.listOnly(st, true)
+			a.include(st)
+		default:
+			if m, ok := a.macros[st.op]; ok {
+				if st.label != "" {
+					a.define(st, st.label, a.dollar())
+				}
+				a.listOnly(st, true)
+				a.expand(m, st)
+				continue
+			}
+			a.statement(st)
+		}
+	}
+
+	for _, c := range conds {
+		a.errorf(c.st, "IF without ENDIF")
+	}
+	return true
+}
+
+// listOnly adds a directive that assembles nothing to the listing
+func (a *assembler) listOnly(st *statement, active bool) {
+	if a.pass == 2 && active {
+		a.prog.Listing = append(a.prog.Listing, ListLine{
+			File: st.file, Line: st.line, Text: st.text, Macro: st.macro != "",
+		})
+	}
+}
+
+// skipBody returns the index of the ENDM closing the MACRO or REPT st, found
+// at lines[start], or len(lines) when there is none
+func (a *assembler) skipBody(st *statement, lines []string, start int) int {
+	var depth = 0
+	for i := start + 1; i < len(lines); i++ {
+		var inner, err = a.parseLine(lines[i])
+		if err != nil {
+			continue
+		}
+		switch inner.op {
+		case "MACRO", "REPT":
+			depth++
+		case "ENDM":
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+
+	a.errorf(st, "missing ENDM")
+	return len(lines)
+}
+
+func (a *assembler) defineMacro(st *statement, body []string) {
+	if st.label == "" {
+		a.errorf(st, "MACRO needs a name")
+		return
+	}
+
+	var m = &macro{name: st.label, body: body}
+	for _, p := range st.args {
+		var name = strings.ToUpper(p)
+		if !a.isName(name) {
+			a.errorf(st, "bad macro parameter %s", p)
+		}
+		m.params = append(m.params, name)
+	}
+	a.macros[m.name] = m
+}
+
+// expand assembles the body of m with the arguments of the call st
+func (a *assembler) expand(m *macro, st *statement) {
+	if a.expanding >= maxExpansion {
+		a.errorf(st, "macros nested too deep")
+		return
+	}
+
+	var args, err = splitMacroArgs(st.rest)
+	if err != nil {
+		a.errorf(st, "%v", err)
+		return
+	}
+	if len(args) > len(m.params) {
+		a.errorf(st, "%s takes %d argument(s), got %d", m.name, len(m.params), len(args))
+		return
+	}
+
+	// %expr passes the value of expr in decimal
+	var values = map[string]string{}
+	for i, p := range m.params {
+		values[p] = ""
+		if i < len(args) && strings.HasPrefix(args[i], "%") {
+			values[p] = fmt.Sprint(a.absolute(st, args[i][1:]))
+		} else if i < len(args) {
+			values[p] = args[i]
+		}
+	}
+
+	// LOCAL names get a new ??nnnn name on every expansion. The ones of
+	// macros defined inside this one are left for their own expansion.
+	var body []string
+	var depth int
+	for _, line := range m.body {
+		var local, err = a.parseLine(line)
+		if err == nil && (local.op == "MACRO" || local.op == "REPT") {
+			depth++
+		} else if err == nil && local.op == "ENDM" {
+			depth--
+		}
+		if err != nil || local.op != "LOCAL" || depth > 0 {
+			body = append(body, line)
+			continue
+		}
+		for _, name := range local.args {
+			a.locals++
+			values[strings.ToUpper(name)] = fmt.Sprintf("??%04d", a.locals)
+		}
+	}
+
+	for i := range body {
+		body[i] = substitute(body[i], values)
+	}
+
+	a.expanding++
+	a.block(body, func(inner *statement, _ int) {
+		inner.file, inner.line, inner.macro = st.file, st.line, m.name
+	})
+	a.expanding--
+}
+
+// include assembles the file named by st
+func (a *assembler) include(st *statement) {
+	if len(st.args) != 1 {
+		a.errorf(st, "INCLUDE takes a file name")
+		return
+	}
+
+	var name = st.args[0]
+	if str, n, err := unquote(name); err == nil && n == len(name) {
+		name = str
+	}
+	var current = a.including[len(a.including)-1]
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(filepath.Dir(current), name)
+	}
+
+	for _, f := range a.including {
+		if f == name {
+			a.errorf(st, "%s includes itself", name)
+			return
+		}
+	}
+	if len(a.including) >= maxExpansion {
+		a.errorf(st, "includes nested too deep")
+		return
+	}
+
+	var lines, ok = a.files[name]
+	if !ok {
+		var src, err = os.ReadFile(name)
+		if err != nil {
+			a.errorf(st, "%v", err)
+			return
+		}
+		lines = splitLines(src)
+		a.files[name] = lines
+	}
+	a.source(name, lines)
+}
+
+// splitMacroArgs splits the arguments of a macro call on commas. An
+// argument in angle brackets is taken as is, commas included.
+func splitMacroArgs(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var args []string
+	var arg strings.Builder
+	var quote byte
+	var depth int
+	for i := 0; i < len(s); i++ {
+		var c = s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '<' && depth == 0 && strings.TrimSpace(arg.String()) == "":
+			var end = strings.IndexByte(s[i:], '>')
+			if end < 0 {
+				return nil, fmt.Errorf("missing >")
+			}
+			arg.Reset()
+			arg.WriteString(s[i+1 : i+end])
+			i += end
+			continue
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			args = append(args, strings.TrimSpace(arg.String()))
+			arg.Reset()
+			continue
+		}
+		arg.WriteByte(c)
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated string")
+	}
+	return append(args, strings.TrimSpace(arg.String())), nil
+}
+
+// substitute replaces the names in values by their values. Names inside
+// quotes are only replaced when joined to the text with &, which is dropped,
+// as in 'ERR&N'.
+func substitute(text string, values map[string]string) string {
+	var out strings.Builder
+	var quote byte
+	var joined bool // the last character written was an &
+	for i := 0; i < len(text); {
+		var c = text[i]
+		switch {
+		case c == '&':
+			joined = true
+			i++
+			continue
+		case quote == 0 && c == ';':
+			out.WriteString(text[i:])
+			return out.String()
+		case quote != 0 && c == quote || quote == 0 && (c == '\'' || c == '"'):
+			if quote == 0 {
+				quote = c
+			} else {
+				quote = 0
+			}
+		case c >= '0' && c <= '9':
+			var number, _ = splitWord(text[i:])
+			out.WriteString(number)
+			i += len(number)
+			joined = false
+			continue
+		case isIdentStart(c):
+			var word, _ = splitWord(text[i:])
+			i += len(word)
+			var v, ok = values[strings.ToUpper(word)]
+			var glued = joined || i < len(text) && text[i] == '&'
+			if ok && (quote == 0 || glued) {
+				out.WriteString(v)
+			} else {
+				out.WriteString(word)
+			}
+			joined = false
+			continue
+		}
+		out.WriteByte(c)
+		joined = false
+		i++
+	}
+	return out.String()
+}
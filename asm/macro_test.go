@@ -0,0 +1,215 @@
+package asm
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMacros(t *testing.T) {
+	var table = []struct {
+		name string
+		src  string
+		exp  []byte
+	}{
+		{"parameters", `
+LOAD	MACRO	REG,VAL
+	MVI	REG,VAL
+	ENDM
+	LOAD	A,1
+	LOAD	B,<2>
+`, []byte{0x3e, 1, 0x06, 2}},
+		{"missing arguments are empty", `
+BYTES	MACRO	X,Y
+	DB	1 X Y
+	ENDM
+	BYTES
+	BYTES	+1
+`, []byte{1, 2}},
+		{"local labels", `
+SPIN	MACRO
+	LOCAL	AGAIN
+AGAIN:	JMP	AGAIN
+	ENDM
+	SPIN
+	SPIN
+`, []byte{0xc3, 0, 0, 0xc3, 3, 0}},
+		{"concatenation", `
+NAMED	MACRO	N
+L&N:	DB	'&N'
+	ENDM
+	NAMED	7
+	DW	L7
+`, []byte{'7', 0, 0}},
+		{"value arguments", `
+N	SET	3
+ONE	MACRO	V
+	DB	V
+	ENDM
+	ONE	%N+1
+`, []byte{4}},
+		{"nested calls", `
+INNER	MACRO	X
+	DB	X
+	ENDM
+OUTER	MACRO	X
+	INNER	X
+	INNER	X+1
+	ENDM
+	OUTER	5
+`, []byte{5, 6}},
+		{"exitm", `
+UPTO	MACRO	N
+	DB	1
+	IF	N EQ 1
+	EXITM
+	ENDIF
+	DB	2
+	ENDM
+	UPTO	1
+	UPTO	2
+`, []byte{1, 1, 2}},
+		{"rept", `
+	REPT	3
+	NOP
+	ENDM
+`, []byte{0, 0, 0}},
+		{"rept with set", `
+N	SET	0
+	REPT	3
+N	SET	N+1
+	DB	N
+	ENDM
+`, []byte{1, 2, 3}},
+		{"if else", `
+ON	EQU	0FFFFH
+	IF	ON
+	DB	1
+	ELSE
+	DB	2
+	ENDIF
+	IF	NOT ON
+	DB	3
+	ELSE
+	DB	4
+	ENDIF
+`, []byte{1, 4}},
+		{"if tests bit 0", `
+FLAG	EQU	1
+	IF	NOT FLAG
+	DB	2
+	ELSE
+	DB	3
+	ENDIF
+	IF	2
+	DB	4
+	ENDIF
+	IF	FLAG
+	DB	5
+	ENDIF
+`, []byte{3, 5}},
+		{"nested if", `
+	IF	0
+	IF	1
+	DB	1
+	ELSE
+	DB	2
+	ENDIF
+	ELSE
+	IF	0
+	DB	3
+	ELSE
+	DB	4
+	ENDIF
+	ENDIF
+`, []byte{4}},
+		{"no macros in false blocks", `
+	IF	0
+SKIP	MACRO
+	DB	1
+	ENDM
+	ENDIF
+SKIP:	DB	2
+`, []byte{2}},
+	}
+
+	for _, test := range table {
+		var prog, err = Assemble(test.name+".asm", []byte(test.src))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		var _, image = prog.Binary()
+		if !bytes.Equal(image, test.exp) {
+			t.Errorf("%s: % x, expected % x", test.name, image, test.exp)
+		}
+	}
+}
+
+func TestMacroErrors(t *testing.T) {
+	var table = []struct {
+		src string
+		exp string
+	}{
+		{"\tIF 1\n\tNOP\n", "e.asm:1: IF without ENDIF"},
+		{"\tNOP\n\tENDIF\n", "e.asm:2: ENDIF without IF"},
+		{"\tIF 1\n\tELSE\n\tELSE\n\tENDIF\n", "e.asm:3: ELSE after ELSE"},
+		{"M\tMACRO\n\tNOP\n", "e.asm:1: missing ENDM"},
+		{"\tENDM\n", "e.asm:1: ENDM without MACRO or REPT"},
+		{"\tEXITM\n", "e.asm:1: EXITM outside of a macro"},
+		{"M\tMACRO\n\tM\n\tENDM\n\tM\n", "e.asm:4: in macro M: macros nested too deep"},
+		{"M\tMACRO X\n\tENDM\n\tM 1,2\n", "e.asm:3: M takes 1 argument(s), got 2"},
+		{"M\tMACRO\n\tMVI A,NOPE\n\tENDM\n\n\tM\n", "e.asm:5: in macro M: undefined symbol NOPE"},
+		{"\tINCLUDE 'missing.inc'\n", "e.asm:1: open missing.inc"},
+		{"\tIF LATER\n\tENDIF\nLATER:\n", "e.asm:1: undefined symbol LATER: it must be defined before this line"},
+	}
+
+	for _, test := range table {
+		var _, err = Assemble("e.asm", []byte(test.src))
+		if err == nil {
+			t.Errorf("%q did not fail", test.src)
+		} else if !strings.Contains(err.Error(), test.exp) {
+			t.Errorf("%q: %v, expected %s", test.src, err, test.exp)
+		}
+	}
+}
+
+func TestIncludeItself(t *testing.T) {
+	var dir = t.TempDir()
+	var loop = filepath.Join(dir, "loop.inc")
+	if err := os.WriteFile(loop, []byte("\tNOP\n\tINCLUDE loop.inc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var _, err = AssembleFile(loop)
+	if err == nil || !strings.Contains(err.Error(), "loop.inc:2: "+loop+" includes itself") {
+		t.Errorf("AssembleFile(loop.inc) = %v, expected it to include itself", err)
+	}
+}
+
+// The BIOS in testdata uses includes, macros with local labels and
+// conditionals. It must assemble to the same bytes as its expansion by hand.
+func TestBIOS(t *testing.T) {
+	var bios, err = AssembleFile("testdata/bios.asm")
+	if err != nil {
+		t.Fatalf("bios.asm: %v", err)
+	}
+	flat, err := AssembleFile("testdata/bios_flat.asm")
+	if err != nil {
+		t.Fatalf("bios_flat.asm: %v", err)
+	}
+
+	var org, image = bios.Binary()
+	var flatOrg, flatImage = flat.Binary()
+	if org != flatOrg || !bytes.Equal(image, flatImage) {
+		t.Errorf("bios.asm = %04x % x\nexpected %04x % x", org, image, flatOrg, flatImage)
+	}
+
+	for _, name := range []string{"BOOT", "CONOUT", "DPH0", "DPH1", "CSV1", "ALV1"} {
+		if bios.Symbols[name] == nil || bios.Symbols[name].Value != flat.Symbols[name].Value {
+			t.Errorf("%s = %v, expected %v", name, bios.Symbols[name], flat.Symbols[name])
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package asm
+
+import "8080emu/obj"
+
+// Relocatable tells if p uses CSEG, DSEG or EXTRN, so it must go through
+// the linker
+func (p *Program) Relocatable() bool {
+	if p.CodeSize > 0 || p.DataSize > 0 || len(p.Relocs) > 0 {
+		return true
+	}
+	for _, s := range p.Symbols {
+		if s.Seg != obj.Absolute || s.Public {
+			return true
+		}
+	}
+	return false
+}
+
+// Object returns p as an object module called name. It keeps the labels,
+// the public symbols and the externals.
+func (p *Program) Object(name string) *obj.Module {
+	var m = &obj.Module{
+		Name:     name,
+		CodeSize: p.CodeSize,
+		DataSize: p.DataSize,
+		Relocs:   p.Relocs,
+		HasEntry: p.hasEntry,
+		EntrySeg: p.EntrySeg,
+		Entry:    p.Entry,
+	}
+
+	for _, f := range p.Fragments {
+		m.Fragments = append(m.Fragments, obj.Fragment{Seg: f.Seg, Addr: f.Addr, Data: f.Data})
+	}
+	for _, s := range p.SortedSymbols() {
+		if s.Public || s.label || s.Seg == obj.External {
+			m.Symbols = append(m.Symbols, obj.Symbol{Name: s.Name, Seg: s.Seg, Value: s.Value, Public: s.Public})
+		}
+	}
+	return m
+}
@@ -0,0 +1,164 @@
+package asm
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"8080emu/obj"
+)
+
+// main calls PUTS of the other module with a message in its data segment
+var mainSrc = `
+	EXTRN	PUTS
+	PUBLIC	START
+	CSEG
+START:	LXI	H,MSG
+	CALL	PUTS
+	MVI	A,HIGH MSG
+	MVI	B,LOW (MSG+1)
+	JMP	START
+	DSEG
+COUNT:	DS	2
+MSG:	DB	'HI',0
+	DW	START,COUNT
+	END	START
+`
+
+var putsSrc = `
+	PUBLIC	PUTS,CONOUT
+CONOUT	EQU	0F000H
+	CSEG
+PUTS:	MOV	A,M
+	ORA	A
+	RZ
+	CALL	CONOUT
+	INX	H
+	JMP	PUTS
+	END
+`
+
+func TestObject(t *testing.T) {
+	var prog, err = Assemble("main.asm", []byte(mainSrc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !prog.Relocatable() {
+		t.Errorf("Relocatable() = false")
+	}
+
+	var m = prog.Object("main")
+	if m.CodeSize != 13 || m.DataSize != 9 {
+		t.Errorf("sizes = %d, %d, expected 13, 9", m.CodeSize, m.DataSize)
+	}
+	if !m.HasEntry || m.EntrySeg != obj.Code || m.Entry != 0 {
+		t.Errorf("entry = %v %s %04x, expected CSEG 0000", m.HasEntry, m.EntrySeg, m.Entry)
+	}
+
+	var relocs = []obj.Reloc{
+		{Seg: obj.Code, Addr: 1, Kind: obj.Word, Base: obj.Data, Addend: 2},
+		{Seg: obj.Code, Addr: 4, Kind: obj.Word, Base: obj.External, Symbol: "PUTS"},
+		{Seg: obj.Code, Addr: 7, Kind: obj.High, Base: obj.Data, Addend: 2},
+		{Seg: obj.Code, Addr: 9, Kind: obj.Low, Base: obj.Data, Addend: 3},
+		{Seg: obj.Code, Addr: 11, Kind: obj.Word, Base: obj.Code},
+		{Seg: obj.Data, Addr: 5, Kind: obj.Word, Base: obj.Code},
+		{Seg: obj.Data, Addr: 7, Kind: obj.Word, Base: obj.Data},
+	}
+	if !reflect.DeepEqual(m.Relocs, relocs) {
+		t.Errorf("Relocs = %+v\nexpected %+v", m.Relocs, relocs)
+	}
+
+	var syms = []obj.Symbol{
+		{Name: "COUNT", Seg: obj.Data, Value: 0},
+		{Name: "MSG", Seg: obj.Data, Value: 2},
+		{Name: "PUTS", Seg: obj.External},
+		{Name: "START", Seg: obj.Code, Value: 0, Public: true},
+	}
+	if !reflect.DeepEqual(m.Symbols, syms) {
+		t.Errorf("Symbols = %+v\nexpected %+v", m.Symbols, syms)
+	}
+}
+
+func TestLink(t *testing.T) {
+	var mods []*obj.Module
+	for _, src := range []struct{ name, text string }{{"main", mainSrc}, {"puts", putsSrc}} {
+		var prog, err = Assemble(src.name+".asm", []byte(src.text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mods = append(mods, prog.Object(src.name))
+	}
+
+	var im, err = obj.Link(mods, 0x100, 0x200)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var org, image = im.Binary()
+	var code = []byte{
+		0x21, 0x02, 0x02, // LXI H,MSG
+		0xcd, 0x0d, 0x01, // CALL PUTS
+		0x3e, 0x02, // MVI A,HIGH MSG
+		0x06, 0x03, // MVI B,LOW (MSG+1)
+		0xc3, 0x00, 0x01, // JMP START
+		0x7e, 0xb7, 0xc8, // PUTS: MOV A,M; ORA A; RZ
+		0xcd, 0x00, 0xf0, // CALL CONOUT
+		0x23, 0xc3, 0x0d, 0x01, // INX H; JMP PUTS
+	}
+	var data = []byte{'H', 'I', 0, 0x00, 0x01, 0x00, 0x02}
+	if org != 0x100 || !bytes.Equal(image[:len(code)], code) || !bytes.Equal(image[0x102:], data) {
+		t.Errorf("image at %04x:\n% x", org, image)
+	}
+	if im.Entry != 0x100 {
+		t.Errorf("Entry = %04x, expected 0100", im.Entry)
+	}
+}
+
+func TestRelocatableErrors(t *testing.T) {
+	var table = []struct {
+		src string
+		exp string
+	}{
+		{"\tCSEG\nL:\tMVI A,L\n", "e.asm:2: relocatable value L does not fit in a byte"},
+		{"\tEXTRN X\n\tDW X*2\n", "e.asm:2: relocatable value used with *"},
+		{"\tCSEG\nL:\tDW HIGH L\n", "e.asm:2: HIGH L is a byte of a relocatable value"},
+		{"\tCSEG\nL:\tDSEG\n\tDS L\n", "e.asm:3: L is relocatable"},
+		{"\tPUBLIC NOPE\n", "e.asm:1: undefined symbol NOPE"},
+		{"\tEXTRN X\n\tPUBLIC X\n", "e.asm:2: X is an EXTRN"},
+		{"\tEXTRN X\nX:\tNOP\n", "e.asm:2: X already defined at e.asm:1"},
+		{"\tEXTRN X\n\tEND X\n", "e.asm:2: the entry point must be in this module"},
+		{"\tEXTRN X\n\tRST X\n", "e.asm:2: X is relocatable"},
+	}
+
+	for _, test := range table {
+		var _, err = Assemble("e.asm", []byte(test.src))
+		if err == nil {
+			t.Errorf("%q did not fail", test.src)
+		} else if !strings.Contains(err.Error(), test.exp) {
+			t.Errorf("%q: %v, expected %s", test.src, err, test.exp)
+		}
+	}
+}
+
+func TestRelocatableListing(t *testing.T) {
+	var prog, err = Assemble("main.asm", []byte(mainSrc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := prog.WriteListing(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{
+		"0000'210200       5  START:\tLXI\tH,MSG",
+		"0002\"484900      12  MSG:\tDB\t'HI',0",
+		"0000 START CSEG PUBLIC",
+		"0000 PUTS EXTRN",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("listing misses %q:\n%s", line, out.String())
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package asm
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"8080emu/obj"
+)
+
+// Binary returns the program as a raw image running from its lowest to its
+// highest assembled address, with the gaps filled with zeros, and the address
+// of its first byte. Relocatable programs are linked with package obj
+// instead.
+func (p *Program) Binary() (uint16, []byte) {
+	var frags = make([]obj.Fragment, len(p.Fragments))
+	for i, f := range p.Fragments {
+		frags[i] = obj.Fragment{Seg: f.Seg, Addr: f.Addr, Data: f.Data}
+	}
+	return obj.Flatten(frags)
+}
+
+// WriteHex writes the program in Intel HEX format with 16 bytes per data
+// record. The end of file record carries the entry address.
+func (p *Program) WriteHex(w io.Writer) error {
+	var bw = bufio.NewWriter(w)
+	for _, f := range p.Fragments {
+		for i := 0; i < len(f.Data); i += 16 {
+			var end = i + 16
+			if end > len(f.Data) {
+				end = len(f.Data)
+			}
+			writeRecord(bw, f.Addr+uint16(i), 0x00, f.Data[i:end])
+		}
+	}
+	writeRecord(bw, p.Entry, 0x01, nil)
+	return bw.Flush()
+}
+
+// segmentMarks follow the addresses of the listing
+var segmentMarks = map[obj.Segment]rune{obj.Absolute: ' ', obj.Code: '\'', obj.Data: '"'}
+
+func writeRecord(w *bufio.Writer, addr uint16, kind byte, data []byte) {
+	var sum = byte(len(data)) + byte(addr>>8) + byte(addr) + kind
+	fmt.Fprintf(w, ":%02X%04X%02X", len(data), addr, kind)
+	for _, b := range data {
+		fmt.Fprintf(w, "%02X", b)
+		sum += b
+	}
+	fmt.Fprintf(w, "%02X\n", -sum)
+}
+
+// WriteListing writes every source line with its address and the bytes it
+// assembled to, followed by the symbol table:
+//
+//	ADDR BYTES     LINE  SOURCE
+//
+// Lines with more than four bytes continue on the following lines, and the
+// lines coming from macro expansions have a + after the line number. A
+// "; FILE: name" line tells where the lines of an included file start and
+// end. Addresses in CSEG are followed by ' and those in DSEG by ", and
+// the symbols that are not absolute are followed by their segment.
+func (p *Program) WriteListing(w io.Writer) error {
+	var bw = bufio.NewWriter(w)
+	var file string
+	for _, l := range p.Listing {
+		if file != "" && l.File != file {
+			fmt.Fprintf(bw, "%19s  ; FILE: %s\n", "", l.File)
+		}
+		file = l.File
+
+		var data = l.Data
+		var head = data
+		if len(head) > 4 {
+			head = head[:4]
+		}
+
+		var mark = ' '
+		if l.Macro {
+			mark = '+'
+		}
+
+		if l.Code {
+			fmt.Fprintf(bw, "%04X%c%-8X %5d%c %s\n", l.Addr, segmentMarks[l.Seg], head, l.Line, mark, l.Text)
+		} else {
+			fmt.Fprintf(bw, "%13s %5d%c %s\n", "", l.Line, mark, l.Text)
+		}
+
+		for i := 4; i < len(data); i += 4 {
+			var end = i + 4
+			if end > len(data) {
+				end = len(data)
+			}
+			fmt.Fprintf(bw, "%04X%c%-8X\n", l.Addr+uint16(i), segmentMarks[l.Seg], data[i:end])
+		}
+	}
+
+	fmt.Fprintf(bw, "\nSymbols:\n")
+	for _, s := range p.SortedSymbols() {
+		fmt.Fprintf(bw, "%04X %s", s.Value, s.Name)
+		if s.Seg != obj.Absolute {
+			fmt.Fprintf(bw, " %s", s.Seg)
+		}
+		if s.Public {
+			fmt.Fprintf(bw, " PUBLIC")
+		}
+		fmt.Fprintf(bw, "\n")
+	}
+	return bw.Flush()
+}
+
+// ReadListing reads back the lines of a listing written by WriteListing,
+// up to its symbol table. name is the file of the lines before the first
+// "; FILE:" line, which the listing does not give. The Data of a line has
+// the bytes of the lines continuing it.
+func ReadListing(name string, r io.Reader) ([]ListLine, error) {
+	var lines []ListLine
+	var file = name
+	var sc = bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		var text = sc.Text()
+		if text == "" {
+			break // the symbols follow
+		}
+		if strings.HasPrefix(text, fmt.Sprintf("%19s  ; FILE: ", "")) {
+			file = text[len("  ; FILE: ")+19:]
+			continue
+		}
+
+		var l = ListLine{File: file}
+		var err error
+		if len(text) >= 13 && strings.TrimSpace(text[:13]) != "" {
+			if l.Seg, l.Addr, l.Data, err = listedCode(text[:13]); err != nil {
+				return nil, fmt.Errorf("listing line %d: %v", n, err)
+			}
+			l.Code = true
+		}
+		if len(text) == 13 && l.Code {
+			if len(lines) == 0 || !lines[len(lines)-1].Code {
+				return nil, fmt.Errorf("listing line %d: bytes continuing no line", n)
+			}
+			var last = &lines[len(lines)-1]
+			last.Data = append(last.Data, l.Data...)
+			continue
+		}
+		if len(text) < 21 {
+			return nil, fmt.Errorf("listing line %d: too short", n)
+		}
+		if l.Line, err = strconv.Atoi(strings.TrimSpace(text[14:19])); err != nil {
+			return nil, fmt.Errorf("listing line %d: bad line number %q", n, text[14:19])
+		}
+		l.Macro = text[19] == '+'
+		l.Text = text[21:]
+		lines = append(lines, l)
+	}
+	return lines, sc.Err()
+}
+
+// listedCode reads the address, segment and bytes at the start of a line
+// of the listing
+func listedCode(s string) (obj.Segment, uint16, []byte, error) {
+	var addr, err = strconv.ParseUint(s[:4], 16, 16)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("bad address %q", s[:4])
+	}
+	var seg, found = obj.Absolute, false
+	for sg, mark := range segmentMarks {
+		if rune(s[4]) == mark {
+			seg, found = sg, true
+		}
+	}
+	if !found {
+		return 0, 0, nil, fmt.Errorf("bad segment mark %q", s[4])
+	}
+	var data []byte
+	if data, err = hex.DecodeString(strings.TrimSpace(s[5:])); err != nil {
+		return 0, 0, nil, fmt.Errorf("bad bytes %q", s[5:])
+	}
+	return seg, uint16(addr), data, nil
+}
@@ -0,0 +1,108 @@
+package asm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"8080emu/obj"
+)
+
+func TestWriteHex(t *testing.T) {
+	var prog = assemble(t, `
+	ORG	0
+	DB	0,1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16
+	ORG	1000H
+START:	JMP	START
+	END	START
+`)
+
+	var out bytes.Buffer
+	if err := prog.WriteHex(&out); err != nil {
+		t.Fatalf("WriteHex: %v", err)
+	}
+
+	var exp = `:10000000000102030405060708090A0B0C0D0E0F78
+:0100100010DF
+:03100000C300101A
+:00100001EF
+`
+	if out.String() != exp {
+		t.Errorf("WriteHex() =\n%s\nexpected\n%s", out.String(), exp)
+	}
+}
+
+func TestWriteListing(t *testing.T) {
+	var prog = assemble(t, `; a comment
+	ORG	100H
+MSG:	DB	'HELLO'
+	MVI	A,1
+`)
+
+	var out bytes.Buffer
+	if err := prog.WriteListing(&out); err != nil {
+		t.Fatalf("WriteListing: %v", err)
+	}
+
+	var exp = []string{
+		"                  1  ; a comment",
+		"0100              2  \tORG\t100H",
+		"0100 48454C4C     3  MSG:\tDB\t'HELLO'",
+		"0104 4F      ",
+		"0105 3E01         4  \tMVI\tA,1",
+		"",
+		"Symbols:",
+		"0100 MSG",
+	}
+	var lines = strings.Split(out.String(), "\n")
+	for i, line := range exp {
+		if i >= len(lines) || lines[i] != line {
+			t.Errorf("WriteListing() =\n%s\nexpected line %d to be %q", out.String(), i+1, line)
+			break
+		}
+	}
+}
+
+func TestReadListing(t *testing.T) {
+	var small, err = Assemble("test.asm", []byte(`	ORG	100H
+MSG:	DB	'HELLO'
+	CSEG
+LOOP:	JMP	LOOP
+	END
+`))
+	if err != nil {
+		t.Fatalf("Assemble: %v", err)
+	}
+	var bios *Program
+	if bios, err = AssembleFile("testdata/bios.asm"); err != nil {
+		t.Fatalf("AssembleFile: %v", err)
+	}
+
+	for _, prog := range []*Program{small, bios} {
+		var out bytes.Buffer
+		if err := prog.WriteListing(&out); err != nil {
+			t.Fatalf("WriteListing: %v", err)
+		}
+		var lines, err = ReadListing(prog.Listing[0].File, &out)
+		if err != nil {
+			t.Fatalf("ReadListing: %v", err)
+		}
+		if len(lines) != len(prog.Listing) {
+			t.Fatalf("read %d lines, expected %d", len(lines), len(prog.Listing))
+		}
+		for i, l := range lines {
+			var exp = prog.Listing[i]
+			if !exp.Code {
+				exp.Seg, exp.Addr = obj.Absolute, 0 // not listed
+			}
+			if l.File != exp.File || l.Line != exp.Line || l.Seg != exp.Seg || l.Addr != exp.Addr ||
+				!bytes.Equal(l.Data, exp.Data) || l.Text != exp.Text || l.Code != exp.Code || l.Macro != exp.Macro {
+				t.Errorf("%s line %d: read %+v, expected %+v", exp.File, i+1, l, exp)
+			}
+		}
+	}
+
+	if _, err = ReadListing("test.asm", strings.NewReader("0100X3E01         4  \tMVI\tA,1\n")); err == nil {
+		t.Errorf("read a bad segment mark")
+	}
+}
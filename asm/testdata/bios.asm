@@ -0,0 +1,66 @@
+; A small CP/M style BIOS using macros, includes and conditionals
+
+	INCLUDE	'bios.inc'
+
+DEBUG	EQU	0FFFFH
+MODEL	EQU	2
+
+	ORG	BIOS
+
+	JMP	BOOT
+	JMP	WBOOT
+	JMP	CONSTAT
+	JMP	CONIN
+	JMP	CONOUT
+
+BOOT:	LXI	SP,80H
+	IF	DEBUG
+	PRINT	'*'
+	PRINT	<'B'>
+	ENDIF
+	IF	MODEL EQ 1
+	MVI	A,1
+	ELSE
+	IF	MODEL EQ 2
+	MVI	A,2
+	ELSE
+	MVI	A,3
+	ENDIF
+	ENDIF
+WBOOT:	JMP	CCP
+
+CONSTAT:
+	IN	CONST
+	ANI	01H
+	RZ
+	MVI	A,0FFH
+	RET
+
+CONIN:	IN	CONST
+	ANI	01H
+	JZ	CONIN
+	IN	CONDAT
+	ANI	7FH
+	RET
+
+CONOUT:	PUTC
+	RET
+
+DPBASE:
+N	SET	0
+	REPT	NDISKS
+	DPH	%N
+N	SET	N+1
+	ENDM
+
+XLT:	DB	1,7,13,19
+	REPT	2
+	DB	0E5H
+	ENDM
+
+DPB:	DW	26
+	DB	3,7,0
+DIRBUF:	DS	128
+	SCRATCH	0,16,31
+	SCRATCH	1,16,31
+	END
@@ -0,0 +1,70 @@
+; bios.asm with the include, macros and conditionals expanded by hand
+
+CCP	EQU	3400H
+CONST	EQU	10H
+CONDAT	EQU	11H
+
+	ORG	4A00H
+
+	JMP	BOOT
+	JMP	WBOOT
+	JMP	CONSTAT
+	JMP	CONIN
+	JMP	CONOUT
+
+BOOT:	LXI	SP,80H
+	MVI	C,'*'
+W1:	IN	CONST
+	ANI	02H
+	JZ	W1
+	MOV	A,C
+	OUT	CONDAT
+	MVI	C,'B'
+W2:	IN	CONST
+	ANI	02H
+	JZ	W2
+	MOV	A,C
+	OUT	CONDAT
+	MVI	A,2
+WBOOT:	JMP	CCP
+
+CONSTAT:
+	IN	CONST
+	ANI	01H
+	RZ
+	MVI	A,0FFH
+	RET
+
+CONIN:	IN	CONST
+	ANI	01H
+	JZ	CONIN
+	IN	CONDAT
+	ANI	7FH
+	RET
+
+CONOUT:
+W3:	IN	CONST
+	ANI	02H
+	JZ	W3
+	MOV	A,C
+	OUT	CONDAT
+	RET
+
+DPBASE:
+DPH0:	DW	XLT, 0000H, 0000H, 0000H
+	DW	DIRBUF, DPB, CSV0, ALV0
+DPH1:	DW	XLT, 0000H, 0000H, 0000H
+	DW	DIRBUF, DPB, CSV1, ALV1
+
+XLT:	DB	1,7,13,19
+	DB	0E5H
+	DB	0E5H
+
+DPB:	DW	26
+	DB	3,7,0
+DIRBUF:	DS	128
+CSV0:	DS	16
+ALV0:	DS	31
+CSV1:	DS	16
+ALV1:	DS	31
+	END
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"8080emu/asm"
+	"8080emu/obj"
+)
+
+var (
+	binOut  = flag.String("o", "", "write the raw binary to `file` (default when no other output is asked for: the source name with .bin)")
+	hexOut  = flag.String("hex", "", "write Intel HEX to `file`")
+	listOut = flag.String("l", "", "write the listing to `file`")
+	objOut  = flag.String("obj", "", "write the object module for the linker to `file` (default for relocatable sources when no other output is asked for: the source name with .obj)")
+)
+
+func main() {
+	log.SetFlags(0)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: assembler [flags] source.asm\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var src = flag.Arg(0)
+
+	var prog, err = asm.AssembleFile(src)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var base = strings.TrimSuffix(src, filepath.Ext(src))
+	if *binOut == "" && *hexOut == "" && *listOut == "" && *objOut == "" {
+		if prog.Relocatable() {
+			*objOut = base + ".obj"
+		} else {
+			*binOut = base + ".bin"
+		}
+	}
+	if prog.Relocatable() && (*binOut != "" || *hexOut != "") {
+		log.Fatalf("%s is relocatable: write an object file with -obj and link it", src)
+	}
+
+	if *binOut != "" {
+		var _, image = prog.Binary()
+		if err := os.WriteFile(*binOut, image, 0644); err != nil {
+			log.Fatalf("Error writing binary: %v", err)
+		}
+	}
+	if *hexOut != "" {
+		writeFile(*hexOut, prog.WriteHex)
+	}
+	if *listOut != "" {
+		writeFile(*listOut, prog.WriteListing)
+	}
+	if *objOut != "" {
+		var m = prog.Object(filepath.Base(base))
+		writeFile(*objOut, func(w io.Writer) error { return obj.Write(w, m) })
+	}
+}
+
+func writeFile(path string, write func(w io.Writer) error) {
+	var f, err = os.Create(path)
+	if err != nil {
+		log.Fatalf("Error creating %s: %v", path, err)
+	}
+	if err := write(f); err != nil {
+		log.Fatalf("Error writing %s: %v", path, err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatalf("Error writing %s: %v", path, err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"8080emu/asm"
+	"8080emu/cover"
+)
+
+var (
+	mergedOut = flag.String("o", "", "write the profiles merged to `file`")
+	imageFile = flag.String("image", "", "annotate the disassembly of the binary `file` on stdout, or in -html")
+	loadAddr  = flag.String("load", "0", "the hex `address` the image runs at")
+	htmlOut   = flag.String("html", "", "write the annotated disassembly as HTML to `file`")
+	listFile  = flag.String("listing", "", "the assembler listing `file` giving the source lines of -lcov")
+	source    = flag.String("source", "", "the source `name` of the listing lines before its first FILE line (default: the listing name with .asm)")
+	lcovOut   = flag.String("lcov", "", "write the coverage of the source lines of -listing in the lcov format to `file`")
+)
+
+func main() {
+	log.SetFlags(0)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: coverage [flags] profile...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 || *mergedOut == "" && *imageFile == "" && *lcovOut == "" ||
+		*htmlOut != "" && *imageFile == "" || *lcovOut != "" && *listFile == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var prof = cover.New()
+	for _, path := range flag.Args() {
+		var f, err = os.Open(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		p, err := cover.Read(f, path)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		prof.Merge(p)
+	}
+
+	if *mergedOut != "" {
+		writeFile(*mergedOut, prof.Write)
+	}
+	if *imageFile != "" {
+		var image, err = os.ReadFile(*imageFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var lines = prof.Disassemble(image, parseAddr("-load", *loadAddr))
+		if *htmlOut != "" {
+			writeFile(*htmlOut, func(w io.Writer) error { return cover.WriteHTML(w, lines, filepath.Base(*imageFile)) })
+		} else if err := cover.WriteAnnotated(os.Stdout, lines); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *lcovOut != "" {
+		var name = *source
+		if name == "" {
+			name = strings.TrimSuffix(*listFile, filepath.Ext(*listFile)) + ".asm"
+		}
+		var f, err = os.Open(*listFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		listing, err := asm.ReadListing(name, f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("%s: %v", *listFile, err)
+		}
+		writeFile(*lcovOut, func(w io.Writer) error { return prof.WriteLcov(w, listing) })
+	}
+}
+
+func parseAddr(name, s string) uint16 {
+	var v, err = strconv.ParseUint(strings.TrimSuffix(strings.ToUpper(s), "H"), 16, 16)
+	if err != nil {
+		log.Fatalf("%s: bad address %s", name, s)
+	}
+	return uint16(v)
+}
+
+func writeFile(path string, write func(w io.Writer) error) {
+	var f, err = os.Create(path)
+	if err != nil {
+		log.Fatalf("Error creating %s: %v", path, err)
+	}
+	if err := write(f); err != nil {
+		log.Fatalf("Error writing %s: %v", path, err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatalf("Error writing %s: %v", path, err)
+	}
+}
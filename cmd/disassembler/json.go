@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"8080emu/isa"
+)
+
+// Instruction is the machine-readable form of a disassembled instruction
+type Instruction struct {
+	Address  int           `json:"address"`
+	Bytes    []int         `json:"bytes"`
+	Mnemonic string        `json:"mnemonic"`
+	Operands []JSONOperand `json:"operands"`
+	Size     uint8         `json:"size"`
+	Flow     Flow          `json:"flow"`
+}
+
+// JSONOperand is an operand of an instruction. Type is one of "register",
+// "immediate" or "address". Registers carry their name, the other types
+// carry their value.
+type JSONOperand struct {
+	Type     string  `json:"type"`
+	Register string  `json:"register,omitempty"`
+	Value    *uint16 `json:"value,omitempty"`
+}
+
+// Flow describes how an instruction may change the program counter
+type Flow struct {
+	Branch      bool `json:"branch"`
+	Call        bool `json:"call"`
+	Return      bool `json:"return"`
+	Conditional bool `json:"conditional"`
+}
+
+// printJSON writes the disassembly of buf to w. When lines is true every
+// instruction is written as its own JSON object on a separate line (JSON
+// Lines), otherwise a single JSON array is written.
+func printJSON(w io.Writer, buf []byte, lines bool) error {
+	var enc = json.NewEncoder(w)
+	var all []Instruction
+
+	var pc int
+	var sz = len(buf)
+	for pc < sz {
+		var instr = toInstruction(pc, buf)
+		if lines {
+			if err := enc.Encode(instr); err != nil {
+				return err
+			}
+		} else {
+			all = append(all, instr)
+		}
+
+		pc += int(instr.Size)
+	}
+
+	if lines {
+		return nil
+	}
+	if all == nil {
+		all = []Instruction{}
+	}
+	return enc.Encode(all)
+}
+
+// toInstruction decodes the instruction at pc into its machine-readable form
+func toInstruction(pc int, buf []byte) Instruction {
+	var opcode = lookup(pc, buf)
+
+	var instr = Instruction{
+		Address:  pc,
+		Mnemonic: opcode.Mnemonic,
+		Operands: []JSONOperand{},
+		Size:     opcode.Size,
+	}
+	instr.Flow = Flow{
+		Branch:      opcode.Flow.IsBranch(),
+		Call:        opcode.Flow.IsCall(),
+		Return:      opcode.Flow.IsReturn(),
+		Conditional: opcode.Flow.IsConditional(),
+	}
+	for i := 0; i < int(opcode.Size); i++ {
+		instr.Bytes = append(instr.Bytes, int(buf[pc+i]))
+	}
+
+	if opcode.FirstOp.IsRegister() {
+		instr.Operands = append(instr.Operands, registerOperand(opcode.FirstOp))
+	}
+
+	switch opcode.Size {
+	case 1:
+		if opcode.OperandLow.IsRegister() {
+			instr.Operands = append(instr.Operands, registerOperand(opcode.OperandLow))
+		}
+	case 2:
+		instr.Operands = append(instr.Operands, valueOperand("immediate", uint16(buf[pc+1])))
+	case 3:
+		var word = uint16(buf[pc+2])<<8 | uint16(buf[pc+1])
+		if opcode.FirstOp == isa.Addr {
+			instr.Operands = append(instr.Operands, valueOperand("address", word))
+		} else {
+			instr.Operands = append(instr.Operands, valueOperand("immediate", word))
+		}
+	}
+
+	return instr
+}
+
+// registerOperand returns a register operand. The vector of RST is not a
+// register: it is an immediate value from 0 to 7.
+func registerOperand(o isa.Operand) JSONOperand {
+	if o >= isa.Reg0 && o <= isa.Reg7 {
+		return valueOperand("immediate", uint16(o-isa.Reg0))
+	}
+	return JSONOperand{Type: "register", Register: o.Name()}
+}
+
+func valueOperand(kind string, value uint16) JSONOperand {
+	return JSONOperand{Type: kind, Value: &value}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestToInstruction(t *testing.T) {
+	var addr, imm, word, vector = uint16(0xf0ff), uint16(0x05), uint16(0x1234), uint16(7)
+	var table = []struct {
+		buf []byte
+		exp Instruction
+	}{
+		{ // MOV B, C
+			[]byte{0x41},
+			Instruction{Bytes: []int{0x41}, Mnemonic: "MOV", Size: 1, Operands: []JSONOperand{
+				JSONOperand{Type: "register", Register: "B"},
+				JSONOperand{Type: "register", Register: "C"},
+			}},
+		},
+		{ // MVI A, D8
+			[]byte{0x3e, 0x05},
+			Instruction{Bytes: []int{0x3e, 0x05}, Mnemonic: "MVI", Size: 2, Operands: []JSONOperand{
+				JSONOperand{Type: "register", Register: "A"},
+				JSONOperand{Type: "immediate", Value: &imm},
+			}},
+		},
+		{ // LXI B, D16
+			[]byte{0x01, 0x34, 0x12},
+			Instruction{Bytes: []int{0x01, 0x34, 0x12}, Mnemonic: "LXI", Size: 3, Operands: []JSONOperand{
+				JSONOperand{Type: "register", Register: "B"},
+				JSONOperand{Type: "immediate", Value: &word},
+			}},
+		},
+		{ // JNZ addr
+			[]byte{0xc2, 0xff, 0xf0},
+			Instruction{Bytes: []int{0xc2, 0xff, 0xf0}, Mnemonic: "JNZ", Size: 3, Operands: []JSONOperand{
+				JSONOperand{Type: "address", Value: &addr},
+			}, Flow: Flow{Branch: true, Conditional: true}},
+		},
+		{ // CALL addr
+			[]byte{0xcd, 0xff, 0xf0},
+			Instruction{Bytes: []int{0xcd, 0xff, 0xf0}, Mnemonic: "CALL", Size: 3, Operands: []JSONOperand{
+				JSONOperand{Type: "address", Value: &addr},
+			}, Flow: Flow{Call: true}},
+		},
+		{ // RST 7
+			[]byte{0xff},
+			Instruction{Bytes: []int{0xff}, Mnemonic: "RST", Size: 1, Operands: []JSONOperand{
+				JSONOperand{Type: "immediate", Value: &vector},
+			}, Flow: Flow{Call: true}},
+		},
+		{ // RZ
+			[]byte{0xc8},
+			Instruction{Bytes: []int{0xc8}, Mnemonic: "RZ", Size: 1, Operands: []JSONOperand{},
+				Flow: Flow{Return: true, Conditional: true}},
+		},
+	}
+
+	for _, test := range table {
+		var instr = toInstruction(0, test.buf)
+		if !reflect.DeepEqual(instr, test.exp) {
+			t.Errorf("toInstruction(% x) = %+v, expected %+v", test.buf, instr, test.exp)
+		}
+	}
+}
+
+func TestPrintJSONLines(t *testing.T) {
+	var out bytes.Buffer
+	if err := printJSON(&out, []byte{0x00, 0x3e, 0x05, 0xc9}, true); err != nil {
+		t.Fatalf("printJSON: %v", err)
+	}
+
+	var lines = bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	if len(lines) != 3 {
+		t.Fatalf("printJSON wrote %d lines, expected 3", len(lines))
+	}
+
+	var addresses = []int{0, 1, 3}
+	for i, line := range lines {
+		var instr Instruction
+		if err := json.Unmarshal(line, &instr); err != nil {
+			t.Fatalf("line %d: %v", i, err)
+		}
+		if instr.Address != addresses[i] {
+			t.Errorf("line %d: address = %d, expected %d", i, instr.Address, addresses[i])
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"8080emu/asm"
+	"8080emu/isa"
+)
+
+// reassemble turns the text output of the disassembler back into source.
+// The disassembler marks immediate values with #, which the assembler does
+// not take.
+func reassemble(t *testing.T, buf []byte) []byte {
+	t.Helper()
+
+	var src strings.Builder
+	for pc := 0; pc < len(buf); {
+		var text, sz = disassemble(pc, buf, intel)
+		fmt.Fprintf(&src, "\t%s\n", strings.ReplaceAll(text[len("00 00 00 "):], "#", ""))
+		pc += int(sz)
+	}
+
+	var prog, err = asm.Assemble("roundtrip.asm", []byte(src.String()))
+	if err != nil {
+		t.Fatalf("Assemble:\n%s\n%v", src.String(), err)
+	}
+	var _, image = prog.Binary()
+	return image
+}
+
+func TestRoundTripOpcodes(t *testing.T) {
+	for code, op := range isa.Opcodes {
+		if op.Size == 0 || op.Mnemonic == "NOP" && code != 0 {
+			continue // the undocumented NOPs assemble to 0x00
+		}
+
+		var buf = []byte{byte(code), 0x34, 0x12}[:op.Size]
+		var image = reassemble(t, buf)
+		if !bytes.Equal(image, buf) {
+			t.Errorf("0x%02x %s: reassembled to % x", code, op.Mnemonic, image)
+		}
+	}
+}
+
+func TestRoundTripProgram(t *testing.T) {
+	var prog, err = asm.Assemble("program.asm", []byte(`
+	LXI	SP,STACK
+	LXI	H,MSG
+LOOP:	MOV	A,M
+	ORA	A
+	JZ	DONE
+	CALL	PUTC
+	INX	H
+	JMP	LOOP
+PUTC:	OUT	1
+	RET
+DONE:	HLT
+MSG:	DB	'HI',0
+	DS	32
+STACK:
+`))
+	if err != nil {
+		t.Fatalf("Assemble: %v", err)
+	}
+
+	// The message is disassembled as code, but still comes back the same
+	var _, image = prog.Binary()
+	if again := reassemble(t, image); !bytes.Equal(again, image) {
+		t.Errorf("reassembled to\n% x\nexpected\n% x", again, image)
+	}
+}
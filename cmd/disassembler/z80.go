@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"8080emu/isa"
+)
+
+// z80Syntax maps every 8080 mnemonic to its Zilog Z80 template. The verbs
+// take the operands of the opcode in order (FirstOp, then OperandLow):
+//
+//	%r  8 bit register, M is written as (HL)
+//	%p  register pair, B is BC, D is DE, H is HL and PSW is AF
+//	%t  RST vector (the RST number times 8)
+//
+// and the bytes following the opcode:
+//
+//	%n  8 bit immediate value
+//	%w  16 bit immediate value or address
+var z80Syntax = map[string]string{
+	"NOP":  "NOP",
+	"LXI":  "LD %p,%w",
+	"STAX": "LD (%p),A",
+	"INX":  "INC %p",
+	"INR":  "INC %r",
+	"DCR":  "DEC %r",
+	"MVI":  "LD %r,%n",
+	"RLC":  "RLCA",
+	"DAD":  "ADD HL,%p",
+	"LDAX": "LD A,(%p)",
+	"DCX":  "DEC %p",
+	"RRC":  "RRCA",
+	"RAL":  "RLA",
+	"RAR":  "RRA",
+	"SHLD": "LD (%w),HL",
+	"DAA":  "DAA",
+	"LHLD": "LD HL,(%w)",
+	"CMA":  "CPL",
+	"STA":  "LD (%w),A",
+	"STC":  "SCF",
+	"LDA":  "LD A,(%w)",
+	"CMC":  "CCF",
+	"MOV":  "LD %r,%r",
+	"HLT":  "HALT",
+	"ADD":  "ADD A,%r",
+	"ADC":  "ADC A,%r",
+	"SUB":  "SUB %r",
+	"SBB":  "SBC A,%r",
+	"ANA":  "AND %r",
+	"XRA":  "XOR %r",
+	"ORA":  "OR %r",
+	"CMP":  "CP %r",
+	"RNZ":  "RET NZ",
+	"POP":  "POP %p",
+	"JNZ":  "JP NZ,%w",
+	"JMP":  "JP %w",
+	"CNZ":  "CALL NZ,%w",
+	"PUSH": "PUSH %p",
+	"ADI":  "ADD A,%n",
+	"RST":  "RST %t",
+	"RZ":   "RET Z",
+	"RET":  "RET",
+	"JZ":   "JP Z,%w",
+	"CZ":   "CALL Z,%w",
+	"CALL": "CALL %w",
+	"ACI":  "ADC A,%n",
+	"RNC":  "RET NC",
+	"JNC":  "JP NC,%w",
+	"OUT":  "OUT (%n),A",
+	"CNC":  "CALL NC,%w",
+	"SUI":  "SUB %n",
+	"RC":   "RET C",
+	"JC":   "JP C,%w",
+	"IN":   "IN A,(%n)",
+	"CC":   "CALL C,%w",
+	"SBI":  "SBC A,%n",
+	"RPO":  "RET PO",
+	"JPO":  "JP PO,%w",
+	"XTHL": "EX (SP),HL",
+	"CPO":  "CALL PO,%w",
+	"ANI":  "AND %n",
+	"RPE":  "RET PE",
+	"PCHL": "JP (HL)",
+	"JPE":  "JP PE,%w",
+	"XCHG": "EX DE,HL",
+	"CPE":  "CALL PE,%w",
+	"XRI":  "XOR %n",
+	"RP":   "RET P",
+	"JP":   "JP P,%w",
+	"DI":   "DI",
+	"CP":   "CALL P,%w",
+	"ORI":  "OR %n",
+	"RM":   "RET M",
+	"SPHL": "LD SP,HL",
+	"JM":   "JP M,%w",
+	"EI":   "EI",
+	"CM":   "CALL M,%w",
+	"CPI":  "CP %n",
+}
+
+var z80Registers = map[isa.Operand]string{
+	isa.RegA: "A",
+	isa.RegB: "B",
+	isa.RegC: "C",
+	isa.RegD: "D",
+	isa.RegE: "E",
+	isa.RegH: "H",
+	isa.RegL: "L",
+	isa.RegM: "(HL)",
+}
+
+var z80Pairs = map[isa.Operand]string{
+	isa.RegB:   "BC",
+	isa.RegD:   "DE",
+	isa.RegH:   "HL",
+	isa.RegSp:  "SP",
+	isa.RegPsw: "AF",
+}
+
+// z80 renders the opcode with Zilog Z80 mnemonics, e.g. MOV A, M becomes
+// LD A,(HL) and JNZ addr becomes JP NZ,addr.
+func z80(opcode isa.Opcode, low, high byte) string {
+	var template, ok = z80Syntax[opcode.Mnemonic]
+	if !ok {
+		panic(fmt.Sprintf("z80: no syntax for %s", opcode.Mnemonic))
+	}
+
+	var regs = []isa.Operand{opcode.FirstOp, opcode.OperandLow}
+	var next = func() isa.Operand {
+		var r = regs[0]
+		regs = regs[1:]
+		return r
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(template); i++ {
+		if template[i] != '%' {
+			out.WriteByte(template[i])
+			continue
+		}
+
+		i++
+		switch template[i] {
+		case 'r':
+			out.WriteString(z80Registers[next()])
+		case 'p':
+			out.WriteString(z80Pairs[next()])
+		case 't':
+			out.WriteString(z80Hex(uint16(next()-isa.Reg0)*8, 2))
+		case 'n':
+			out.WriteString(z80Hex(uint16(low), 2))
+		case 'w':
+			out.WriteString(z80Hex(uint16(high)<<8|uint16(low), 4))
+		default:
+			panic(fmt.Sprintf("z80: bad verb %%%c in %q", template[i], template))
+		}
+	}
+
+	// Keep the operands in the same column as the Intel dialect
+	var text = out.String()
+	if sp := strings.IndexByte(text, ' '); sp >= 0 {
+		return fmt.Sprintf("%-4s   %s", text[:sp], text[sp+1:])
+	}
+	return fmt.Sprintf("%-4s", text)
+}
+
+// z80Hex writes x with the H suffix, adding a leading 0 when the first digit
+// is a letter so assemblers do not take it for a symbol.
+func z80Hex(x uint16, digits int) string {
+	var hex = fmt.Sprintf("%0*XH", digits, x)
+	if hex[0] >= 'A' {
+		return "0" + hex
+	}
+	return hex
+}
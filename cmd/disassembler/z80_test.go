@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"8080emu/isa"
+)
+
+func TestZ80(t *testing.T) {
+	var table = []struct {
+		buf []byte
+		exp string
+	}{
+		{[]byte{0x7e}, "LD A,(HL)"},
+		{[]byte{0x41}, "LD B,C"},
+		{[]byte{0x36, 0x0a}, "LD (HL),0AH"},
+		{[]byte{0x01, 0x34, 0x12}, "LD BC,1234H"},
+		{[]byte{0x1a}, "LD A,(DE)"},
+		{[]byte{0x32, 0x00, 0x20}, "LD (2000H),A"},
+		{[]byte{0xc2, 0xff, 0xf0}, "JP NZ,0F0FFH"},
+		{[]byte{0xc3, 0x00, 0x01}, "JP 0100H"},
+		{[]byte{0xdc, 0x00, 0x01}, "CALL C,0100H"},
+		{[]byte{0x80}, "ADD A,B"},
+		{[]byte{0x9e}, "SBC A,(HL)"},
+		{[]byte{0xd6, 0x01}, "SUB 01H"},
+		{[]byte{0xeb}, "EX DE,HL"},
+		{[]byte{0xe3}, "EX (SP),HL"},
+		{[]byte{0xe9}, "JP (HL)"},
+		{[]byte{0xf5}, "PUSH AF"},
+		{[]byte{0x29}, "ADD HL,HL"},
+		{[]byte{0xd3, 0x10}, "OUT (10H),A"},
+		{[]byte{0xdb, 0x11}, "IN A,(11H)"},
+		{[]byte{0xcf}, "RST 08H"},
+		{[]byte{0xd0}, "RET NC"},
+		{[]byte{0x2f}, "CPL"},
+		{[]byte{0x76}, "HALT"},
+	}
+
+	for _, test := range table {
+		var opcode = lookup(0, test.buf)
+		var low, high byte
+		if len(test.buf) > 1 {
+			low = test.buf[1]
+		}
+		if len(test.buf) > 2 {
+			high = test.buf[2]
+		}
+
+		var text = strings.Join(strings.Fields(z80(opcode, low, high)), " ")
+		if text != test.exp {
+			t.Errorf("z80(% x) = %q, expected %q", test.buf, text, test.exp)
+		}
+	}
+}
+
+func TestZ80SyntaxComplete(t *testing.T) {
+	for code, opcode := range isa.Opcodes {
+		if _, ok := z80Syntax[opcode.Mnemonic]; !ok && opcode.Size != 0 {
+			t.Errorf("0x%02x: no z80 syntax for %s", code, opcode.Mnemonic)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"8080emu/obj"
+)
+
+var (
+	binOut   = flag.String("o", "", "write the raw binary to `file` (default: the first module name with .bin)")
+	mapOut   = flag.String("map", "", "write the symbol map to `file` (default: the binary name with .map)")
+	codeAddr = flag.String("code", "0", "place the code segments from hex `address`")
+	dataAddr = flag.String("data", "", "place the data segments from hex `address` (default: after the code)")
+)
+
+func main() {
+	log.SetFlags(0)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: linker [flags] module.obj...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var code = parseAddr("-code", *codeAddr)
+	var data = -1
+	if *dataAddr != "" {
+		data = parseAddr("-data", *dataAddr)
+	}
+
+	var mods []*obj.Module
+	for _, path := range flag.Args() {
+		var f, err = os.Open(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		m, err := obj.Read(f, path)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		mods = append(mods, m)
+	}
+
+	var im, err = obj.Link(mods, code, data)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *binOut == "" {
+		var first = flag.Arg(0)
+		*binOut = strings.TrimSuffix(first, filepath.Ext(first)) + ".bin"
+	}
+	if *mapOut == "" {
+		*mapOut = strings.TrimSuffix(*binOut, filepath.Ext(*binOut)) + ".map"
+	}
+
+	var _, image = im.Binary()
+	if err := os.WriteFile(*binOut, image, 0644); err != nil {
+		log.Fatalf("Error writing binary: %v", err)
+	}
+	writeFile(*mapOut, im.WriteMap)
+}
+
+func parseAddr(name, s string) int {
+	var v, err = strconv.ParseUint(strings.TrimSuffix(strings.ToUpper(s), "H"), 16, 16)
+	if err != nil {
+		log.Fatalf("%s: bad address %s", name, s)
+	}
+	return int(v)
+}
+
+func writeFile(path string, write func(w io.Writer) error) {
+	var f, err = os.Create(path)
+	if err != nil {
+		log.Fatalf("Error creating %s: %v", path, err)
+	}
+	if err := write(f); err != nil {
+		log.Fatalf("Error writing %s: %v", path, err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatalf("Error writing %s: %v", path, err)
+	}
+}
@@ -0,0 +1,164 @@
+// Package cover is the code coverage of 8080 programs: the instructions run
+// and the ways their conditional jumps, calls and returns went, merged
+// across runs and reported on the disassembly or, as lcov, on the source
+// lines of an assembler listing.
+//
+// A profile file is text, one address per line:
+//
+//	8080COV 1
+//	ADDR RUNS TAKEN NOTTAKEN
+//
+// ADDR is hex and the counts decimal. TAKEN and NOTTAKEN count the runs
+// of a conditional instruction that jumped, called or returned, and those
+// that went on to the next instruction.
+package cover
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"8080emu/isa"
+)
+
+// magic is the first line of a profile file
+const magic = "8080COV 1"
+
+// Count is what ran at an address
+type Count struct {
+	Runs     uint64 // of the instruction starting there
+	Taken    uint64 // the runs a conditional instruction jumped
+	NotTaken uint64 // and went on
+}
+
+// Both tells if a conditional instruction went both ways
+func (c Count) Both() bool {
+	return c.Taken > 0 && c.NotTaken > 0
+}
+
+// Profile counts what ran at each address
+type Profile struct {
+	Counts map[uint16]*Count
+}
+
+// New returns an empty profile
+func New() *Profile {
+	return &Profile{Counts: map[uint16]*Count{}}
+}
+
+// Record counts a run of op at addr. taken tells if a conditional op
+// jumped.
+func (p *Profile) Record(addr uint16, op isa.Opcode, taken bool) {
+	var c = p.count(addr)
+	c.Runs++
+	if !op.Flow.IsConditional() {
+		return
+	}
+	if taken {
+		c.Taken++
+	} else {
+		c.NotTaken++
+	}
+}
+
+func (p *Profile) count(addr uint16) *Count {
+	var c = p.Counts[addr]
+	if c == nil {
+		c = &Count{}
+		p.Counts[addr] = c
+	}
+	return c
+}
+
+// Get returns the count of addr, zero when nothing ran there
+func (p *Profile) Get(addr uint16) Count {
+	if c := p.Counts[addr]; c != nil {
+		return *c
+	}
+	return Count{}
+}
+
+// Merge adds the counts of q to p
+func (p *Profile) Merge(q *Profile) {
+	for addr, c := range q.Counts {
+		var m = p.count(addr)
+		m.Runs += c.Runs
+		m.Taken += c.Taken
+		m.NotTaken += c.NotTaken
+	}
+}
+
+// addrs returns the addresses counted, in order
+func (p *Profile) addrs() []uint16 {
+	var addrs []uint16
+	for addr := range p.Counts {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	return addrs
+}
+
+// Write writes p as a profile file
+func (p *Profile) Write(w io.Writer) error {
+	var bw = bufio.NewWriter(w)
+	fmt.Fprintln(bw, magic)
+	for _, addr := range p.addrs() {
+		var c = p.Counts[addr]
+		fmt.Fprintf(bw, "%04X %d %d %d\n", addr, c.Runs, c.Taken, c.NotTaken)
+	}
+	return bw.Flush()
+}
+
+// Read reads a profile file. name is used in the error messages.
+func Read(r io.Reader, name string) (*Profile, error) {
+	var p = New()
+	var sc = bufio.NewScanner(r)
+	var line = 0
+
+	var fail = func(format string, args ...interface{}) (*Profile, error) {
+		return nil, fmt.Errorf("%s:%d: %s", name, line, fmt.Sprintf(format, args...))
+	}
+
+	for sc.Scan() {
+		line++
+		var text = strings.TrimSpace(sc.Text())
+		if line == 1 {
+			if text != magic {
+				return fail("not a coverage profile")
+			}
+			continue
+		}
+		if text == "" {
+			continue
+		}
+
+		var f = strings.Fields(text)
+		if len(f) != 4 {
+			return fail("%d fields, expected 4", len(f))
+		}
+		var addr, err = strconv.ParseUint(f[0], 16, 16)
+		if err != nil {
+			return fail("bad address %s", f[0])
+		}
+		var n [3]uint64
+		for i := range n {
+			if n[i], err = strconv.ParseUint(f[i+1], 10, 64); err != nil {
+				return fail("bad count %s", f[i+1])
+			}
+		}
+		var c = p.count(uint16(addr))
+		c.Runs += n[0]
+		c.Taken += n[1]
+		c.NotTaken += n[2]
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if line == 0 {
+		return fail("not a coverage profile")
+	}
+	return p, nil
+}
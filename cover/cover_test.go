@@ -0,0 +1,72 @@
+package cover
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"8080emu/isa"
+)
+
+func TestRecord(t *testing.T) {
+	var p = New()
+	var jnz, _ = isa.Lookup(0xc2)
+	var nop, _ = isa.Lookup(0x00)
+	p.Record(0x10, jnz, true)
+	p.Record(0x10, jnz, true)
+	p.Record(0x10, jnz, false)
+	p.Record(0x13, nop, true)
+	if c := p.Get(0x10); c != (Count{Runs: 3, Taken: 2, NotTaken: 1}) || !c.Both() {
+		t.Errorf("JNZ counted %+v, expected 3 runs, 2 taken", c)
+	}
+	if c := p.Get(0x13); c != (Count{Runs: 1}) {
+		t.Errorf("NOP counted %+v, expected a run and no ways", c)
+	}
+	if c := p.Get(0x14); c != (Count{}) {
+		t.Errorf("counted %+v where nothing ran", c)
+	}
+}
+
+func TestMergeAndReadBack(t *testing.T) {
+	var a, b = New(), New()
+	var jz, _ = isa.Lookup(0xca)
+	a.Record(0x100, jz, true)
+	b.Record(0x100, jz, false)
+	b.Record(0xfffd, jz, false)
+	a.Merge(b)
+
+	var out bytes.Buffer
+	if err := a.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	var exp = "8080COV 1\n0100 2 1 1\nFFFD 1 0 1\n"
+	if out.String() != exp {
+		t.Errorf("wrote\n%s\nexpected\n%s", out.String(), exp)
+	}
+	var p, err = Read(&out, "test.cov")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Counts) != 2 || p.Get(0x100) != a.Get(0x100) || p.Get(0xfffd) != a.Get(0xfffd) {
+		t.Errorf("read back %+v, expected %+v", p.Counts, a.Counts)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	var table = []struct {
+		src string
+		exp string
+	}{
+		{"", "test.cov:0: not a coverage profile"},
+		{"8080OBJ 1\n", "test.cov:1: not a coverage profile"},
+		{"8080COV 1\n0100 1 0\n", "test.cov:2: 3 fields, expected 4"},
+		{"8080COV 1\n\n10000 1 0 0\n", "test.cov:3: bad address 10000"},
+		{"8080COV 1\n0100 1 -1 0\n", "test.cov:2: bad count -1"},
+	}
+	for _, test := range table {
+		var _, err = Read(strings.NewReader(test.src), "test.cov")
+		if err == nil || err.Error() != test.exp {
+			t.Errorf("%q: error %v, expected %s", test.src, err, test.exp)
+		}
+	}
+}
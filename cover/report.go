@@ -0,0 +1,276 @@
+package cover
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+
+	"8080emu/asm"
+	"8080emu/isa"
+	"8080emu/obj"
+)
+
+// Line is a line of the disassembly: an instruction, or a byte of data
+// where none can start
+type Line struct {
+	Addr  uint16
+	Data  []byte
+	Text  string
+	Code  bool // an instruction, not a byte of data
+	Count Count
+	Op    isa.Opcode
+}
+
+// Branch tells the ways a conditional instruction went: both, jump or next
+// when it only jumped or only went on to the next instruction, and "" when
+// it is not conditional or never ran
+func (l Line) Branch() string {
+	switch {
+	case !l.Code || !l.Op.Flow.IsConditional() || l.Count.Runs == 0:
+		return ""
+	case l.Count.Both():
+		return "both"
+	case l.Count.Taken > 0:
+		return "jump"
+	}
+	return "next"
+}
+
+// Disassemble disassembles image, loaded at base, with the counts of p. The
+// disassembly follows the instructions run: bytes that would start an
+// instruction running over one that ran are data.
+func (p *Profile) Disassemble(image []byte, base uint16) []Line {
+	var lines []Line
+	for i := 0; i < len(image); {
+		var addr = base + uint16(i)
+		var op, ok = isa.Lookup(image[i])
+		var size = int(op.Size)
+		if ok && i+size <= len(image) {
+			for j := 1; j < size; j++ {
+				if p.Get(addr+uint16(j)).Runs > 0 {
+					ok = false
+				}
+			}
+		} else {
+			ok = false
+		}
+
+		if !ok {
+			lines = append(lines, Line{Addr: addr, Data: image[i : i+1],
+				Text: fmt.Sprintf("%-4s   $%02x", "DB", image[i]), Count: p.Get(addr)})
+			i++
+			continue
+		}
+		var low, high byte
+		if size > 1 {
+			low = image[i+1]
+		}
+		if size > 2 {
+			high = image[i+2]
+		}
+		lines = append(lines, Line{Addr: addr, Data: image[i : i+size], Text: strings.TrimRight(op.Text(low, high), " "),
+			Code: true, Count: p.Get(addr), Op: op})
+		i += size
+	}
+	return lines
+}
+
+// Summary counts the instructions of a disassembly that ran, and the
+// conditional ones that went both ways
+type Summary struct {
+	Instructions, Run      int
+	Conditionals, BothWays int
+}
+
+// Summarize counts what ran in lines
+func Summarize(lines []Line) Summary {
+	var s Summary
+	for _, l := range lines {
+		if !l.Code {
+			continue
+		}
+		s.Instructions++
+		if l.Count.Runs > 0 {
+			s.Run++
+		}
+		if l.Op.Flow.IsConditional() {
+			s.Conditionals++
+			if l.Count.Both() {
+				s.BothWays++
+			}
+		}
+	}
+	return s
+}
+
+func (s Summary) String() string {
+	return fmt.Sprintf("%d of %d instructions run, %d of %d conditional instructions both ways",
+		s.Run, s.Instructions, s.BothWays, s.Conditionals)
+}
+
+// WriteAnnotated writes the disassembly of lines with the runs of each
+// instruction, ##### for those that never ran, and the ways the
+// conditional ones went, then the summary
+func WriteAnnotated(w io.Writer, lines []Line) error {
+	var bw = bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%10s %-6s %-4s  %-9s %s\n", "RUNS", "BRANCH", "ADDR", "BYTES", "INSTRUCTION")
+	for _, l := range lines {
+		var runs = ""
+		switch {
+		case l.Code && l.Count.Runs == 0:
+			runs = "#####"
+		case l.Code:
+			runs = fmt.Sprint(l.Count.Runs)
+		}
+		fmt.Fprintf(bw, "%10s %-6s %04x  %-9s %s\n", runs, l.Branch(), l.Addr, fmt.Sprintf("% x", l.Data), l.Text)
+	}
+	fmt.Fprintf(bw, "\n%s\n", Summarize(lines))
+	return bw.Flush()
+}
+
+var htmlReport = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: monospace; }
+td { padding: 0 0.5em; white-space: pre; }
+td.runs { text-align: right; }
+tr.run { background: #dfd; }
+tr.unrun { background: #fdd; }
+tr.partial { background: #ffd; }
+tr.data { color: #888; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Summary}}</p>
+<table>
+<tr><th>runs</th><th>branch</th><th>addr</th><th>bytes</th><th>instruction</th></tr>
+{{range .Lines}}<tr class="{{.Class}}"><td class="runs">{{.Runs}}</td><td>{{.Branch}}</td><td>{{printf "%04x" .Addr}}</td><td>{{printf "% x" .Data}}</td><td>{{.Text}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// htmlLine is a line of the HTML report
+type htmlLine struct {
+	Line
+	Class string
+	Runs  string
+}
+
+// WriteHTML writes the annotated disassembly of lines as an HTML page
+// called title: the instructions run are green, those that did not red, and
+// the conditional ones that only went one way yellow
+func WriteHTML(w io.Writer, lines []Line, title string) error {
+	var page = struct {
+		Title   string
+		Summary Summary
+		Lines   []htmlLine
+	}{Title: title, Summary: Summarize(lines)}
+	for _, l := range lines {
+		var h = htmlLine{Line: l, Class: "data"}
+		switch {
+		case !l.Code:
+		case l.Count.Runs == 0:
+			h.Class, h.Runs = "unrun", "0"
+		case l.Op.Flow.IsConditional() && !l.Count.Both():
+			h.Class, h.Runs = "partial", fmt.Sprint(l.Count.Runs)
+		default:
+			h.Class, h.Runs = "run", fmt.Sprint(l.Count.Runs)
+		}
+		page.Lines = append(page.Lines, h)
+	}
+	return htmlReport.Execute(w, page)
+}
+
+// WriteLcov writes the counts of p on the source lines of listing in the
+// tracefile format of lcov: the runs of each line with an instruction and
+// the ways of its conditional instructions, the first way jumping. Only
+// the absolute lines are counted: the addresses of CSEG and DSEG are
+// offsets the linker moves.
+func (p *Profile) WriteLcov(w io.Writer, listing []asm.ListLine) error {
+	type source struct {
+		lines    []int
+		runs     map[int]uint64
+		branches map[int][]Count
+	}
+	var files []string
+	var sources = map[string]*source{}
+	for _, l := range listing {
+		var op, ok = instruction(l)
+		if !ok {
+			continue
+		}
+		var src = sources[l.File]
+		if src == nil {
+			src = &source{runs: map[int]uint64{}, branches: map[int][]Count{}}
+			sources[l.File] = src
+			files = append(files, l.File)
+		}
+		var c = p.Get(l.Addr)
+		if r, seen := src.runs[l.Line]; !seen {
+			src.lines = append(src.lines, l.Line)
+			src.runs[l.Line] = c.Runs
+		} else if c.Runs > r {
+			src.runs[l.Line] = c.Runs
+		}
+		if op.Flow.IsConditional() {
+			src.branches[l.Line] = append(src.branches[l.Line], c)
+		}
+	}
+
+	var bw = bufio.NewWriter(w)
+	for _, file := range files {
+		var src = sources[file]
+		var hit, found, taken int
+		fmt.Fprintf(bw, "SF:%s\n", file)
+		for _, line := range src.lines {
+			for block, c := range src.branches[line] {
+				for way, n := range []uint64{c.Taken, c.NotTaken} {
+					found++
+					switch {
+					case c.Runs == 0:
+						fmt.Fprintf(bw, "BRDA:%d,%d,%d,-\n", line, block, way)
+						continue
+					case n > 0:
+						taken++
+					}
+					fmt.Fprintf(bw, "BRDA:%d,%d,%d,%d\n", line, block, way, n)
+				}
+			}
+		}
+		fmt.Fprintf(bw, "BRF:%d\nBRH:%d\n", found, taken)
+		for _, line := range src.lines {
+			fmt.Fprintf(bw, "DA:%d,%d\n", line, src.runs[line])
+			if src.runs[line] > 0 {
+				hit++
+			}
+		}
+		fmt.Fprintf(bw, "LF:%d\nLH:%d\nend_of_record\n", len(src.lines), hit)
+	}
+	return bw.Flush()
+}
+
+// instruction returns the instruction a line of the listing assembled. The
+// lines of data whose bytes happen to make one do not name its mnemonic.
+func instruction(l asm.ListLine) (isa.Opcode, bool) {
+	if !l.Code || l.Seg != obj.Absolute || len(l.Data) == 0 {
+		return isa.Opcode{}, false
+	}
+	var op, ok = isa.Lookup(l.Data[0])
+	if !ok || int(op.Size) != len(l.Data) {
+		return isa.Opcode{}, false
+	}
+	var f = strings.Fields(strings.ToUpper(l.Text))
+	for i := 0; i < len(f) && i < 2; i++ {
+		if f[i] == op.Mnemonic {
+			return op, true
+		}
+	}
+	return isa.Opcode{}, false
+}
@@ -0,0 +1,132 @@
+package cover
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"8080emu/asm"
+	"8080emu/isa"
+)
+
+// loop is a program counting down B with a branch that only ever jumps, an
+// instruction that never runs and data that look like an instruction
+const loop = `	ORG	100H
+START:	MVI	B,2
+LOOP:	DCR	B
+	JNZ	LOOP
+	JZ	DONE
+	NOP
+DONE:	HLT
+MSG:	DB	0C2H,0,0
+	END
+`
+
+// ran returns the program assembled and a profile of its run
+func ran(t *testing.T) (*asm.Program, *Profile) {
+	var prog, err = asm.Assemble("loop.asm", []byte(loop))
+	if err != nil {
+		t.Fatalf("Assemble: %v", err)
+	}
+	var p = New()
+	var record = func(addr uint16, taken bool) {
+		var _, image = prog.Binary()
+		var op, _ = isa.Lookup(image[addr-0x100])
+		p.Record(addr, op, taken)
+	}
+	record(0x100, false)
+	record(0x102, false)
+	record(0x103, true)
+	record(0x102, false)
+	record(0x103, false)
+	record(0x106, true)
+	record(0x10a, false)
+	return prog, p
+}
+
+func TestWriteAnnotated(t *testing.T) {
+	var prog, p = ran(t)
+	var base, image = prog.Binary()
+	var out bytes.Buffer
+	if err := WriteAnnotated(&out, p.Disassemble(image, base)); err != nil {
+		t.Fatal(err)
+	}
+	var exp = `      RUNS BRANCH ADDR  BYTES     INSTRUCTION
+         1        0100  06 02     MVI    B, #$02
+         2        0102  05        DCR    B
+         2 both   0103  c2 02 01  JNZ    $0102
+         1 jump   0106  ca 0a 01  JZ     $010a
+     #####        0109  00        NOP
+         1        010a  76        HLT
+     #####        010b  c2 00 00  JNZ    $0000
+
+5 of 7 instructions run, 1 of 3 conditional instructions both ways
+`
+	if out.String() != exp {
+		t.Errorf("annotated\n%s\nexpected\n%s", out.String(), exp)
+	}
+}
+
+func TestDisassembleFollowsRuns(t *testing.T) {
+	var p = New()
+	var nop, _ = isa.Lookup(0x00)
+	p.Record(0x02, nop, false)
+	// LXI H would take the NOP that ran
+	var lines = p.Disassemble([]byte{0x21, 0x00, 0x00, 0x76}, 0)
+	var texts []string
+	for _, l := range lines {
+		texts = append(texts, l.Text)
+	}
+	var exp = "DB     $21|NOP|NOP|HLT"
+	if got := strings.Join(texts, "|"); got != exp {
+		t.Errorf("disassembled %s, expected %s", got, exp)
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	var prog, p = ran(t)
+	var base, image = prog.Binary()
+	var out bytes.Buffer
+	if err := WriteHTML(&out, p.Disassemble(image, base), "loop <test>"); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"<title>loop &lt;test&gt;</title>",
+		"<p>5 of 7 instructions run, 1 of 3 conditional instructions both ways</p>",
+		`<tr class="run"><td class="runs">2</td><td>both</td><td>0103</td><td>c2 02 01</td><td>JNZ    $0102</td></tr>`,
+		`<tr class="partial"><td class="runs">1</td><td>jump</td><td>0106</td>`,
+		`<tr class="unrun"><td class="runs">0</td><td></td><td>0109</td>`,
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("HTML without %s:\n%s", s, out.String())
+		}
+	}
+}
+
+func TestWriteLcov(t *testing.T) {
+	var prog, p = ran(t)
+	var out bytes.Buffer
+	if err := p.WriteLcov(&out, prog.Listing); err != nil {
+		t.Fatal(err)
+	}
+	var exp = `SF:loop.asm
+BRDA:4,0,0,1
+BRDA:4,0,1,1
+BRDA:5,0,0,1
+BRDA:5,0,1,0
+BRF:4
+BRH:3
+DA:2,1
+DA:3,2
+DA:4,2
+DA:5,1
+DA:6,0
+DA:7,1
+LF:6
+LH:5
+end_of_record
+`
+	if out.String() != exp {
+		t.Errorf("wrote\n%s\nexpected\n%s", out.String(), exp)
+	}
+}
@@ -0,0 +1,342 @@
+// Package isa describes the Intel 8080 instruction set: mnemonic, size,
+// operands, cycles, flags affected and control flow of every opcode. It is
+// shared by the emulator and the tools in cmd.
+package isa
+
+// Opcode describes a single 8080 operation code
+type Opcode struct {
+	Mnemonic    string
+	Size        uint8
+	FirstOp     Operand
+	OperandLow  Operand
+	OperandHigh Operand
+	Cycles      uint8 // states taken, or when the condition is false for conditional instructions
+	CyclesTaken uint8 // states taken when the condition of a conditional instruction is true
+	Flags       Flags // flags the instruction may change
+	Flow        Flow  // how the instruction changes the program counter
+}
+
+type Operand int
+
+const (
+	Nil       Operand = iota // no operand
+	RegA                     // Register A
+	RegB                     // Register B
+	RegC                     // Register C
+	RegD                     // Register D
+	RegE                     // Register E
+	RegH                     // Register H
+	RegL                     // Register L
+	RegM                     // Not a register, but means (HL), and is treated as such
+	RegSp                    // Stack Pointer
+	Reg0                     // Register used for RST
+	Reg1                     // Register used for RST
+	Reg2                     // Register used for RST
+	Reg3                     // Register used for RST
+	Reg4                     // Register used for RST
+	Reg5                     // Register used for RST
+	Reg6                     // Register used for RST
+	Reg7                     // Register used for RST
+	RegPsw                   // Register A + Flags
+	Addr                     // Address
+	Immediate                // Immediate value
+)
+
+func (o Operand) IsRegister() bool {
+	return o >= RegA && o <= RegPsw
+}
+
+// Flags is a set of condition flags. The bits follow the order the
+// emulator keeps them in: Z, S, P, Cy, Ac.
+type Flags uint8
+
+const (
+	Z  Flags = 1 << iota // Zero
+	S                    // Sign
+	P                    // Parity
+	Cy                   // Carry
+	Ac                   // Aux carry
+)
+
+// Flow tells how an instruction changes the program counter. The zero value
+// means the instruction falls through to the next one.
+type Flow uint8
+
+const (
+	Branch      Flow = 1 << iota // JMP, Jcc and PCHL
+	Call                         // CALL, Ccc and RST
+	Return                       // RET and Rcc
+	Conditional                  // only taken when a condition flag holds
+)
+
+func (f Flow) IsBranch() bool      { return f&Branch != 0 }
+func (f Flow) IsCall() bool        { return f&Call != 0 }
+func (f Flow) IsReturn() bool      { return f&Return != 0 }
+func (f Flow) IsConditional() bool { return f&Conditional != 0 }
+
+// Lookup returns the description of code. ok is false for the opcodes the
+// 8080 does not define (0xcb, 0xd9, 0xdd, 0xed and 0xfd).
+func Lookup(code byte) (op Opcode, ok bool) {
+	op = Opcodes[code]
+	return op, op.Size != 0
+}
+
+// Opcodes is indexed by operation code. Undefined opcodes are left zeroed.
+var Opcodes = [256]Opcode{
+	0x00: Opcode{Mnemonic: "NOP", Size: 1, Cycles: 4},
+	0x01: Opcode{Mnemonic: "LXI", Size: 3, FirstOp: RegB, OperandLow: Immediate, OperandHigh: Immediate, Cycles: 10},
+	0x02: Opcode{Mnemonic: "STAX", Size: 1, FirstOp: RegB, Cycles: 7},
+	0x03: Opcode{Mnemonic: "INX", Size: 1, FirstOp: RegB, Cycles: 5},
+	0x04: Opcode{Mnemonic: "INR", Size: 1, FirstOp: RegB, Cycles: 5, Flags: Z | S | P | Ac},
+	0x05: Opcode{Mnemonic: "DCR", Size: 1, FirstOp: RegB, Cycles: 5, Flags: Z | S | P | Ac},
+	0x06: Opcode{Mnemonic: "MVI", Size: 2, FirstOp: RegB, OperandLow: Immediate, Cycles: 7},
+	0x07: Opcode{Mnemonic: "RLC", Size: 1, Cycles: 4, Flags: Cy},
+	0x08: Opcode{Mnemonic: "NOP", Size: 1, Cycles: 4},
+	0x09: Opcode{Mnemonic: "DAD", Size: 1, FirstOp: RegB, Cycles: 10, Flags: Cy},
+	0x0a: Opcode{Mnemonic: "LDAX", Size: 1, FirstOp: RegB, Cycles: 7},
+	0x0b: Opcode{Mnemonic: "DCX", Size: 1, FirstOp: RegB, Cycles: 5},
+	0x0c: Opcode{Mnemonic: "INR", Size: 1, FirstOp: RegC, Cycles: 5, Flags: Z | S | P | Ac},
+	0x0d: Opcode{Mnemonic: "DCR", Size: 1, FirstOp: RegC, Cycles: 5, Flags: Z | S | P | Ac},
+	0x0e: Opcode{Mnemonic: "MVI", Size: 2, FirstOp: RegC, OperandLow: Immediate, Cycles: 7},
+	0x0f: Opcode{Mnemonic: "RRC", Size: 1, Cycles: 4, Flags: Cy},
+	0x10: Opcode{Mnemonic: "NOP", Size: 1, Cycles: 4},
+	0x11: Opcode{Mnemonic: "LXI", Size: 3, FirstOp: RegD, OperandLow: Immediate, OperandHigh: Immediate, Cycles: 10},
+	0x12: Opcode{Mnemonic: "STAX", Size: 1, FirstOp: RegD, Cycles: 7},
+	0x13: Opcode{Mnemonic: "INX", Size: 1, FirstOp: RegD, Cycles: 5},
+	0x14: Opcode{Mnemonic: "INR", Size: 1, FirstOp: RegD, Cycles: 5, Flags: Z | S | P | Ac},
+	0x15: Opcode{Mnemonic: "DCR", Size: 1, FirstOp: RegD, Cycles: 5, Flags: Z | S | P | Ac},
+	0x16: Opcode{Mnemonic: "MVI", Size: 2, FirstOp: RegD, OperandLow: Immediate, Cycles: 7},
+	0x17: Opcode{Mnemonic: "RAL", Size: 1, Cycles: 4, Flags: Cy},
+	0x18: Opcode{Mnemonic: "NOP", Size: 1, Cycles: 4},
+	0x19: Opcode{Mnemonic: "DAD", Size: 1, FirstOp: RegD, Cycles: 10, Flags: Cy},
+	0x1a: Opcode{Mnemonic: "LDAX", Size: 1, FirstOp: RegD, Cycles: 7},
+	0x1b: Opcode{Mnemonic: "DCX", Size: 1, FirstOp: RegD, Cycles: 5},
+	0x1c: Opcode{Mnemonic: "INR", Size: 1, FirstOp: RegE, Cycles: 5, Flags: Z | S | P | Ac},
+	0x1d: Opcode{Mnemonic: "DCR", Size: 1, FirstOp: RegE, Cycles: 5, Flags: Z | S | P | Ac},
+	0x1e: Opcode{Mnemonic: "MVI", Size: 2, FirstOp: RegE, OperandLow: Immediate, Cycles: 7},
+	0x1f: Opcode{Mnemonic: "RAR", Size: 1, Cycles: 4, Flags: Cy},
+	0x20: Opcode{Mnemonic: "NOP", Size: 1, Cycles: 4},
+	0x21: Opcode{Mnemonic: "LXI", Size: 3, FirstOp: RegH, OperandLow: Immediate, OperandHigh: Immediate, Cycles: 10},
+	0x22: Opcode{Mnemonic: "SHLD", Size: 3, FirstOp: Addr, OperandLow: Addr, Cycles: 16},
+	0x23: Opcode{Mnemonic: "INX", Size: 1, FirstOp: RegH, Cycles: 5},
+	0x24: Opcode{Mnemonic: "INR", Size: 1, FirstOp: RegH, Cycles: 5, Flags: Z | S | P | Ac},
+	0x25: Opcode{Mnemonic: "DCR", Size: 1, FirstOp: RegH, Cycles: 5, Flags: Z | S | P | Ac},
+	0x26: Opcode{Mnemonic: "MVI", Size: 2, FirstOp: RegH, OperandLow: Immediate, Cycles: 7},
+	0x27: Opcode{Mnemonic: "DAA", Size: 1, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x28: Opcode{Mnemonic: "NOP", Size: 1, Cycles: 4},
+	0x29: Opcode{Mnemonic: "DAD", Size: 1, FirstOp: RegH, Cycles: 10, Flags: Cy},
+	0x2a: Opcode{Mnemonic: "LHLD", Size: 3, FirstOp: Addr, OperandLow: Addr, Cycles: 16},
+	0x2b: Opcode{Mnemonic: "DCX", Size: 1, FirstOp: RegH, Cycles: 5},
+	0x2c: Opcode{Mnemonic: "INR", Size: 1, FirstOp: RegL, Cycles: 5, Flags: Z | S | P | Ac},
+	0x2d: Opcode{Mnemonic: "DCR", Size: 1, FirstOp: RegL, Cycles: 5, Flags: Z | S | P | Ac},
+	0x2e: Opcode{Mnemonic: "MVI", Size: 2, FirstOp: RegL, OperandLow: Immediate, Cycles: 7},
+	0x2f: Opcode{Mnemonic: "CMA", Size: 1, Cycles: 4},
+	0x30: Opcode{Mnemonic: "NOP", Size: 1, Cycles: 4},
+	0x31: Opcode{Mnemonic: "LXI", Size: 3, FirstOp: RegSp, OperandLow: Immediate, OperandHigh: Immediate, Cycles: 10},
+	0x32: Opcode{Mnemonic: "STA", Size: 3, FirstOp: Addr, OperandLow: Addr, Cycles: 13},
+	0x33: Opcode{Mnemonic: "INX", Size: 1, FirstOp: RegSp, Cycles: 5},
+	0x34: Opcode{Mnemonic: "INR", Size: 1, FirstOp: RegM, Cycles: 10, Flags: Z | S | P | Ac},
+	0x35: Opcode{Mnemonic: "DCR", Size: 1, FirstOp: RegM, Cycles: 10, Flags: Z | S | P | Ac},
+	0x36: Opcode{Mnemonic: "MVI", Size: 2, FirstOp: RegM, OperandLow: Immediate, Cycles: 10},
+	0x37: Opcode{Mnemonic: "STC", Size: 1, Cycles: 4, Flags: Cy},
+	0x38: Opcode{Mnemonic: "NOP", Size: 1, Cycles: 4},
+	0x39: Opcode{Mnemonic: "DAD", Size: 1, FirstOp: RegSp, Cycles: 10, Flags: Cy},
+	0x3a: Opcode{Mnemonic: "LDA", Size: 3, FirstOp: Addr, OperandLow: Addr, Cycles: 13},
+	0x3b: Opcode{Mnemonic: "DCX", Size: 1, FirstOp: RegSp, Cycles: 5},
+	0x3c: Opcode{Mnemonic: "INR", Size: 1, FirstOp: RegA, Cycles: 5, Flags: Z | S | P | Ac},
+	0x3d: Opcode{Mnemonic: "DCR", Size: 1, FirstOp: RegA, Cycles: 5, Flags: Z | S | P | Ac},
+	0x3e: Opcode{Mnemonic: "MVI", Size: 2, FirstOp: RegA, OperandLow: Immediate, Cycles: 7},
+	0x3f: Opcode{Mnemonic: "CMC", Size: 1, Cycles: 4, Flags: Cy},
+	0x40: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegB, OperandLow: RegB, Cycles: 5},
+	0x41: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegB, OperandLow: RegC, Cycles: 5},
+	0x42: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegB, OperandLow: RegD, Cycles: 5},
+	0x43: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegB, OperandLow: RegE, Cycles: 5},
+	0x44: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegB, OperandLow: RegH, Cycles: 5},
+	0x45: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegB, OperandLow: RegL, Cycles: 5},
+	0x46: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegB, OperandLow: RegM, Cycles: 7},
+	0x47: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegB, OperandLow: RegA, Cycles: 5},
+	0x48: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegC, OperandLow: RegB, Cycles: 5},
+	0x49: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegC, OperandLow: RegC, Cycles: 5},
+	0x4a: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegC, OperandLow: RegD, Cycles: 5},
+	0x4b: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegC, OperandLow: RegE, Cycles: 5},
+	0x4c: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegC, OperandLow: RegH, Cycles: 5},
+	0x4d: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegC, OperandLow: RegL, Cycles: 5},
+	0x4e: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegC, OperandLow: RegM, Cycles: 7},
+	0x4f: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegC, OperandLow: RegA, Cycles: 5},
+	0x50: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegD, OperandLow: RegB, Cycles: 5},
+	0x51: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegD, OperandLow: RegC, Cycles: 5},
+	0x52: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegD, OperandLow: RegD, Cycles: 5},
+	0x53: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegD, OperandLow: RegE, Cycles: 5},
+	0x54: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegD, OperandLow: RegH, Cycles: 5},
+	0x55: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegD, OperandLow: RegL, Cycles: 5},
+	0x56: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegD, OperandLow: RegM, Cycles: 7},
+	0x57: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegD, OperandLow: RegA, Cycles: 5},
+	0x58: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegE, OperandLow: RegB, Cycles: 5},
+	0x59: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegE, OperandLow: RegC, Cycles: 5},
+	0x5a: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegE, OperandLow: RegD, Cycles: 5},
+	0x5b: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegE, OperandLow: RegE, Cycles: 5},
+	0x5c: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegE, OperandLow: RegH, Cycles: 5},
+	0x5d: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegE, OperandLow: RegL, Cycles: 5},
+	0x5e: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegE, OperandLow: RegM, Cycles: 7},
+	0x5f: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegE, OperandLow: RegA, Cycles: 5},
+	0x60: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegH, OperandLow: RegB, Cycles: 5},
+	0x61: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegH, OperandLow: RegC, Cycles: 5},
+	0x62: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegH, OperandLow: RegD, Cycles: 5},
+	0x63: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegH, OperandLow: RegE, Cycles: 5},
+	0x64: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegH, OperandLow: RegH, Cycles: 5},
+	0x65: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegH, OperandLow: RegL, Cycles: 5},
+	0x66: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegH, OperandLow: RegM, Cycles: 7},
+	0x67: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegH, OperandLow: RegA, Cycles: 5},
+	0x68: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegL, OperandLow: RegB, Cycles: 5},
+	0x69: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegL, OperandLow: RegC, Cycles: 5},
+	0x6a: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegL, OperandLow: RegD, Cycles: 5},
+	0x6b: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegL, OperandLow: RegE, Cycles: 5},
+	0x6c: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegL, OperandLow: RegH, Cycles: 5},
+	0x6d: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegL, OperandLow: RegL, Cycles: 5},
+	0x6e: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegL, OperandLow: RegM, Cycles: 7},
+	0x6f: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegL, OperandLow: RegA, Cycles: 5},
+	0x70: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegM, OperandLow: RegB, Cycles: 7},
+	0x71: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegM, OperandLow: RegC, Cycles: 7},
+	0x72: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegM, OperandLow: RegD, Cycles: 7},
+	0x73: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegM, OperandLow: RegE, Cycles: 7},
+	0x74: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegM, OperandLow: RegH, Cycles: 7},
+	0x75: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegM, OperandLow: RegL, Cycles: 7},
+	0x76: Opcode{Mnemonic: "HLT", Size: 1, Cycles: 7},
+	0x77: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegM, OperandLow: RegA, Cycles: 7},
+	0x78: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegA, OperandLow: RegB, Cycles: 5},
+	0x79: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegA, OperandLow: RegC, Cycles: 5},
+	0x7a: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegA, OperandLow: RegD, Cycles: 5},
+	0x7b: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegA, OperandLow: RegE, Cycles: 5},
+	0x7c: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegA, OperandLow: RegH, Cycles: 5},
+	0x7d: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegA, OperandLow: RegL, Cycles: 5},
+	0x7e: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegA, OperandLow: RegM, Cycles: 7},
+	0x7f: Opcode{Mnemonic: "MOV", Size: 1, FirstOp: RegA, OperandLow: RegA, Cycles: 5},
+	0x80: Opcode{Mnemonic: "ADD", Size: 1, FirstOp: RegB, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x81: Opcode{Mnemonic: "ADD", Size: 1, FirstOp: RegC, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x82: Opcode{Mnemonic: "ADD", Size: 1, FirstOp: RegD, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x83: Opcode{Mnemonic: "ADD", Size: 1, FirstOp: RegE, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x84: Opcode{Mnemonic: "ADD", Size: 1, FirstOp: RegH, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x85: Opcode{Mnemonic: "ADD", Size: 1, FirstOp: RegL, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x86: Opcode{Mnemonic: "ADD", Size: 1, FirstOp: RegM, Cycles: 7, Flags: Z | S | P | Cy | Ac},
+	0x87: Opcode{Mnemonic: "ADD", Size: 1, FirstOp: RegA, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x88: Opcode{Mnemonic: "ADC", Size: 1, FirstOp: RegB, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x89: Opcode{Mnemonic: "ADC", Size: 1, FirstOp: RegC, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x8a: Opcode{Mnemonic: "ADC", Size: 1, FirstOp: RegD, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x8b: Opcode{Mnemonic: "ADC", Size: 1, FirstOp: RegE, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x8c: Opcode{Mnemonic: "ADC", Size: 1, FirstOp: RegH, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x8d: Opcode{Mnemonic: "ADC", Size: 1, FirstOp: RegL, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x8e: Opcode{Mnemonic: "ADC", Size: 1, FirstOp: RegM, Cycles: 7, Flags: Z | S | P | Cy | Ac},
+	0x8f: Opcode{Mnemonic: "ADC", Size: 1, FirstOp: RegA, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x90: Opcode{Mnemonic: "SUB", Size: 1, FirstOp: RegB, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x91: Opcode{Mnemonic: "SUB", Size: 1, FirstOp: RegC, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x92: Opcode{Mnemonic: "SUB", Size: 1, FirstOp: RegD, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x93: Opcode{Mnemonic: "SUB", Size: 1, FirstOp: RegE, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x94: Opcode{Mnemonic: "SUB", Size: 1, FirstOp: RegH, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x95: Opcode{Mnemonic: "SUB", Size: 1, FirstOp: RegL, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x96: Opcode{Mnemonic: "SUB", Size: 1, FirstOp: RegM, Cycles: 7, Flags: Z | S | P | Cy | Ac},
+	0x97: Opcode{Mnemonic: "SUB", Size: 1, FirstOp: RegA, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x98: Opcode{Mnemonic: "SBB", Size: 1, FirstOp: RegB, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x99: Opcode{Mnemonic: "SBB", Size: 1, FirstOp: RegC, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x9a: Opcode{Mnemonic: "SBB", Size: 1, FirstOp: RegD, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x9b: Opcode{Mnemonic: "SBB", Size: 1, FirstOp: RegE, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x9c: Opcode{Mnemonic: "SBB", Size: 1, FirstOp: RegH, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x9d: Opcode{Mnemonic: "SBB", Size: 1, FirstOp: RegL, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0x9e: Opcode{Mnemonic: "SBB", Size: 1, FirstOp: RegM, Cycles: 7, Flags: Z | S | P | Cy | Ac},
+	0x9f: Opcode{Mnemonic: "SBB", Size: 1, FirstOp: RegA, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xa0: Opcode{Mnemonic: "ANA", Size: 1, FirstOp: RegB, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xa1: Opcode{Mnemonic: "ANA", Size: 1, FirstOp: RegC, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xa2: Opcode{Mnemonic: "ANA", Size: 1, FirstOp: RegD, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xa3: Opcode{Mnemonic: "ANA", Size: 1, FirstOp: RegE, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xa4: Opcode{Mnemonic: "ANA", Size: 1, FirstOp: RegH, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xa5: Opcode{Mnemonic: "ANA", Size: 1, FirstOp: RegL, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xa6: Opcode{Mnemonic: "ANA", Size: 1, FirstOp: RegM, Cycles: 7, Flags: Z | S | P | Cy | Ac},
+	0xa7: Opcode{Mnemonic: "ANA", Size: 1, FirstOp: RegA, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xa8: Opcode{Mnemonic: "XRA", Size: 1, FirstOp: RegB, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xa9: Opcode{Mnemonic: "XRA", Size: 1, FirstOp: RegC, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xaa: Opcode{Mnemonic: "XRA", Size: 1, FirstOp: RegD, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xab: Opcode{Mnemonic: "XRA", Size: 1, FirstOp: RegE, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xac: Opcode{Mnemonic: "XRA", Size: 1, FirstOp: RegH, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xad: Opcode{Mnemonic: "XRA", Size: 1, FirstOp: RegL, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xae: Opcode{Mnemonic: "XRA", Size: 1, FirstOp: RegM, Cycles: 7, Flags: Z | S | P | Cy | Ac},
+	0xaf: Opcode{Mnemonic: "XRA", Size: 1, FirstOp: RegA, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xb0: Opcode{Mnemonic: "ORA", Size: 1, FirstOp: RegB, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xb1: Opcode{Mnemonic: "ORA", Size: 1, FirstOp: RegC, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xb2: Opcode{Mnemonic: "ORA", Size: 1, FirstOp: RegD, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xb3: Opcode{Mnemonic: "ORA", Size: 1, FirstOp: RegE, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xb4: Opcode{Mnemonic: "ORA", Size: 1, FirstOp: RegH, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xb5: Opcode{Mnemonic: "ORA", Size: 1, FirstOp: RegL, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xb6: Opcode{Mnemonic: "ORA", Size: 1, FirstOp: RegM, Cycles: 7, Flags: Z | S | P | Cy | Ac},
+	0xb7: Opcode{Mnemonic: "ORA", Size: 1, FirstOp: RegA, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xb8: Opcode{Mnemonic: "CMP", Size: 1, FirstOp: RegB, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xb9: Opcode{Mnemonic: "CMP", Size: 1, FirstOp: RegC, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xba: Opcode{Mnemonic: "CMP", Size: 1, FirstOp: RegD, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xbb: Opcode{Mnemonic: "CMP", Size: 1, FirstOp: RegE, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xbc: Opcode{Mnemonic: "CMP", Size: 1, FirstOp: RegH, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xbd: Opcode{Mnemonic: "CMP", Size: 1, FirstOp: RegL, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xbe: Opcode{Mnemonic: "CMP", Size: 1, FirstOp: RegM, Cycles: 7, Flags: Z | S | P | Cy | Ac},
+	0xbf: Opcode{Mnemonic: "CMP", Size: 1, FirstOp: RegA, Cycles: 4, Flags: Z | S | P | Cy | Ac},
+	0xc0: Opcode{Mnemonic: "RNZ", Size: 1, Cycles: 5, CyclesTaken: 11, Flow: Return | Conditional},
+	0xc1: Opcode{Mnemonic: "POP", Size: 1, FirstOp: RegB, Cycles: 10},
+	0xc2: Opcode{Mnemonic: "JNZ", Size: 3, FirstOp: Addr, OperandLow: Addr, Cycles: 10, CyclesTaken: 10, Flow: Branch | Conditional},
+	0xc3: Opcode{Mnemonic: "JMP", Size: 3, FirstOp: Addr, OperandLow: Addr, Cycles: 10, Flow: Branch},
+	0xc4: Opcode{Mnemonic: "CNZ", Size: 3, FirstOp: Addr, OperandLow: Addr, Cycles: 11, CyclesTaken: 17, Flow: Call | Conditional},
+	0xc5: Opcode{Mnemonic: "PUSH", Size: 1, FirstOp: RegB, Cycles: 11},
+	0xc6: Opcode{Mnemonic: "ADI", Size: 2, FirstOp: Immediate, Cycles: 7, Flags: Z | S | P | Cy | Ac},
+	0xc7: Opcode{Mnemonic: "RST", Size: 1, FirstOp: Reg0, Cycles: 11, Flow: Call},
+	0xc8: Opcode{Mnemonic: "RZ", Size: 1, Cycles: 5, CyclesTaken: 11, Flow: Return | Conditional},
+	0xc9: Opcode{Mnemonic: "RET", Size: 1, Cycles: 10, Flow: Return},
+	0xca: Opcode{Mnemonic: "JZ", Size: 3, FirstOp: Addr, OperandLow: Addr, Cycles: 10, CyclesTaken: 10, Flow: Branch | Conditional},
+
+	0xcc: Opcode{Mnemonic: "CZ", Size: 3, FirstOp: Addr, OperandLow: Addr, Cycles: 11, CyclesTaken: 17, Flow: Call | Conditional},
+	0xcd: Opcode{Mnemonic: "CALL", Size: 3, FirstOp: Addr, OperandLow: Addr, Cycles: 17, Flow: Call},
+	0xce: Opcode{Mnemonic: "ACI", Size: 2, FirstOp: Immediate, Cycles: 7, Flags: Z | S | P | Cy | Ac},
+	0xcf: Opcode{Mnemonic: "RST", Size: 1, FirstOp: Reg1, Cycles: 11, Flow: Call},
+	0xd0: Opcode{Mnemonic: "RNC", Size: 1, Cycles: 5, CyclesTaken: 11, Flow: Return | Conditional},
+	0xd1: Opcode{Mnemonic: "POP", Size: 1, FirstOp: RegD, Cycles: 10},
+	0xd2: Opcode{Mnemonic: "JNC", Size: 3, FirstOp: Addr, OperandLow: Addr, Cycles: 10, CyclesTaken: 10, Flow: Branch | Conditional},
+	0xd3: Opcode{Mnemonic: "OUT", Size: 2, FirstOp: Immediate, Cycles: 10},
+	0xd4: Opcode{Mnemonic: "CNC", Size: 3, FirstOp: Addr, OperandLow: Addr, Cycles: 11, CyclesTaken: 17, Flow: Call | Conditional},
+	0xd5: Opcode{Mnemonic: "PUSH", Size: 1, FirstOp: RegD, Cycles: 11},
+	0xd6: Opcode{Mnemonic: "SUI", Size: 2, FirstOp: Immediate, Cycles: 7, Flags: Z | S | P | Cy | Ac},
+	0xd7: Opcode{Mnemonic: "RST", Size: 1, FirstOp: Reg2, Cycles: 11, Flow: Call},
+	0xd8: Opcode{Mnemonic: "RC", Size: 1, Cycles: 5, CyclesTaken: 11, Flow: Return | Conditional},
+
+	0xda: Opcode{Mnemonic: "JC", Size: 3, FirstOp: Addr, OperandLow: Addr, Cycles: 10, CyclesTaken: 10, Flow: Branch | Conditional},
+	0xdb: Opcode{Mnemonic: "IN", Size: 2, FirstOp: Immediate, Cycles: 10},
+	0xdc: Opcode{Mnemonic: "CC", Size: 3, FirstOp: Addr, OperandLow: Addr, Cycles: 11, CyclesTaken: 17, Flow: Call | Conditional},
+
+	0xde: Opcode{Mnemonic: "SBI", Size: 2, FirstOp: Immediate, Cycles: 7, Flags: Z | S | P | Cy | Ac},
+	0xdf: Opcode{Mnemonic: "RST", Size: 1, FirstOp: Reg3, Cycles: 11, Flow: Call},
+	0xe0: Opcode{Mnemonic: "RPO", Size: 1, Cycles: 5, CyclesTaken: 11, Flow: Return | Conditional},
+	0xe1: Opcode{Mnemonic: "POP", Size: 1, FirstOp: RegH, Cycles: 10},
+	0xe2: Opcode{Mnemonic: "JPO", Size: 3, FirstOp: Addr, OperandLow: Addr, Cycles: 10, CyclesTaken: 10, Flow: Branch | Conditional},
+	0xe3: Opcode{Mnemonic: "XTHL", Size: 1, Cycles: 18},
+	0xe4: Opcode{Mnemonic: "CPO", Size: 3, FirstOp: Addr, OperandLow: Addr, Cycles: 11, CyclesTaken: 17, Flow: Call | Conditional},
+	0xe5: Opcode{Mnemonic: "PUSH", Size: 1, FirstOp: RegH, Cycles: 11},
+	0xe6: Opcode{Mnemonic: "ANI", Size: 2, FirstOp: Immediate, Cycles: 7, Flags: Z | S | P | Cy | Ac},
+	0xe7: Opcode{Mnemonic: "RST", Size: 1, FirstOp: Reg4, Cycles: 11, Flow: Call},
+	0xe8: Opcode{Mnemonic: "RPE", Size: 1, Cycles: 5, CyclesTaken: 11, Flow: Return | Conditional},
+	0xe9: Opcode{Mnemonic: "PCHL", Size: 1, Cycles: 5, Flow: Branch},
+	0xea: Opcode{Mnemonic: "JPE", Size: 3, FirstOp: Addr, OperandLow: Addr, Cycles: 10, CyclesTaken: 10, Flow: Branch | Conditional},
+	0xeb: Opcode{Mnemonic: "XCHG", Size: 1, Cycles: 4},
+	0xec: Opcode{Mnemonic: "CPE", Size: 3, FirstOp: Addr, OperandLow: Addr, Cycles: 11, CyclesTaken: 17, Flow: Call | Conditional},
+
+	0xee: Opcode{Mnemonic: "XRI", Size: 2, FirstOp: Immediate, Cycles: 7, Flags: Z | S | P | Cy | Ac},
+	0xef: Opcode{Mnemonic: "RST", Size: 1, FirstOp: Reg5, Cycles: 11, Flow: Call},
+	0xf0: Opcode{Mnemonic: "RP", Size: 1, Cycles: 5, CyclesTaken: 11, Flow: Return | Conditional},
+	0xf1: Opcode{Mnemonic: "POP", Size: 1, FirstOp: RegPsw, Cycles: 10, Flags: Z | S | P | Cy | Ac},
+	0xf2: Opcode{Mnemonic: "JP", Size: 3, FirstOp: Addr, OperandLow: Addr, Cycles: 10, CyclesTaken: 10, Flow: Branch | Conditional},
+	0xf3: Opcode{Mnemonic: "DI", Size: 1, Cycles: 4},
+	0xf4: Opcode{Mnemonic: "CP", Size: 3, FirstOp: Addr, OperandLow: Addr, Cycles: 11, CyclesTaken: 17, Flow: Call | Conditional},
+	0xf5: Opcode{Mnemonic: "PUSH", Size: 1, FirstOp: RegPsw, Cycles: 11},
+	0xf6: Opcode{Mnemonic: "ORI", Size: 2, FirstOp: Immediate, Cycles: 7, Flags: Z | S | P | Cy | Ac},
+	0xf7: Opcode{Mnemonic: "RST", Size: 1, FirstOp: Reg6, Cycles: 11, Flow: Call},
+	0xf8: Opcode{Mnemonic: "RM", Size: 1, Cycles: 5, CyclesTaken: 11, Flow: Return | Conditional},
+	0xf9: Opcode{Mnemonic: "SPHL", Size: 1, Cycles: 5},
+	0xfa: Opcode{Mnemonic: "JM", Size: 3, FirstOp: Addr, OperandLow: Addr, Cycles: 10, CyclesTaken: 10, Flow: Branch | Conditional},
+	0xfb: Opcode{Mnemonic: "EI", Size: 1, Cycles: 4},
+	0xfc: Opcode{Mnemonic: "CM", Size: 3, FirstOp: Addr, OperandLow: Addr, Cycles: 11, CyclesTaken: 17, Flow: Call | Conditional},
+
+	0xfe: Opcode{Mnemonic: "CPI", Size: 2, FirstOp: Immediate, Cycles: 7, Flags: Z | S | P | Cy | Ac},
+	0xff: Opcode{Mnemonic: "RST", Size: 1, FirstOp: Reg7, Cycles: 11, Flow: Call},
+}
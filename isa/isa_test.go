@@ -0,0 +1,275 @@
+package isa
+
+import (
+	"fmt"
+	"testing"
+)
+
+// datasheet is the instruction summary of the Intel 8080 manual. Patterns
+// are the opcode bits 7..0 where
+//
+//	DDD, SSS  register: B C D E H L M A
+//	RP        register pair: B D H SP (B D H PSW for PUSH and POP)
+//	X         register pair: B D
+//	CCC       condition: NZ Z NC C PO PE P M
+//	NNN       RST number
+//
+// cyclesM are the states when a register field is M, or when the condition
+// holds for conditional instructions.
+var datasheet = []struct {
+	pattern  string
+	mnemonic string
+	size     uint8
+	cycles   uint8
+	cyclesM  uint8
+	flags    Flags
+}{
+	{"01DDDSSS", "MOV", 1, 5, 7, 0},
+	{"00DDD110", "MVI", 2, 7, 10, 0},
+	{"00RP0001", "LXI", 3, 10, 10, 0},
+	{"00111010", "LDA", 3, 13, 13, 0},
+	{"00110010", "STA", 3, 13, 13, 0},
+	{"00101010", "LHLD", 3, 16, 16, 0},
+	{"00100010", "SHLD", 3, 16, 16, 0},
+	{"000X1010", "LDAX", 1, 7, 7, 0},
+	{"000X0010", "STAX", 1, 7, 7, 0},
+	{"11101011", "XCHG", 1, 4, 4, 0},
+	{"10000SSS", "ADD", 1, 4, 7, Z | S | P | Cy | Ac},
+	{"11000110", "ADI", 2, 7, 7, Z | S | P | Cy | Ac},
+	{"10001SSS", "ADC", 1, 4, 7, Z | S | P | Cy | Ac},
+	{"11001110", "ACI", 2, 7, 7, Z | S | P | Cy | Ac},
+	{"10010SSS", "SUB", 1, 4, 7, Z | S | P | Cy | Ac},
+	{"11010110", "SUI", 2, 7, 7, Z | S | P | Cy | Ac},
+	{"10011SSS", "SBB", 1, 4, 7, Z | S | P | Cy | Ac},
+	{"11011110", "SBI", 2, 7, 7, Z | S | P | Cy | Ac},
+	{"00DDD100", "INR", 1, 5, 10, Z | S | P | Ac},
+	{"00DDD101", "DCR", 1, 5, 10, Z | S | P | Ac},
+	{"00RP0011", "INX", 1, 5, 5, 0},
+	{"00RP1011", "DCX", 1, 5, 5, 0},
+	{"00RP1001", "DAD", 1, 10, 10, Cy},
+	{"00100111", "DAA", 1, 4, 4, Z | S | P | Cy | Ac},
+	{"10100SSS", "ANA", 1, 4, 7, Z | S | P | Cy | Ac},
+	{"11100110", "ANI", 2, 7, 7, Z | S | P | Cy | Ac},
+	{"10101SSS", "XRA", 1, 4, 7, Z | S | P | Cy | Ac},
+	{"11101110", "XRI", 2, 7, 7, Z | S | P | Cy | Ac},
+	{"10110SSS", "ORA", 1, 4, 7, Z | S | P | Cy | Ac},
+	{"11110110", "ORI", 2, 7, 7, Z | S | P | Cy | Ac},
+	{"10111SSS", "CMP", 1, 4, 7, Z | S | P | Cy | Ac},
+	{"11111110", "CPI", 2, 7, 7, Z | S | P | Cy | Ac},
+	{"00000111", "RLC", 1, 4, 4, Cy},
+	{"00001111", "RRC", 1, 4, 4, Cy},
+	{"00010111", "RAL", 1, 4, 4, Cy},
+	{"00011111", "RAR", 1, 4, 4, Cy},
+	{"00101111", "CMA", 1, 4, 4, 0},
+	{"00111111", "CMC", 1, 4, 4, Cy},
+	{"00110111", "STC", 1, 4, 4, Cy},
+	{"11000011", "JMP", 3, 10, 10, 0},
+	{"11CCC010", "J", 3, 10, 10, 0},
+	{"11001101", "CALL", 3, 17, 17, 0},
+	{"11CCC100", "C", 3, 11, 17, 0},
+	{"11001001", "RET", 1, 10, 10, 0},
+	{"11CCC000", "R", 1, 5, 11, 0},
+	{"11NNN111", "RST", 1, 11, 11, 0},
+	{"11101001", "PCHL", 1, 5, 5, 0},
+	{"11RP0101", "PUSH", 1, 11, 11, 0},
+	{"11RP0001", "POP", 1, 10, 10, 0},
+	{"11100011", "XTHL", 1, 18, 18, 0},
+	{"11111001", "SPHL", 1, 5, 5, 0},
+	{"11011011", "IN", 2, 10, 10, 0},
+	{"11010011", "OUT", 2, 10, 10, 0},
+	{"11111011", "EI", 1, 4, 4, 0},
+	{"11110011", "DI", 1, 4, 4, 0},
+	{"01110110", "HLT", 1, 7, 7, 0},
+	{"00000000", "NOP", 1, 4, 4, 0},
+}
+
+var (
+	registerField = []Operand{RegB, RegC, RegD, RegE, RegH, RegL, RegM, RegA}
+	pairField     = []Operand{RegB, RegD, RegH, RegSp}
+	conditions    = []string{"NZ", "Z", "NC", "C", "PO", "PE", "P", "M"}
+)
+
+// expansion is one opcode of a datasheet row after its fields are filled in
+type expansion struct {
+	code     byte
+	mnemonic string
+	regs     []Operand
+	usesM    bool
+	cond     bool
+}
+
+// expand fills in the fields of a datasheet pattern
+func expand(pattern, mnemonic string) []expansion {
+	var out = []expansion{{mnemonic: mnemonic}}
+
+	for i := 0; i < len(pattern); {
+		var bit = uint(7 - i)
+		switch {
+		case pattern[i] == '0' || pattern[i] == '1':
+			for j := range out {
+				out[j].code |= (pattern[i] - '0') << bit
+			}
+			i++
+		case pattern[i] == 'X':
+			out = fill(out, 1, bit, func(e *expansion, v int) {
+				e.regs = append(e.regs, pairField[v])
+			})
+			i++
+		case pattern[i:i+2] == "RP":
+			out = fill(out, 2, bit-1, func(e *expansion, v int) {
+				var pair = pairField[v]
+				if pair == RegSp && (mnemonic == "PUSH" || mnemonic == "POP") {
+					pair = RegPsw
+				}
+				e.regs = append(e.regs, pair)
+			})
+			i += 2
+		case pattern[i:i+3] == "CCC":
+			out = fill(out, 3, bit-2, func(e *expansion, v int) {
+				e.mnemonic += conditions[v]
+				e.cond = true
+			})
+			i += 3
+		case pattern[i:i+3] == "NNN":
+			out = fill(out, 3, bit-2, func(e *expansion, v int) {
+				e.regs = append(e.regs, Reg0+Operand(v))
+			})
+			i += 3
+		default: // DDD or SSS
+			out = fill(out, 3, bit-2, func(e *expansion, v int) {
+				e.regs = append(e.regs, registerField[v])
+				e.usesM = e.usesM || registerField[v] == RegM
+			})
+			i += 3
+		}
+	}
+
+	return out
+}
+
+// fill multiplies every expansion by the 1<<width values of a field placed
+// at bit shift
+func fill(in []expansion, width, shift uint, set func(e *expansion, v int)) []expansion {
+	var out []expansion
+	for _, e := range in {
+		for v := 0; v < 1<<width; v++ {
+			var n = e
+			n.regs = append([]Operand(nil), e.regs...)
+			n.code |= byte(v) << shift
+			set(&n, v)
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+func TestDatasheet(t *testing.T) {
+	var seen = map[byte]bool{}
+
+	for _, row := range datasheet {
+		for _, e := range expand(row.pattern, row.mnemonic) {
+			if e.code == 0x76 && row.mnemonic == "MOV" {
+				continue // MOV M, M is HLT
+			}
+			seen[e.code] = true
+
+			var op, ok = Lookup(e.code)
+			var name = fmt.Sprintf("0x%02x %s", e.code, e.mnemonic)
+			if !ok {
+				t.Errorf("%s: missing from Opcodes", name)
+				continue
+			}
+
+			if op.Mnemonic != e.mnemonic {
+				t.Errorf("%s: Mnemonic = %s", name, op.Mnemonic)
+			}
+			if op.Size != row.size {
+				t.Errorf("%s: Size = %d, expected %d", name, op.Size, row.size)
+			}
+			var flags = row.flags
+			if e.code == 0xf1 {
+				flags = Z | S | P | Cy | Ac // POP PSW restores all of them
+			}
+			if op.Flags != flags {
+				t.Errorf("%s: Flags = %05b, expected %05b", name, op.Flags, flags)
+			}
+
+			var cycles = row.cycles
+			if e.usesM {
+				cycles = row.cyclesM
+			}
+			if op.Cycles != cycles {
+				t.Errorf("%s: Cycles = %d, expected %d", name, op.Cycles, cycles)
+			}
+			if e.cond && op.CyclesTaken != row.cyclesM {
+				t.Errorf("%s: CyclesTaken = %d, expected %d", name, op.CyclesTaken, row.cyclesM)
+			}
+			if e.cond != op.Flow.IsConditional() {
+				t.Errorf("%s: IsConditional() = %v", name, op.Flow.IsConditional())
+			}
+
+			var regs []Operand
+			for _, o := range []Operand{op.FirstOp, op.OperandLow} {
+				if o.IsRegister() {
+					regs = append(regs, o)
+				}
+			}
+			if fmt.Sprint(regs) != fmt.Sprint(e.regs) {
+				t.Errorf("%s: registers = %v, expected %v", name, regs, e.regs)
+			}
+		}
+	}
+
+	// The undocumented NOPs are the only opcodes left
+	for code := 0; code < 256; code++ {
+		var op, ok = Lookup(byte(code))
+		if !ok || seen[byte(code)] {
+			continue
+		}
+		if op.Mnemonic != "NOP" || code&0b1100_0111 != 0 {
+			t.Errorf("0x%02x %s: not in the datasheet", code, op.Mnemonic)
+		}
+	}
+}
+
+func TestFlow(t *testing.T) {
+	var table = []struct {
+		code byte
+		flow Flow
+	}{
+		{0x00, 0},
+		{0xc3, Branch},
+		{0xc2, Branch | Conditional},
+		{0xe9, Branch},
+		{0xcd, Call},
+		{0xdc, Call | Conditional},
+		{0xff, Call},
+		{0xc9, Return},
+		{0xf8, Return | Conditional},
+	}
+
+	for _, test := range table {
+		if Opcodes[test.code].Flow != test.flow {
+			t.Errorf("0x%02x: Flow = %04b, expected %04b", test.code, Opcodes[test.code].Flow, test.flow)
+		}
+	}
+}
+
+func TestOperandSizes(t *testing.T) {
+	// Immediate and Addr operands stand for one byte each after the opcode
+	for code, op := range Opcodes {
+		if op.Size == 0 {
+			continue
+		}
+
+		var extra uint8
+		for _, o := range []Operand{op.FirstOp, op.OperandLow, op.OperandHigh} {
+			if o == Immediate || o == Addr {
+				extra++
+			}
+		}
+		if extra != op.Size-1 {
+			t.Errorf("0x%02x %s: operands cover %d bytes, Size is %d", code, op.Mnemonic, extra, op.Size)
+		}
+	}
+}
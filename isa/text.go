@@ -0,0 +1,56 @@
+package isa
+
+import "fmt"
+
+var registerNames = map[Operand]string{
+	RegA:   "A",
+	RegB:   "B",
+	RegC:   "C",
+	RegD:   "D",
+	RegE:   "E",
+	RegH:   "H",
+	RegL:   "L",
+	RegM:   "M",
+	RegSp:  "SP",
+	Reg0:   "0",
+	Reg1:   "1",
+	Reg2:   "2",
+	Reg3:   "3",
+	Reg4:   "4",
+	Reg5:   "5",
+	Reg6:   "6",
+	Reg7:   "7",
+	RegPsw: "PSW",
+}
+
+// Name returns how the Intel manual writes a register operand, or "" for
+// the other operands
+func (o Operand) Name() string {
+	return registerNames[o]
+}
+
+// Text renders the instruction with the mnemonics of the Intel 8080 manual,
+// as the disassembler prints it: immediate values after #, and hex after $.
+// low and high are the bytes following the opcode, zero when the
+// instruction is shorter.
+func (op Opcode) Text(low, high byte) string {
+	var mnemonic = fmt.Sprintf("%-4s", op.Mnemonic)
+	switch {
+	case op.Size == 1 && op.FirstOp.IsRegister() && op.OperandLow.IsRegister():
+		return fmt.Sprintf("%s   %s, %s", mnemonic, op.FirstOp.Name(), op.OperandLow.Name())
+	case op.Size == 1 && op.FirstOp.IsRegister():
+		return fmt.Sprintf("%s   %s", mnemonic, op.FirstOp.Name())
+	case op.Size == 1:
+		return mnemonic
+	case op.Size == 2 && op.FirstOp.IsRegister() && op.OperandLow == Immediate:
+		return fmt.Sprintf("%s   %s, #$%02x", mnemonic, op.FirstOp.Name(), low)
+	case op.Size == 2 && op.FirstOp == Immediate:
+		return fmt.Sprintf("%s   #$%02x", mnemonic, low)
+	case op.Size == 3 && op.FirstOp.IsRegister() && op.OperandLow == Immediate && op.OperandHigh == Immediate:
+		return fmt.Sprintf("%s   %s, #$%02x%02x", mnemonic, op.FirstOp.Name(), high, low)
+	case op.Size == 3 && op.FirstOp == Addr && op.OperandLow == Addr:
+		return fmt.Sprintf("%s   $%02x%02x", mnemonic, high, low)
+	}
+
+	panic(fmt.Sprintf("isa: can not render %v", op))
+}
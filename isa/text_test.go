@@ -0,0 +1,26 @@
+package isa
+
+import "testing"
+
+func TestText(t *testing.T) {
+	var table = []struct {
+		code      byte
+		low, high byte
+		exp       string
+	}{
+		{0x00, 0, 0, "NOP "},
+		{0x78, 0, 0, "MOV    A, B"},
+		{0xf5, 0, 0, "PUSH   PSW"},
+		{0xff, 0, 0, "RST    7"},
+		{0x3e, 0x12, 0, "MVI    A, #$12"},
+		{0xfe, 0x0d, 0, "CPI    #$0d"},
+		{0x31, 0x00, 0x20, "LXI    SP, #$2000"},
+		{0xcd, 0x34, 0x12, "CALL   $1234"},
+	}
+
+	for _, test := range table {
+		if text := Opcodes[test.code].Text(test.low, test.high); text != test.exp {
+			t.Errorf("%02x: %q, expected %q", test.code, text, test.exp)
+		}
+	}
+}
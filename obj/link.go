@@ -0,0 +1,241 @@
+package obj
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Image is a program linked from modules, with every byte at its address
+type Image struct {
+	Fragments  []Fragment // all Absolute, sorted by address
+	Symbols    []Placed   // sorted by address
+	Placements []Placement
+	Entry      uint16
+}
+
+// Placement is where the segments of a module went
+type Placement struct {
+	Module   string
+	Code     uint16
+	CodeSize uint16
+	Data     uint16
+	DataSize uint16
+}
+
+// Placed is a symbol at its final address. The symbols that are not public
+// are named module.name.
+type Placed struct {
+	Name   string
+	Addr   uint16
+	Public bool
+}
+
+// region is a range of memory used by a module, to find overlaps
+type region struct {
+	what       string
+	start, end int
+}
+
+// Link places the code segments of mods one after the other from code, and
+// their data segments from data, or right after the code when data is
+// negative. It resolves the external symbols and relocations.
+func Link(mods []*Module, code, data int) (*Image, error) {
+	var im = &Image{}
+	var errs []string
+	var fail = func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+
+	// Place the segments
+	var next = code
+	for _, m := range mods {
+		im.Placements = append(im.Placements, Placement{Module: m.Name, Code: uint16(next), CodeSize: m.CodeSize})
+		next += int(m.CodeSize)
+	}
+	if data < 0 {
+		data = next
+	}
+	for i, m := range mods {
+		im.Placements[i].Data, im.Placements[i].DataSize = uint16(data), m.DataSize
+		data += int(m.DataSize)
+	}
+	if next > 0x10000 || data > 0x10000 {
+		return nil, errors.New("the segments do not fit in 64K")
+	}
+
+	var base = func(i int, seg Segment) uint16 {
+		switch seg {
+		case Code:
+			return im.Placements[i].Code
+		case Data:
+			return im.Placements[i].Data
+		}
+		return 0
+	}
+
+	// Resolve the public symbols
+	var publics = map[string]uint16{}
+	var owner = map[string]string{}
+	for i, m := range mods {
+		for _, s := range m.Symbols {
+			if s.Seg == External {
+				continue
+			}
+			var addr = base(i, s.Seg) + s.Value
+			if !s.Public {
+				im.Symbols = append(im.Symbols, Placed{Name: m.Name + "." + s.Name, Addr: addr})
+				continue
+			}
+			if other, dup := owner[s.Name]; dup {
+				fail("%s is public in %s and %s", s.Name, other, m.Name)
+				continue
+			}
+			publics[s.Name], owner[s.Name] = addr, m.Name
+			im.Symbols = append(im.Symbols, Placed{Name: s.Name, Addr: addr, Public: true})
+		}
+	}
+
+	// Copy the bytes and patch the relocations
+	var regions []region
+	var entryFrom string
+	for i, m := range mods {
+		var p = im.Placements[i]
+		if p.CodeSize > 0 {
+			regions = append(regions, region{m.Name + " CSEG", int(p.Code), int(p.Code) + int(p.CodeSize)})
+		}
+		if p.DataSize > 0 {
+			regions = append(regions, region{m.Name + " DSEG", int(p.Data), int(p.Data) + int(p.DataSize)})
+		}
+
+		var frags []Fragment
+		for _, f := range m.Fragments {
+			var start = int(base(i, f.Seg)) + int(f.Addr)
+			if start+len(f.Data) > 0x10000 {
+				fail("%s: %s data at %04X goes past FFFF", m.Name, f.Seg, f.Addr)
+				continue
+			}
+			if f.Seg == Absolute {
+				regions = append(regions, region{m.Name + " ASEG", start, start + len(f.Data)})
+			}
+			frags = append(frags, Fragment{Seg: Absolute, Addr: uint16(start), Data: append([]byte(nil), f.Data...)})
+		}
+
+		for _, r := range m.Relocs {
+			var v = r.Addend
+			if r.Base == External {
+				var addr, ok = publics[r.Symbol]
+				if !ok {
+					fail("%s: undefined external %s", m.Name, r.Symbol)
+					continue
+				}
+				v += addr
+			} else {
+				v += base(i, r.Base)
+			}
+
+			var at = int(base(i, r.Seg)) + int(r.Addr)
+			if !patch(frags, at, r.Kind, v) {
+				fail("%s: relocation at %s %04X is outside of the data", m.Name, r.Seg, r.Addr)
+			}
+		}
+		im.Fragments = append(im.Fragments, frags...)
+
+		if m.HasEntry {
+			if entryFrom != "" {
+				fail("%s and %s both have an entry point", entryFrom, m.Name)
+			}
+			entryFrom = m.Name
+			im.Entry = base(i, m.EntrySeg) + m.Entry
+		}
+	}
+
+	sort.Slice(regions, func(i, j int) bool { return regions[i].start < regions[j].start })
+	for i := 1; i < len(regions); i++ {
+		if regions[i].start < regions[i-1].end {
+			fail("%s at %04X overlaps %s", regions[i].what, regions[i].start, regions[i-1].what)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.New(strings.Join(errs, "\n"))
+	}
+
+	sort.Slice(im.Fragments, func(i, j int) bool { return im.Fragments[i].Addr < im.Fragments[j].Addr })
+	sort.SliceStable(im.Symbols, func(i, j int) bool { return im.Symbols[i].Addr < im.Symbols[j].Addr })
+	return im, nil
+}
+
+// patch stores the kind part of v at address at of the fragment holding it
+func patch(frags []Fragment, at int, kind RelocKind, v uint16) bool {
+	for _, f := range frags {
+		var off = at - int(f.Addr)
+		if off < 0 || off+kind.Size() > len(f.Data) {
+			continue
+		}
+		switch kind {
+		case Word:
+			f.Data[off], f.Data[off+1] = byte(v), byte(v>>8)
+		case Low:
+			f.Data[off] = byte(v)
+		case High:
+			f.Data[off] = byte(v >> 8)
+		}
+		return true
+	}
+	return false
+}
+
+// Binary returns the image as raw bytes running from its lowest to its
+// highest address, with the gaps filled with zeros, and the address of its
+// first byte.
+func (im *Image) Binary() (uint16, []byte) {
+	return Flatten(im.Fragments)
+}
+
+// Flatten lays out fragments as raw bytes running from their lowest to
+// their highest address, with the gaps filled with zeros, and returns the
+// address of the first byte. The segments of the fragments are ignored.
+func Flatten(frags []Fragment) (uint16, []byte) {
+	if len(frags) == 0 {
+		return 0, nil
+	}
+
+	var low, high = 0x10000, 0
+	for _, f := range frags {
+		if int(f.Addr) < low {
+			low = int(f.Addr)
+		}
+		if end := int(f.Addr) + len(f.Data); end > high {
+			high = end
+		}
+	}
+
+	var image = make([]byte, high-low)
+	for _, f := range frags {
+		copy(image[int(f.Addr)-low:], f.Data)
+	}
+	return uint16(low), image
+}
+
+// WriteMap writes where the modules went, the address Binary starts at and
+// the entry point as comments, then one symbol per line:
+//
+//	ADDR NAME
+func (im *Image) WriteMap(w io.Writer) error {
+	var bw = bufio.NewWriter(w)
+	fmt.Fprintf(bw, "; %-12s %-10s %s\n", "MODULE", "CSEG", "DSEG")
+	for _, p := range im.Placements {
+		fmt.Fprintf(bw, "; %-12s %04X %04X  %04X %04X\n", p.Module, p.Code, p.CodeSize, p.Data, p.DataSize)
+	}
+	var load, _ = im.Binary()
+	fmt.Fprintf(bw, "; load %04X entry %04X\n", load, im.Entry)
+
+	for _, s := range im.Symbols {
+		fmt.Fprintf(bw, "%04X %s\n", s.Addr, s.Name)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,103 @@
+package obj
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLink(t *testing.T) {
+	var lib = &Module{
+		Name:      "lib",
+		CodeSize:  4,
+		DataSize:  2,
+		Fragments: []Fragment{{Seg: Code, Addr: 0, Data: []byte{0x3e, 0, 0xc9, 0}}},
+		Symbols: []Symbol{
+			{Name: "PUTS", Seg: Code, Public: true},
+			{Name: "TMP", Seg: Data},
+		},
+		Relocs: []Reloc{{Seg: Code, Addr: 1, Kind: High, Base: Data, Addend: 1}},
+	}
+
+	var im, err = Link([]*Module{module, lib}, 0x100, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var placements = []Placement{
+		{Module: "main", Code: 0x100, CodeSize: 6, Data: 0x10a, DataSize: 0x40},
+		{Module: "lib", Code: 0x106, CodeSize: 4, Data: 0x14a, DataSize: 2},
+	}
+	for i, p := range placements {
+		if im.Placements[i] != p {
+			t.Errorf("Placements[%d] = %+v, expected %+v", i, im.Placements[i], p)
+		}
+	}
+
+	var org, image = im.Binary()
+	var exp = make([]byte, 0x10a)
+	copy(exp, []byte{0xc3, 0x00, 0x01})
+	copy(exp[0x100:], []byte{0x21, 0x1a, 0x01, 0xc3, 0x09, 0x01, 0x3e, 0x01, 0xc9, 0})
+	if org != 0 || !bytes.Equal(image, exp) {
+		t.Errorf("Binary = %04x % x\nexpected % x", org, image, exp)
+	}
+	if im.Entry != 0x100 {
+		t.Errorf("Entry = %04x, expected 0100", im.Entry)
+	}
+
+	var out bytes.Buffer
+	if err := im.WriteMap(&out); err != nil {
+		t.Fatal(err)
+	}
+	var mapExp = `; MODULE       CSEG       DSEG
+; main         0100 0006  010A 0040
+; lib          0106 0004  014A 0002
+; load 0000 entry 0100
+0100 START
+0106 PUTS
+011A main.BUF
+014A lib.TMP
+`
+	if out.String() != mapExp {
+		t.Errorf("WriteMap:\n%s\nexpected:\n%s", out.String(), mapExp)
+	}
+}
+
+func TestLinkErrors(t *testing.T) {
+	var code = func(name string, size uint16, syms ...Symbol) *Module {
+		return &Module{Name: name, CodeSize: size, Symbols: syms,
+			Fragments: []Fragment{{Seg: Code, Data: make([]byte, size)}}}
+	}
+	var public = Symbol{Name: "X", Seg: Code, Public: true}
+	var external = Symbol{Name: "Y", Seg: External}
+
+	var undefined = code("a", 3, external)
+	undefined.Relocs = []Reloc{{Seg: Code, Addr: 1, Base: External, Symbol: "Y"}}
+	var outside = code("a", 3)
+	outside.Relocs = []Reloc{{Seg: Code, Addr: 2, Base: Code}}
+	var absolute = &Module{Name: "b", Fragments: []Fragment{{Seg: Absolute, Addr: 0x101, Data: []byte{0}}}}
+	var entry = code("b", 1)
+	entry.HasEntry = true
+
+	var table = []struct {
+		mods []*Module
+		code int
+		exp  string
+	}{
+		{[]*Module{code("a", 1, public), code("b", 1, public)}, 0, "X is public in a and b"},
+		{[]*Module{undefined}, 0, "a: undefined external Y"},
+		{[]*Module{outside}, 0, "a: relocation at CSEG 0002 is outside of the data"},
+		{[]*Module{code("a", 4), absolute}, 0x100, "b ASEG at 0101 overlaps a CSEG"},
+		{[]*Module{entry, entry}, 0, "b and b both have an entry point"},
+		{[]*Module{code("a", 0x20)}, 0xfff0, "the segments do not fit in 64K"},
+	}
+
+	for _, test := range table {
+		var _, err = Link(test.mods, test.code, -1)
+		if err == nil {
+			t.Errorf("%s did not fail", test.exp)
+		} else if !strings.Contains(err.Error(), test.exp) {
+			t.Errorf("%v, expected %s", err, test.exp)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+// Package obj is the relocatable object format of the assembler and the
+// linker that places object modules in memory.
+//
+// An object file is text, one record per line:
+//
+//	8080OBJ 1
+//	MODULE name
+//	CSEG size
+//	DSEG size
+//	EXTRN name
+//	PUBLIC name seg value
+//	LOCAL name seg value
+//	DATA seg addr hexbytes
+//	RELOC seg addr kind base addend
+//	ENTRY seg addr
+//	END
+//
+// seg is ASEG, CSEG or DSEG and every number is hex. A RELOC record tells the
+// linker to store at addr the address of base, a segment or an external
+// symbol, plus addend: the whole word, or its LOW or HIGH byte.
+package obj
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// magic is the first line of an object file
+const magic = "8080OBJ 1"
+
+// Segment is where a value or byte of a module lives
+type Segment uint8
+
+const (
+	Absolute Segment = iota // ASEG: at the address it was assembled at
+	Code                    // CSEG: placed by the linker
+	Data                    // DSEG: placed by the linker
+	External                // a symbol of another module
+)
+
+var segmentNames = []string{"ASEG", "CSEG", "DSEG", "EXTRN"}
+
+func (s Segment) String() string {
+	if int(s) < len(segmentNames) {
+		return segmentNames[s]
+	}
+	return fmt.Sprintf("Segment(%d)", s)
+}
+
+// RelocKind is the part of a relocated address stored in the code
+type RelocKind uint8
+
+const (
+	Word RelocKind = iota // two bytes, low byte first
+	Low                   // the low byte
+	High                  // the high byte
+)
+
+var relocNames = []string{"WORD", "LOW", "HIGH"}
+
+func (k RelocKind) String() string {
+	if int(k) < len(relocNames) {
+		return relocNames[k]
+	}
+	return fmt.Sprintf("RelocKind(%d)", k)
+}
+
+// Size is the number of bytes a relocation patches
+func (k RelocKind) Size() int {
+	if k == Word {
+		return 2
+	}
+	return 1
+}
+
+// Fragment is a run of bytes at consecutive addresses of a segment
+type Fragment struct {
+	Seg  Segment
+	Addr uint16
+	Data []byte
+}
+
+// Symbol is a name defined by a module. Externals have no value.
+type Symbol struct {
+	Name   string
+	Seg    Segment
+	Value  uint16
+	Public bool
+}
+
+// Reloc is a place in a segment that holds the address of Base plus Addend.
+// Symbol names the external symbol when Base is External.
+type Reloc struct {
+	Seg    Segment
+	Addr   uint16
+	Kind   RelocKind
+	Base   Segment
+	Symbol string
+	Addend uint16
+}
+
+// Module is an assembled source file
+type Module struct {
+	Name      string
+	CodeSize  uint16
+	DataSize  uint16
+	Fragments []Fragment
+	Symbols   []Symbol
+	Relocs    []Reloc
+
+	HasEntry bool
+	EntrySeg Segment
+	Entry    uint16
+}
+
+// Write writes m in the object format
+func Write(w io.Writer, m *Module) error {
+	var bw = bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s\nMODULE %s\nCSEG %04X\nDSEG %04X\n", magic, m.Name, m.CodeSize, m.DataSize)
+
+	for _, s := range m.Symbols {
+		switch {
+		case s.Seg == External:
+			fmt.Fprintf(bw, "EXTRN %s\n", s.Name)
+		case s.Public:
+			fmt.Fprintf(bw, "PUBLIC %s %s %04X\n", s.Name, s.Seg, s.Value)
+		default:
+			fmt.Fprintf(bw, "LOCAL %s %s %04X\n", s.Name, s.Seg, s.Value)
+		}
+	}
+
+	for _, f := range m.Fragments {
+		for i := 0; i < len(f.Data); i += 32 {
+			var end = i + 32
+			if end > len(f.Data) {
+				end = len(f.Data)
+			}
+			fmt.Fprintf(bw, "DATA %s %04X %X\n", f.Seg, f.Addr+uint16(i), f.Data[i:end])
+		}
+	}
+
+	for _, r := range m.Relocs {
+		var base = r.Base.String()
+		if r.Base == External {
+			base = r.Symbol
+		}
+		fmt.Fprintf(bw, "RELOC %s %04X %s %s %04X\n", r.Seg, r.Addr, r.Kind, base, r.Addend)
+	}
+
+	if m.HasEntry {
+		fmt.Fprintf(bw, "ENTRY %s %04X\n", m.EntrySeg, m.Entry)
+	}
+	fmt.Fprintf(bw, "END\n")
+	return bw.Flush()
+}
+
+// Read reads a module written by Write. name is used in the error messages.
+func Read(r io.Reader, name string) (*Module, error) {
+	var m = &Module{}
+	var sc = bufio.NewScanner(r)
+	var line = 0
+	var ended = false
+
+	var fail = func(format string, args ...interface{}) (*Module, error) {
+		return nil, fmt.Errorf("%s:%d: %s", name, line, fmt.Sprintf(format, args...))
+	}
+
+	for sc.Scan() {
+		line++
+		var text = strings.TrimSpace(sc.Text())
+		if line == 1 {
+			if text != magic {
+				return fail("not an object file")
+			}
+			continue
+		}
+		if text == "" {
+			continue
+		}
+		if ended {
+			return fail("records after END")
+		}
+
+		var f = strings.Fields(text)
+		var want = map[string]int{
+			"MODULE": 2, "CSEG": 2, "DSEG": 2, "EXTRN": 2, "PUBLIC": 4, "LOCAL": 4,
+			"DATA": 4, "RELOC": 6, "ENTRY": 3, "END": 1,
+		}
+		if n, ok := want[f[0]]; !ok {
+			return fail("unknown record %s", f[0])
+		} else if len(f) != n {
+			return fail("%s record has %d fields, expected %d", f[0], len(f), n)
+		}
+
+		var err error
+		switch f[0] {
+		case "MODULE":
+			m.Name = f[1]
+		case "CSEG":
+			m.CodeSize, err = parseHex(f[1])
+		case "DSEG":
+			m.DataSize, err = parseHex(f[1])
+		case "EXTRN":
+			m.Symbols = append(m.Symbols, Symbol{Name: f[1], Seg: External})
+		case "PUBLIC", "LOCAL":
+			var s = Symbol{Name: f[1], Public: f[0] == "PUBLIC"}
+			if s.Seg, err = parseSegment(f[2]); err == nil {
+				s.Value, err = parseHex(f[3])
+			}
+			m.Symbols = append(m.Symbols, s)
+		case "DATA":
+			var frag Fragment
+			if frag.Seg, err = parseSegment(f[1]); err != nil {
+				break
+			}
+			if frag.Addr, err = parseHex(f[2]); err != nil {
+				break
+			}
+			if frag.Data, err = parseBytes(f[3]); err != nil {
+				break
+			}
+			m.addFragment(frag)
+		case "RELOC":
+			var r Reloc
+			if r.Seg, err = parseSegment(f[1]); err != nil {
+				break
+			}
+			if r.Addr, err = parseHex(f[2]); err != nil {
+				break
+			}
+			if r.Kind, err = parseKind(f[3]); err != nil {
+				break
+			}
+			if r.Base, err = parseSegment(f[4]); err != nil {
+				r.Base, r.Symbol, err = External, f[4], nil
+			} else if r.Base == Absolute {
+				err = fmt.Errorf("relocation against ASEG")
+				break
+			}
+			r.Addend, err = parseHex(f[5])
+			m.Relocs = append(m.Relocs, r)
+		case "ENTRY":
+			m.HasEntry = true
+			if m.EntrySeg, err = parseSegment(f[1]); err == nil {
+				m.Entry, err = parseHex(f[2])
+			}
+		case "END":
+			ended = true
+		}
+		if err != nil {
+			return fail("%v", err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if !ended {
+		return fail("missing END")
+	}
+
+	for _, r := range m.Relocs {
+		if r.Base == External && m.Symbol(r.Symbol) == nil {
+			return nil, fmt.Errorf("%s: relocation against %s, which is not an EXTRN", name, r.Symbol)
+		}
+	}
+	return m, nil
+}
+
+// Symbol returns the symbol called name, or nil
+func (m *Module) Symbol(name string) *Symbol {
+	for i := range m.Symbols {
+		if m.Symbols[i].Name == name {
+			return &m.Symbols[i]
+		}
+	}
+	return nil
+}
+
+// addFragment appends f, joining it to the last fragment when it follows it
+func (m *Module) addFragment(f Fragment) {
+	if n := len(m.Fragments); n > 0 {
+		var last = &m.Fragments[n-1]
+		if last.Seg == f.Seg && int(last.Addr)+len(last.Data) == int(f.Addr) {
+			last.Data = append(last.Data, f.Data...)
+			return
+		}
+	}
+	m.Fragments = append(m.Fragments, f)
+}
+
+func parseHex(s string) (uint16, error) {
+	var v, err = strconv.ParseUint(s, 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("bad number %s", s)
+	}
+	return uint16(v), nil
+}
+
+func parseBytes(s string) ([]byte, error) {
+	if len(s)%2 != 0 {
+		return nil, fmt.Errorf("odd number of hex digits")
+	}
+	var data = make([]byte, len(s)/2)
+	for i := range data {
+		var v, err = strconv.ParseUint(s[2*i:2*i+2], 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("bad byte %s", s[2*i:2*i+2])
+		}
+		data[i] = byte(v)
+	}
+	return data, nil
+}
+
+// parseSegment reads ASEG, CSEG or DSEG
+func parseSegment(s string) (Segment, error) {
+	for i, name := range segmentNames[:External] {
+		if s == name {
+			return Segment(i), nil
+		}
+	}
+	return 0, fmt.Errorf("bad segment %s", s)
+}
+
+func parseKind(s string) (RelocKind, error) {
+	for i, name := range relocNames {
+		if s == name {
+			return RelocKind(i), nil
+		}
+	}
+	return 0, fmt.Errorf("bad relocation kind %s", s)
+}
@@ -0,0 +1,92 @@
+package obj
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var module = &Module{
+	Name:     "main",
+	CodeSize: 6,
+	DataSize: 0x40,
+	Fragments: []Fragment{
+		{Seg: Absolute, Addr: 0, Data: []byte{0xc3, 0, 0}},
+		{Seg: Code, Addr: 0, Data: []byte{0x21, 0, 0, 0xc3, 0, 0}},
+	},
+	Symbols: []Symbol{
+		{Name: "BUF", Seg: Data, Value: 0x10},
+		{Name: "PUTS", Seg: External},
+		{Name: "START", Seg: Code, Public: true},
+	},
+	Relocs: []Reloc{
+		{Seg: Absolute, Addr: 1, Kind: Word, Base: Code},
+		{Seg: Code, Addr: 1, Kind: Word, Base: Data, Addend: 0x10},
+		{Seg: Code, Addr: 4, Kind: Word, Base: External, Symbol: "PUTS", Addend: 3},
+	},
+	HasEntry: true,
+	EntrySeg: Code,
+}
+
+func TestWriteRead(t *testing.T) {
+	var out bytes.Buffer
+	if err := Write(&out, module); err != nil {
+		t.Fatal(err)
+	}
+
+	var exp = `8080OBJ 1
+MODULE main
+CSEG 0006
+DSEG 0040
+LOCAL BUF DSEG 0010
+EXTRN PUTS
+PUBLIC START CSEG 0000
+DATA ASEG 0000 C30000
+DATA CSEG 0000 210000C30000
+RELOC ASEG 0001 WORD CSEG 0000
+RELOC CSEG 0001 WORD DSEG 0010
+RELOC CSEG 0004 WORD PUTS 0003
+ENTRY CSEG 0000
+END
+`
+	if out.String() != exp {
+		t.Errorf("Write:\n%s\nexpected:\n%s", out.String(), exp)
+	}
+
+	var m, err = Read(&out, "main.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, module) {
+		t.Errorf("Read = %+v\nexpected %+v", m, module)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	var table = []struct {
+		src string
+		exp string
+	}{
+		{"", "x.obj:0: missing END"},
+		{"8080OBJ 2\n", "x.obj:1: not an object file"},
+		{"8080OBJ 1\nMODULE\n", "x.obj:2: MODULE record has 1 fields, expected 2"},
+		{"8080OBJ 1\nFOO 1\n", "x.obj:2: unknown record FOO"},
+		{"8080OBJ 1\nCSEG 10000\n", "x.obj:2: bad number 10000"},
+		{"8080OBJ 1\nDATA XSEG 0000 00\n", "x.obj:2: bad segment XSEG"},
+		{"8080OBJ 1\nDATA CSEG 0000 0\n", "x.obj:2: odd number of hex digits"},
+		{"8080OBJ 1\nRELOC CSEG 0000 WORD ASEG 0000\n", "x.obj:2: relocation against ASEG"},
+		{"8080OBJ 1\nRELOC CSEG 0000 BYTE CSEG 0000\n", "x.obj:2: bad relocation kind BYTE"},
+		{"8080OBJ 1\nRELOC CSEG 0000 WORD X 0000\nEND\n", "x.obj: relocation against X, which is not an EXTRN"},
+		{"8080OBJ 1\nEND\nEND\n", "x.obj:3: records after END"},
+	}
+
+	for _, test := range table {
+		var _, err = Read(strings.NewReader(test.src), "x.obj")
+		if err == nil {
+			t.Errorf("%q did not fail", test.src)
+		} else if err.Error() != test.exp {
+			t.Errorf("%q: %v, expected %s", test.src, err, test.exp)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+// ACIA is a Motorola MC6850 serial interface, the chip behind each port of
+// the 88-2SIO. The control port reads the status and the data port moves
+// the bytes. Nothing is paced: a byte written is sent at once.
+type ACIA struct {
+	line    Line // nil when nothing is connected
+	control byte
+	rx      byte // the last byte received
+}
+
+// The bits of the status register
+const (
+	aciaRDRF = 1 << 0 // receive data register full
+	aciaTDRE = 1 << 1 // transmit data register empty
+	aciaIRQ  = 1 << 7 // interrupt request
+)
+
+// The fields of the control register
+const (
+	aciaReset     = 0b0000_0011 // counter divide bits both set: master reset
+	aciaEightBits = 0b0001_0000 // word select: 8 data bits when set
+	aciaTxIntMask = 0b0110_0000
+	aciaTxInt     = 0b0010_0000 // RTS low, transmit interrupt enabled
+	aciaRxInt     = 0b1000_0000 // receive interrupt enabled
+)
+
+func NewACIA(line Line) *ACIA {
+	return &ACIA{line: line}
+}
+
+// Attach puts the control port at port and the data port at port+1
+func (c *ACIA) Attach(bus *Bus, port byte) {
+	bus.Attach(port, c.Status, c.Control)
+	bus.Attach(port+1, c.ReadData, c.WriteData)
+}
+
+func (c *ACIA) Status() byte {
+	var st byte = aciaTDRE
+	if c.line != nil && c.line.Ready() {
+		st |= aciaRDRF
+	}
+	if c.IRQ() {
+		st |= aciaIRQ
+	}
+	return st
+}
+
+func (c *ACIA) Control(v byte) {
+	if v&aciaReset == aciaReset {
+		v = 0
+	}
+	c.control = v
+}
+
+func (c *ACIA) ReadData() byte {
+	if c.line != nil && c.line.Ready() {
+		c.rx = c.line.Read()
+	}
+	return c.rx & c.dataMask()
+}
+
+func (c *ACIA) WriteData(v byte) {
+	if c.line != nil {
+		c.line.Write(v & c.dataMask())
+	}
+}
+
+func (c *ACIA) dataMask() byte {
+	if c.control&aciaEightBits == 0 {
+		return 0x7f
+	}
+	return 0xff
+}
+
+// IRQ tells if the ACIA requests an interrupt
+func (c *ACIA) IRQ() bool {
+	var rx = c.control&aciaRxInt != 0 && c.line != nil && c.line.Ready()
+	var tx = c.control&aciaTxIntMask == aciaTxInt
+	return rx || tx
+}
+
+func (c *ACIA) SaveState(e *Encoder) {
+	e.Byte(c.control)
+	e.Byte(c.rx)
+}
+
+func (c *ACIA) LoadState(d *Decoder) {
+	c.control = d.Byte()
+	c.rx = d.Byte()
+}
@@ -0,0 +1,65 @@
+package main
+
+import "testing"
+
+// bufLine is a Line fed from a string, collecting what is written
+type bufLine struct {
+	in  string
+	out []byte
+}
+
+func (l *bufLine) Ready() bool {
+	return l.in != ""
+}
+
+func (l *bufLine) Read() byte {
+	var b = l.in[0]
+	l.in = l.in[1:]
+	return b
+}
+
+func (l *bufLine) Write(b byte) {
+	l.out = append(l.out, b)
+}
+
+func TestACIA(t *testing.T) {
+	var line = &bufLine{in: "\xc1"}
+	var c = NewACIA(line)
+
+	if st := c.Status(); st != aciaTDRE|aciaRDRF {
+		t.Errorf("Status() = %08b, expected TDRE and RDRF", st)
+	}
+
+	c.Control(aciaReset)
+	c.Control(0b0001_0001) // 8 bits, no parity, 2 stop bits, divide by 16
+	if b := c.ReadData(); b != 0xc1 {
+		t.Errorf("ReadData() = %02x, expected c1", b)
+	}
+	if st := c.Status(); st != aciaTDRE {
+		t.Errorf("Status() = %08b after reading, expected TDRE", st)
+	}
+
+	c.Control(0b0000_1001) // 7 bits, even parity
+	c.WriteData(0xc1)
+	if string(line.out) != "A" {
+		t.Errorf("wrote %q in 7 bits, expected A", line.out)
+	}
+
+	c.Control(aciaRxInt | aciaEightBits)
+	if c.IRQ() {
+		t.Errorf("IRQ() with nothing received")
+	}
+	line.in = "x"
+	if !c.IRQ() || c.Status()&aciaIRQ == 0 {
+		t.Errorf("no IRQ with a byte received")
+	}
+	c.ReadData()
+	if c.IRQ() {
+		t.Errorf("IRQ() after reading")
+	}
+
+	c.Control(aciaTxInt)
+	if !c.IRQ() {
+		t.Errorf("no IRQ with the transmit interrupt enabled")
+	}
+}
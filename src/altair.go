@@ -0,0 +1,91 @@
+package main
+
+// Altair is an Altair 8800: an 8080 with up to 64K of RAM, the sense
+// switches of the front panel on port 0xff and an 88-2SIO serial card whose
+// first port, on 0x10 and 0x11, is the console. The second port is on 0x12
+// and 0x13. An 88-DCDD floppy disk controller sits on 0x08 to 0x0a.
+// Interrupts arrive as RST 7, as the bus floats to 0xff.
+type Altair struct {
+	CPU      *State
+	Bus      *Bus
+	SIO      [2]*ACIA
+	Disks    *DiskController
+	Switches byte     // sense switches A15-A8
+	Hz       int      // the clock of the CPU, which paces the cards
+	Snapshot Snapshot // the CPU and the cards, with the cards added
+
+	irqs []func() bool // the interrupt requests of the cards added
+}
+
+// altairHz is the clock of the 8080 of the Altair
+const altairHz = 2000000
+
+// NewAltair returns an Altair with memKiB of RAM from address 0
+func NewAltair(memKiB int, console Line) *Altair {
+	var a = &Altair{CPU: &State{}, Bus: &Bus{}, Hz: altairHz}
+	a.CPU.ports = a.Bus
+	a.CPU.intr = altairInterrupts{a}
+	if memKiB < 64 {
+		a.CPU.Unmap(uint16(memKiB*1024), 0x10000-memKiB*1024)
+	}
+
+	a.SIO[0], a.SIO[1] = NewACIA(console), NewACIA(nil)
+	a.SIO[0].Attach(a.Bus, 0x10)
+	a.SIO[1].Attach(a.Bus, 0x12)
+	a.Disks = NewDiskController()
+	a.Disks.Attach(a.Bus)
+	a.Bus.Attach(0xff, func() byte { return a.Switches }, nil)
+
+	a.Snapshot.Add("cpu", a.CPU)
+	a.Snapshot.Add("sio0", a.SIO[0])
+	a.Snapshot.Add("sio1", a.SIO[1])
+	a.Snapshot.Add("dcdd", a.Disks)
+	return a
+}
+
+// Run runs the CPU until it halts with interrupts disabled or stop returns
+// true. stop is called every few thousand instructions.
+func (a *Altair) Run(stop func() bool) {
+	run(a.CPU, a.CPU.Step, stop)
+}
+
+// altairInterrupts is the interrupt line of the bus
+type altairInterrupts struct {
+	a *Altair
+}
+
+// AttachPIC puts an 8259 at port, between the interrupt line of the bus and
+// the CPU. The line goes to IR7: devices give the PIC their own requests.
+func (a *Altair) AttachPIC(pic *PIC, port byte) {
+	pic.Attach(a.Bus, port)
+	pic.Connect(7, altairInterrupts{a}.Pending)
+	a.CPU.intr = pic
+	a.Snapshot.Add("pic", pic)
+}
+
+// AddIRQ connects the interrupt request of a card to the bus
+func (a *Altair) AddIRQ(irq func() bool) {
+	a.irqs = append(a.irqs, irq)
+}
+
+func (l altairInterrupts) Pending() bool {
+	if l.a.SIO[0].IRQ() || l.a.SIO[1].IRQ() {
+		return true
+	}
+	for _, irq := range l.a.irqs {
+		if irq() {
+			return true
+		}
+	}
+	return false
+}
+
+func (l altairInterrupts) Acknowledge() byte {
+	return 0xff // RST 7
+}
+
+// LoadROM puts rom at addr, where the CPU can not write it
+func (a *Altair) LoadROM(addr uint16, rom []byte) {
+	a.CPU.Load(addr, rom)
+	a.CPU.MapROM(addr, len(rom))
+}
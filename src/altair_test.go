@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+
+	"8080emu/asm"
+)
+
+func TestAltair(t *testing.T) {
+	var prog, err = asm.AssembleFile("testdata/echo.asm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var org, image = prog.Binary()
+
+	var table = []struct {
+		memKiB   int
+		switches byte
+		exp      string
+	}{
+		{64, 0x00, "00 00 HELLO, ALTAIR."},
+		{16, 0xa5, "A5 40 HELLO, ALTAIR."},
+		{4, 0x0f, "0F 10 HELLO, ALTAIR."},
+	}
+
+	for _, test := range table {
+		var line = &bufLine{in: "Hello, Altair.ignored"}
+		var a = NewAltair(test.memKiB, line)
+		a.Switches = test.switches
+		a.CPU.Load(org, image)
+		a.Run(func() bool { return a.CPU.Cycles() > 10000000 })
+
+		if !a.CPU.Halted() {
+			t.Errorf("%dK: did not halt", test.memKiB)
+		}
+		if string(line.out) != test.exp {
+			t.Errorf("%dK: printed %q, expected %q", test.memKiB, line.out, test.exp)
+		}
+	}
+}
+
+func TestAltairInterrupts(t *testing.T) {
+	var line = &bufLine{}
+	var a = NewAltair(64, line)
+	a.CPU.Load(0, []byte{
+		0x3e, 0x95, // MVI A, 95H: receive interrupt, 8 bits
+		0xd3, 0x10, // OUT 10H
+		0x31, 0x00, 0x01, // LXI SP, 100H
+		0xfb, // EI
+		0x76, // HLT
+		0x38: 0xdb, // IN 11H
+		0x39: 0x11,
+		0x3a: 0x76, // HLT
+	})
+
+	for i := 0; i < 10; i++ {
+		a.CPU.Step()
+	}
+	if !a.CPU.Halted() || a.CPU.pc != 9 {
+		t.Fatalf("pc = %04x, expected the CPU halted at 0009", a.CPU.pc)
+	}
+
+	line.in = "k"
+	for i := 0; i < 3; i++ {
+		a.CPU.Step()
+	}
+	if a.CPU.regA != 'k' || a.CPU.pc != 0x3b {
+		t.Errorf("A = %02x at %04x, expected 6b read at 003b by RST 7", a.CPU.regA, a.CPU.pc)
+	}
+}
+
+func TestAltairPIC(t *testing.T) {
+	var line = &bufLine{}
+	var a = NewAltair(64, line)
+	a.AttachPIC(NewPIC(), 0x20)
+	a.CPU.Load(0, []byte{
+		0x3e, 0x16, // MVI A, 16H: ICW1, interval 4, single
+		0xd3, 0x20, // OUT 20H
+		0x3e, 0x02, // MVI A, 02H: ICW2, vectors at 0200H
+		0xd3, 0x21, // OUT 21H
+		0x3e, 0x95, // MVI A, 95H: receive interrupt, 8 bits
+		0xd3, 0x10, // OUT 10H
+		0x31, 0x00, 0x01, // LXI SP, 100H
+		0xfb, // EI
+		0x76, // HLT
+	})
+	a.CPU.Load(0x021c, []byte{
+		0xdb, 0x11, // IN 11H
+		0x76, // HLT
+	})
+
+	for i := 0; i < 12; i++ {
+		a.CPU.Step()
+	}
+	line.in = "p"
+	for i := 0; i < 3; i++ {
+		a.CPU.Step()
+	}
+	if a.CPU.regA != 'p' || a.CPU.pc != 0x021f {
+		t.Errorf("A = %02x at %04x, expected 70 read at 021f through IR7", a.CPU.regA, a.CPU.pc)
+	}
+}
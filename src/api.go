@@ -0,0 +1,663 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// API drives a machine under the debugger over HTTP, for the programs
+// testing what runs on it. Requests and responses are JSON, and GET /schema
+// describes them in the OpenAPI format. The addresses of the requests are
+// strings read as the debugger does: symbols, hex or expressions; those of
+// the responses numbers. Bytes are hex strings.
+//
+// The machine runs only in the requests: the terminal of the machine reads
+// what POST /input sends and writes what GET /output returns. The machines
+// have no display: GET /screen shows the latest lines of their terminal, as
+// a screenshot would, without taking them. A request runs at a time, but
+// POST /stop, which stops the run going on.
+type API struct {
+	D *Debugger
+
+	mu       sync.Mutex
+	snap     *Snapshot
+	start    []byte      // the snapshot of the machine reset restores
+	typed    chan<- byte // read by the machine
+	pending  []byte      // the input not taken yet
+	output   []byte      // what the machine wrote since the last GET /output
+	screen   tuiConsole  // what the machine wrote, by lines
+	stopping int32       // POST /stop came during a run
+	done     chan struct{}
+	quit     sync.Once
+}
+
+// apiOutputSize is the output kept, the latest
+const apiOutputSize = 1 << 20
+
+// apiScreenRows are the lines GET /screen shows by default
+const apiScreenRows = 24
+
+// apiRunTimeout is how long POST /run runs by default
+const apiRunTimeout = 10 * time.Second
+
+// NewAPI serves d, whose machine is saved and restored by snap, with the
+// machine on term
+func NewAPI(d *Debugger, snap *Snapshot, term *Terminal) (*API, error) {
+	var a = &API{D: d, snap: snap, done: make(chan struct{})}
+	var buf bytes.Buffer
+	if err := snap.Save(&buf); err != nil {
+		return nil, err
+	}
+	a.start = buf.Bytes()
+	_, a.typed = term.divert(apiOutput{a})
+	return a, nil
+}
+
+// Done is closed by POST /quit
+func (a *API) Done() <-chan struct{} {
+	return a.done
+}
+
+// Stop stops the run going on, if any
+func (a *API) Stop() {
+	atomic.StoreInt32(&a.stopping, 1)
+}
+
+// apiOutput takes what the machine writes on its terminal
+type apiOutput struct{ a *API }
+
+func (o apiOutput) Write(p []byte) (int, error) {
+	var a = o.a
+	a.screen.Write(p)
+	a.output = append(a.output, p...)
+	if len(a.output) > apiOutputSize {
+		a.output = append(a.output[:0], a.output[len(a.output)-apiOutputSize:]...)
+	}
+	return len(p), nil
+}
+
+// pump gives the machine what it has room for of the input pending
+func (a *API) pump() {
+	for len(a.pending) > 0 {
+		select {
+		case a.typed <- a.pending[0]:
+			a.pending = a.pending[1:]
+		default:
+			return
+		}
+	}
+}
+
+// apiError is an error with the status of its response
+type apiError struct {
+	status int
+	msg    string
+}
+
+func (e *apiError) Error() string {
+	return e.msg
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &apiError{http.StatusBadRequest, fmt.Sprintf(format, args...)}
+}
+
+// apiRoute is a request the API serves
+type apiRoute struct {
+	method, path, summary string
+	params                []apiParam  // of the query
+	request, response     interface{} // values of the types of the bodies, or nil
+	handle                func(a *API, r *http.Request) (interface{}, error)
+}
+
+type apiParam struct {
+	name, doc string
+	required  bool
+}
+
+// the bodies of the requests and the responses
+
+type apiRegisters struct {
+	A      *byte   `json:"a,omitempty"`
+	B      *byte   `json:"b,omitempty"`
+	C      *byte   `json:"c,omitempty"`
+	D      *byte   `json:"d,omitempty"`
+	E      *byte   `json:"e,omitempty"`
+	H      *byte   `json:"h,omitempty"`
+	L      *byte   `json:"l,omitempty"`
+	F      *byte   `json:"f,omitempty" doc:"the flags as PUSH PSW stores them: S Z 0 AC 0 P 1 CY"`
+	SP     *uint16 `json:"sp,omitempty"`
+	PC     *uint16 `json:"pc,omitempty"`
+	IE     *bool   `json:"ie,omitempty" doc:"interrupts enabled"`
+	Halted *bool   `json:"halted,omitempty"`
+	States *uint64 `json:"states,omitempty" doc:"the states run since the start, read only"`
+}
+
+type apiMemory struct {
+	Addr uint16 `json:"addr"`
+	Data string `json:"data" doc:"hex"`
+}
+
+type apiWrite struct {
+	Addr string `json:"addr" doc:"a symbol, hex or an expression"`
+	Data string `json:"data" doc:"hex"`
+}
+
+type apiStep struct {
+	Count int `json:"count,omitempty" doc:"the instructions to run, 1 by default; < 0 steps back"`
+}
+
+type apiRun struct {
+	Until   string `json:"until,omitempty" doc:"an expression of the debugger: the run stops once it is true"`
+	Steps   int    `json:"steps,omitempty" doc:"the most instructions to run, no limit by default"`
+	Timeout int    `json:"timeout,omitempty" doc:"the most milliseconds to run, 10000 by default"`
+}
+
+type apiStop struct {
+	Reason string `json:"reason" doc:"done, breakpoint, halted, stopped, start of history, watchpoint, changed or until"`
+	Why    string `json:"why" doc:"as the debugger tells it"`
+	PC     uint16 `json:"pc"`
+	Where  string `json:"where" doc:"the instruction at pc"`
+	States uint64 `json:"states"`
+}
+
+type apiBreakpoint struct {
+	Addr string `json:"addr" doc:"a symbol, hex or an expression"`
+	If   string `json:"if,omitempty" doc:"the condition, an expression of the debugger"`
+}
+
+type apiBreakpointSet struct {
+	Addr uint16 `json:"addr"`
+	Name string `json:"name"`
+	If   string `json:"if,omitempty"`
+}
+
+type apiText struct {
+	Text string `json:"text"`
+}
+
+type apiScreen struct {
+	Lines []string `json:"lines" doc:"the latest lines the machine wrote, the last one the line it writes on"`
+}
+
+type apiInput struct {
+	Pending int `json:"pending" doc:"the bytes sent the machine has not read yet"`
+}
+
+type apiEmpty struct{}
+
+var apiRoutes = []apiRoute{
+	{method: "GET", path: "/schema", summary: "describe the API in the OpenAPI format",
+		response: map[string]interface{}{}},
+	{method: "POST", path: "/reset", summary: "restore the machine as it was when the API started: the CPU, memory and the devices",
+		response: apiRegisters{}, handle: (*API).reset},
+	{method: "POST", path: "/load", summary: "load bytes in memory, ROM included, and jump to them",
+		request: apiWrite{}, response: apiRegisters{}, handle: (*API).load},
+	{method: "GET", path: "/registers", summary: "read the registers",
+		response: apiRegisters{}, handle: (*API).registers},
+	{method: "PUT", path: "/registers", summary: "set the registers given",
+		request: apiRegisters{}, response: apiRegisters{}, handle: (*API).setRegisters},
+	{method: "GET", path: "/memory", summary: "read memory",
+		params:   []apiParam{{"addr", "a symbol, hex or an expression", true}, {"len", "the bytes to read, decimal, 256 by default", false}},
+		response: apiMemory{}, handle: (*API).memory},
+	{method: "PUT", path: "/memory", summary: "write memory, ROM included",
+		request: apiWrite{}, response: apiMemory{}, handle: (*API).write},
+	{method: "POST", path: "/step", summary: "run instructions, or step back",
+		request: apiStep{}, response: apiStop{}, handle: (*API).step},
+	{method: "POST", path: "/run", summary: "run until a breakpoint, a watchpoint, the CPU halts with interrupts disabled, until is true, the limits or POST /stop",
+		request: apiRun{}, response: apiStop{}, handle: (*API).run},
+	{method: "POST", path: "/stop", summary: "stop the run going on",
+		response: apiEmpty{}},
+	{method: "GET", path: "/breakpoints", summary: "list the breakpoints",
+		response: []apiBreakpointSet{}, handle: (*API).breakpoints},
+	{method: "POST", path: "/breakpoints", summary: "set a breakpoint",
+		request: apiBreakpoint{}, response: []apiBreakpointSet{}, handle: (*API).setBreakpoint},
+	{method: "DELETE", path: "/breakpoints", summary: "clear a breakpoint",
+		params:   []apiParam{{"addr", "a symbol, hex or an expression", true}},
+		response: []apiBreakpointSet{}, handle: (*API).clearBreakpoint},
+	{method: "POST", path: "/input", summary: "type text on the terminal of the machine",
+		request: apiText{}, response: apiInput{}, handle: (*API).input},
+	{method: "GET", path: "/output", summary: "take what the machine wrote on its terminal since the last time",
+		response: apiText{}, handle: (*API).takeOutput},
+	{method: "GET", path: "/screen", summary: "show the latest lines of the terminal of the machine, leaving GET /output what it takes",
+		params:   []apiParam{{"rows", "the lines to show, 24 by default", false}},
+		response: apiScreen{}, handle: (*API).showScreen},
+	{method: "POST", path: "/quit", summary: "end the emulator, which writes the files of its flags",
+		response: apiEmpty{}},
+}
+
+// ServeHTTP serves the routes of the API
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var route *apiRoute
+	var allowed []string
+	for i := range apiRoutes {
+		if apiRoutes[i].path == r.URL.Path {
+			allowed = append(allowed, apiRoutes[i].method)
+			if apiRoutes[i].method == r.Method {
+				route = &apiRoutes[i]
+			}
+		}
+	}
+	switch {
+	case len(allowed) == 0:
+		apiReply(w, nil, &apiError{http.StatusNotFound, "no such path " + r.URL.Path})
+		return
+	case route == nil:
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		apiReply(w, nil, &apiError{http.StatusMethodNotAllowed, r.Method + " not allowed on " + r.URL.Path})
+		return
+	}
+
+	// these do not wait for the run going on
+	switch route.path {
+	case "/schema":
+		apiReply(w, apiSchema(), nil)
+		return
+	case "/stop":
+		a.Stop()
+		apiReply(w, apiEmpty{}, nil)
+		return
+	case "/quit":
+		a.Stop()
+		a.quit.Do(func() { close(a.done) })
+		apiReply(w, apiEmpty{}, nil)
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var v, err = route.handle(a, r)
+	apiReply(w, v, err)
+}
+
+// apiReply writes v, or err as {"error": message}
+func apiReply(w http.ResponseWriter, v interface{}, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		var status = http.StatusInternalServerError
+		if e, ok := err.(*apiError); ok {
+			status = e.status
+		}
+		w.WriteHeader(status)
+		v = map[string]string{"error": err.Error()}
+	}
+	var enc = json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// decode reads the body of r in v, leaving v as it is when there is none
+func decode(r *http.Request, v interface{}) error {
+	var dec = json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil && err != io.EOF {
+		return badRequest("bad body: %v", err)
+	}
+	return nil
+}
+
+// addr reads an address as the debugger does
+func (a *API) addr(s string) (uint16, error) {
+	if s == "" {
+		return 0, badRequest("no address")
+	}
+	var addr, err = a.D.Addr(s)
+	if err != nil {
+		return 0, badRequest("%v", err)
+	}
+	return addr, nil
+}
+
+// bytes reads the address and the bytes of w
+func (a *API) bytes(w apiWrite) (uint16, []byte, error) {
+	var addr, err = a.addr(w.Addr)
+	if err != nil {
+		return 0, nil, err
+	}
+	var data []byte
+	if data, err = hex.DecodeString(w.Data); err != nil {
+		return 0, nil, badRequest("bad data: %v", err)
+	}
+	return addr, data, nil
+}
+
+func (a *API) reset(r *http.Request) (interface{}, error) {
+	if err := a.snap.Restore(bytes.NewReader(a.start)); err != nil {
+		return nil, err
+	}
+	a.pending, a.output, a.screen = nil, nil, tuiConsole{}
+	a.D.Forget()
+	return a.registers(r)
+}
+
+func (a *API) load(r *http.Request) (interface{}, error) {
+	var w apiWrite
+	if err := decode(r, &w); err != nil {
+		return nil, err
+	}
+	var addr, data, err = a.bytes(w)
+	if err != nil {
+		return nil, err
+	}
+	a.D.CPU.Load(addr, data)
+	a.D.CPU.pc, a.D.CPU.halted = addr, false
+	a.D.Forget()
+	return a.registers(r)
+}
+
+func (a *API) registers(r *http.Request) (interface{}, error) {
+	var s = a.D.CPU
+	var f, ie = byte(s.psw()), s.intEnable != 0
+	return apiRegisters{A: &s.regA, B: &s.regB, C: &s.regC, D: &s.regD, E: &s.regE, H: &s.regH, L: &s.regL,
+		F: &f, SP: &s.sp, PC: &s.pc, IE: &ie, Halted: &s.halted, States: &s.cycles}, nil
+}
+
+func (a *API) setRegisters(r *http.Request) (interface{}, error) {
+	var regs apiRegisters
+	if err := decode(r, &regs); err != nil {
+		return nil, err
+	}
+	var s = a.D.CPU
+	for _, reg := range []struct {
+		v   *byte
+		reg *byte
+	}{{regs.A, &s.regA}, {regs.B, &s.regB}, {regs.C, &s.regC}, {regs.D, &s.regD}, {regs.E, &s.regE},
+		{regs.H, &s.regH}, {regs.L, &s.regL}} {
+		if reg.v != nil {
+			*reg.reg = *reg.v
+		}
+	}
+	if regs.F != nil {
+		s.setPsw(pairTo16(s.regA, *regs.F))
+	}
+	if regs.SP != nil {
+		s.sp = *regs.SP
+	}
+	if regs.PC != nil {
+		s.pc = *regs.PC
+	}
+	if regs.IE != nil {
+		s.intEnable = 0
+		if *regs.IE {
+			s.intEnable = 1
+		}
+	}
+	if regs.Halted != nil {
+		s.halted = *regs.Halted
+	}
+	a.D.Forget()
+	return a.registers(r)
+}
+
+func (a *API) memory(r *http.Request) (interface{}, error) {
+	var q = r.URL.Query()
+	var addr, err = a.addr(q.Get("addr"))
+	if err != nil {
+		return nil, err
+	}
+	var n = 256
+	if s := q.Get("len"); s != "" {
+		if n, err = strconv.Atoi(s); err != nil || n < 0 || n > 0x10000 {
+			return nil, badRequest("bad len %s", s)
+		}
+	}
+	var data = make([]byte, n)
+	for i := range data {
+		data[i] = a.D.CPU.peek(addr + uint16(i))
+	}
+	return apiMemory{addr, hex.EncodeToString(data)}, nil
+}
+
+func (a *API) write(r *http.Request) (interface{}, error) {
+	var w apiWrite
+	if err := decode(r, &w); err != nil {
+		return nil, err
+	}
+	var addr, data, err = a.bytes(w)
+	if err != nil {
+		return nil, err
+	}
+	a.D.CPU.Load(addr, data)
+	a.D.Forget()
+	return apiMemory{addr, hex.EncodeToString(data)}, nil
+}
+
+func (a *API) step(r *http.Request) (interface{}, error) {
+	var step apiStep
+	if err := decode(r, &step); err != nil {
+		return nil, err
+	}
+	a.pump()
+	switch {
+	case step.Count < 0:
+		return a.stopped(a.D.Back(-step.Count), false), nil
+	case step.Count == 0:
+		step.Count = 1
+	}
+	atomic.StoreInt32(&a.stopping, 0)
+	return a.stopped(a.D.Run(step.Count, a.stop(apiRunTimeout)), false), nil
+}
+
+func (a *API) run(r *http.Request) (interface{}, error) {
+	var run apiRun
+	if err := decode(r, &run); err != nil {
+		return nil, err
+	}
+	var until func() bool
+	if run.Until != "" {
+		var e, err = ParseExpr(run.Until, a.D.Symbols)
+		if err != nil {
+			return nil, badRequest("bad until: %v", err)
+		}
+		until = func() bool { return e.True(a.D.CPU) }
+	}
+	var timeout = apiRunTimeout
+	if run.Timeout > 0 {
+		timeout = time.Duration(run.Timeout) * time.Millisecond
+	}
+	if run.Steps <= 0 {
+		run.Steps = -1
+	}
+	atomic.StoreInt32(&a.stopping, 0)
+	a.pump()
+	return a.stopped(a.D.run(run.Steps, a.stop(timeout), until), until != nil), nil
+}
+
+// stop returns the stop of a run of d at most, which also gives the
+// machine the input pending
+func (a *API) stop(d time.Duration) func() bool {
+	var end = time.Now().Add(d)
+	return func() bool {
+		a.pump()
+		return atomic.LoadInt32(&a.stopping) != 0 || time.Now().After(end)
+	}
+}
+
+// stopped describes s, a stop of a run with until when until is true
+func (a *API) stopped(s Stop, until bool) apiStop {
+	var reason = s.Reason.String()
+	if until && s.Reason == StopReturn {
+		reason = "until"
+	}
+	var why = a.D.Why(s)
+	if s.Reason == StopReturn {
+		why = reason
+	}
+	return apiStop{Reason: reason, Why: why, PC: s.PC, Where: a.D.Where(s.PC), States: a.D.CPU.cycles}
+}
+
+func (a *API) breakpoints(r *http.Request) (interface{}, error) {
+	var list = []apiBreakpointSet{}
+	for _, addr := range a.D.Breakpoints() {
+		var b = apiBreakpointSet{Addr: addr, Name: a.D.Symbols.Name(addr)}
+		if cond := a.D.Condition(addr); cond != nil {
+			b.If = cond.String()
+		}
+		list = append(list, b)
+	}
+	return list, nil
+}
+
+func (a *API) setBreakpoint(r *http.Request) (interface{}, error) {
+	var b apiBreakpoint
+	if err := decode(r, &b); err != nil {
+		return nil, err
+	}
+	var addr, err = a.addr(b.Addr)
+	if err != nil {
+		return nil, err
+	}
+	var cond *Expr
+	if b.If != "" {
+		if cond, err = ParseExpr(b.If, a.D.Symbols); err != nil {
+			return nil, badRequest("bad condition: %v", err)
+		}
+	}
+	a.D.SetBreakpoint(addr, cond)
+	return a.breakpoints(r)
+}
+
+func (a *API) clearBreakpoint(r *http.Request) (interface{}, error) {
+	var addr, err = a.addr(r.URL.Query().Get("addr"))
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := a.D.breaks[addr]; !ok {
+		return nil, &apiError{http.StatusNotFound, fmt.Sprintf("no breakpoint at %04x", addr)}
+	}
+	a.D.ClearBreakpoint(addr)
+	return a.breakpoints(r)
+}
+
+func (a *API) input(r *http.Request) (interface{}, error) {
+	var in apiText
+	if err := decode(r, &in); err != nil {
+		return nil, err
+	}
+	a.pending = append(a.pending, in.Text...)
+	a.pump()
+	return apiInput{len(a.pending)}, nil
+}
+
+func (a *API) takeOutput(r *http.Request) (interface{}, error) {
+	var out = apiText{string(a.output)}
+	a.output = nil
+	return out, nil
+}
+
+func (a *API) showScreen(r *http.Request) (interface{}, error) {
+	var rows = apiScreenRows
+	if s := r.URL.Query().Get("rows"); s != "" {
+		var err error
+		if rows, err = strconv.Atoi(s); err != nil || rows < 0 || rows > tuiConsoleLines {
+			return nil, badRequest("bad rows %s", s)
+		}
+	}
+	var lines = []string{}
+	for _, l := range a.screen.lines {
+		lines = append(lines, string(l.text))
+	}
+	if !a.screen.open && len(lines) > 0 {
+		lines = append(lines, "") // after a new line
+	}
+	if len(lines) > rows {
+		lines = lines[len(lines)-rows:]
+	}
+	var screen = apiScreen{lines}
+	return screen, nil
+}
+
+// apiSchema describes the routes in the OpenAPI format
+func apiSchema() map[string]interface{} {
+	var paths = map[string]interface{}{}
+	var content = func(t reflect.Type) map[string]interface{} {
+		return map[string]interface{}{"application/json": map[string]interface{}{"schema": schemaOf(t)}}
+	}
+	for _, route := range apiRoutes {
+		var op = map[string]interface{}{
+			"summary": route.summary,
+			"responses": map[string]interface{}{
+				"200":     map[string]interface{}{"description": "done", "content": content(reflect.TypeOf(route.response))},
+				"default": map[string]interface{}{"description": "failed", "content": content(reflect.TypeOf(map[string]string{}))},
+			},
+		}
+		if route.request != nil {
+			op["requestBody"] = map[string]interface{}{"required": true, "content": content(reflect.TypeOf(route.request))}
+		}
+		var params []interface{}
+		for _, p := range route.params {
+			params = append(params, map[string]interface{}{"name": p.name, "in": "query", "required": p.required,
+				"description": p.doc, "schema": map[string]interface{}{"type": "string"}})
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+		if paths[route.path] == nil {
+			paths[route.path] = map[string]interface{}{}
+		}
+		paths[route.path].(map[string]interface{})[strings.ToLower(route.method)] = op
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    map[string]interface{}{"title": "8080emu", "version": "1"},
+		"paths":   paths,
+	}
+}
+
+// schemaOf returns the JSON schema of the values of t as encoding/json
+// writes them
+func schemaOf(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+	case reflect.Interface:
+		return map[string]interface{}{}
+	case reflect.Struct:
+		var props = map[string]interface{}{}
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			var f = t.Field(i)
+			var tag = strings.Split(f.Tag.Get("json"), ",")
+			if tag[0] == "" || tag[0] == "-" {
+				continue
+			}
+			var s = schemaOf(f.Type)
+			if doc := f.Tag.Get("doc"); doc != "" {
+				s["description"] = doc
+			}
+			props[tag[0]] = s
+			if len(tag) == 1 && f.Type.Kind() != reflect.Ptr {
+				required = append(required, tag[0])
+			}
+		}
+		var s = map[string]interface{}{"type": "object", "properties": props, "additionalProperties": false}
+		if required != nil {
+			sort.Strings(required)
+			s["required"] = required
+		}
+		return s
+	}
+	panic("no schema of " + t.String())
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// apiServer serves an Altair whose console echoes what it reads, the
+// program at 0 and the data at 1000H, under the symbols ECHO and COUNT
+func apiServer(t *testing.T) (*API, *httptest.Server) {
+	var r, _ = io.Pipe()
+	var term = NewTerminal(r, io.Discard, false)
+	var a = NewAltair(64, term)
+	a.CPU.Load(0, []byte{
+		0xdb, 0x10, // ECHO: IN 10H
+		0x0f,             // RRC
+		0xd2, 0x00, 0x00, // JNC ECHO
+		0xdb, 0x11, // IN 11H
+		0xd3, 0x11, // OUT 11H
+		0x21, 0x00, 0x10, // LXI H, COUNT
+		0x34,             // INR M
+		0xc3, 0x00, 0x00, // JMP ECHO
+	})
+	var d = NewDebugger(a.CPU, a.CPU.Step, 100)
+	d.Symbols.Add("ECHO", 0)
+	d.Symbols.Add("COUNT", 0x1000)
+	var api, err = NewAPI(d, &a.Snapshot, term)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var srv = httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	return api, srv
+}
+
+// call makes a request of srv, with the JSON of body if not nil, and
+// decodes the response in reply. It returns the status.
+func call(t *testing.T, srv *httptest.Server, method, path string, body, reply interface{}) int {
+	t.Helper()
+	var in io.Reader
+	if body != nil {
+		var b, err = json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		in = bytes.NewReader(b)
+	}
+	var req, err = http.NewRequest(method, srv.URL+path, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("%s %s: Content-Type %q", method, path, ct)
+	}
+	if reply != nil {
+		if err := json.NewDecoder(resp.Body).Decode(reply); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestAPI(t *testing.T) {
+	var _, srv = apiServer(t)
+	type obj = map[string]interface{}
+	var do = func(method, path string, body, reply interface{}) {
+		t.Helper()
+		if status := call(t, srv, method, path, body, reply); status != http.StatusOK {
+			t.Fatalf("%s %s: status %d", method, path, status)
+		}
+	}
+
+	var stop apiStop
+	do("POST", "/step", apiStep{Count: 3}, &stop)
+	if stop.Reason != "done" || stop.PC != 0 || stop.States != 24 {
+		t.Errorf("stepped to %+v, expected done at ECHO after 24 states", stop)
+	}
+
+	var bps []apiBreakpointSet
+	do("POST", "/breakpoints", apiBreakpoint{Addr: "ECHO+0dh", If: "B == 0"}, &bps)
+	if len(bps) != 1 || bps[0].Addr != 0x0d || bps[0].Name != "ECHO+13" || bps[0].If == "" {
+		t.Errorf("breakpoints %+v, expected one at 000d", bps)
+	}
+	var in apiInput
+	do("POST", "/input", apiText{"hi"}, &in)
+	if in.Pending != 0 {
+		t.Errorf("%d bytes pending, expected none", in.Pending)
+	}
+	do("POST", "/run", apiRun{}, &stop)
+	if stop.Reason != "breakpoint" || stop.PC != 0x0d || !strings.Contains(stop.Where, "INR") {
+		t.Errorf("ran to %+v, expected the breakpoint at 000d", stop)
+	}
+	do("DELETE", "/breakpoints?addr=d", nil, &bps)
+	if len(bps) != 0 {
+		t.Errorf("breakpoints %+v, expected none", bps)
+	}
+	do("POST", "/run", apiRun{Until: "[COUNT] == 2"}, &stop)
+	if stop.Reason != "until" || stop.Why != "until" || stop.PC != 0x0e {
+		t.Errorf("ran to %+v, expected until at 000e", stop)
+	}
+	var screen apiScreen
+	do("GET", "/screen?rows=2", nil, &screen)
+	if strings.Join(screen.Lines, "|") != "hi" {
+		t.Errorf("screen %q, expected hi echoed", screen.Lines)
+	}
+	var out apiText
+	do("GET", "/output", nil, &out)
+	if out.Text != "hi" {
+		t.Errorf("output %q, expected hi echoed", out.Text)
+	}
+	do("GET", "/output", nil, &out)
+	if out.Text != "" {
+		t.Errorf("output %q again, expected none", out.Text)
+	}
+	do("POST", "/run", apiRun{Steps: 1000}, &stop)
+	if stop.Reason != "done" || stop.PC > 5 {
+		t.Errorf("ran to %+v, expected done polling the console", stop)
+	}
+	do("POST", "/run", apiRun{Timeout: 20}, &stop)
+	if stop.Reason != "stopped" {
+		t.Errorf("ran to %+v, expected stopped by the timeout", stop)
+	}
+	do("POST", "/step", apiStep{Count: -2}, &stop)
+	if stop.Reason != "done" {
+		t.Errorf("stepped back to %+v", stop)
+	}
+
+	var mem apiMemory
+	do("GET", "/memory?addr=COUNT&len=2", nil, &mem)
+	if mem.Addr != 0x1000 || mem.Data != "0200" {
+		t.Errorf("memory %+v, expected 0200 at 1000", mem)
+	}
+	do("PUT", "/memory", apiWrite{Addr: "COUNT+1", Data: "abcd"}, &mem)
+	do("GET", "/memory?addr=1000&len=3", nil, &mem)
+	if mem.Data != "02abcd" {
+		t.Errorf("memory %+v, expected 02abcd at 1000", mem)
+	}
+
+	var regs obj
+	do("PUT", "/registers", obj{"a": 0x12, "f": 0xd7, "pc": 0x0a, "ie": true}, &regs)
+	do("GET", "/registers", nil, &regs)
+	var expected = obj{"a": 0x12, "f": 0xd7, "h": 0x10, "pc": 0x0a, "ie": true, "halted": false}
+	for name, v := range expected {
+		if f, ok := regs[name].(float64); ok && f != float64(v.(int)) || !ok && regs[name] != v {
+			t.Errorf("%s = %v, expected %v", name, regs[name], v)
+		}
+	}
+
+	do("POST", "/load", apiWrite{Addr: "2000", Data: "76"}, &regs)
+	do("POST", "/run", apiRun{Timeout: 50}, &stop)
+	do("GET", "/registers", nil, &regs)
+	if stop.Reason != "stopped" || regs["halted"] != true || regs["pc"] != float64(0x2001) {
+		t.Errorf("ran to %+v with %v, expected the HLT at 2000 waiting for an interrupt", stop, regs)
+	}
+
+	do("GET", "/screen", nil, &screen)
+	if strings.Join(screen.Lines, "|") != "hi" {
+		t.Errorf("screen %q after GET /output, expected hi still", screen.Lines)
+	}
+
+	do("POST", "/reset", nil, &regs)
+	do("GET", "/memory?addr=1000&len=3", nil, &mem)
+	do("GET", "/screen", nil, &screen)
+	if regs["pc"] != float64(0) || regs["states"] != float64(0) || mem.Data != "000000" || len(screen.Lines) != 0 {
+		t.Errorf("reset to %v, %+v and screen %q, expected the machine as it started", regs, mem, screen.Lines)
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	var _, srv = apiServer(t)
+	var tests = []struct {
+		method, path string
+		body         interface{}
+		status       int
+	}{
+		{"GET", "/nowhere", nil, 404},
+		{"PATCH", "/registers", nil, 405},
+		{"GET", "/memory?addr=NOWHERE", nil, 400},
+		{"GET", "/memory?addr=0&len=-1", nil, 400},
+		{"PUT", "/memory", apiWrite{Addr: "0", Data: "xyz"}, 400},
+		{"PUT", "/registers", map[string]int{"q": 1}, 400},
+		{"PUT", "/registers", map[string]int{"a": 256}, 400},
+		{"POST", "/run", apiRun{Until: "A =="}, 400},
+		{"GET", "/screen?rows=x", nil, 400},
+		{"DELETE", "/breakpoints?addr=0", nil, 404},
+	}
+	for _, test := range tests {
+		var reply map[string]string
+		if status := call(t, srv, test.method, test.path, test.body, &reply); status != test.status || reply["error"] == "" {
+			t.Errorf("%s %s: %d %v, expected %d and an error", test.method, test.path, status, reply, test.status)
+		}
+	}
+}
+
+func TestAPISchema(t *testing.T) {
+	var _, srv = apiServer(t)
+	var schema struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]map[string]struct {
+			RequestBody *struct {
+				Content map[string]struct {
+					Schema map[string]interface{}
+				}
+			} `json:"requestBody"`
+			Parameters []map[string]interface{}
+		}
+	}
+	call(t, srv, "GET", "/schema", nil, &schema)
+	if schema.OpenAPI == "" {
+		t.Errorf("no openapi version")
+	}
+	for _, route := range apiRoutes {
+		var op, ok = schema.Paths[route.path][strings.ToLower(route.method)]
+		if !ok {
+			t.Errorf("%s %s is not in the schema", route.method, route.path)
+			continue
+		}
+		if (op.RequestBody != nil) != (route.request != nil) || len(op.Parameters) != len(route.params) {
+			t.Errorf("%s %s: body %v, parameters %v", route.method, route.path, op.RequestBody, op.Parameters)
+		}
+	}
+	var run = schema.Paths["/run"]["post"].RequestBody.Content["application/json"].Schema
+	var props, _ = run["properties"].(map[string]interface{})
+	var until, _ = props["until"].(map[string]interface{})
+	if run["type"] != "object" || until["type"] != "string" || until["description"] == nil || run["required"] != nil {
+		t.Errorf("the body of POST /run is %v", run)
+	}
+}
+
+func TestAPIStop(t *testing.T) {
+	var api, srv = apiServer(t)
+	var stopped = make(chan apiStop)
+	go func() {
+		var stop apiStop
+		call(t, srv, "POST", "/run", apiRun{}, &stop)
+		stopped <- stop
+	}()
+	time.Sleep(50 * time.Millisecond)
+	var start = time.Now()
+	call(t, srv, "POST", "/stop", nil, nil)
+	if stop := <-stopped; stop.Reason != "stopped" || time.Since(start) > time.Second {
+		t.Errorf("ran to %+v %v after the stop", stop, time.Since(start))
+	}
+
+	call(t, srv, "POST", "/quit", nil, nil)
+	select {
+	case <-api.Done():
+	default:
+		t.Errorf("not done after POST /quit")
+	}
+}
+
+func TestAPIScreen(t *testing.T) {
+	var api, srv = apiServer(t)
+	apiOutput{api}.Write([]byte("one\r\ntwo\r\nthree\r\n"))
+	var tests = []struct {
+		path string
+		exp  string
+	}{
+		{"/screen", "one|two|three|"},
+		{"/screen?rows=2", "three|"},
+		{"/screen?rows=0", ""},
+	}
+	for _, test := range tests {
+		var screen apiScreen
+		call(t, srv, "GET", test.path, nil, &screen)
+		if strings.Join(screen.Lines, "|") != test.exp {
+			t.Errorf("GET %s: %q, expected %q", test.path, screen.Lines, test.exp)
+		}
+	}
+}
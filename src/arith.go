@@ -1,18 +1,27 @@
 package main
 
 func (s *State) add(x byte) {
+	s.addWithCarry(x, 0)
+}
+
+func (s *State) addCy(x byte) {
+	s.addWithCarry(x, s.carry())
+}
+
+func (s *State) addWithCarry(x, cy byte) {
 	// I do the math with 8 bits more, to capture the carry
-	var result uint16 = uint16(s.regA) + uint16(x)
+	var result uint16 = uint16(s.regA) + uint16(x) + uint16(cy)
+	s.flags.SetValue(FlagAc, (s.regA&0xf)+(x&0xf)+cy > 0xf)
 	s.setFlags(result)
 	s.regA = byte(result)
 }
 
-func (s *State) addCy(x byte) {
-	var cy byte
+// carry returns the Carry flag as a number
+func (s *State) carry() byte {
 	if s.flags.IsSet(FlagCy) {
-		cy = 1
+		return 1
 	}
-	s.add(x + cy)
+	return 0
 }
 
 // dad performs the DAD instruction
@@ -28,6 +37,7 @@ func (s *State) dad(x uint16) {
 func (s *State) inc(x *byte) {
 	*x = *x + 1
 	s.setFlagsNoCy(*x)
+	s.flags.SetValue(FlagAc, *x&0xf == 0)
 }
 
 func (s *State) inx(x, y *byte) {
@@ -39,6 +49,7 @@ func (s *State) inx(x, y *byte) {
 func (s *State) dec(x *byte) {
 	*x = *x - 1
 	s.setFlagsNoCy(*x)
+	s.flags.SetValue(FlagAc, *x&0xf != 0xf)
 }
 
 func (s *State) dcx(x, y *byte) {
@@ -48,18 +59,39 @@ func (s *State) dcx(x, y *byte) {
 }
 
 func (s *State) sub(x byte) {
-	var result uint16 = uint16(s.regA) - uint16(x)
-	s.setFlags(result)
-	s.regA = byte(result)
+	s.regA = s.subtract(x, 0)
 }
 
 func (s *State) subCy(x byte) {
-	var cy byte
-	if s.flags.IsSet(FlagCy) {
-		cy = 1
+	s.regA = s.subtract(x, s.carry())
+}
+
+// subtract returns regA - x - cy and sets the flags. The 8080 adds the
+// complement of x, so Aux carry is set when the low nibble does not borrow.
+func (s *State) subtract(x, cy byte) byte {
+	var result uint16 = uint16(s.regA) - uint16(x) - uint16(cy)
+	s.flags.SetValue(FlagAc, (s.regA&0xf)+(^x&0xf)+(1-cy) > 0xf)
+	s.setFlags(result)
+	return byte(result)
+}
+
+// daa adjusts A to two BCD digits after an addition
+func (s *State) daa() {
+	var a = s.regA
+	var correction byte
+	var cy = s.flags.IsSet(FlagCy)
+	if a&0xf > 9 || s.flags.IsSet(FlagAc) {
+		correction |= 0x06
 	}
-	// a + because inside `sub`, it will be regA - (x + cy) = regA - x - cy
-	s.sub(x + cy)
+	if a>>4 > 9 || cy || a>>4 >= 9 && a&0xf > 9 {
+		correction |= 0x60
+		cy = true
+	}
+
+	s.flags.SetValue(FlagAc, (a&0xf)+(correction&0xf) > 0xf)
+	s.regA = a + correction
+	s.setFlagsNoCy(s.regA)
+	s.flags.SetValue(FlagCy, cy)
 }
 
 func (s *State) setFlags(result uint16) {
@@ -15,11 +15,11 @@ func TestArithmetic(t *testing.T) {
 		},
 		Pair{ // INR B ... does not affect Cy
 			State{regB: 0xff, pc: 0, mem: [65536]byte{0x04}},
-			State{regB: 0x00, pc: 1, mem: [65536]byte{0x04}, flags: 0b00000101},
+			State{regB: 0x00, pc: 1, mem: [65536]byte{0x04}, flags: 0b00010101},
 		},
 		Pair{ // DCR B
 			State{regB: 0x01, pc: 0, mem: [65536]byte{0x05}},
-			State{regB: 0x00, pc: 1, mem: [65536]byte{0x05}, flags: 0b00000101},
+			State{regB: 0x00, pc: 1, mem: [65536]byte{0x05}, flags: 0b00010101},
 		},
 		Pair{ // DAD B
 			State{regB: 0x0f, regC: 0x0f, regH: 0x00, regL: 0x01, pc: 0, mem: [65536]byte{0x09}},
@@ -59,7 +59,7 @@ func TestArithmetic(t *testing.T) {
 		},
 		Pair{ // ADD C ... 1 + (-1) -> Carry + Parity + Zero
 			State{regA: 1, regC: 0b11111111, pc: 0, mem: [65536]byte{0x81}},
-			State{regA: 0, regC: 0b11111111, pc: 1, mem: [65536]byte{0x81}, flags: 0b00001101},
+			State{regA: 0, regC: 0b11111111, pc: 1, mem: [65536]byte{0x81}, flags: 0b00011101},
 		},
 		Pair{ // ADD D ... 0 + (-2) -> Sign. No Parity
 			State{regA: 0, regD: 0b11111110, pc: 0, mem: [65536]byte{0x82}},
@@ -83,7 +83,7 @@ func TestArithmetic(t *testing.T) {
 		},
 		Pair{ // SUB B regA - regB = 1 - 1 = 0
 			State{regA: 1, regB: 1, pc: 0, mem: [65536]byte{0x90}},
-			State{regA: 0, regB: 1, pc: 1, mem: [65536]byte{0x90}, flags: 0b00000101},
+			State{regA: 0, regB: 1, pc: 1, mem: [65536]byte{0x90}, flags: 0b00010101},
 		},
 		Pair{ // SUB C regA - regC = 1 - 2 = -1 = 0b11111111
 			State{regA: 1, regC: 2, pc: 0, mem: [65536]byte{0x91}},
@@ -95,11 +95,11 @@ func TestArithmetic(t *testing.T) {
 		},
 		Pair{ // SBB C regA - regC - Cy = 1 - 0 - 1 = 0
 			State{regA: 1, regC: 0, pc: 0, mem: [65536]byte{0x99}, flags: 0b00001000},
-			State{regA: 0, regC: 0, pc: 1, mem: [65536]byte{0x99}, flags: 0b00000101},
+			State{regA: 0, regC: 0, pc: 1, mem: [65536]byte{0x99}, flags: 0b00010101},
 		},
 		Pair{ // SBB A regA - regA - Cy = 1 - 1 - 0 = 0
 			State{regA: 1, pc: 0, mem: [65536]byte{0x9f}, flags: 0b00000000},
-			State{regA: 0, pc: 1, mem: [65536]byte{0x9f}, flags: 0b00000101},
+			State{regA: 0, pc: 1, mem: [65536]byte{0x9f}, flags: 0b00010101},
 		},
 		Pair{ // ADI D8
 			State{regA: 1, pc: 0, mem: [65536]byte{0xC6, 2}},
@@ -118,41 +118,5 @@ func TestArithmetic(t *testing.T) {
 			State{regA: 0xfe, pc: 2, mem: [65536]byte{0xde, 2}, flags: 0b00001010},
 		},
 	}
-	for _, test := range table {
-		var env = test.init
-		var opcode = env.mem[0]
-		env.ExecInstruction()
-		if env.regA != test.exp.regA {
-			t.Errorf("[0x%02x] env.regA = %v, expected %v", opcode, env.regA, test.exp.regA)
-		}
-		if env.regB != test.exp.regB {
-			t.Errorf("[0x%02x] env.regB = %v, expected %v", opcode, env.regB, test.exp.regB)
-		}
-		if env.regC != test.exp.regC {
-			t.Errorf("[0x%02x] env.regC = %v, expected %v", opcode, env.regC, test.exp.regC)
-		}
-		if env.regD != test.exp.regD {
-			t.Errorf("[0x%02x] env.regD = %v, expected %v", opcode, env.regD, test.exp.regD)
-		}
-		if env.regE != test.exp.regE {
-			t.Errorf("[0x%02x] env.regE = %v, expected %v", opcode, env.regE, test.exp.regE)
-		}
-		if env.regH != test.exp.regH {
-			t.Errorf("[0x%02x] env.regH = %v, expected %v", opcode, env.regH, test.exp.regH)
-		}
-		if env.regL != test.exp.regL {
-			t.Errorf("[0x%02x] env.regL = %v, expected %v", opcode, env.regL, test.exp.regL)
-		}
-		if env.pc != test.exp.pc {
-			t.Errorf("[0x%02x] env.pc = %v, expected %v", opcode, env.pc, test.exp.pc)
-		}
-		for i := 0; i < len(env.mem); i++ {
-			if env.mem[i] != test.exp.mem[i] {
-				t.Errorf("[0x%02x] env.mem[%d] = 0x%02x, expected 0x%02x", opcode, i, env.mem[i], test.exp.mem[i])
-			}
-		}
-		if env.flags != test.exp.flags {
-			t.Errorf("[0x%02x] env.flags = %.8b, expected %.8b", opcode, env.flags, test.exp.flags)
-		}
-	}
+	doTest(t, table)
 }
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// The entries of the CP/M 2.2 BIOS jump table
+const (
+	biosBoot = iota
+	biosWBoot
+	biosConst
+	biosConin
+	biosConout
+	biosList
+	biosPunch
+	biosReader
+	biosHome
+	biosSelDsk
+	biosSetTrk
+	biosSetSec
+	biosSetDMA
+	biosRead
+	biosWrite
+	biosListSt
+	biosSecTran
+	biosEntries
+)
+
+// The CCP and the BDOS sit right below the BIOS, loaded at boot from the
+// system tracks of drive A: from the second sector of track 0 on, the
+// first one holding the loader of the real machine.
+const (
+	ccpSize    = 0x800
+	bdosSize   = 0xe00
+	systemSize = ccpSize + bdosSize
+)
+
+// cpmDrives is the number of drives, A: to P:
+const cpmDrives = 16
+
+// Where the tables of the BIOS are, from its base
+const (
+	biosDPB    = 0x040             // the disk parameter block of all the drives
+	biosXLT    = 0x050             // the sector skew table
+	biosDirBuf = 0x080             // the directory buffer of the BDOS
+	biosDPH    = 0x100             // the disk parameter headers, 16 bytes each
+	biosALV    = 0x200             // the allocation vectors, 32 bytes each
+	biosCSV    = 0x400             // the check vectors, 16 bytes each
+	biosSize   = biosCSV + 16*0x10 // the size of the BIOS
+)
+
+// BIOS is a CP/M 2.2 BIOS written in Go. The CPU traps at the entries of
+// its jump table at Base, which the CCP and the BDOS call, and the BIOS does
+// the work with the console, the printer and the disks. Its disk parameter
+// headers and the buffers of the BDOS are in memory after the jump table.
+type BIOS struct {
+	Base    uint16
+	Console Line
+	List    io.Writer // the printer, or nil
+	System  []byte    // the CCP and the BDOS, read from drive A when nil
+
+	cpu    *State
+	disks  [cpmDrives]*Disk
+	hosts  [cpmDrives]*HostDrive
+	host   hostState
+	disk   int
+	track  uint16
+	sector uint16
+	dma    uint16
+	err    error
+}
+
+// NewBIOS puts a BIOS at base in the memory of cpu
+func NewBIOS(cpu *State, base uint16, console Line) (*BIOS, error) {
+	if int(base) < systemSize+0x100 || int(base)+biosSize > 0x10000 {
+		return nil, fmt.Errorf("the BIOS can not be at %04X", base)
+	}
+	var b = &BIOS{Base: base, Console: console, cpu: cpu}
+
+	var handlers = [biosEntries]func(){
+		b.boot, b.wboot, b.conSt, b.conIn, b.conOut, b.list, b.punch, b.reader,
+		b.home, b.selDsk, b.setTrk, b.setSec, b.setDMA, b.read, b.write, b.listSt, b.secTran,
+	}
+	for i, f := range handlers {
+		// each entry jumps to itself, for the programs that look at the table
+		var entry = base + uint16(3*i)
+		cpu.Load(entry, []byte{0xc3, byte(entry), byte(entry >> 8)}) // JMP entry
+		cpu.Trap(entry, f)
+	}
+
+	cpu.Load(base+biosDPB, ibm3740.bytes())
+	cpu.Load(base+biosXLT, ibm3740Skew)
+	return b, nil
+}
+
+// CCP returns the address of the CCP. The BDOS is ccpSize bytes above.
+func (b *BIOS) CCP() uint16 {
+	return b.Base - systemSize
+}
+
+// Mount puts the disk image at path in drive, 0 for A:, or mounts the
+// directory at path as a host drive
+func (b *BIOS) Mount(drive int, path string) error {
+	if drive < 0 || drive >= cpmDrives {
+		return fmt.Errorf("no drive %c:", 'A'+drive)
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return b.MountDir(drive, path)
+	}
+	var d, err = OpenDisk(path)
+	if err != nil {
+		return err
+	}
+	b.MountDisk(drive, d)
+	return nil
+}
+
+// MountDisk puts d in drive, 0 for A:, and makes its disk parameter header
+func (b *BIOS) MountDisk(drive int, d *Disk) {
+	b.disks[drive], b.hosts[drive] = d, nil
+
+	var dph = b.dph(drive)
+	var words = []uint16{
+		b.Base + biosXLT, 0, 0, 0, b.Base + biosDirBuf, b.Base + biosDPB,
+		b.Base + biosCSV + uint16(16*drive), b.Base + biosALV + uint16(32*drive),
+	}
+	for i, w := range words {
+		b.cpu.write16(dph+uint16(2*i), w)
+	}
+}
+
+// dph is the address of the disk parameter header of drive
+func (b *BIOS) dph(drive int) uint16 {
+	return b.Base + biosDPH + uint16(16*drive)
+}
+
+// Err tells why the CPU stopped at a boot that failed
+func (b *BIOS) Err() error {
+	return b.err
+}
+
+// boot is the cold boot: it loads the system and starts the CCP on drive A:
+func (b *BIOS) boot() {
+	b.cpu.write(0x0003, 0) // IOBYTE
+	b.cpu.write(0x0004, 0) // user 0, drive A:
+	b.start(b.CCP())
+}
+
+// wboot is the warm boot, back to the CCP when a program ends. The CCP
+// keeps the current drive and user.
+func (b *BIOS) wboot() {
+	b.start(b.CCP() + 3)
+}
+
+// start loads the CCP and the BDOS, sets up page zero and jumps to the
+// CCP at entry with the current drive in C. It halts the CPU when the
+// system can not be loaded.
+func (b *BIOS) start(entry uint16) {
+	var s = b.cpu
+	if err := b.loadSystem(); err != nil {
+		b.err = err
+		s.intEnable, s.halted = 0, true
+		return
+	}
+
+	var bdos = b.CCP() + ccpSize
+	s.Load(0x0000, []byte{0xc3, byte(b.Base + 3), byte((b.Base + 3) >> 8)}) // JMP WBOOT
+	s.Load(0x0005, []byte{0xc3, byte(bdos + 6), byte((bdos + 6) >> 8)})     // JMP BDOS
+	b.dma = 0x80
+	b.host.dma = 0x80
+
+	var drive = s.read(0x0004)
+	if b.disks[drive&0x0f] == nil && b.hosts[drive&0x0f] == nil {
+		drive &^= 0x0f
+		s.write(0x0004, drive)
+	}
+	s.regC = drive
+	s.sp = b.CCP()
+	s.pc = entry
+}
+
+// loadSystem copies the CCP and the BDOS below the BIOS
+func (b *BIOS) loadSystem() error {
+	var system = b.System
+	if system == nil {
+		var d = b.disks[0]
+		if d == nil {
+			return errors.New("no disk in drive A: to boot from")
+		}
+		system = make([]byte, systemSize)
+		var track, sector = 0, 2
+		for i := 0; i < systemSize; i += cpmSectorSize {
+			if err := d.ReadSector(track, sector, system[i:]); err != nil {
+				return fmt.Errorf("reading the system from A: %v", err)
+			}
+			if sector++; sector > int(ibm3740.spt) {
+				track, sector = track+1, 1
+			}
+		}
+	}
+	if len(system) > systemSize {
+		return fmt.Errorf("the system is %d bytes, more than %d", len(system), systemSize)
+	}
+	b.cpu.Load(b.CCP(), system)
+	return nil
+}
+
+func (b *BIOS) conSt() {
+	b.cpu.regA = 0
+	if b.Console.Ready() {
+		b.cpu.regA = 0xff
+	}
+	b.cpu.ret()
+}
+
+// conIn waits for a key
+func (b *BIOS) conIn() {
+	if b.Console.Ready() {
+		b.cpu.regA = b.Console.Read() & 0x7f
+		b.cpu.ret()
+	}
+}
+
+func (b *BIOS) conOut() {
+	b.Console.Write(b.cpu.regC & 0x7f)
+	b.cpu.ret()
+}
+
+func (b *BIOS) list() {
+	if b.List != nil {
+		b.List.Write([]byte{b.cpu.regC})
+	}
+	b.cpu.ret()
+}
+
+// punch drops what it is given: there is no punch
+func (b *BIOS) punch() {
+	b.cpu.ret()
+}
+
+// reader reads the end of file: there is no reader
+func (b *BIOS) reader() {
+	b.cpu.regA = 0x1a
+	b.cpu.ret()
+}
+
+func (b *BIOS) listSt() {
+	b.cpu.regA = 0xff
+	b.cpu.ret()
+}
+
+func (b *BIOS) home() {
+	b.track = 0
+	b.cpu.ret()
+}
+
+// selDsk selects the drive in C and returns its disk parameter header in
+// HL, or 0 when the drive is empty
+func (b *BIOS) selDsk() {
+	var s = b.cpu
+	var drive = int(s.regC)
+	s.regH, s.regL = 0, 0
+	if drive < cpmDrives && b.disks[drive] != nil {
+		b.disk = drive
+		var dph = b.dph(drive)
+		s.regH, s.regL = byte(dph>>8), byte(dph)
+	}
+	s.ret()
+}
+
+func (b *BIOS) setTrk() {
+	b.track = pairTo16(b.cpu.regB, b.cpu.regC)
+	b.cpu.ret()
+}
+
+func (b *BIOS) setSec() {
+	b.sector = pairTo16(b.cpu.regB, b.cpu.regC)
+	b.cpu.ret()
+}
+
+func (b *BIOS) setDMA() {
+	b.dma = pairTo16(b.cpu.regB, b.cpu.regC)
+	b.cpu.ret()
+}
+
+// read reads the sector to the DMA address and returns 0 in A, or 1 on
+// an error
+func (b *BIOS) read() {
+	var s = b.cpu
+	var buf [cpmSectorSize]byte
+	s.regA = 1
+	if d := b.disks[b.disk]; d != nil && d.ReadSector(int(b.track), int(b.sector), buf[:]) == nil {
+		for i, v := range buf {
+			s.write(b.dma+uint16(i), v)
+		}
+		s.regA = 0
+	}
+	s.ret()
+}
+
+// write writes the sector from the DMA address and returns 0 in A, or 1
+// on an error. Every write goes straight to the image, whatever C says.
+func (b *BIOS) write() {
+	var s = b.cpu
+	var buf [cpmSectorSize]byte
+	for i := range buf {
+		buf[i] = s.read(b.dma + uint16(i))
+	}
+	s.regA = 1
+	if d := b.disks[b.disk]; d != nil && d.WriteSector(int(b.track), int(b.sector), buf[:]) == nil {
+		s.regA = 0
+	}
+	s.ret()
+}
+
+// secTran returns in HL the physical sector of the logical sector BC,
+// counted from 0, through the table at DE. Without a table sectors are
+// counted from 1.
+func (b *BIOS) secTran() {
+	var s = b.cpu
+	var sector = pairTo16(s.regB, s.regC)
+	var table = pairTo16(s.regD, s.regE)
+	var phys = sector + 1
+	if table != 0 {
+		phys = uint16(s.read(table + sector))
+	}
+	s.regH, s.regL = byte(phys>>8), byte(phys)
+	s.ret()
+}
+
+// SaveState saves the disk, track, sector and DMA address set by the
+// calls, and the state of the BDOS calls on host drives
+func (b *BIOS) SaveState(e *Encoder) {
+	e.Int(b.disk)
+	e.Uint16(b.track)
+	e.Uint16(b.sector)
+	e.Uint16(b.dma)
+	e.Int(b.host.drive)
+	e.Int(b.host.user)
+	e.Uint16(b.host.dma)
+	e.Bool(b.host.search)
+	e.Int(len(b.host.found))
+	for _, entry := range b.host.found {
+		e.Bytes(entry[:])
+	}
+}
+
+func (b *BIOS) LoadState(d *Decoder) {
+	b.disk = d.Int()
+	b.track = d.Uint16()
+	b.sector = d.Uint16()
+	b.dma = d.Uint16()
+	b.host.drive = d.Int()
+	b.host.user = d.Int()
+	b.host.dma = d.Uint16()
+	b.host.search = d.Bool()
+	b.host.opened = nil
+	var n = d.Int()
+	if n < 0 || n > 0xffff || d.Err() != nil {
+		d.Fail(errors.New("bad directory entries"))
+		return
+	}
+	b.host.found = make([][32]byte, n)
+	for i := range b.host.found {
+		d.Bytes(b.host.found[i][:])
+	}
+	if b.disk < 0 || b.disk >= cpmDrives || b.host.drive < 0 || b.host.drive >= cpmDrives {
+		d.Fail(errors.New("bad drive"))
+	}
+}
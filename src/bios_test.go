@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"8080emu/asm"
+)
+
+// bootDisk returns an IBM 3740 image with system on its system tracks and a
+// directory entry for FILE.TXT
+func bootDisk(t *testing.T, system []byte) *growImage {
+	var image = &growImage{data: bytes.Repeat([]byte{0xe5}, 77*26*128)}
+	copy(image.data[cpmSectorSize:], system)
+	copy(image.data[2*26*cpmSectorSize:], append([]byte{0}, "FILE    TXT"...))
+	return image
+}
+
+func TestBoot(t *testing.T) {
+	var prog, err = asm.AssembleFile("testdata/cpmsys.asm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var _, system = prog.Binary()
+	var image = bootDisk(t, system)
+
+	var line = &bufLine{}
+	cpm, err := NewCPM(0xfa00, line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpm.BIOS.MountDisk(0, NewDisk(image, int64(len(image.data)), false))
+	cpm.Boot()
+	cpm.Run(func() bool { return cpm.CPU.Cycles() > 1000000 })
+
+	if err := cpm.BIOS.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if string(line.out) != "CFILE    TXTW" {
+		t.Errorf("printed %q, expected %q", line.out, "CFILE    TXTW")
+	}
+
+	// the second logical sector of the directory is the physical sector 7
+	var dir = 2 * 26 * cpmSectorSize
+	if !bytes.Equal(image.data[dir+6*cpmSectorSize:dir+7*cpmSectorSize], image.data[dir:dir+cpmSectorSize]) {
+		t.Errorf("the directory sector was not written to the second one")
+	}
+
+	var page0 = []byte{0xc3, 0x03, 0xfa, 0x00, 0x00, 0xc3, 0x06, 0xec}
+	if got := cpm.CPU.mem[:8]; !bytes.Equal(got, page0) {
+		t.Errorf("page zero is % x, expected % x", got, page0)
+	}
+}
+
+func TestBootErrors(t *testing.T) {
+	var cpm, err = NewCPM(0xfa00, &bufLine{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpm.Boot()
+	cpm.Run(func() bool { return true })
+	if cpm.BIOS.Err() == nil || !cpm.CPU.Halted() {
+		t.Errorf("booted without a disk")
+	}
+
+	cpm.BIOS.System = make([]byte, systemSize+1)
+	cpm.Boot()
+	cpm.Run(func() bool { return true })
+	if cpm.BIOS.Err() == nil {
+		t.Errorf("booted a system too big")
+	}
+
+	for _, base := range []uint16{0x1000, 0xfc00} {
+		if _, err := NewCPM(base, &bufLine{}); err == nil {
+			t.Errorf("put the BIOS at %04x", base)
+		}
+	}
+}
+
+// biosCall runs the BIOS entry fn with bc and de and returns A and HL
+func biosCall(c *CPM, fn int, bc, de uint16) (byte, uint16) {
+	var s = c.CPU
+	s.regB, s.regC, s.regD, s.regE = byte(bc>>8), byte(bc), byte(de>>8), byte(de)
+	s.sp = 0x100
+	s.push(0x1234)
+	s.pc = c.BIOS.Base + uint16(3*fn)
+	s.Step()
+	if s.pc != 0x1234 {
+		return 0xee, 0xeeee
+	}
+	return s.regA, pairTo16(s.regH, s.regL)
+}
+
+func TestBIOS(t *testing.T) {
+	var line = &bufLine{in: "x"}
+	var cpm, err = NewCPM(0xe000, line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list bytes.Buffer
+	cpm.BIOS.List = &list
+	var image = &growImage{}
+	cpm.BIOS.MountDisk(1, NewDisk(image, 0, false))
+
+	var table = []struct {
+		what   string
+		fn     int
+		bc, de uint16
+		a      byte
+		hl     uint16
+	}{
+		{"const", biosConst, 0, 0, 0xff, 5},
+		{"conin", biosConin, 0, 0, 'x', 5},
+		{"const empty", biosConst, 0, 0, 0, 5},
+		{"conout", biosConout, 'A', 0, 0xff, 5},
+		{"list", biosList, 'L', 0, 0xff, 5},
+		{"reader", biosReader, 0, 0, 0x1a, 5},
+		{"listst", biosListSt, 0, 0, 0xff, 5},
+		{"seldsk empty", biosSelDsk, 0, 0, 0xff, 0},
+		{"seldsk", biosSelDsk, 1, 0, 0xff, 0xe110},
+		{"seldsk P:", biosSelDsk, 15, 0, 0xff, 0},
+		{"sectran", biosSecTran, 1, 0xe050, 0xff, 7},
+		{"sectran last", biosSecTran, 25, 0xe050, 0xff, 22},
+		{"sectran no table", biosSecTran, 4, 0, 0xff, 5},
+		{"settrk", biosSetTrk, 3, 0, 0xff, 5},
+		{"setsec", biosSetSec, 2, 0, 0xff, 5},
+		{"setdma", biosSetDMA, 0x200, 0, 0xff, 5},
+		{"write", biosWrite, 0, 0, 0, 5},
+		{"setdma", biosSetDMA, 0x300, 0, 0xff, 5},
+		{"read", biosRead, 0, 0, 0, 5},
+		{"setsec bad", biosSetSec, 27, 0, 0xff, 5},
+		{"read bad", biosRead, 0, 0, 1, 5},
+		{"write bad", biosWrite, 0, 0, 1, 5},
+	}
+
+	for i := 0; i < cpmSectorSize; i++ {
+		cpm.CPU.mem[0x200+i] = byte(i)
+	}
+	for _, test := range table {
+		cpm.CPU.regA, cpm.CPU.regH, cpm.CPU.regL = 0xff, 0, 5
+		var a, hl = biosCall(cpm, test.fn, test.bc, test.de)
+		if a != test.a || hl != test.hl {
+			t.Errorf("%s: A = %02x, HL = %04x, expected %02x, %04x", test.what, a, hl, test.a, test.hl)
+		}
+	}
+
+	if string(line.out) != "A" || list.String() != "L" {
+		t.Errorf("printed %q on the console and %q on the printer", line.out, list.String())
+	}
+	if !bytes.Equal(cpm.CPU.mem[0x300:0x380], cpm.CPU.mem[0x200:0x280]) {
+		t.Errorf("did not read back the sector written")
+	}
+	if len(image.data) != (3*26+2)*cpmSectorSize {
+		t.Errorf("image of %d bytes after writing sector 2 of track 3", len(image.data))
+	}
+
+	// The DPH of B: points to the tables of the BIOS
+	var dph = []uint16{0xe050, 0, 0, 0, 0xe080, 0xe040, 0xe410, 0xe220}
+	for i, w := range dph {
+		if got := cpm.CPU.read16(0xe110 + uint16(2*i)); got != w {
+			t.Errorf("word %d of the DPH is %04x, expected %04x", i, got, w)
+		}
+	}
+
+	// CONIN waits at its entry for a key
+	var s = cpm.CPU
+	s.pc = cpm.BIOS.Base + 3*biosConin
+	s.Step()
+	if s.pc != cpm.BIOS.Base+3*biosConin {
+		t.Errorf("conin returned without a key")
+	}
+}
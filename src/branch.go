@@ -9,11 +9,12 @@ func (s *State) jmpOnFlag(f Flag, set bool) {
 }
 
 func (s *State) jmp() {
-	s.pc = pairTo16(s.mem[s.pc+1], s.mem[s.pc+2])
+	s.pc = s.read16(s.pc + 1)
 }
 
 func (s *State) callOnFlag(f Flag, set bool) {
 	if s.flags.IsSet(f) == set {
+		s.taken()
 		s.call()
 	} else {
 		s.pc += 3
@@ -21,28 +22,19 @@ func (s *State) callOnFlag(f Flag, set bool) {
 }
 
 func (s *State) call() {
-	var ret = s.pc + 3
-
-	// Push the return address into the stack. Stack goes "down"
-	s.mem[s.sp-1] = byte(ret >> 8)
-	s.mem[s.sp-2] = byte(ret)
-	s.sp += 2
-
+	// Push the return address into the stack
+	s.push(s.pc + 3)
 	s.jmp()
 }
 
 func (s *State) rst(addr uint16) {
-	var ret = s.pc + 3
-
-	s.mem[s.sp-1] = byte(ret >> 8)
-	s.mem[s.sp-2] = byte(ret)
-	s.sp += 2
-
+	s.push(s.pc + 1)
 	s.pc = addr
 }
 
 func (s *State) retOnFlag(f Flag, set bool) {
 	if s.flags.IsSet(f) == set {
+		s.taken()
 		s.ret()
 	} else {
 		s.pc += 1
@@ -50,6 +42,12 @@ func (s *State) retOnFlag(f Flag, set bool) {
 }
 
 func (s *State) ret() {
-	s.pc = pairTo16(s.mem[s.sp+1], s.mem[s.sp])
-	s.sp += 2
+	s.pc = s.pop()
+}
+
+// taken counts the states the conditional call or return at pc takes on
+// top of its Cycles when its condition holds
+func (s *State) taken() {
+	var op = s.opcode(s.pc)
+	s.cycles += uint64(op.CyclesTaken - op.Cycles)
 }
@@ -5,72 +5,72 @@ import "testing"
 func TestJump(t *testing.T) {
 	var table = []Pair{
 		Pair{ // JNZ addr when Z is set
-			State{pc: 0, mem: [65536]byte{0xc2, 0xff, 0xf0}, flags: 0b00000001},
-			State{pc: 3, mem: [65536]byte{0xc2, 0xff, 0xf0}, flags: 0b00000001},
+			State{pc: 0, mem: [65536]byte{0xc2, 0xf0, 0xff}, flags: 0b00000001},
+			State{pc: 3, mem: [65536]byte{0xc2, 0xf0, 0xff}, flags: 0b00000001},
 		},
 		Pair{ // JNZ addr when Z is not set
-			State{pc: 0, mem: [65536]byte{0xc3, 0xff, 0xf0}},
-			State{pc: 0xfff0, mem: [65536]byte{0xc3, 0xff, 0xf0}},
+			State{pc: 0, mem: [65536]byte{0xc3, 0xf0, 0xff}},
+			State{pc: 0xfff0, mem: [65536]byte{0xc3, 0xf0, 0xff}},
 		},
 		Pair{ // JMP addr
-			State{pc: 0, mem: [65536]byte{0xc3, 0xff, 0xf0}},
-			State{pc: 0xfff0, mem: [65536]byte{0xc3, 0xff, 0xf0}},
+			State{pc: 0, mem: [65536]byte{0xc3, 0xf0, 0xff}},
+			State{pc: 0xfff0, mem: [65536]byte{0xc3, 0xf0, 0xff}},
 		},
 		Pair{ // JZ addr when Z is set
-			State{pc: 0, mem: [65536]byte{0xca, 0xff, 0xf0}, flags: 0b00000001},
-			State{pc: 0xfff0, mem: [65536]byte{0xca, 0xff, 0xf0}, flags: 0b00000001},
+			State{pc: 0, mem: [65536]byte{0xca, 0xf0, 0xff}, flags: 0b00000001},
+			State{pc: 0xfff0, mem: [65536]byte{0xca, 0xf0, 0xff}, flags: 0b00000001},
 		},
 		Pair{ // JZ addr when Z is not set
-			State{pc: 0, mem: [65536]byte{0xca, 0xff, 0xf0}},
-			State{pc: 3, mem: [65536]byte{0xca, 0xff, 0xf0}},
+			State{pc: 0, mem: [65536]byte{0xca, 0xf0, 0xff}},
+			State{pc: 3, mem: [65536]byte{0xca, 0xf0, 0xff}},
 		},
 		Pair{ // JNC addr when Cy is set
-			State{pc: 0, mem: [65536]byte{0xd2, 0xff, 0xf0}, flags: 0b00001000},
-			State{pc: 3, mem: [65536]byte{0xd2, 0xff, 0xf0}, flags: 0b00001000},
+			State{pc: 0, mem: [65536]byte{0xd2, 0xf0, 0xff}, flags: 0b00001000},
+			State{pc: 3, mem: [65536]byte{0xd2, 0xf0, 0xff}, flags: 0b00001000},
 		},
 		Pair{ // JNC addr when Cy is not set
-			State{pc: 0, mem: [65536]byte{0xd2, 0xff, 0xf0}},
-			State{pc: 0xfff0, mem: [65536]byte{0xd2, 0xff, 0xf0}},
+			State{pc: 0, mem: [65536]byte{0xd2, 0xf0, 0xff}},
+			State{pc: 0xfff0, mem: [65536]byte{0xd2, 0xf0, 0xff}},
 		},
 		Pair{ // JC addr when Cy is set
-			State{pc: 0, mem: [65536]byte{0xda, 0xff, 0xf0}, flags: 0b00001000},
-			State{pc: 0xfff0, mem: [65536]byte{0xda, 0xff, 0xf0}, flags: 0b00001000},
+			State{pc: 0, mem: [65536]byte{0xda, 0xf0, 0xff}, flags: 0b00001000},
+			State{pc: 0xfff0, mem: [65536]byte{0xda, 0xf0, 0xff}, flags: 0b00001000},
 		},
 		Pair{ // JC addr when Cy is not set
-			State{pc: 0, mem: [65536]byte{0xda, 0xff, 0xf0}},
-			State{pc: 3, mem: [65536]byte{0xda, 0xff, 0xf0}},
+			State{pc: 0, mem: [65536]byte{0xda, 0xf0, 0xff}},
+			State{pc: 3, mem: [65536]byte{0xda, 0xf0, 0xff}},
 		},
 		Pair{ // JPO addr when P is set
-			State{pc: 0, mem: [65536]byte{0xe2, 0xff, 0xf0}, flags: 0b00000100},
-			State{pc: 3, mem: [65536]byte{0xe2, 0xff, 0xf0}, flags: 0b00000100},
+			State{pc: 0, mem: [65536]byte{0xe2, 0xf0, 0xff}, flags: 0b00000100},
+			State{pc: 3, mem: [65536]byte{0xe2, 0xf0, 0xff}, flags: 0b00000100},
 		},
 		Pair{ // JPO addr when P is not set
-			State{pc: 0, mem: [65536]byte{0xe2, 0xff, 0xf0}},
-			State{pc: 0xfff0, mem: [65536]byte{0xe2, 0xff, 0xf0}},
+			State{pc: 0, mem: [65536]byte{0xe2, 0xf0, 0xff}},
+			State{pc: 0xfff0, mem: [65536]byte{0xe2, 0xf0, 0xff}},
 		},
 		Pair{ // JPE addr when P is set
-			State{pc: 0, mem: [65536]byte{0xea, 0xff, 0xf0}, flags: 0b00000100},
-			State{pc: 0xfff0, mem: [65536]byte{0xea, 0xff, 0xf0}, flags: 0b00000100},
+			State{pc: 0, mem: [65536]byte{0xea, 0xf0, 0xff}, flags: 0b00000100},
+			State{pc: 0xfff0, mem: [65536]byte{0xea, 0xf0, 0xff}, flags: 0b00000100},
 		},
 		Pair{ // JPE addr when P is not set
-			State{pc: 0, mem: [65536]byte{0xea, 0xff, 0xf0}},
-			State{pc: 3, mem: [65536]byte{0xea, 0xff, 0xf0}},
+			State{pc: 0, mem: [65536]byte{0xea, 0xf0, 0xff}},
+			State{pc: 3, mem: [65536]byte{0xea, 0xf0, 0xff}},
 		},
 		Pair{ // JP addr when S is set
-			State{pc: 0, mem: [65536]byte{0xf2, 0xff, 0xf0}, flags: 0b00000010},
-			State{pc: 3, mem: [65536]byte{0xf2, 0xff, 0xf0}, flags: 0b00000010},
+			State{pc: 0, mem: [65536]byte{0xf2, 0xf0, 0xff}, flags: 0b00000010},
+			State{pc: 3, mem: [65536]byte{0xf2, 0xf0, 0xff}, flags: 0b00000010},
 		},
 		Pair{ // JP addr when S is not set
-			State{pc: 0, mem: [65536]byte{0xf2, 0xff, 0xf0}},
-			State{pc: 0xfff0, mem: [65536]byte{0xf2, 0xff, 0xf0}},
+			State{pc: 0, mem: [65536]byte{0xf2, 0xf0, 0xff}},
+			State{pc: 0xfff0, mem: [65536]byte{0xf2, 0xf0, 0xff}},
 		},
 		Pair{ // JM addr when S is set
-			State{pc: 0, mem: [65536]byte{0xfa, 0xff, 0xf0}, flags: 0b00000010},
-			State{pc: 0xfff0, mem: [65536]byte{0xfa, 0xff, 0xf0}, flags: 0b00000010},
+			State{pc: 0, mem: [65536]byte{0xfa, 0xf0, 0xff}, flags: 0b00000010},
+			State{pc: 0xfff0, mem: [65536]byte{0xfa, 0xf0, 0xff}, flags: 0b00000010},
 		},
 		Pair{ // JM addr when S is not set
-			State{pc: 0, mem: [65536]byte{0xfa, 0xff, 0xf0}},
-			State{pc: 3, mem: [65536]byte{0xfa, 0xff, 0xf0}},
+			State{pc: 0, mem: [65536]byte{0xfa, 0xf0, 0xff}},
+			State{pc: 3, mem: [65536]byte{0xfa, 0xf0, 0xff}},
 		},
 	}
 	doTest(t, table)
@@ -79,8 +79,8 @@ func TestJump(t *testing.T) {
 func TestCall(t *testing.T) {
 	var table = []Pair{
 		Pair{ // CALL addr
-			State{pc: 0, sp: 0xffff, mem: [65536]byte{0xcd, 0xff, 0xf0}},
-			State{pc: 0xfff0, sp: 0xfffd, mem: [65536]byte{0xcd, 0xff, 0xf0, 0xfffd: 3, 0xfffe: 0}},
+			State{pc: 0, sp: 0xffff, mem: [65536]byte{0xcd, 0xf0, 0xff}},
+			State{pc: 0xfff0, sp: 0xfffd, mem: [65536]byte{0xcd, 0xf0, 0xff, 0xfffd: 3, 0xfffe: 0}},
 		},
 		Pair{ // RET
 			State{pc: 0, sp: 0xfffd, mem: [65536]byte{0xc9, 0xfffd: 3, 0xfffe: 0}},
@@ -90,42 +90,61 @@ func TestCall(t *testing.T) {
 	doTest(t, table)
 }
 
+// engines run the instruction at pc: ExecInstruction and the threaded code
+var engines = []struct {
+	name string
+	exec func(s *State)
+}{
+	{"decoding", (*State).ExecInstruction},
+	{"threaded", func(s *State) {
+		s.UseThreadedCode()
+		s.code.exec(s)
+	}},
+}
+
 func doTest(t *testing.T, table []Pair) {
-	for _, test := range table {
-		var env = test.init
-		var opcode = env.mem[0]
-		env.ExecInstruction()
-		if env.regA != test.exp.regA {
-			t.Errorf("[0x%02x] env.regA = %v, expected %v", opcode, env.regA, test.exp.regA)
-		}
-		if env.regB != test.exp.regB {
-			t.Errorf("[0x%02x] env.regB = %v, expected %v", opcode, env.regB, test.exp.regB)
-		}
-		if env.regC != test.exp.regC {
-			t.Errorf("[0x%02x] env.regC = %v, expected %v", opcode, env.regC, test.exp.regC)
-		}
-		if env.regD != test.exp.regD {
-			t.Errorf("[0x%02x] env.regD = %v, expected %v", opcode, env.regD, test.exp.regD)
-		}
-		if env.regE != test.exp.regE {
-			t.Errorf("[0x%02x] env.regE = %v, expected %v", opcode, env.regE, test.exp.regE)
-		}
-		if env.regH != test.exp.regH {
-			t.Errorf("[0x%02x] env.regH = %v, expected %v", opcode, env.regH, test.exp.regH)
-		}
-		if env.regL != test.exp.regL {
-			t.Errorf("[0x%02x] env.regL = %v, expected %v", opcode, env.regL, test.exp.regL)
-		}
-		if env.pc != test.exp.pc {
-			t.Errorf("[0x%02x] env.pc = %v, expected %v", opcode, env.pc, test.exp.pc)
-		}
-		for i := 0; i < len(env.mem); i++ {
-			if env.mem[i] != test.exp.mem[i] {
-				t.Errorf("[0x%02x] env.mem[%d] = 0x%02x, expected 0x%02x", opcode, i, env.mem[i], test.exp.mem[i])
+	for _, engine := range engines {
+		t.Run(engine.name, func(t *testing.T) {
+			for _, test := range table {
+				var env = test.init
+				var opcode = env.mem[0]
+				engine.exec(&env)
+				if env.regA != test.exp.regA {
+					t.Errorf("[0x%02x] env.regA = %v, expected %v", opcode, env.regA, test.exp.regA)
+				}
+				if env.regB != test.exp.regB {
+					t.Errorf("[0x%02x] env.regB = %v, expected %v", opcode, env.regB, test.exp.regB)
+				}
+				if env.regC != test.exp.regC {
+					t.Errorf("[0x%02x] env.regC = %v, expected %v", opcode, env.regC, test.exp.regC)
+				}
+				if env.regD != test.exp.regD {
+					t.Errorf("[0x%02x] env.regD = %v, expected %v", opcode, env.regD, test.exp.regD)
+				}
+				if env.regE != test.exp.regE {
+					t.Errorf("[0x%02x] env.regE = %v, expected %v", opcode, env.regE, test.exp.regE)
+				}
+				if env.regH != test.exp.regH {
+					t.Errorf("[0x%02x] env.regH = %v, expected %v", opcode, env.regH, test.exp.regH)
+				}
+				if env.regL != test.exp.regL {
+					t.Errorf("[0x%02x] env.regL = %v, expected %v", opcode, env.regL, test.exp.regL)
+				}
+				if env.pc != test.exp.pc {
+					t.Errorf("[0x%02x] env.pc = %v, expected %v", opcode, env.pc, test.exp.pc)
+				}
+				if env.sp != test.exp.sp {
+					t.Errorf("[0x%02x] env.sp = %v, expected %v", opcode, env.sp, test.exp.sp)
+				}
+				for i := 0; i < len(env.mem); i++ {
+					if env.mem[i] != test.exp.mem[i] {
+						t.Errorf("[0x%02x] env.mem[%d] = 0x%02x, expected 0x%02x", opcode, i, env.mem[i], test.exp.mem[i])
+					}
+				}
+				if env.flags != test.exp.flags {
+					t.Errorf("[0x%02x] env.flags = %.8b, expected %.8b", opcode, env.flags, test.exp.flags)
+				}
 			}
-		}
-		if env.flags != test.exp.flags {
-			t.Errorf("[0x%02x] env.flags = %.8b, expected %.8b", opcode, env.flags, test.exp.flags)
-		}
+		})
 	}
 }
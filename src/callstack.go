@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+
+	"8080emu/isa"
+)
+
+// Frame is a routine seen entered and not yet returned from
+type Frame struct {
+	Kind   FrameKind
+	From   uint16 // the CALL or RST, or the instruction interrupted
+	To     uint16 // the routine
+	Return uint16 // the address it returns to
+	SP     uint16 // where the return address is on the stack
+
+	taken bool // the return address was popped
+}
+
+// FrameKind tells how a routine was entered
+type FrameKind int
+
+const (
+	FrameCall FrameKind = iota
+	FrameRST
+	FrameInterrupt
+)
+
+var frameKinds = []string{"call", "rst", "interrupt"}
+
+func (k FrameKind) String() string {
+	if int(k) < len(frameKinds) {
+		return frameKinds[k]
+	}
+	return fmt.Sprintf("FrameKind(%d)", k)
+}
+
+// callStack follows the routines entered by the steps of a CPU
+type callStack struct {
+	frames []Frame
+	save   func() // called before a step changes frames, or nil
+}
+
+// track follows the calls and the returns of the step that ran op at pc
+// with the stack at sp. A step that pushed the address of the next
+// instruction and jumped is a call, one that pushed pc an interrupt. A
+// routine returned when pc reaches its return address with the address off
+// the stack, and the routines it called returned with it. A routine that
+// popped its return address returns by the next jump, as with the POP H,
+// PCHL of the routines reading the bytes after their call. Stacks moved
+// with LXI SP or SPHL do not end routines.
+func (c *callStack) track(s *State, pc, sp uint16, op isa.Opcode) {
+	var top = len(c.frames) - 1
+	var next = pc + uint16(op.Size)
+	if s.pc == next || s.pc == pc && s.sp == sp {
+		if top >= 0 && s.sp > sp && s.sp-sp <= 2 && c.frames[top].SP >= sp && c.frames[top].SP < s.sp {
+			c.changing()
+			c.frames[top].taken = true
+		}
+		return
+	}
+
+	if s.sp == sp-2 {
+		var ret = pairTo16(s.peek(s.sp+1), s.peek(s.sp))
+		var f = Frame{From: pc, To: s.pc, Return: ret, SP: s.sp}
+		switch {
+		case ret == pc:
+			f.Kind = FrameInterrupt
+		case ret == next && op.Flow.IsCall() && op.Mnemonic == "RST":
+			f.Kind = FrameRST
+		case ret == next && op.Flow.IsCall():
+		default:
+			return
+		}
+		c.changing()
+		c.frames = append(c.frames, f)
+		return
+	}
+
+	for i := top; i >= 0; i-- {
+		if f := c.frames[i]; s.pc == f.Return && s.sp > f.SP {
+			c.changing()
+			c.frames = c.frames[:i]
+			return
+		}
+	}
+	for top >= 0 && c.frames[top].taken {
+		c.changing()
+		c.frames = c.frames[:top]
+		top--
+	}
+}
+
+func (c *callStack) changing() {
+	if c.save != nil {
+		c.save()
+	}
+}
+
+// save journals the frames before the step running changes them
+func (d *Debugger) save() {
+	if d.undo != nil && !d.undo.tracked {
+		d.undo.tracked = true
+		d.undo.frames = append(d.undo.frames[:0], d.calls.frames...)
+	}
+}
+
+// untrack undoes what track did in the step of u
+func (d *Debugger) untrack(u *undo) {
+	if u.tracked {
+		d.calls.frames = append(d.calls.frames[:0], u.frames...)
+	}
+}
+
+// Backtrace returns the routines entered, the last one first
+func (d *Debugger) Backtrace() []Frame {
+	var frames []Frame
+	for i := len(d.calls.frames) - 1; i >= 0; i-- {
+		frames = append(frames, d.calls.frames[i])
+	}
+	return frames
+}
+
+// StepOut runs until the last n routines entered return, as Run would
+// otherwise stop. It does not run when fewer were entered.
+func (d *Debugger) StepOut(n int, stop func() bool) Stop {
+	var depth = len(d.calls.frames) - n
+	if depth < 0 {
+		return d.stop(StopDone)
+	}
+	return d.run(-1, stop, func() bool { return len(d.calls.frames) <= depth })
+}
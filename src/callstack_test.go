@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// calling returns a debugger of routines calling each other in the ways
+// the call stack follows
+func calling(history int) *Debugger {
+	var cpu = &State{}
+	cpu.Load(0, []byte{
+		0x31, 0x00, 0x20, // LXI SP, 2000H
+		0xcd, 0x20, 0x00, // CALL ONE
+		0x76, // HLT
+	})
+	cpu.Load(0x20, []byte{
+		0xcd, 0x30, 0x00, // ONE: CALL TWO
+		0xc9, // RET
+	})
+	cpu.Load(0x30, []byte{
+		0xff,             // TWO: RST 7
+		0xcd, 0x40, 0x00, // CALL INLINE
+		'x', 0, // the bytes INLINE skips
+		0xe5, // PUSH H
+		0xc9, // RET to the address pushed
+	})
+	cpu.Load(0x38, []byte{
+		0xc9, // RST7: RET
+	})
+	cpu.Load(0x40, []byte{
+		0xe1,             // INLINE: POP H
+		0x23,             // INX H
+		0x23,             // INX H
+		0x21, 0x50, 0x00, // LXI H, JUMPED
+		0xe9, // PCHL
+	})
+	cpu.Load(0x50, []byte{
+		0xc3, 0x23, 0x00, // JUMPED: JMP ONE+3
+	})
+	var d = NewDebugger(cpu, cpu.Step, history)
+	for name, addr := range map[string]uint16{"ONE": 0x20, "TWO": 0x30, "RST7": 0x38, "INLINE": 0x40, "JUMPED": 0x50} {
+		d.Symbols.Add(name, addr)
+	}
+	return d
+}
+
+// frames returns the routines of the backtrace of d
+func frames(d *Debugger) []uint16 {
+	var to []uint16
+	for _, f := range d.Backtrace() {
+		to = append(to, f.To)
+	}
+	return to
+}
+
+func TestCallStack(t *testing.T) {
+	var d = calling(100)
+	var table = []struct {
+		pc     uint16   // after the step
+		frames []uint16 // the routines entered, the last one first
+	}{
+		{0x03, nil},
+		{0x20, []uint16{0x20}},
+		{0x30, []uint16{0x30, 0x20}},
+		{0x38, []uint16{0x38, 0x30, 0x20}},
+		{0x31, []uint16{0x30, 0x20}},
+		{0x40, []uint16{0x40, 0x30, 0x20}},
+		{0x41, []uint16{0x40, 0x30, 0x20}}, // POP H took the return address
+		{0x42, []uint16{0x40, 0x30, 0x20}},
+		{0x43, []uint16{0x40, 0x30, 0x20}},
+		{0x46, []uint16{0x40, 0x30, 0x20}},
+		{0x50, []uint16{0x30, 0x20}}, // PCHL left INLINE
+		{0x23, []uint16{0x30, 0x20}}, // the return address of TWO is still on the stack
+		{0x23, []uint16{0x20}},       // and RET takes it
+		{0x06, nil},
+	}
+	var kinds = []FrameKind{FrameRST, FrameCall, FrameCall}
+
+	for i, test := range table {
+		d.Step()
+		var got = frames(d)
+		if d.CPU.pc != test.pc || len(got) != len(test.frames) || len(got) > 0 && got[0] != test.frames[0] {
+			t.Fatalf("step %d: at %04x in %04x, expected at %04x in %04x", i, d.CPU.pc, got, test.pc, test.frames)
+		}
+		if i == 3 {
+			for j, f := range d.Backtrace() {
+				if f.Kind != kinds[j] {
+					t.Errorf("frame %d is a %v, expected a %v", j, f.Kind, kinds[j])
+				}
+			}
+		}
+	}
+
+	// and back
+	for i := len(table) - 2; i >= 0; i-- {
+		d.StepBack()
+		if got := frames(d); d.CPU.pc != table[i].pc || len(got) != len(table[i].frames) {
+			t.Fatalf("back to step %d: at %04x in %04x, expected at %04x in %04x", i, d.CPU.pc, got, table[i].pc, table[i].frames)
+		}
+	}
+}
+
+// interrupter interrupts once with RST 1
+type interrupter struct{ pending bool }
+
+func (i *interrupter) Pending() bool     { return i.pending }
+func (i *interrupter) Acknowledge() byte { i.pending = false; return 0xcf }
+
+func TestCallStackInterrupt(t *testing.T) {
+	var d = calling(0)
+	var intr = &interrupter{}
+	d.CPU.intr = intr
+	d.CPU.Load(0x08, []byte{0xc9}) // RET
+	d.CPU.intEnable = 1
+	d.Run(2, nil)
+	intr.pending = true
+	d.Step()
+	var bt = d.Backtrace()
+	if len(bt) != 2 || bt[0] != (Frame{Kind: FrameInterrupt, From: 0x20, To: 0x08, Return: 0x20, SP: 0x1ffc}) {
+		t.Fatalf("interrupted in %+v, expected an interrupt of ONE", bt)
+	}
+	d.Step()
+	if got := frames(d); d.CPU.pc != 0x20 || len(got) != 1 || got[0] != 0x20 {
+		t.Errorf("returned to %04x in %04x, expected to ONE", d.CPU.pc, got)
+	}
+}
+
+func TestStepOut(t *testing.T) {
+	var table = []struct {
+		steps  int
+		n      int
+		reason StopReason
+		pc     uint16
+	}{
+		{3, 1, StopReturn, 0x23},
+		{4, 1, StopReturn, 0x31},
+		{4, 2, StopReturn, 0x23},
+		{4, 3, StopReturn, 0x06},
+		{4, 4, StopDone, 0x38},
+		{1, 1, StopDone, 0x03},
+	}
+
+	for _, test := range table {
+		var d = calling(0)
+		d.Run(test.steps, nil)
+		if stop := d.StepOut(test.n, nil); stop.Reason != test.reason || stop.PC != test.pc {
+			t.Errorf("out of %d after %d steps: %v at %04x, expected %v at %04x",
+				test.n, test.steps, stop.Reason, stop.PC, test.reason, test.pc)
+		}
+	}
+}
+
+func TestREPLBacktrace(t *testing.T) {
+	var d = calling(100)
+	var out bytes.Buffer
+	var r = &REPL{D: d, Out: &out}
+	r.Run(strings.NewReader(`b RST7
+c
+bt
+finish 2
+o 3
+`))
+	var exp = `0000               31 00 20  LXI    SP, #$2000
+(8080) (8080) breakpoint
+0038  RST7         c9        RET
+(8080) #0  0038  RST7         c9        RET
+#1  0030  TWO          ff        RST    7
+#2  0020  ONE          cd 30 00  CALL   $0030
+#3  0003               cd 20 00  CALL   $0020
+(8080) returned
+0023  ONE+3        c9        RET
+A=00 BC=0000 DE=0000 HL=0050 SP=1ffe PC=0023 ----- DI states=137
+(8080) cannot step out of 3 routines, 1 entered
+(8080) `
+	if out.String() != exp {
+		t.Errorf("printed\n%s\nexpected\n%s", out.String(), exp)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import "8080emu/cover"
+
+// Coverage records the instructions a machine runs, and the ways its
+// conditional jumps, calls and returns go, in a profile of package cover
+type Coverage struct {
+	Profile *cover.Profile
+
+	cpu  *State
+	step func() int
+}
+
+// NewCoverage records the coverage of the machine of cpu, whose step is
+// step
+func NewCoverage(cpu *State, step func() int) *Coverage {
+	return &Coverage{Profile: cover.New(), cpu: cpu, step: step}
+}
+
+// Step runs a step of the machine and records the instruction it ran. The
+// steps of a halted CPU and those accepting an interrupt, which push pc,
+// run none.
+func (c *Coverage) Step() int {
+	var s = c.cpu
+	var pc, sp, op, halted = s.pc, s.sp, s.opcode(s.pc), s.halted
+	var n = c.step()
+	var next = pc + uint16(op.Size)
+	if halted || s.pc != next && s.sp == sp-2 && pairTo16(s.peek(s.sp+1), s.peek(s.sp)) == pc {
+		return n
+	}
+	c.Profile.Record(pc, op, s.pc != next)
+	return n
+}
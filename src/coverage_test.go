@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"8080emu/cover"
+)
+
+func TestCoverage(t *testing.T) {
+	var d = calling(0)
+	var intr = &interrupter{}
+	d.CPU.intr = intr
+	d.CPU.Load(0x08, []byte{0xc9})       // RET
+	d.CPU.Load(0x23, []byte{0xd8, 0xc9}) // ONE+3: RC, RET
+	d.CPU.intEnable = 1
+	var c = NewCoverage(d.CPU, d.CPU.Step)
+	c.Step()
+	c.Step()
+	intr.pending = true
+	c.Step()
+	for !d.CPU.halted {
+		c.Step()
+	}
+	c.Step()
+
+	var table = []struct {
+		addr uint16
+		exp  cover.Count
+	}{
+		{0x00, cover.Count{Runs: 1}},
+		{0x03, cover.Count{Runs: 1}},
+		{0x08, cover.Count{Runs: 1}}, // the RET of the interrupt, not its RST
+		{0x20, cover.Count{Runs: 1}}, // run after the interrupt returned
+		{0x23, cover.Count{Runs: 2, NotTaken: 2}},
+		{0x24, cover.Count{Runs: 2}},
+		{0x06, cover.Count{Runs: 1}}, // HLT, not the steps halted
+	}
+	for _, test := range table {
+		if got := c.Profile.Get(test.addr); got != test.exp {
+			t.Errorf("%04x: %+v, expected %+v", test.addr, got, test.exp)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+// CPM is a computer running CP/M 2.2: an 8080 with 64K of RAM, a console and
+// up to 16 disk drives, A: to P:, behind a BIOS written in Go
+type CPM struct {
+	CPU      *State
+	BIOS     *BIOS
+	Snapshot Snapshot // the CPU and the BIOS
+}
+
+// NewCPM returns a CP/M computer with its BIOS at base. Boot it once its
+// disks are mounted.
+func NewCPM(base uint16, console Line) (*CPM, error) {
+	var c = &CPM{CPU: &State{}}
+	var err error
+	if c.BIOS, err = NewBIOS(c.CPU, base, console); err != nil {
+		return nil, err
+	}
+	c.Snapshot.Add("cpu", c.CPU)
+	c.Snapshot.Add("bios", c.BIOS)
+	return c, nil
+}
+
+// Boot starts the cold boot of the BIOS
+func (c *CPM) Boot() {
+	c.CPU.pc = c.BIOS.Base + 3*biosBoot
+}
+
+// Run runs the CPU until it halts with interrupts disabled or stop returns
+// true. stop is called every few thousand instructions.
+func (c *CPM) Run(stop func() bool) {
+	run(c.CPU, c.CPU.Step, stop)
+}
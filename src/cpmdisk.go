@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// cpmSectorSize is the size of a CP/M record and of the sectors of its disks
+const cpmSectorSize = 128
+
+// dpb is a CP/M 2.2 disk parameter block
+type dpb struct {
+	spt      uint16 // sectors per track
+	bsh, blm byte   // block shift and mask: blocks of 128 << bsh bytes
+	exm      byte   // extent mask
+	dsm      uint16 // the last block
+	drm      uint16 // the last directory entry
+	al0, al1 byte   // the blocks of the directory
+	cks      uint16 // directory entries checked for a changed disk, / 4
+	off      uint16 // reserved system tracks
+}
+
+// bytes is the block as the BDOS reads it
+func (p *dpb) bytes() []byte {
+	return []byte{
+		byte(p.spt), byte(p.spt >> 8), p.bsh, p.blm, p.exm,
+		byte(p.dsm), byte(p.dsm >> 8), byte(p.drm), byte(p.drm >> 8),
+		p.al0, p.al1, byte(p.cks), byte(p.cks >> 8), byte(p.off), byte(p.off >> 8),
+	}
+}
+
+// The standard 8" single sided single density disk of CP/M: 77 tracks of 26
+// sectors, 2 of them for the system, 1K blocks and 64 directory entries. The
+// sectors are stored in their physical order and the BDOS reads them with a
+// skew of 6.
+const ibm3740Tracks = 77
+
+var ibm3740 = dpb{spt: 26, bsh: 3, blm: 7, exm: 0, dsm: 242, drm: 63, al0: 0xc0, al1: 0, cks: 16, off: 2}
+
+var ibm3740Skew = []byte{
+	1, 7, 13, 19, 25, 5, 11, 17, 23, 3, 9, 15, 21,
+	2, 8, 14, 20, 26, 6, 12, 18, 24, 4, 10, 16, 22,
+}
+
+// Disk is a CP/M disk image, .img or .dsk: the 128 byte sectors of an IBM
+// 3740 disk one track after the other. Images may be shorter than the disk,
+// even empty: the missing sectors read as freshly formatted, full of 0xe5.
+type Disk struct {
+	image    Image
+	readOnly bool
+	size     int64 // the bytes in image
+}
+
+// OpenDisk opens the disk image at path, read only when the file can not be
+// written
+func OpenDisk(path string) (*Disk, error) {
+	var f, err = os.OpenFile(path, os.O_RDWR, 0)
+	var readOnly = false
+	if os.IsPermission(err) {
+		f, err = os.Open(path)
+		readOnly = true
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.Size() > ibm3740Tracks*int64(ibm3740.spt)*cpmSectorSize {
+		f.Close()
+		return nil, fmt.Errorf("%s: %d bytes is too big for an 8\" disk", path, info.Size())
+	}
+	return NewDisk(f, info.Size(), readOnly), nil
+}
+
+// NewDisk returns a disk stored in image, which holds size bytes
+func NewDisk(image Image, size int64, readOnly bool) *Disk {
+	return &Disk{image: image, readOnly: readOnly, size: size}
+}
+
+// offset is where sector, counted from 1, of track starts in the image, or
+// -1 when the disk has no such sector
+func (d *Disk) offset(track, sector int) int64 {
+	if track < 0 || track >= ibm3740Tracks || sector < 1 || sector > int(ibm3740.spt) {
+		return -1
+	}
+	return int64(track*int(ibm3740.spt)+sector-1) * cpmSectorSize
+}
+
+// ReadSector reads sector, counted from 1, of track to buf
+func (d *Disk) ReadSector(track, sector int, buf []byte) error {
+	var off = d.offset(track, sector)
+	if off < 0 {
+		return fmt.Errorf("no sector %d on track %d", sector, track)
+	}
+	var n, _ = d.image.ReadAt(buf[:cpmSectorSize], off)
+	for i := n; i < cpmSectorSize; i++ {
+		buf[i] = 0xe5
+	}
+	return nil
+}
+
+// WriteSector writes buf to sector, counted from 1, of track. Writing past
+// the end of the image formats the sectors before it.
+func (d *Disk) WriteSector(track, sector int, buf []byte) error {
+	var off = d.offset(track, sector)
+	switch {
+	case off < 0:
+		return fmt.Errorf("no sector %d on track %d", sector, track)
+	case d.readOnly:
+		return fmt.Errorf("the disk is read only")
+	}
+
+	var blank [cpmSectorSize]byte
+	for i := range blank {
+		blank[i] = 0xe5
+	}
+	for d.size < off {
+		var n = off - d.size
+		if n > cpmSectorSize {
+			n = cpmSectorSize
+		}
+		if _, err := d.image.WriteAt(blank[:n], d.size); err != nil {
+			return err
+		}
+		d.size += n
+	}
+
+	if _, err := d.image.WriteAt(buf[:cpmSectorSize], off); err != nil {
+		return err
+	}
+	if off+cpmSectorSize > d.size {
+		d.size = off + cpmSectorSize
+	}
+	return nil
+}
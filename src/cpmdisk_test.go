@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// growImage is a disk image in memory that grows as it is written
+type growImage struct {
+	data []byte
+}
+
+func (g *growImage) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(g.data)) {
+		return 0, nil
+	}
+	return copy(p, g.data[off:]), nil
+}
+
+func (g *growImage) WriteAt(p []byte, off int64) (int, error) {
+	if end := int(off) + len(p); end > len(g.data) {
+		g.data = append(g.data, make([]byte, end-len(g.data))...)
+	}
+	return copy(g.data[off:], p), nil
+}
+
+func TestDisk(t *testing.T) {
+	var image = &growImage{}
+	var d = NewDisk(image, 0, false)
+	var buf = make([]byte, cpmSectorSize)
+
+	if err := d.ReadSector(2, 1, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, bytes.Repeat([]byte{0xe5}, cpmSectorSize)) {
+		t.Errorf("read % x from an empty image, expected e5", buf[:4])
+	}
+
+	for i := range buf {
+		buf[i] = byte(i)
+	}
+	if err := d.WriteSector(1, 3, buf); err != nil {
+		t.Fatal(err)
+	}
+	var off = (26 + 2) * cpmSectorSize
+	if len(image.data) != off+cpmSectorSize {
+		t.Fatalf("image of %d bytes, expected %d", len(image.data), off+cpmSectorSize)
+	}
+	if image.data[off-1] != 0xe5 || image.data[0] != 0xe5 {
+		t.Errorf("the sectors before the one written are not formatted")
+	}
+	if !bytes.Equal(image.data[off:], buf) {
+		t.Errorf("wrote % x..., expected % x...", image.data[off:off+4], buf[:4])
+	}
+
+	var table = []struct {
+		track, sector int
+	}{
+		{0, 0}, {0, 27}, {77, 1}, {-1, 1},
+	}
+	for _, test := range table {
+		if err := d.ReadSector(test.track, test.sector, buf); err == nil {
+			t.Errorf("read sector %d of track %d", test.sector, test.track)
+		}
+		if err := d.WriteSector(test.track, test.sector, buf); err == nil {
+			t.Errorf("wrote sector %d of track %d", test.sector, test.track)
+		}
+	}
+
+	d = NewDisk(image, int64(len(image.data)), true)
+	if err := d.WriteSector(0, 1, buf); err == nil {
+		t.Errorf("wrote a read only disk")
+	}
+}
+
+func TestOpenDisk(t *testing.T) {
+	var dir = t.TempDir()
+	var big = filepath.Join(dir, "big.img")
+	if err := os.WriteFile(big, make([]byte, 77*26*128+1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenDisk(big); err == nil {
+		t.Errorf("opened an image too big for the disk")
+	}
+	if _, err := OpenDisk(filepath.Join(dir, "missing.img")); err == nil {
+		t.Errorf("opened a missing image")
+	}
+
+	var path = filepath.Join(dir, "a.img")
+	if err := os.WriteFile(path, make([]byte, 77*26*128), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var d, err = OpenDisk(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf = bytes.Repeat([]byte{0x42}, cpmSectorSize)
+	if err := d.WriteSector(76, 26, buf); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if !bytes.Equal(data[len(data)-cpmSectorSize:], buf) {
+		t.Errorf("the last sector was not written")
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// The Altair 8" disks of the 88-DCDD have 77 tracks of 32 sectors of 137
+// bytes, stored one after the other in .dsk images
+const (
+	dcddTracks     = 77
+	dcddSectors    = 32
+	dcddSectorSize = 137
+	dcddDrives     = 4
+)
+
+// The status register of port 0x08. Its bits are true when clear.
+const (
+	dcddENWD  = 1 << 0 // ready for the next byte to write
+	dcddMove  = 1 << 1 // the head may step
+	dcddHead  = 1 << 2 // the head is loaded
+	dcddINTE  = 1 << 5 // interrupts are enabled
+	dcddTrack = 1 << 6 // the head is on track 0
+	dcddNRDA  = 1 << 7 // a byte can be read
+)
+
+// The commands of port 0x09
+const (
+	dcddStepIn     = 1 << 0
+	dcddStepOut    = 1 << 1
+	dcddHeadLoad   = 1 << 2
+	dcddHeadUnload = 1 << 3
+	dcddIntEnable  = 1 << 4
+	dcddIntDisable = 1 << 5
+	dcddWrite      = 1 << 7
+)
+
+// Image is a disk image file
+type Image interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// DiskController is the MITS 88-DCDD floppy disk controller with up to 4
+// drives, on ports 0x08 to 0x0a:
+//
+//	0x08 out: select the drive in bits 0-3, or none when bit 7 is set
+//	     in:  status
+//	0x09 out: step, load the head and start writing
+//	     in:  the sector under the head, bit 0 clear when it starts
+//	0x0a      read or write the next byte of the sector
+//
+// The disk turns by one sector each time the CPU reads the sector position,
+// which is all the timing the boot loader and the BIOSes need.
+type DiskController struct {
+	drives   [dcddDrives]*Drive
+	selected *Drive
+	inte     bool
+}
+
+// Drive is a drive of the 88-DCDD
+type Drive struct {
+	image    Image
+	readOnly bool
+	track    int
+	sector   int
+	pos      int // the next byte of buf to read or write
+	buf      [dcddSectorSize]byte
+	loaded   bool // the head is loaded
+	writing  bool
+}
+
+func NewDiskController() *DiskController {
+	return &DiskController{}
+}
+
+// Attach puts the controller on ports 0x08 to 0x0a
+func (c *DiskController) Attach(bus *Bus) {
+	bus.Attach(0x08, c.Status, c.Select)
+	bus.Attach(0x09, c.Position, c.Command)
+	bus.Attach(0x0a, c.ReadData, c.WriteData)
+}
+
+// Mount puts the .dsk image at path in drive n, read only when the file
+// can not be written
+func (c *DiskController) Mount(n int, path string) error {
+	if n < 0 || n >= dcddDrives {
+		return fmt.Errorf("no drive %d", n)
+	}
+
+	var f, err = os.OpenFile(path, os.O_RDWR, 0)
+	var readOnly = false
+	if os.IsPermission(err) {
+		f, err = os.Open(path)
+		readOnly = true
+	}
+	if err != nil {
+		return err
+	}
+	c.MountImage(n, f, readOnly)
+	return nil
+}
+
+// MountImage puts image in drive n
+func (c *DiskController) MountImage(n int, image Image, readOnly bool) {
+	c.drives[n] = &Drive{image: image, readOnly: readOnly}
+}
+
+// Select selects the drive in bits 0-3 of v, or none when bit 7 is set or
+// the drive is empty
+func (c *DiskController) Select(v byte) {
+	if c.selected != nil {
+		c.selected.flush()
+		c.selected.loaded, c.selected.writing = false, false
+	}
+	c.selected = nil
+	if v&0x80 == 0 && int(v&0x0f) < dcddDrives {
+		c.selected = c.drives[v&0x0f]
+	}
+}
+
+func (c *DiskController) Status() byte {
+	var d = c.selected
+	if d == nil {
+		return 0xff
+	}
+
+	var st byte = dcddMove
+	if d.writing {
+		st |= dcddENWD
+	}
+	if d.loaded {
+		st |= dcddHead | dcddNRDA
+	}
+	if c.inte {
+		st |= dcddINTE
+	}
+	if d.track == 0 {
+		st |= dcddTrack
+	}
+	return ^st
+}
+
+func (c *DiskController) Command(v byte) {
+	var d = c.selected
+	if d == nil {
+		return
+	}
+
+	if v&(dcddStepIn|dcddStepOut) != 0 {
+		d.flush()
+		if v&dcddStepIn != 0 && d.track < dcddTracks-1 {
+			d.track++
+		}
+		if v&dcddStepOut != 0 && d.track > 0 {
+			d.track--
+		}
+		d.pos = 0
+	}
+	if v&dcddHeadLoad != 0 {
+		d.loaded = true
+	}
+	if v&dcddHeadUnload != 0 {
+		d.flush()
+		d.loaded = false
+	}
+	if v&dcddIntEnable != 0 {
+		c.inte = true
+	}
+	if v&dcddIntDisable != 0 {
+		c.inte = false
+	}
+	if v&dcddWrite != 0 && d.loaded {
+		d.writing, d.pos = true, 0
+	}
+}
+
+// Position turns the disk to the next sector and returns its number in bits
+// 1-5. Bit 0, sector true, is clear as the sector starts.
+func (c *DiskController) Position() byte {
+	var d = c.selected
+	if d == nil || !d.loaded {
+		return 0xff
+	}
+
+	d.flush()
+	d.sector = (d.sector + 1) % dcddSectors
+	d.pos = 0
+	return 0xc0 | byte(d.sector<<1)
+}
+
+func (c *DiskController) ReadData() byte {
+	var d = c.selected
+	if d == nil || !d.loaded || d.pos >= dcddSectorSize {
+		return 0xff
+	}
+	if d.pos == 0 {
+		d.read()
+	}
+	var b = d.buf[d.pos]
+	d.pos++
+	return b
+}
+
+func (c *DiskController) WriteData(v byte) {
+	var d = c.selected
+	if d == nil || !d.writing || d.pos >= dcddSectorSize {
+		return
+	}
+	d.buf[d.pos] = v
+	d.pos++
+	if d.pos == dcddSectorSize {
+		d.flush()
+	}
+}
+
+// offset is where the sector under the head starts in the image
+func (d *Drive) offset() int64 {
+	return int64(d.track*dcddSectors+d.sector) * dcddSectorSize
+}
+
+// read loads the sector under the head into buf. Past the end of the image
+// the disk reads zeros.
+func (d *Drive) read() {
+	var n, _ = d.image.ReadAt(d.buf[:], d.offset())
+	for i := n; i < len(d.buf); i++ {
+		d.buf[i] = 0
+	}
+}
+
+// flush writes the sector being written, padded with zeros
+func (d *Drive) flush() {
+	if !d.writing {
+		return
+	}
+	for i := d.pos; i < len(d.buf); i++ {
+		d.buf[i] = 0
+	}
+	if !d.readOnly {
+		d.image.WriteAt(d.buf[:], d.offset())
+	}
+	d.writing = false
+}
+
+// SaveState saves the drive selected and the heads of the drives. The
+// images stay in their files: the same ones have to be mounted to restore.
+func (c *DiskController) SaveState(e *Encoder) {
+	e.Bool(c.inte)
+	var selected = -1
+	for n, d := range c.drives {
+		if d != nil && d == c.selected {
+			selected = n
+		}
+	}
+	e.Int(selected)
+	for _, d := range c.drives {
+		e.Bool(d != nil)
+		if d != nil {
+			e.Int(d.track)
+			e.Int(d.sector)
+			e.Int(d.pos)
+			e.Bytes(d.buf[:])
+			e.Bool(d.loaded)
+			e.Bool(d.writing)
+		}
+	}
+}
+
+func (c *DiskController) LoadState(dec *Decoder) {
+	c.inte = dec.Bool()
+	var selected = dec.Int()
+	for n, d := range c.drives {
+		if mounted := dec.Bool(); mounted != (d != nil) {
+			dec.Fail(fmt.Errorf("drive %d mounted differently", n))
+			return
+		} else if !mounted {
+			continue
+		}
+		d.track, d.sector, d.pos = dec.Int(), dec.Int(), dec.Int()
+		dec.Bytes(d.buf[:])
+		d.loaded, d.writing = dec.Bool(), dec.Bool()
+		if d.track < 0 || d.track >= dcddTracks || d.sector < 0 || d.sector >= dcddSectors || d.pos < 0 || d.pos > dcddSectorSize {
+			dec.Fail(fmt.Errorf("drive %d: bad position", n))
+		}
+	}
+	c.selected = nil
+	if selected >= dcddDrives || selected >= 0 && c.drives[selected] == nil {
+		dec.Fail(fmt.Errorf("bad drive %d selected", selected))
+	} else if selected >= 0 {
+		c.selected = c.drives[selected]
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"8080emu/asm"
+)
+
+// memImage is a disk image in memory
+type memImage []byte
+
+func (m memImage) ReadAt(p []byte, off int64) (int, error) {
+	return copy(p, m[off:]), nil
+}
+
+func (m memImage) WriteAt(p []byte, off int64) (int, error) {
+	return copy(m[off:], p), nil
+}
+
+func sectorOffset(track, sector int) int {
+	return (track*dcddSectors + sector) * dcddSectorSize
+}
+
+func TestDiskController(t *testing.T) {
+	var prog, err = asm.AssembleFile("testdata/disk.asm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var org, image = prog.Binary()
+
+	var disk = make(memImage, dcddTracks*dcddSectors*dcddSectorSize)
+	for i := 0; i < dcddSectorSize; i++ {
+		disk[sectorOffset(2, 5)+i] = byte(i)
+	}
+
+	var a = NewAltair(64, &bufLine{})
+	a.Disks.MountImage(0, disk, false)
+	a.CPU.Load(org, image)
+	a.Run(func() bool { return a.CPU.Cycles() > 1000000 })
+
+	if !a.CPU.Halted() {
+		t.Fatal("did not halt")
+	}
+	var buf = prog.Symbols["BUF"].Value
+	for i := 0; i < dcddSectorSize; i++ {
+		if a.CPU.mem[int(buf)+i] != byte(i) {
+			t.Fatalf("read %02x at byte %d, expected %02x", a.CPU.mem[int(buf)+i], i, byte(i))
+		}
+		if disk[sectorOffset(0, 7)+i] != byte(i+1) {
+			t.Fatalf("wrote %02x at byte %d, expected %02x", disk[sectorOffset(0, 7)+i], i, byte(i+1))
+		}
+	}
+}
+
+func TestDiskStatus(t *testing.T) {
+	var c = NewDiskController()
+	c.MountImage(1, make(memImage, dcddSectorSize), false)
+
+	var table = []struct {
+		what   string
+		port   byte
+		out    byte
+		status byte
+	}{
+		{"no drive", 0x08, 0x00, 0xff},
+		{"select", 0x08, 0x01, 0xbd},
+		{"load head", 0x09, 0x04, 0x39},
+		{"step in", 0x09, 0x01, 0x79},
+		{"step out", 0x09, 0x02, 0x39},
+		{"step out at track 0", 0x09, 0x02, 0x39},
+		{"interrupts", 0x09, 0x10, 0x19},
+		{"write", 0x09, 0x80, 0x18},
+		{"no interrupts", 0x09, 0x20, 0x38},
+		{"unload head", 0x09, 0x08, 0xbd},
+		{"deselect", 0x08, 0x80, 0xff},
+	}
+
+	for _, test := range table {
+		if test.port == 0x08 {
+			c.Select(test.out)
+		} else {
+			c.Command(test.out)
+		}
+		if st := c.Status(); st != test.status {
+			t.Errorf("%s: status %02x, expected %02x", test.what, st, test.status)
+		}
+	}
+}
+
+func TestDiskPosition(t *testing.T) {
+	var c = NewDiskController()
+	c.MountImage(0, make(memImage, 0), false)
+	c.Select(0)
+	if p := c.Position(); p != 0xff {
+		t.Errorf("position %02x with the head unloaded, expected ff", p)
+	}
+
+	c.Command(dcddHeadLoad)
+	for i := 1; i <= dcddSectors; i++ {
+		var exp = 0xc0 | byte(i%dcddSectors)<<1
+		if p := c.Position(); p != exp {
+			t.Errorf("position %02x, expected %02x", p, exp)
+		}
+	}
+	if b := c.ReadData(); b != 0 {
+		t.Errorf("read %02x past the end of the image, expected 00", b)
+	}
+}
+
+func TestDiskMount(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "disk.dsk")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var c = NewDiskController()
+	if err := c.Mount(4, path); err == nil {
+		t.Errorf("mounted drive 4")
+	}
+	if err := c.Mount(0, filepath.Join(t.TempDir(), "missing.dsk")); err == nil {
+		t.Errorf("mounted a missing file")
+	}
+	if err := c.Mount(3, path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Write the second sector of track 1, half of it
+	c.Select(3)
+	c.Command(dcddStepIn | dcddHeadLoad)
+	c.Position()
+	c.Command(dcddWrite)
+	for i := 0; i < dcddSectorSize/2; i++ {
+		c.WriteData(0xe5)
+	}
+	c.Select(0x80)
+
+	var data, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var off = sectorOffset(1, 1)
+	if len(data) != off+dcddSectorSize {
+		t.Fatalf("image of %d bytes, expected %d", len(data), off+dcddSectorSize)
+	}
+	for i, b := range data[off:] {
+		var exp byte = 0xe5
+		if i >= dcddSectorSize/2 {
+			exp = 0
+		}
+		if b != exp {
+			t.Fatalf("byte %d of the sector is %02x, expected %02x", i, b, exp)
+		}
+	}
+}
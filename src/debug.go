@@ -0,0 +1,550 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Debugger runs a machine under control: step by step, forward and back,
+// or until a breakpoint. It keeps a journal of what the last steps changed
+// in the CPU and its memory to undo them. The devices are not rewound: what
+// a step read from them or wrote to them stays done.
+type Debugger struct {
+	CPU     *State
+	Symbols *Symbols  // the names of the addresses
+	Trace   io.Writer // where the steps are traced, or nil
+	TraceIf *Expr     // traces only the steps it is true before, or nil
+
+	step    func() int       // a step of the machine
+	breaks  map[uint16]*Expr // the breakpoints and their conditions, or nil
+	watches []Watchpoint
+	journal journal
+	undo    *undo  // the entry of the step running
+	running bool   // a step is running
+	at      uint16 // the pc of the step running
+	hit     *Hit   // the first watchpoint the step running hit
+	change  *Stop  // the first watched expression the last step changed
+	calls   callStack
+}
+
+// StopReason tells why the debugger stopped running
+type StopReason int
+
+const (
+	StopDone       StopReason = iota // the steps asked for are done
+	StopBreakpoint                   // pc reached a breakpoint
+	StopHalt                         // the CPU halted with interrupts disabled
+	StopUser                         // the caller asked to stop
+	StopHistory                      // stepping back reached the oldest step kept
+	StopWatch                        // an access hit a watchpoint
+	StopChange                       // the value of a watched expression changed
+	StopReturn                       // the routines stepped out of returned
+)
+
+var stopReasons = []string{"done", "breakpoint", "halted", "stopped", "start of history", "watchpoint", "changed",
+	"returned"}
+
+func (r StopReason) String() string {
+	if int(r) < len(stopReasons) {
+		return stopReasons[r]
+	}
+	return fmt.Sprintf("StopReason(%d)", r)
+}
+
+// Stop is why and where the debugger stopped
+type Stop struct {
+	Reason StopReason
+	PC     uint16
+	Hit    Hit // the access, for StopWatch
+
+	Change   *Expr // the expression, for StopChange
+	Old, New int   // its values before and after
+}
+
+// Access is a kind of memory access, or a set of them
+type Access int
+
+const (
+	AccessRead  Access = 1 << iota // a byte read as data
+	AccessWrite                    // a byte written, even to ROM
+	AccessExec                     // an instruction run
+)
+
+func (a Access) String() string {
+	var s string
+	for i, c := range "rwx" {
+		if a&(1<<i) != 0 {
+			s += string(c)
+		}
+	}
+	return s
+}
+
+// Watchpoint stops the runs at the accesses to the addresses from Start to
+// End. With Cond, only at those of the byte Value: the one read, written or
+// the opcode run. With If, only when it is true at the access. A watchpoint
+// with Change stops instead when the value of the expression changes from a
+// step to the next.
+type Watchpoint struct {
+	Start, End uint16
+	Access     Access
+	Cond       bool
+	Value      byte
+	If         *Expr
+	Change     *Expr
+
+	last int // the value of Change
+}
+
+func (w Watchpoint) String() string {
+	if w.Change != nil {
+		return fmt.Sprintf("change %s", w.Change)
+	}
+	var s = fmt.Sprintf("%04x-%04x %s", w.Start, w.End, w.Access)
+	if w.Cond {
+		s += fmt.Sprintf(" =%02x", w.Value)
+	}
+	if w.If != nil {
+		s += fmt.Sprintf(" if %s", w.If)
+	}
+	return s
+}
+
+// matches tells if w watches an access of v at addr on the machine of s
+func (w Watchpoint) matches(s *State, a Access, addr uint16, v byte) bool {
+	return w.Access&a != 0 && addr >= w.Start && addr <= w.End && (!w.Cond || v == w.Value) &&
+		(w.If == nil || w.If.True(s))
+}
+
+// Hit is an access that hit a watchpoint
+type Hit struct {
+	Access Access
+	Addr   uint16
+	Value  byte
+	PC     uint16 // the instruction that accessed Addr
+}
+
+// NewDebugger debugs the machine of cpu, whose step is step: cpu.Step, or
+// that of a Recorder or a Player. history is the number of steps that can
+// be undone.
+func NewDebugger(cpu *State, step func() int, history int) *Debugger {
+	var d = &Debugger{CPU: cpu, Symbols: NewSymbols(), step: step, breaks: map[uint16]*Expr{}}
+	d.journal.steps = make([]undo, history)
+	d.calls.save = d.save
+	cpu.onWrite = d.written
+	return d
+}
+
+// AddWatchpoint adds w, which the runs check from their next step
+func (d *Debugger) AddWatchpoint(w Watchpoint) {
+	if w.Change != nil {
+		w.last = w.Change.Eval(d.CPU)
+	}
+	d.watches = append(d.watches, w)
+	d.hookReads()
+}
+
+// ClearWatchpoint removes the watchpoint i of Watchpoints
+func (d *Debugger) ClearWatchpoint(i int) {
+	d.watches = append(d.watches[:i], d.watches[i+1:]...)
+	d.hookReads()
+}
+
+// Watchpoints returns the watchpoints in the order they were added
+func (d *Debugger) Watchpoints() []Watchpoint {
+	return d.watches
+}
+
+// hookReads sees the reads of the CPU only while a watchpoint needs them,
+// as they are many
+func (d *Debugger) hookReads() {
+	d.CPU.onRead = nil
+	for _, w := range d.watches {
+		if w.Access&AccessRead != 0 {
+			d.CPU.onRead = d.read
+		}
+	}
+}
+
+// watch records the first access of the step running that hits a watchpoint
+func (d *Debugger) watch(a Access, addr uint16, v byte) {
+	if !d.running || d.hit != nil {
+		return
+	}
+	for _, w := range d.watches {
+		if w.matches(d.CPU, a, addr, v) {
+			d.hit = &Hit{a, addr, v, d.at}
+			return
+		}
+	}
+}
+
+// read watches the reads of data. Those of the bytes of the instruction
+// running are taken for its fetch.
+func (d *Debugger) read(addr uint16, v byte) {
+	if addr-d.at < 3 && addr-d.at < uint16(d.size(d.at)) {
+		return
+	}
+	d.watch(AccessRead, addr, v)
+}
+
+// size returns the size of the instruction at addr
+func (d *Debugger) size(addr uint16) int {
+	return int(d.CPU.opcode(addr).Size)
+}
+
+// SetBreakpoint stops the runs before the instruction at addr, when cond
+// is nil or true there
+func (d *Debugger) SetBreakpoint(addr uint16, cond *Expr) {
+	d.breaks[addr] = cond
+}
+
+// Condition returns the condition of the breakpoint at addr, or nil
+func (d *Debugger) Condition(addr uint16) *Expr {
+	return d.breaks[addr]
+}
+
+func (d *Debugger) ClearBreakpoint(addr uint16) {
+	delete(d.breaks, addr)
+}
+
+// Breakpoints returns the addresses of the breakpoints in order
+func (d *Debugger) Breakpoints() []uint16 {
+	var addrs []uint16
+	for addr := range d.breaks {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	return addrs
+}
+
+// breakpoint tells if pc is at a breakpoint whose condition holds
+func (d *Debugger) breakpoint() bool {
+	var cond, ok = d.breaks[d.CPU.pc]
+	return ok && (cond == nil || cond.True(d.CPU))
+}
+
+// Step runs one step of the machine and journals it
+func (d *Debugger) Step() {
+	if d.Trace != nil && (d.TraceIf == nil || d.TraceIf.True(d.CPU)) {
+		fmt.Fprintf(d.Trace, "%-50s %s\n", d.Where(d.CPU.pc), d.Registers())
+	}
+	d.undo = d.journal.push(d.CPU.regs())
+	var pc, sp, op = d.CPU.pc, d.CPU.sp, d.CPU.opcode(d.CPU.pc)
+	d.running, d.at, d.hit = true, pc, nil
+	d.step()
+	d.calls.track(d.CPU, pc, sp, op)
+	d.undo, d.running = nil, false
+	d.change = d.changes()
+}
+
+// written journals the byte a write overwrites and watches the write
+func (d *Debugger) written(addr uint16, v byte) {
+	if d.undo != nil {
+		d.undo.writes = append(d.undo.writes, undoWrite{addr, d.CPU.mem[addr]})
+	}
+	d.watch(AccessWrite, addr, v)
+}
+
+// StepBack undoes the last step. It returns false when there is none left
+// in the journal.
+func (d *Debugger) StepBack() bool {
+	var u = d.journal.pop()
+	if u == nil {
+		return false
+	}
+	for i := len(u.writes) - 1; i >= 0; i-- {
+		d.CPU.poke(u.writes[i].addr, u.writes[i].old)
+	}
+	d.CPU.setRegs(u.regs)
+	d.untrack(u)
+	d.change = d.changes()
+	return true
+}
+
+// Forget drops the journal and the routines entered, when the machine
+// changed otherwise than by its steps
+func (d *Debugger) Forget() {
+	d.journal.first, d.journal.n = 0, 0
+	d.calls.frames = nil
+	d.changes()
+}
+
+// History returns the number of steps that can be undone
+func (d *Debugger) History() int {
+	return d.journal.n
+}
+
+// Run steps n times, or until a breakpoint, a watchpoint, a change, the CPU
+// halts or stop returns true. stop is called every few thousand steps; n < 0 runs
+// until the other reasons. A read or a write stops the run after the
+// instruction that made it, and the run of an instruction before it.
+func (d *Debugger) Run(n int, stop func() bool) Stop {
+	return d.run(n, stop, nil)
+}
+
+// run is Run, also stopping once until returns true if not nil
+func (d *Debugger) run(n int, stop func() bool, until func() bool) Stop {
+	for i := 1; n < 0 || i <= n; i++ {
+		d.Step()
+		if d.hit == nil {
+			d.executes(d.CPU.pc)
+		}
+		switch {
+		case d.hit != nil:
+			return d.stop(StopWatch)
+		case d.change != nil:
+			return *d.change
+		case d.breakpoint():
+			return d.stop(StopBreakpoint)
+		case until != nil && until():
+			return d.stop(StopReturn)
+		case d.CPU.halted && d.CPU.intEnable == 0:
+			return d.stop(StopHalt)
+		case i%4096 == 0 && stop != nil && stop():
+			return d.stop(StopUser)
+		}
+	}
+	return d.stop(StopDone)
+}
+
+// stop returns the Stop of reason at pc
+func (d *Debugger) stop(reason StopReason) Stop {
+	var s = Stop{Reason: reason, PC: d.CPU.pc}
+	if reason == StopWatch {
+		s.Hit = *d.hit
+	}
+	return s
+}
+
+// changes updates the values of the watched expressions and returns the
+// Stop of the first one that changed, or nil
+func (d *Debugger) changes() *Stop {
+	var stop *Stop
+	for i := range d.watches {
+		var w = &d.watches[i]
+		if w.Change == nil {
+			continue
+		}
+		var v = w.Change.Eval(d.CPU)
+		if v != w.last && stop == nil {
+			stop = &Stop{Reason: StopChange, PC: d.CPU.pc, Change: w.Change, Old: w.last, New: v}
+		}
+		w.last = v
+	}
+	return stop
+}
+
+// executes watches the run of the instruction at addr
+func (d *Debugger) executes(addr uint16) {
+	if len(d.watches) > 0 {
+		d.running, d.at = true, addr
+		d.watch(AccessExec, addr, d.CPU.mem[addr])
+		d.running = false
+	}
+}
+
+// Back steps back n times, or until a breakpoint, a watchpoint, a change or
+// the oldest step of the journal. n < 0 goes back until the other reasons. The
+// journal keeps the writes but not the reads: stepping back stops before
+// the writes and the runs watched, not the reads.
+func (d *Debugger) Back(n int) Stop {
+	for i := 1; n < 0 || i <= n; i++ {
+		d.hit = nil
+		if u := d.journal.last(); u != nil {
+			d.running, d.at = true, u.regs.pc
+			for _, w := range u.writes {
+				// the byte written is there until the step is undone
+				d.watch(AccessWrite, w.addr, d.CPU.mem[w.addr])
+			}
+			d.running = false
+		}
+		if !d.StepBack() {
+			return d.stop(StopHistory)
+		}
+		if d.hit == nil {
+			d.executes(d.CPU.pc)
+		}
+		switch {
+		case d.hit != nil:
+			return d.stop(StopWatch)
+		case d.change != nil:
+			return *d.change
+		case d.breakpoint():
+			return d.stop(StopBreakpoint)
+		}
+	}
+	return d.stop(StopDone)
+}
+
+// Addr reads an address: a symbol, hex with an optional H suffix or an
+// expression
+func (d *Debugger) Addr(s string) (uint16, error) {
+	if addr, ok := d.Symbols.Addr(s); ok {
+		return addr, nil
+	}
+	if v, err := strconv.ParseUint(strings.TrimSuffix(strings.ToUpper(s), "H"), 16, 16); err == nil {
+		return uint16(v), nil
+	}
+	var e, err = ParseExpr(s, d.Symbols)
+	if err != nil {
+		return 0, fmt.Errorf("bad address %s: %v", s, err)
+	}
+	return uint16(e.Eval(d.CPU)), nil
+}
+
+// Disassemble returns the instruction at addr in the syntax of the Intel
+// manual and its size. The opcodes the 8080 does not define are shown as
+// the ones it runs.
+func (d *Debugger) Disassemble(addr uint16) (string, int) {
+	var op = d.CPU.opcode(addr)
+	return op.Text(d.CPU.peek(addr+1), d.CPU.peek(addr+2)), int(op.Size)
+}
+
+// Where describes the instruction at addr: its address, the symbol it is
+// at and its text
+func (d *Debugger) Where(addr uint16) string {
+	var text, size = d.Disassemble(addr)
+	var code []string
+	for i := 0; i < size; i++ {
+		code = append(code, fmt.Sprintf("%02x", d.CPU.peek(addr+uint16(i))))
+	}
+	return fmt.Sprintf("%04x  %-12s %-8s  %s", addr, d.Symbols.Label(addr), strings.Join(code, " "), strings.TrimRight(text, " "))
+}
+
+// Dump gives the address and the n bytes from addr, in hex and ASCII, for
+// n up to 16
+func (d *Debugger) Dump(addr uint16, n int) string {
+	var hex, text strings.Builder
+	for i := 0; i < n; i++ {
+		var b = d.CPU.peek(addr + uint16(i))
+		fmt.Fprintf(&hex, " %02x", b)
+		if b < ' ' || b > '~' {
+			b = '.'
+		}
+		text.WriteByte(b)
+	}
+	return fmt.Sprintf("%04x %-48s  %s", addr, hex.String(), text.String())
+}
+
+// Registers describes the registers, the flags and the states run
+func (d *Debugger) Registers() string {
+	var s = d.CPU
+	return fmt.Sprintf("A=%02x BC=%02x%02x DE=%02x%02x HL=%02x%02x SP=%04x PC=%04x %s %s states=%d",
+		s.regA, s.regB, s.regC, s.regD, s.regE, s.regH, s.regL, s.sp, s.pc, d.Flags(), d.Interrupts(), s.cycles)
+}
+
+// Flags gives the letters of the flags set, in the order ZSPCA, and - for
+// the others
+func (d *Debugger) Flags() string {
+	var flags = []byte("ZSPCA")
+	for i := range flags {
+		if !d.CPU.flags.IsSet(Flag(i)) {
+			flags[i] = '-'
+		}
+	}
+	return string(flags)
+}
+
+// Interrupts tells if interrupts are enabled: EI or DI
+func (d *Debugger) Interrupts() string {
+	if d.CPU.intEnable != 0 {
+		return "EI"
+	}
+	return "DI"
+}
+
+// accessNames name a single access
+var accessNames = map[Access]string{AccessRead: "read", AccessWrite: "write", AccessExec: "run"}
+
+// Why tells why a run stopped, or returns "" when it ran all its steps
+func (d *Debugger) Why(s Stop) string {
+	var syms = d.Symbols
+	switch s.Reason {
+	case StopDone:
+		return ""
+	case StopWatch:
+		return fmt.Sprintf("%s: %s of %02x at %s by %s", s.Reason, accessNames[s.Hit.Access],
+			s.Hit.Value, syms.Name(s.Hit.Addr), syms.Name(s.Hit.PC))
+	case StopChange:
+		return fmt.Sprintf("%s: %s from 0x%x to 0x%x", s.Reason, s.Change, s.Old, s.New)
+	}
+	return s.Reason.String()
+}
+
+// regs are what a step changes in the CPU, memory aside
+type regs struct {
+	a, b, c, d, e, h, l byte
+	flags               Flags
+	intEnable           byte
+	sp, pc              uint16
+	cycles              uint64
+	halted, eiDelay     bool
+}
+
+func (s *State) regs() regs {
+	return regs{s.regA, s.regB, s.regC, s.regD, s.regE, s.regH, s.regL, s.flags, s.intEnable,
+		s.sp, s.pc, s.cycles, s.halted, s.eiDelay}
+}
+
+func (s *State) setRegs(r regs) {
+	s.regA, s.regB, s.regC, s.regD, s.regE, s.regH, s.regL = r.a, r.b, r.c, r.d, r.e, r.h, r.l
+	s.flags, s.intEnable, s.sp, s.pc = r.flags, r.intEnable, r.sp, r.pc
+	s.cycles, s.halted, s.eiDelay = r.cycles, r.halted, r.eiDelay
+}
+
+// journal is a ring of the last steps, each with the registers before it
+// and the bytes its writes overwrote
+type journal struct {
+	steps []undo
+	first int // the oldest step
+	n     int
+}
+
+type undo struct {
+	regs    regs
+	writes  []undoWrite
+	tracked bool    // the step changed the frames
+	frames  []Frame // the frames before it
+}
+
+type undoWrite struct {
+	addr uint16
+	old  byte
+}
+
+// push starts the entry of a step, dropping the oldest one when the
+// journal is full. It returns nil when the journal keeps nothing.
+func (j *journal) push(r regs) *undo {
+	if len(j.steps) == 0 {
+		return nil
+	}
+	if j.n == len(j.steps) {
+		j.first = (j.first + 1) % len(j.steps)
+		j.n--
+	}
+	var u = &j.steps[(j.first+j.n)%len(j.steps)]
+	u.regs, u.writes, u.tracked = r, u.writes[:0], false
+	j.n++
+	return u
+}
+
+// pop takes the entry of the last step, or nil when there is none
+func (j *journal) pop() *undo {
+	var u = j.last()
+	if u != nil {
+		j.n--
+	}
+	return u
+}
+
+// last returns the entry of the last step, or nil when there is none
+func (j *journal) last() *undo {
+	if j.n == 0 {
+		return nil
+	}
+	return &j.steps[(j.first+j.n-1)%len(j.steps)]
+}
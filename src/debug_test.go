@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// debugged returns a debugger of a loop counting at 1000 and calling a
+// routine that pushes and pops
+func debugged(history int) *Debugger {
+	var cpu = &State{}
+	cpu.Load(0, []byte{
+		0x31, 0x00, 0x20, // LXI SP, 2000H
+		0x21, 0x00, 0x10, // LXI H, 1000H
+		0x34,             // LOOP: INR M
+		0xcd, 0x10, 0x00, // CALL SUB
+		0xc3, 0x06, 0x00, // JMP LOOP
+	})
+	cpu.Load(0x10, []byte{
+		0xf5, // SUB: PUSH PSW
+		0x3c, // INR A
+		0xf1, // POP PSW
+		0xc9, // RET
+	})
+	var d = NewDebugger(cpu, cpu.Step, history)
+	d.Symbols.Add("LOOP", 0x06)
+	d.Symbols.Add("SUB", 0x10)
+	d.Symbols.Add("COUNT", 0x1000)
+	return d
+}
+
+// frozen is what a step can change
+type frozen struct {
+	regs regs
+	mem  [65536]byte
+}
+
+func frozenOf(s *State) frozen {
+	return frozen{s.regs(), s.mem}
+}
+
+func TestStepBack(t *testing.T) {
+	var d = debugged(100)
+	var seen []frozen
+	for i := 0; i < 50; i++ {
+		seen = append(seen, frozenOf(d.CPU))
+		d.Step()
+	}
+	if d.History() != 50 {
+		t.Errorf("%d steps in the history, expected 50", d.History())
+	}
+	for i := 49; i >= 0; i-- {
+		if !d.StepBack() {
+			t.Fatalf("no step back to %d", i)
+		}
+		if frozenOf(d.CPU) != seen[i] {
+			t.Fatalf("step back to %d: %+v, expected %+v", i, d.CPU.regs(), seen[i].regs)
+		}
+	}
+	if d.StepBack() {
+		t.Errorf("stepped back before the start")
+	}
+
+	// the history goes on after stepping back
+	d.Run(10, nil)
+	if frozenOf(d.CPU) != seen[10] || d.History() != 10 {
+		t.Errorf("ran again to %+v, expected %+v", d.CPU.regs(), seen[10].regs)
+	}
+}
+
+func TestReverseContinue(t *testing.T) {
+	var table = []struct {
+		what    string
+		history int
+		breaks  []uint16
+		reason  StopReason
+		pc      uint16
+		left    int // steps in the history
+	}{
+		{"breakpoint", 100, []uint16{0x10}, StopBreakpoint, 0x10, 25},
+		{"start", 100, nil, StopHistory, 0, 0},
+		{"oldest step", 10, nil, StopHistory, 0x12, 0},
+		{"breakpoint too old", 10, []uint16{0x03}, StopHistory, 0x12, 0},
+	}
+
+	for _, test := range table {
+		var d = debugged(test.history)
+		d.Run(30, nil)
+		for _, addr := range test.breaks {
+			d.SetBreakpoint(addr, nil)
+		}
+		var stop = d.Back(-1)
+		if stop.Reason != test.reason || stop.PC != test.pc || d.History() != test.left {
+			t.Errorf("%s: stopped %v at %04x with %d steps left, expected %v at %04x with %d",
+				test.what, stop.Reason, stop.PC, d.History(), test.reason, test.pc, test.left)
+		}
+	}
+}
+
+func TestDebuggerRun(t *testing.T) {
+	var d = debugged(0)
+	d.SetBreakpoint(0x12, nil)
+	if stop := d.Run(-1, nil); stop.Reason != StopBreakpoint || stop.PC != 0x12 {
+		t.Errorf("stopped %v at %04x, expected at the breakpoint", stop.Reason, stop.PC)
+	}
+	if stop := d.Run(5, nil); stop.Reason != StopDone || stop.PC != 0x10 {
+		t.Errorf("stopped %v at %04x, expected done at 0010", stop.Reason, stop.PC)
+	}
+	if d.History() != 0 || d.StepBack() {
+		t.Errorf("stepped back without a history")
+	}
+	d.ClearBreakpoint(0x12)
+	if stop := d.Run(-1, func() bool { return true }); stop.Reason != StopUser || d.CPU.cycles < 4096*4 {
+		t.Errorf("stopped %v after %d states, expected stopped after 4096 steps", stop.Reason, d.CPU.cycles)
+	}
+
+	d.CPU.Load(d.CPU.pc, []byte{0xf3, 0x76}) // DI, HLT
+	if stop := d.Run(-1, nil); stop.Reason != StopHalt {
+		t.Errorf("stopped %v, expected halted", stop.Reason)
+	}
+}
+
+func TestWatchpoints(t *testing.T) {
+	var none = Hit{}
+	var table = []struct {
+		what  string
+		code  []byte // at 0009
+		watch Watchpoint
+		exp   Hit
+	}{
+		{"MOV M, A", []byte{0x77}, Watchpoint{Start: 0x2000, End: 0x2000, Access: AccessWrite}, Hit{AccessWrite, 0x2000, 0, 9}},
+		{"MVI M", []byte{0x36, 0x05}, Watchpoint{Start: 0x2000, End: 0x2000, Access: AccessWrite, Cond: true, Value: 5}, Hit{AccessWrite, 0x2000, 5, 9}},
+		{"other value", []byte{0x36, 0x05}, Watchpoint{Start: 0x2000, End: 0x2000, Access: AccessWrite, Cond: true, Value: 6}, none},
+		{"INR M", []byte{0x34}, Watchpoint{Start: 0x2000, End: 0x2000, Access: AccessRead | AccessWrite}, Hit{AccessRead, 0x2000, 0, 9}},
+		{"MOV A, M", []byte{0x7e}, Watchpoint{Start: 0x2000, End: 0x2000, Access: AccessWrite}, none},
+		{"STAX D", []byte{0x12}, Watchpoint{Start: 0x2100, End: 0x2100, Access: AccessWrite}, Hit{AccessWrite, 0x2100, 0, 9}},
+		{"PUSH B", []byte{0xc5}, Watchpoint{Start: 0x2ffe, End: 0x2fff, Access: AccessWrite}, Hit{AccessWrite, 0x2ffe, 0, 9}},
+		{"CALL", []byte{0xcd, 0x00, 0x01}, Watchpoint{Start: 0x2ffe, End: 0x2ffe, Access: AccessWrite}, Hit{AccessWrite, 0x2ffe, 0x0c, 9}},
+		{"RST", []byte{0xff}, Watchpoint{Start: 0x2ffe, End: 0x2ffe, Access: AccessWrite}, Hit{AccessWrite, 0x2ffe, 0x0a, 9}},
+		{"XTHL", []byte{0xe3}, Watchpoint{Start: 0x3000, End: 0x3001, Access: AccessRead}, Hit{AccessRead, 0x3001, 0, 9}},
+		{"SHLD", []byte{0x22, 0x00, 0x40}, Watchpoint{Start: 0x4000, End: 0x4001, Access: AccessWrite}, Hit{AccessWrite, 0x4000, 0, 9}},
+		{"LHLD", []byte{0x2a, 0x00, 0x40}, Watchpoint{Start: 0x4001, End: 0x4001, Access: AccessRead}, Hit{AccessRead, 0x4001, 0, 9}},
+		{"fetches", []byte{0x3a, 0x08, 0x00}, Watchpoint{Start: 0x0000, End: 0x00ff, Access: AccessRead}, Hit{AccessRead, 0x0008, 0x21, 9}},
+		{"run", []byte{0x00}, Watchpoint{Start: 0x0009, End: 0x0009, Access: AccessExec}, Hit{AccessExec, 0x0009, 0, 9}},
+	}
+
+	for _, test := range table {
+		var cpu = &State{}
+		cpu.Load(0, []byte{
+			0x31, 0x00, 0x30, // LXI SP, 3000H
+			0x21, 0x00, 0x20, // LXI H, 2000H
+			0x11, 0x00, 0x21, // LXI D, 2100H
+		})
+		cpu.Load(9, test.code)
+		var d = NewDebugger(cpu, cpu.Step, 0)
+		d.AddWatchpoint(test.watch)
+		var stop = d.Run(4, nil)
+		if stop.Hit != test.exp || (stop.Reason == StopWatch) != (test.exp != none) {
+			t.Errorf("%s: stopped %v with %+v, expected %+v", test.what, stop.Reason, stop.Hit, test.exp)
+		}
+	}
+}
+
+func TestWatchBack(t *testing.T) {
+	var table = []struct {
+		what  string
+		watch Watchpoint
+		exp   Hit
+		left  int
+	}{
+		{"last write", Watchpoint{Start: 0x1000, End: 0x1000, Access: AccessWrite}, Hit{AccessWrite, 0x1000, 4, 0x06}, 23},
+		{"value", Watchpoint{Start: 0x1000, End: 0x1000, Access: AccessWrite, Cond: true, Value: 2}, Hit{AccessWrite, 0x1000, 2, 0x06}, 9},
+		{"run", Watchpoint{Start: 0x0012, End: 0x0013, Access: AccessExec}, Hit{AccessExec, 0x0013, 0xc9, 0x13}, 28},
+	}
+
+	for _, test := range table {
+		var d = debugged(100)
+		d.Run(30, nil)
+		d.AddWatchpoint(test.watch)
+		var stop = d.Back(-1)
+		if stop.Reason != StopWatch || stop.Hit != test.exp || stop.PC != test.exp.PC || d.History() != test.left {
+			t.Errorf("%s: stopped %v with %+v and %d steps left, expected %+v with %d",
+				test.what, stop.Reason, stop.Hit, d.History(), test.exp, test.left)
+		}
+	}
+}
+
+func TestREPLWatch(t *testing.T) {
+	var d = debugged(100)
+	var out bytes.Buffer
+	var r = &REPL{D: d, Out: &out}
+	r.Run(strings.NewReader(`w COUNT =2
+w 0-ff rx
+w
+c
+unwatch 2
+c
+rc
+unwatch 2
+w 10-5
+`))
+	var exp = `0000               31 00 20  LXI    SP, #$2000
+(8080) (8080) (8080) 1: 1000-1000 w =02
+2: 0000-00ff rx
+(8080) watchpoint: run of 21 at 0003 by 0003
+0003               21 00 10  LXI    H, #$1000
+(8080) (8080) watchpoint: write of 02 at COUNT by LOOP
+0007  LOOP+1       cd 10 00  CALL   $0010
+(8080) watchpoint: write of 02 at COUNT by LOOP
+0006  LOOP         34        INR    M
+(8080) usage: unwatch n, n from 1 to the number of watchpoints
+(8080) bad range 10-5
+(8080) `
+	if out.String() != exp {
+		t.Errorf("printed\n%s\nexpected\n%s", out.String(), exp)
+	}
+}
+
+func TestREPL(t *testing.T) {
+	var d = debugged(100)
+	var out bytes.Buffer
+	var r = &REPL{D: d, Out: &out}
+	r.Run(strings.NewReader(`s 3
+b SUB
+c
+
+r
+rc
+b
+d 10
+rs
+x 1000 4
+l 13
+nonsense
+`))
+	var exp = `0000               31 00 20  LXI    SP, #$2000
+(8080) 0007  LOOP+1       cd 10 00  CALL   $0010
+(8080) (8080) breakpoint
+0010  SUB          f5        PUSH   PSW
+(8080) breakpoint
+0010  SUB          f5        PUSH   PSW
+(8080) A=00 BC=0000 DE=0000 HL=1000 SP=1ffe PC=0010 ----- DI states=120
+(8080) breakpoint
+0010  SUB          f5        PUSH   PSW
+(8080) 0010  SUB          f5        PUSH   PSW
+(8080) (8080) 0007  LOOP+1       cd 10 00  CALL   $0010
+(8080) 1000  01 00 00 00                                      ....
+(8080) 0013  SUB+3        c9        RET
+0014  SUB+4        00        NOP
+0015  SUB+5        00        NOP
+0016  SUB+6        00        NOP
+0017  SUB+7        00        NOP
+0018  SUB+8        00        NOP
+0019  SUB+9        00        NOP
+001a  SUB+10       00        NOP
+001b  SUB+11       00        NOP
+001c  SUB+12       00        NOP
+(8080) unknown command nonsense, try help
+(8080) `
+	if out.String() != exp {
+		t.Errorf("printed\n%s\nexpected\n%s", out.String(), exp)
+	}
+}
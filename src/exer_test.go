@@ -0,0 +1,143 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"8080emu/asm"
+)
+
+// exercise runs prog as a CP/M program at 0100 on s, with a BDOS printing
+// with the calls 2 and 9, until it jumps to 0, and returns what it printed
+func exercise(t *testing.T, s *State, prog []byte) string {
+	var out strings.Builder
+	s.Load(0x100, prog)
+	s.Load(0x0000, []byte{0x76})                   // HLT
+	s.Load(0x0005, []byte{0xc9, 0x00, 0xf0, 0xc9}) // RET, and the top of the TPA at 0006
+	s.Trap(0x0005, func() {
+		switch s.regC {
+		case 2:
+			out.WriteByte(s.regE)
+		case 9:
+			for a := pairTo16(s.regD, s.regE); s.read(a) != '$'; a++ {
+				out.WriteByte(s.read(a))
+			}
+		default:
+			t.Errorf("BDOS call %d at %04x", s.regC, s.read16(s.sp))
+		}
+		s.ret()
+	})
+	s.sp, s.pc = 0xf000, 0x100
+	for !s.halted {
+		s.Step()
+	}
+	return out.String()
+}
+
+// exerEngines are the CPU cores the exercisers run on
+var exerEngines = []struct {
+	name string
+	init func(s *State)
+}{
+	{"decoding", func(s *State) {}},
+	{"threaded", (*State).UseThreadedCode},
+}
+
+// exerCRCs is what testdata/exer.asm prints, as exerModel computes it
+var exerCRCs = `alu r            AF06C6A3
+alu n            F9D064D1
+daa cma stc cmc  5D1D3184
+inr dcr r        8FF99975
+inr dcr a        79ABEA02
+rlc rrc ral rar  D6EC257A
+dad              C2A95CAA
+inx dcx          40A737D3
+mov              2F5193E3
+mvi              9BA7984C
+lxi b d          5F1D6EFD
+lxi h            9649BEBA
+ldax stax        CF857226
+lda sta          EFC62CB4
+lhld shld        771796BC
+xthl xchg        5F636603
+push pop         83E3F909
+jcc              1E210D2B
+ccc              959EAF1A
+rcc              D308C88A
+jmp              ABD00744
+call             1ABA2379
+ret              486E663E
+pchl             3F822182
+nop              D7699590
+`
+
+// TestExerciser runs the instructions from the states of testdata/exer.asm
+// on both cores
+func TestExerciser(t *testing.T) {
+	var prog, err = asm.AssembleFile("testdata/exer.asm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var _, image = prog.Binary()
+	for _, engine := range exerEngines {
+		var s = &State{}
+		engine.init(s)
+		var out = strings.ReplaceAll(exercise(t, s, image), "\r", "")
+		if out != exerCRCs {
+			t.Errorf("%s: printed\n%s\nexpected\n%s", engine.name, out, exerCRCs)
+		}
+	}
+}
+
+// TestExerciserModel checks exerCRCs against exerModel, which shares no
+// code with the cores
+func TestExerciserModel(t *testing.T) {
+	var prog, err = asm.AssembleFile("testdata/exer.asm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := exerModelCRCs(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != exerCRCs {
+		t.Errorf("the model printed\n%s\nexpected\n%s", out, exerCRCs)
+	}
+}
+
+// TestExercisers runs the CP/M exercisers of the 8080 found in testdata,
+// which are not shipped with the emulator, on both cores. 8080EXM runs
+// for minutes and is left out of the short tests.
+func TestExercisers(t *testing.T) {
+	var table = []struct {
+		file string
+		pass string
+		long bool
+	}{
+		{"TST8080.COM", "CPU IS OPERATIONAL", false},
+		{"CPUDIAG.COM", "CPU IS OPERATIONAL", false},
+		{"8080PRE.COM", "Preliminary tests complete", false},
+		{"8080EXM.COM", "Tests complete", true},
+	}
+	for _, test := range table {
+		var test = test
+		t.Run(test.file, func(t *testing.T) {
+			var prog, err = os.ReadFile("testdata/" + test.file)
+			if err != nil {
+				t.Skipf("%s is not in testdata", test.file)
+			}
+			if test.long && testing.Short() {
+				t.Skipf("%s runs for minutes", test.file)
+			}
+			for _, engine := range exerEngines {
+				var s = &State{}
+				engine.init(s)
+				var out = exercise(t, s, prog)
+				if !strings.Contains(out, test.pass) || strings.Contains(out, "ERROR") {
+					t.Errorf("%s core printed\n%s", engine.name, out)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"fmt"
+	"hash/crc32"
+	"strings"
+
+	"8080emu/asm"
+)
+
+// exerModel is an 8080 written from the Intel 8080 Microcomputer Systems
+// User's Manual, sharing no code with the cores, to check the CRCs that
+// testdata/exer.asm prints. Aux carry follows the silicon where the manual
+// is silent: subtractions add the complement, ANA sets it to the OR of bit
+// 3 of the operands, XRA and ORA clear it. The model runs only the
+// instruction slot of the program and knows only the four bytes around SP.
+type exerModel struct {
+	a, b, c, d, e, h, l byte
+	s, z, ac, p, cy     bool
+	sp, pc              uint16
+	mem                 map[uint16]byte
+	err                 error
+}
+
+func (m *exerModel) load(addr uint16) byte {
+	var v, ok = m.mem[addr]
+	if !ok && m.err == nil {
+		m.err = fmt.Errorf("read of %04X", addr)
+	}
+	return v
+}
+
+func (m *exerModel) store(addr uint16, v byte) {
+	if _, ok := m.mem[addr]; !ok {
+		if m.err == nil {
+			m.err = fmt.Errorf("write of %04X", addr)
+		}
+		return
+	}
+	m.mem[addr] = v
+}
+
+func (m *exerModel) hl() uint16 {
+	return uint16(m.h)<<8 | uint16(m.l)
+}
+
+// reg returns the register of the 3-bit code r: B C D E H L M A
+func (m *exerModel) reg(r byte) byte {
+	switch r {
+	case 0:
+		return m.b
+	case 1:
+		return m.c
+	case 2:
+		return m.d
+	case 3:
+		return m.e
+	case 4:
+		return m.h
+	case 5:
+		return m.l
+	case 6:
+		return m.load(m.hl())
+	}
+	return m.a
+}
+
+func (m *exerModel) setReg(r, v byte) {
+	switch r {
+	case 0:
+		m.b = v
+	case 1:
+		m.c = v
+	case 2:
+		m.d = v
+	case 3:
+		m.e = v
+	case 4:
+		m.h = v
+	case 5:
+		m.l = v
+	case 6:
+		m.store(m.hl(), v)
+	default:
+		m.a = v
+	}
+}
+
+// pair returns the register pair of the 2-bit code rp: BC DE HL SP
+func (m *exerModel) pair(rp byte) uint16 {
+	switch rp {
+	case 0:
+		return uint16(m.b)<<8 | uint16(m.c)
+	case 1:
+		return uint16(m.d)<<8 | uint16(m.e)
+	case 2:
+		return m.hl()
+	}
+	return m.sp
+}
+
+func (m *exerModel) setPair(rp byte, v uint16) {
+	switch rp {
+	case 0:
+		m.b, m.c = byte(v>>8), byte(v)
+	case 1:
+		m.d, m.e = byte(v>>8), byte(v)
+	case 2:
+		m.h, m.l = byte(v>>8), byte(v)
+	default:
+		m.sp = v
+	}
+}
+
+// psw is the flag byte as PUSH PSW stores it: S Z 0 AC 0 P 1 CY
+func (m *exerModel) psw() byte {
+	var f byte = 0x02
+	for _, bit := range []struct {
+		set  bool
+		mask byte
+	}{{m.s, 0x80}, {m.z, 0x40}, {m.ac, 0x10}, {m.p, 0x04}, {m.cy, 0x01}} {
+		if bit.set {
+			f |= bit.mask
+		}
+	}
+	return f
+}
+
+func (m *exerModel) setPSW(f byte) {
+	m.s, m.z, m.ac, m.p, m.cy = f&0x80 != 0, f&0x40 != 0, f&0x10 != 0, f&0x04 != 0, f&0x01 != 0
+}
+
+// szp sets Sign, Zero and Parity from v
+func (m *exerModel) szp(v byte) {
+	var ones = 0
+	for i := 0; i < 8; i++ {
+		ones += int(v>>i) & 1
+	}
+	m.s, m.z, m.p = v&0x80 != 0, v == 0, ones%2 == 0
+}
+
+func (m *exerModel) push(v uint16) {
+	m.sp -= 2
+	m.store(m.sp+1, byte(v>>8))
+	m.store(m.sp, byte(v))
+}
+
+func (m *exerModel) pop() uint16 {
+	var v = uint16(m.load(m.sp)) | uint16(m.load(m.sp+1))<<8
+	m.sp += 2
+	return v
+}
+
+// cond tells if the condition of the 3-bit code cc holds: NZ Z NC C PO PE P M
+func (m *exerModel) cond(cc byte) bool {
+	var flag = []bool{m.z, m.cy, m.p, m.s}[cc>>1]
+	return flag == (cc&1 != 0)
+}
+
+// alu runs the operation of the 3-bit code op on A and v: ADD ADC SUB SBB
+// ANA XRA ORA CMP
+func (m *exerModel) alu(op, v byte) {
+	var result byte
+	switch op {
+	case 0, 1:
+		var carry = 0
+		if op == 1 && m.cy {
+			carry = 1
+		}
+		var sum = int(m.a) + int(v) + carry
+		m.ac = int(m.a&0xf)+int(v&0xf)+carry > 0xf
+		m.cy = sum > 0xff
+		result = byte(sum)
+	case 2, 3, 7:
+		// A plus the complement of v and of the borrow; no carry out is
+		// a borrow
+		var carry = 1
+		if op == 3 && m.cy {
+			carry = 0
+		}
+		var sum = int(m.a) + int(^v) + carry
+		m.ac = int(m.a&0xf)+int(^v&0xf)+carry > 0xf
+		m.cy = sum <= 0xff
+		result = byte(sum)
+	case 4:
+		m.ac, m.cy = (m.a|v)&0x08 != 0, false
+		result = m.a & v
+	case 5:
+		m.ac, m.cy = false, false
+		result = m.a ^ v
+	case 6:
+		m.ac, m.cy = false, false
+		result = m.a | v
+	}
+	m.szp(result)
+	if op != 7 {
+		m.a = result
+	}
+}
+
+// step runs the instruction at pc
+func (m *exerModel) step() {
+	var op = m.load(m.pc)
+	var x, y, z = op >> 6, op >> 3 & 7, op & 7
+	var imm8 = func() byte { return m.load(m.pc + 1) }
+	var imm16 = func() uint16 { return uint16(m.load(m.pc+1)) | uint16(m.load(m.pc+2))<<8 }
+	var size uint16 = 1
+	var bad = func() {
+		if m.err == nil {
+			m.err = fmt.Errorf("opcode %02X is not modeled", op)
+		}
+	}
+
+	switch x {
+	case 0:
+		switch z {
+		case 0: // NOP and its aliases
+		case 1:
+			if y&1 == 0 { // LXI
+				m.setPair(y>>1, imm16())
+				size = 3
+			} else { // DAD
+				var sum = uint32(m.hl()) + uint32(m.pair(y>>1))
+				m.cy = sum > 0xffff
+				m.setPair(2, uint16(sum))
+			}
+		case 2:
+			switch y {
+			case 0, 2: // STAX
+				m.store(m.pair(y>>1), m.a)
+			case 1, 3: // LDAX
+				m.a = m.load(m.pair(y >> 1))
+			case 4: // SHLD
+				m.store(imm16(), m.l)
+				m.store(imm16()+1, m.h)
+				size = 3
+			case 5: // LHLD
+				m.l, m.h = m.load(imm16()), m.load(imm16()+1)
+				size = 3
+			case 6: // STA
+				m.store(imm16(), m.a)
+				size = 3
+			case 7: // LDA
+				m.a = m.load(imm16())
+				size = 3
+			}
+		case 3: // INX, DCX
+			if y&1 == 0 {
+				m.setPair(y>>1, m.pair(y>>1)+1)
+			} else {
+				m.setPair(y>>1, m.pair(y>>1)-1)
+			}
+		case 4: // INR
+			var v = m.reg(y) + 1
+			m.ac = v&0xf == 0
+			m.szp(v)
+			m.setReg(y, v)
+		case 5: // DCR
+			var v = m.reg(y) - 1
+			m.ac = v&0xf != 0xf
+			m.szp(v)
+			m.setReg(y, v)
+		case 6: // MVI
+			m.setReg(y, imm8())
+			size = 2
+		case 7:
+			switch y {
+			case 0: // RLC
+				m.cy = m.a&0x80 != 0
+				m.a = m.a<<1 | m.a>>7
+			case 1: // RRC
+				m.cy = m.a&1 != 0
+				m.a = m.a>>1 | m.a<<7
+			case 2: // RAL
+				var in byte
+				if m.cy {
+					in = 1
+				}
+				m.cy = m.a&0x80 != 0
+				m.a = m.a<<1 | in
+			case 3: // RAR
+				var in byte
+				if m.cy {
+					in = 0x80
+				}
+				m.cy = m.a&1 != 0
+				m.a = m.a>>1 | in
+			case 4: // DAA: one addition of the corrections of both digits
+				var low, high = m.a & 0xf, m.a >> 4
+				var add byte
+				if low > 9 || m.ac {
+					add |= 0x06
+				}
+				if high > 9 || m.cy || high == 9 && low > 9 {
+					add |= 0x60
+					m.cy = true
+				}
+				m.ac = low+(add&0xf) > 0xf
+				m.a += add
+				m.szp(m.a)
+			case 5: // CMA
+				m.a = ^m.a
+			case 6: // STC
+				m.cy = true
+			case 7: // CMC
+				m.cy = !m.cy
+			}
+		}
+	case 1:
+		if op == 0x76 {
+			bad()
+			return
+		}
+		m.setReg(y, m.reg(z))
+	case 2:
+		m.alu(y, m.reg(z))
+	case 3:
+		switch z {
+		case 0: // Rcc
+			if m.cond(y) {
+				m.pc = m.pop()
+				return
+			}
+		case 1:
+			switch y {
+			case 0, 2, 4: // POP
+				m.setPair(y>>1, m.pop())
+			case 6: // POP PSW
+				var v = m.pop()
+				m.setPSW(byte(v))
+				m.a = byte(v >> 8)
+			case 1, 3: // RET and its alias
+				m.pc = m.pop()
+				return
+			case 5: // PCHL
+				m.pc = m.hl()
+				return
+			default:
+				bad()
+			}
+		case 2: // Jcc
+			if m.cond(y) {
+				m.pc = imm16()
+				return
+			}
+			size = 3
+		case 3:
+			switch y {
+			case 0, 1: // JMP and its alias
+				m.pc = imm16()
+				return
+			case 4: // XTHL
+				var l, h = m.load(m.sp), m.load(m.sp + 1)
+				m.store(m.sp, m.l)
+				m.store(m.sp+1, m.h)
+				m.l, m.h = l, h
+			case 5: // XCHG
+				m.d, m.e, m.h, m.l = m.h, m.l, m.d, m.e
+			default:
+				bad()
+			}
+		case 4: // Ccc
+			if m.cond(y) {
+				m.push(m.pc + 3)
+				m.pc = imm16()
+				return
+			}
+			size = 3
+		case 5:
+			switch y {
+			case 0, 2, 4: // PUSH
+				m.push(m.pair(y >> 1))
+			case 6: // PUSH PSW
+				m.push(uint16(m.a)<<8 | uint16(m.psw()))
+			default: // CALL and its aliases
+				m.push(m.pc + 3)
+				m.pc = imm16()
+				return
+			}
+		case 6:
+			m.alu(y, imm8())
+			size = 2
+		default:
+			bad()
+		}
+	}
+	m.pc += size
+}
+
+// exerModelRun runs the state st of a test of exer.asm, laid out as the
+// program keeps it, and returns the bytes of the state it leaves, as the
+// program adds them to its CRC
+func exerModelRun(st []byte, slot, mem, taken uint16) ([]byte, error) {
+	var m = &exerModel{mem: map[uint16]byte{
+		slot: st[0], slot + 1: st[1], slot + 2: st[2],
+		mem - 2: st[3], mem - 1: st[4], mem: st[5], mem + 1: st[6],
+	}}
+	m.c, m.b, m.e, m.d, m.l, m.h = st[7], st[8], st[9], st[10], st[11], st[12]
+	m.setPSW(st[13])
+	m.a, m.sp, m.pc = st[14], mem, slot
+
+	// the instruction runs from the slot, then the NOPs after a short one
+	var done = slot + 3
+	for m.pc != done && m.pc != taken && m.err == nil {
+		if m.pc < slot || m.pc >= done {
+			return nil, fmt.Errorf("%02X %02X %02X went to %04X", st[0], st[1], st[2], m.pc)
+		}
+		m.step()
+	}
+	if m.err != nil {
+		return nil, fmt.Errorf("%02X %02X %02X: %v", st[0], st[1], st[2], m.err)
+	}
+	if m.pc == taken {
+		m.sp--
+	}
+	return []byte{m.mem[mem-2], m.mem[mem-1], m.mem[mem], m.mem[mem+1],
+		m.c, m.b, m.e, m.d, m.l, m.h, m.psw(), m.a, byte(m.sp), byte(m.sp >> 8)}, nil
+}
+
+// exerModelCRCs runs the tests of exer.asm on exerModel and returns what
+// the program prints
+func exerModelCRCs(prog *asm.Program) (string, error) {
+	var org, image = prog.Binary()
+	var at = func(name string) uint16 { return prog.Symbols[name].Value }
+	var slot, mem, taken = at("SLOT"), at("MEM"), at("TAKEN")
+	var size = int(at("SIZE"))
+
+	var out strings.Builder
+	for test := int(at("TESTS") - org); image[test] != 0 || image[test+1] != 0; test += 2 + 3*size {
+		var name = int(image[test]) | int(image[test+1])<<8 - int(org)
+		out.WriteString(string(image[name : name+strings.IndexByte(string(image[name:]), '$')]))
+
+		var base, count, shift = image[test+2:], image[test+2+size:], image[test+2+2*size:]
+		var crc = crc32.NewIEEE()
+		var run = func(st []byte) error {
+			if st[0] == 0x76 {
+				return nil
+			}
+			var left, err = exerModelRun(st, slot, mem, taken)
+			crc.Write(left)
+			return err
+		}
+
+		// every combination of the bits of the counter mask, each alone
+		// and with each bit of the shift mask
+		var cur = make([]byte, size)
+		for carry := 0; carry == 0; {
+			var st = make([]byte, size)
+			for i := range st {
+				st[i] = base[i] ^ cur[i]
+			}
+			if err := run(st); err != nil {
+				return "", err
+			}
+			for i := 0; i < size; i++ {
+				for bit := 1; bit < 0x100; bit <<= 1 {
+					if shift[i]&byte(bit) != 0 {
+						st[i] ^= byte(bit)
+						var err = run(st)
+						st[i] ^= byte(bit)
+						if err != nil {
+							return "", err
+						}
+					}
+				}
+			}
+			carry = 1
+			for i := range cur {
+				var v = int(cur[i]|^count[i]) + carry
+				cur[i], carry = byte(v)&count[i], v>>8
+			}
+		}
+		fmt.Fprintf(&out, "%08X\n", crc.Sum32())
+	}
+	return out.String(), nil
+}
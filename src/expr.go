@@ -0,0 +1,358 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Expr is an expression over the machine: its registers, flags and memory.
+// It reads
+//
+//	A B C D E H L M       the registers, M the byte at HL
+//	BC DE HL SP PC PSW    the pairs, PSW as PUSH PSW stores it
+//	Z S P CY AC           the flags, 0 or 1
+//	[x] word[x]           the byte and the little endian word at x
+//	LOOP                  a symbol, its address
+//	42 0x2a 2AH $2a '*'   numbers
+//
+// with the operators, from lowest to highest precedence:
+//
+//	||
+//	&&
+//	== != < <= > >=
+//	| ^
+//	&
+//	<< >>
+//	+ -
+//	* / %
+//	unary - ! ~
+//
+// Values are ints and relations are 1 when true. Dividing by 0 gives 0.
+// The names of the registers and flags are in any case, and hide symbols of
+// the same name.
+type Expr struct {
+	src  string
+	eval func(s *State) int
+}
+
+// ParseExpr parses src with the symbols of syms, which may be nil
+func ParseExpr(src string, syms *Symbols) (*Expr, error) {
+	var toks, err = exprTokens(src)
+	if err != nil {
+		return nil, err
+	}
+	if toks[0].kind == xEOF {
+		return nil, fmt.Errorf("missing expression")
+	}
+	var p = exprParser{toks: toks, syms: syms}
+	var f exprFunc
+	if f, err = p.binary(0); err != nil {
+		return nil, err
+	}
+	if p.peek().kind != xEOF {
+		return nil, fmt.Errorf("unexpected %s in expression", p.peek().text)
+	}
+	return &Expr{src: src, eval: f}, nil
+}
+
+// Eval returns the value of e on the machine of s
+func (e *Expr) Eval(s *State) int {
+	return e.eval(s)
+}
+
+// True tells if e is not 0 on the machine of s
+func (e *Expr) True(s *State) bool {
+	return e.eval(s) != 0
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+type exprFunc func(s *State) int
+
+type exprKind int
+
+const (
+	xEOF   exprKind = iota
+	xNum            // a number, value in val
+	xIdent          // a name
+	xOp             // an operator or a bracket
+)
+
+type exprToken struct {
+	kind exprKind
+	text string
+	val  int
+}
+
+// exprOps are the operators, the longest first
+var exprOps = []string{"||", "&&", "==", "!=", "<=", ">=", "<<", ">>",
+	"<", ">", "|", "^", "&", "+", "-", "*", "/", "%", "!", "~", "(", ")", "[", "]"}
+
+func isExprIdent(c byte, first bool) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c == '_' || c == '?' || c == '@' || c == '.' ||
+		!first && c >= '0' && c <= '9'
+}
+
+// exprTokens splits an expression into tokens
+func exprTokens(s string) ([]exprToken, error) {
+	var toks []exprToken
+outer:
+	for i := 0; i < len(s); {
+		var c = s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+			continue
+		case c >= '0' && c <= '9' || c == '$':
+			var j = i + 1
+			for j < len(s) && isExprIdent(s[j], false) {
+				j++
+			}
+			var v, err = exprNumber(s[i:j])
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, exprToken{xNum, s[i:j], v})
+			i = j
+			continue
+		case isExprIdent(c, true):
+			var j = i
+			for j < len(s) && isExprIdent(s[j], false) {
+				j++
+			}
+			toks = append(toks, exprToken{kind: xIdent, text: s[i:j]})
+			i = j
+			continue
+		case c == '\'':
+			if i+2 >= len(s) || s[i+2] != '\'' {
+				return nil, fmt.Errorf("bad character %s", s[i:])
+			}
+			toks = append(toks, exprToken{xNum, s[i : i+3], int(s[i+1])})
+			i += 3
+			continue
+		}
+		for _, op := range exprOps {
+			if strings.HasPrefix(s[i:], op) {
+				toks = append(toks, exprToken{kind: xOp, text: op})
+				i += len(op)
+				continue outer
+			}
+		}
+		return nil, fmt.Errorf("unexpected character %q", c)
+	}
+	return append(toks, exprToken{kind: xEOF, text: "end"}), nil
+}
+
+// exprNumber reads a decimal number, or a hex one after 0x or $ or before H
+func exprNumber(s string) (int, error) {
+	var digits, base = s, 10
+	var upper = strings.ToUpper(s)
+	switch {
+	case strings.HasPrefix(upper, "0X"):
+		digits, base = s[2:], 16
+	case strings.HasPrefix(s, "$"):
+		digits, base = s[1:], 16
+	case strings.HasSuffix(upper, "H"):
+		digits, base = s[:len(s)-1], 16
+	}
+	var v, err = strconv.ParseUint(digits, base, 32)
+	if err != nil {
+		return 0, fmt.Errorf("bad number %s", s)
+	}
+	return int(v), nil
+}
+
+// exprRegs are the registers and flags by name
+var exprRegs = map[string]exprFunc{
+	"A":   func(s *State) int { return int(s.regA) },
+	"B":   func(s *State) int { return int(s.regB) },
+	"C":   func(s *State) int { return int(s.regC) },
+	"D":   func(s *State) int { return int(s.regD) },
+	"E":   func(s *State) int { return int(s.regE) },
+	"H":   func(s *State) int { return int(s.regH) },
+	"L":   func(s *State) int { return int(s.regL) },
+	"M":   func(s *State) int { return int(s.peek(s.hl())) },
+	"BC":  func(s *State) int { return int(pairTo16(s.regB, s.regC)) },
+	"DE":  func(s *State) int { return int(pairTo16(s.regD, s.regE)) },
+	"HL":  func(s *State) int { return int(s.hl()) },
+	"SP":  func(s *State) int { return int(s.sp) },
+	"PC":  func(s *State) int { return int(s.pc) },
+	"PSW": func(s *State) int { return int(s.psw()) },
+	"Z":   exprFlag(FlagZ),
+	"S":   exprFlag(FlagS),
+	"P":   exprFlag(FlagP),
+	"CY":  exprFlag(FlagCy),
+	"AC":  exprFlag(FlagAc),
+}
+
+func exprFlag(f Flag) exprFunc {
+	return func(s *State) int {
+		if s.flags.IsSet(f) {
+			return 1
+		}
+		return 0
+	}
+}
+
+func exprBool(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// exprBinary are the binary operators by precedence, lowest first
+var exprBinary = []map[string]func(x, y int) int{
+	{"||": func(x, y int) int { return exprBool(x != 0 || y != 0) }},
+	{"&&": func(x, y int) int { return exprBool(x != 0 && y != 0) }},
+	{
+		"==": func(x, y int) int { return exprBool(x == y) },
+		"!=": func(x, y int) int { return exprBool(x != y) },
+		"<":  func(x, y int) int { return exprBool(x < y) },
+		"<=": func(x, y int) int { return exprBool(x <= y) },
+		">":  func(x, y int) int { return exprBool(x > y) },
+		">=": func(x, y int) int { return exprBool(x >= y) },
+	},
+	{"|": func(x, y int) int { return x | y }, "^": func(x, y int) int { return x ^ y }},
+	{"&": func(x, y int) int { return x & y }},
+	{
+		"<<": func(x, y int) int { return x << uint(y&63) },
+		">>": func(x, y int) int { return x >> uint(y&63) },
+	},
+	{"+": func(x, y int) int { return x + y }, "-": func(x, y int) int { return x - y }},
+	{
+		"*": func(x, y int) int { return x * y },
+		"/": func(x, y int) int {
+			if y == 0 {
+				return 0
+			}
+			return x / y
+		},
+		"%": func(x, y int) int {
+			if y == 0 {
+				return 0
+			}
+			return x % y
+		},
+	},
+}
+
+// exprParser compiles an expression to closures by recursive descent
+type exprParser struct {
+	toks []exprToken
+	pos  int
+	syms *Symbols
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.toks[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	var t = p.toks[p.pos]
+	if t.kind != xEOF {
+		p.pos++
+	}
+	return t
+}
+
+// expect consumes the operator op
+func (p *exprParser) expect(op string) error {
+	if t := p.next(); t.kind != xOp || t.text != op {
+		return fmt.Errorf("expected %s, found %s", op, t.text)
+	}
+	return nil
+}
+
+// binary parses the operators of precedence level and above
+func (p *exprParser) binary(level int) (exprFunc, error) {
+	if level == len(exprBinary) {
+		return p.unary()
+	}
+	var x, err = p.binary(level + 1)
+	for err == nil {
+		var t = p.peek()
+		var op, ok = exprBinary[level][t.text]
+		if t.kind != xOp || !ok {
+			break
+		}
+		p.next()
+		var y exprFunc
+		if y, err = p.binary(level + 1); err == nil {
+			x = exprApply(op, x, y)
+		}
+	}
+	return x, err
+}
+
+func exprApply(op func(x, y int) int, x, y exprFunc) exprFunc {
+	return func(s *State) int { return op(x(s), y(s)) }
+}
+
+func (p *exprParser) unary() (exprFunc, error) {
+	var t = p.peek()
+	if t.kind != xOp || t.text != "-" && t.text != "!" && t.text != "~" {
+		return p.primary()
+	}
+	p.next()
+	var x, err = p.unary()
+	if err != nil {
+		return nil, err
+	}
+	switch t.text {
+	case "-":
+		return func(s *State) int { return -x(s) }, nil
+	case "!":
+		return func(s *State) int { return exprBool(x(s) == 0) }, nil
+	}
+	return func(s *State) int { return ^x(s) }, nil
+}
+
+func (p *exprParser) primary() (exprFunc, error) {
+	var t = p.next()
+	switch {
+	case t.kind == xNum:
+		var v = t.val
+		return func(s *State) int { return v }, nil
+
+	case t.kind == xOp && t.text == "(":
+		var x, err = p.binary(0)
+		if err == nil {
+			err = p.expect(")")
+		}
+		return x, err
+
+	case t.kind == xOp && t.text == "[":
+		var x, err = p.binary(0)
+		if err == nil {
+			err = p.expect("]")
+		}
+		return func(s *State) int { return int(s.peek(uint16(x(s)))) }, err
+
+	case t.kind == xIdent && strings.EqualFold(t.text, "word") && p.peek().text == "[":
+		p.next()
+		var x, err = p.binary(0)
+		if err == nil {
+			err = p.expect("]")
+		}
+		return func(s *State) int {
+			var addr = uint16(x(s))
+			return int(pairTo16(s.peek(addr+1), s.peek(addr)))
+		}, err
+
+	case t.kind == xIdent:
+		if f, ok := exprRegs[strings.ToUpper(t.text)]; ok {
+			return f, nil
+		}
+		if p.syms != nil {
+			if addr, ok := p.syms.Addr(t.text); ok {
+				return func(s *State) int { return int(addr) }, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown name %s", t.text)
+	}
+	return nil, fmt.Errorf("unexpected %s in expression", t.text)
+}
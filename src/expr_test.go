@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExpr(t *testing.T) {
+	var s = &State{regA: 0x3f, regB: 0x12, regC: 0x34, regH: 0x24, regL: 0x10, sp: 0x2000, pc: 0x100}
+	s.flags.Set(FlagZ)
+	s.flags.Set(FlagCy)
+	s.Load(0x2410, []byte{0xaa, 0x55})
+	s.Load(0x0005, []byte{0xc3, 0x06, 0xf2})
+	s.Unmap(0x8000, 0x100)
+	var syms = NewSymbols()
+	syms.Add("BDOS", 0x0005)
+	syms.Add("main.START", 0x0100)
+	syms.Add("C", 0x1234)
+
+	var table = []struct {
+		expr string
+		exp  int
+	}{
+		{"A", 0x3f},
+		{"a == 0x3f && HL > 0x2400", 1},
+		{"A == 0x3f && HL > 0x2500", 0},
+		{"BC", 0x1234},
+		{"C", 0x34},
+		{"M", 0xaa},
+		{"[HL+1]", 0x55},
+		{"word[HL]", 0x55aa},
+		{"word[BDOS+1]", 0xf206},
+		{"[0x8000]", 0xff},
+		{"PSW", 0x3f43},
+		{"Z + 2*CY + 4*S + 8*P + 16*AC", 3},
+		{"PC == main.START", 1},
+		{"SP - 2", 0x1ffe},
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"A & 0x80 == 0", 1},
+		{"(A & 0x80) == 0", 1},
+		{"1 << 4 | 1", 17},
+		{"7 / 2 + 7 % 2", 4},
+		{"1 / 0", 0},
+		{"-1", -1},
+		{"!A", 0},
+		{"~0 & 0xff", 0xff},
+		{"0FFH + $10 + 10", 0x119},
+		{"'A'", 0x41},
+		{"1 < 2 || 1 / 0", 1},
+	}
+	for _, test := range table {
+		var e, err = ParseExpr(test.expr, syms)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if v := e.Eval(s); v != test.exp {
+			t.Errorf("%s = %#x, expected %#x", test.expr, v, test.exp)
+		}
+	}
+}
+
+func TestExprErrors(t *testing.T) {
+	var table = []struct {
+		expr string
+		exp  string
+	}{
+		{"", "missing expression"},
+		{"A ==", "unexpected end in expression"},
+		{"(A", "expected ), found end"},
+		{"[HL", "expected ], found end"},
+		{"A B", "unexpected B in expression"},
+		{"NOWHERE", "unknown name NOWHERE"},
+		{"0x", "bad number 0x"},
+		{"12G", "bad number 12G"},
+		{"A # 1", "unexpected character '#'"},
+		{"'A", "bad character 'A"},
+	}
+	for _, test := range table {
+		var _, err = ParseExpr(test.expr, nil)
+		if err == nil || err.Error() != test.exp {
+			t.Errorf("%q: error %v, expected %s", test.expr, err, test.exp)
+		}
+	}
+}
+
+func TestDebuggerExpr(t *testing.T) {
+	var d = debugged(100)
+	var cond, _ = ParseExpr("[COUNT] == 3", d.Symbols)
+	d.SetBreakpoint(0x10, cond)
+	if stop := d.Run(-1, nil); stop.Reason != StopBreakpoint || d.CPU.mem[0x1000] != 3 {
+		t.Errorf("stopped %v with %d at 1000, expected at the breakpoint with 3", stop.Reason, d.CPU.mem[0x1000])
+	}
+
+	var change, _ = ParseExpr("SP", nil)
+	d.AddWatchpoint(Watchpoint{Change: change})
+	if stop := d.Run(-1, nil); stop.Reason != StopChange || stop.Old != 0x1ffe || stop.New != 0x1ffc || stop.PC != 0x11 {
+		t.Errorf("stopped %v at %04x from %#x to %#x, expected the change of SP by PUSH PSW",
+			stop.Reason, stop.PC, stop.Old, stop.New)
+	}
+	if stop := d.Back(-1); stop.Reason != StopChange || stop.Old != 0x1ffc || stop.New != 0x1ffe || stop.PC != 0x10 {
+		t.Errorf("stopped %v at %04x from %#x to %#x, expected the change of SP back",
+			stop.Reason, stop.PC, stop.Old, stop.New)
+	}
+	d.ClearWatchpoint(0)
+
+	var trace bytes.Buffer
+	d.Trace = &trace
+	d.TraceIf, _ = ParseExpr("PC == SUB && P", d.Symbols)
+	d.Run(15, nil)
+	var lines = strings.Split(strings.TrimSpace(trace.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "0010  SUB ") || !strings.HasSuffix(lines[1], "states=339") {
+		t.Errorf("traced\n%s\nexpected the 2 runs of SUB", trace.String())
+	}
+}
+
+func TestREPLExpr(t *testing.T) {
+	var d = debugged(100)
+	var out bytes.Buffer
+	var r = &REPL{D: d, Out: &out}
+	r.Run(strings.NewReader(`b SUB if [COUNT] == 2
+b
+c
+p word[SP] + 1
+watch change M
+w
+c
+w COUNT if A
+w if
+x SUB-2 2
+b SUB if (
+`))
+	var exp = `0000               31 00 20  LXI    SP, #$2000
+(8080) (8080) 0010  SUB          f5        PUSH   PSW  if [COUNT] == 2
+(8080) breakpoint
+0010  SUB          f5        PUSH   PSW
+(8080) 11 0xb
+(8080) (8080) 1: change M
+(8080) changed: M from 0x2 to 0x3
+0007  LOOP+1       cd 10 00  CALL   $0010
+(8080) (8080) missing expression
+(8080) 000e  00 00                                            ..
+(8080) unexpected end in expression
+(8080) `
+	if out.String() != exp {
+		t.Errorf("printed\n%s\nexpected\n%s", out.String(), exp)
+	}
+}
@@ -0,0 +1,568 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// HostDrive is a directory of the host seen as a CP/M drive. The files of
+// user 0 are those of the directory and the files of user n, 1 to 15, those
+// of its subdirectory n. Only the files whose names fit in 8.3 show up, in
+// upper case; the files CP/M creates get lower case names.
+//
+// The disk is not emulated: the BIOS traps the calls to the BDOS through the
+// jump at 0005 and does the file functions itself when they go to a host
+// drive. The other calls go on to the BDOS. Programs jumping straight into
+// the BDOS do not see host drives.
+type HostDrive struct {
+	Dir string
+}
+
+// hostFile is a file of a host drive
+type hostFile struct {
+	name [11]byte // as in an FCB: the name then the type, padded with spaces
+	user int
+	path string
+	size int64
+}
+
+// records is the size of f in records of 128 bytes
+func (f *hostFile) records() int {
+	return int((f.size + cpmSectorSize - 1) / cpmSectorSize)
+}
+
+// The BDOS functions the host drives answer or watch
+const (
+	bdosReset       = 13
+	bdosSelect      = 14
+	bdosOpen        = 15
+	bdosClose       = 16
+	bdosSearchFirst = 17
+	bdosSearchNext  = 18
+	bdosDelete      = 19
+	bdosRead        = 20
+	bdosWrite       = 21
+	bdosMake        = 22
+	bdosRename      = 23
+	bdosCurrent     = 25
+	bdosSetDMA      = 26
+	bdosSetAttr     = 30
+	bdosUser        = 32
+	bdosReadRand    = 33
+	bdosWriteRand   = 34
+	bdosFileSize    = 35
+	bdosSetRand     = 36
+	bdosWriteZero   = 40
+)
+
+// The fields of an FCB
+const (
+	fcbDrive  = 0
+	fcbName   = 1
+	fcbExtent = 12
+	fcbModule = 14
+	fcbCount  = 15
+	fcbRecord = 32
+	fcbRandom = 33
+)
+
+// hostState is what the BIOS knows of the BDOS to serve the host drives
+type hostState struct {
+	drive  int
+	user   int
+	dma    uint16
+	found  [][32]byte           // the directory entries left to return to search next
+	search bool                 // the last search first went to a host drive
+	opened map[uint16]*hostOpen // the files found through the FCB at each address, until closed
+}
+
+// hostOpen is a file found through an FCB, kept so that reading and writing
+// it record by record does not read the directory each time
+type hostOpen struct {
+	drive *HostDrive
+	user  int
+	file  hostFile
+}
+
+// cpmName returns the name of the host file name in an FCB, and whether CP/M
+// can spell it
+func cpmName(name string) ([11]byte, bool) {
+	var n [11]byte
+	for i := range n {
+		n[i] = ' '
+	}
+
+	var base, ext = name, ""
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		base, ext = name[:i], name[i+1:]
+	}
+	if len(base) < 1 || len(base) > 8 || len(ext) > 3 {
+		return n, false
+	}
+	for _, c := range []byte(base + ext) {
+		if c <= ' ' || c >= 0x7f || strings.IndexByte("<>.,;:=?*[]\\/|", c) >= 0 {
+			return n, false
+		}
+	}
+	copy(n[:8], strings.ToUpper(base))
+	copy(n[8:], strings.ToUpper(ext))
+	return n, true
+}
+
+// validName tells if an FCB name is one cpmName gives, which keeps the
+// host file in the directory of its drive: no path, no wildcard
+func validName(n [11]byte) bool {
+	var m, ok = cpmName(hostName(n))
+	return ok && m == n
+}
+
+// hostName is the host file name of an FCB name
+func hostName(n [11]byte) string {
+	var base = strings.TrimRight(string(n[:8]), " ")
+	var ext = strings.TrimRight(string(n[8:]), " ")
+	if ext != "" {
+		base += "." + ext
+	}
+	return strings.ToLower(base)
+}
+
+// userDir is the directory of the files of user
+func (h *HostDrive) userDir(user int) string {
+	if user == 0 {
+		return h.Dir
+	}
+	return filepath.Join(h.Dir, strconv.Itoa(user))
+}
+
+// files returns the files of user, or of every user when user is negative,
+// whose names match pattern, where ? matches any character
+func (h *HostDrive) files(user int, pattern [11]byte) []hostFile {
+	var files []hostFile
+	for u := 0; u < 16; u++ {
+		if user >= 0 && u != user {
+			continue
+		}
+		var dir = h.userDir(u)
+		var entries, _ = os.ReadDir(dir)
+		var seen = map[[11]byte]bool{}
+		for _, e := range entries {
+			var name, ok = cpmName(e.Name())
+			if !ok || !e.Type().IsRegular() || seen[name] || !nameMatches(pattern, name) {
+				continue
+			}
+			var info, err = e.Info()
+			if err != nil {
+				continue
+			}
+			seen[name] = true
+			files = append(files, hostFile{name: name, user: u, path: filepath.Join(dir, e.Name()), size: info.Size()})
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].user < files[j].user })
+	return files
+}
+
+// find returns the first file of user matching pattern, or nil
+func (h *HostDrive) find(user int, pattern [11]byte) *hostFile {
+	var files = h.files(user, pattern)
+	if len(files) == 0 {
+		return nil
+	}
+	return &files[0]
+}
+
+func nameMatches(pattern, name [11]byte) bool {
+	for i := range pattern {
+		if pattern[i] != '?' && pattern[i] != name[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// MountDir makes the directory at path drive, 0 for A:
+func (b *BIOS) MountDir(drive int, path string) error {
+	if drive < 0 || drive >= cpmDrives {
+		return fmt.Errorf("no drive %c:", 'A'+drive)
+	}
+	if info, err := os.Stat(path); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", path)
+	}
+
+	b.disks[drive] = nil
+	b.hosts[drive] = &HostDrive{Dir: path}
+	b.cpu.Trap(0x0005, b.bdosCall)
+	return nil
+}
+
+// bdosCall runs the BDOS function in C with DE when it is for a host drive,
+// or jumps to the BDOS
+func (b *BIOS) bdosCall() {
+	var s = b.cpu
+	var v, done = b.hostCall(s.regC, pairTo16(s.regD, s.regE))
+	if !done {
+		s.pc = s.read16(0x0006)
+		return
+	}
+	s.regA, s.regL, s.regB, s.regH = v, v, 0, 0
+	s.ret()
+}
+
+// hostCall runs function fn for a host drive and returns its result. It
+// tells false when the BDOS has to run fn, after taking note of the drive,
+// user and DMA address it sets.
+func (b *BIOS) hostCall(fn byte, de uint16) (byte, bool) {
+	var st = &b.host
+	switch fn {
+	case bdosReset:
+		st.drive, st.dma, st.opened = 0, 0x80, nil
+		return 0, false
+	case bdosSelect:
+		st.drive = int(de & 0x0f)
+		return 0, b.hosts[st.drive] != nil
+	case bdosCurrent:
+		return byte(st.drive), b.hosts[st.drive] != nil
+	case bdosSetDMA:
+		st.dma = de
+		return 0, false
+	case bdosUser:
+		if byte(de) != 0xff {
+			st.user = int(de & 0x0f)
+		}
+		return 0, false
+	case bdosSearchNext:
+		if !st.search {
+			return 0, false
+		}
+		return b.nextEntry(), true
+	}
+
+	var h = b.fcbDrive(de)
+	if h == nil {
+		if fn == bdosSearchFirst {
+			st.search = false
+		}
+		return 0, false
+	}
+
+	switch fn {
+	case bdosSearchFirst:
+		return b.searchFirst(h, de), true
+	case bdosOpen:
+		return b.open(h, de), true
+	case bdosClose, bdosSetAttr:
+		if b.file(h, de) == nil {
+			return 0xff, true
+		}
+		if fn == bdosClose {
+			delete(st.opened, de)
+		}
+		return 0, true
+	case bdosDelete:
+		var files = h.files(st.user, b.fcbName(de))
+		for _, f := range files {
+			b.forget(f.path)
+			os.Remove(f.path)
+		}
+		if len(files) == 0 {
+			return 0xff, true
+		}
+		return 0, true
+	case bdosMake:
+		return b.make(h, de), true
+	case bdosRename:
+		return b.rename(h, de), true
+	case bdosRead, bdosReadRand:
+		return b.readRecord(h, de, fn == bdosRead), true
+	case bdosWrite, bdosWriteRand, bdosWriteZero:
+		return b.writeRecord(h, de, fn == bdosWrite), true
+	case bdosFileSize:
+		var f = b.file(h, de)
+		if f == nil {
+			return 0xff, true
+		}
+		b.setRandom(de, f.records())
+		return 0, true
+	case bdosSetRand:
+		b.setRandom(de, b.position(de))
+		return 0, true
+	}
+	return 0, false
+}
+
+// fcbDrive returns the host drive the FCB at addr is on, or nil
+func (b *BIOS) fcbDrive(addr uint16) *HostDrive {
+	var dr = int(b.cpu.read(addr + fcbDrive))
+	switch {
+	case dr == 0 || dr == '?':
+		return b.hosts[b.host.drive]
+	case dr <= cpmDrives:
+		return b.hosts[dr-1]
+	}
+	return nil
+}
+
+// fcbName returns the name in the FCB at addr, without the attribute bits
+func (b *BIOS) fcbName(addr uint16) [11]byte {
+	var n [11]byte
+	for i := range n {
+		n[i] = b.cpu.read(addr+fcbName+uint16(i)) & 0x7f
+		if n[i] >= 'a' && n[i] <= 'z' {
+			n[i] -= 'a' - 'A'
+		}
+	}
+	return n
+}
+
+// file returns the file named in the FCB at addr, or nil. The file found is
+// kept for the next calls with the same FCB until it is closed.
+func (b *BIOS) file(h *HostDrive, addr uint16) *hostFile {
+	var st = &b.host
+	var name = b.fcbName(addr)
+	if o := st.opened[addr]; o != nil && o.drive == h && o.user == st.user && o.file.name == name {
+		return &o.file
+	}
+	var f = h.find(st.user, name)
+	if f == nil {
+		return nil
+	}
+	if st.opened == nil {
+		st.opened = map[uint16]*hostOpen{}
+	}
+	var o = &hostOpen{drive: h, user: st.user, file: *f}
+	st.opened[addr] = o
+	return &o.file
+}
+
+// forget drops the files kept for the FCBs that found the file at path
+func (b *BIOS) forget(path string) {
+	for addr, o := range b.host.opened {
+		if o.file.path == path {
+			delete(b.host.opened, addr)
+		}
+	}
+}
+
+// position returns the record the FCB at addr reads or writes next
+func (b *BIOS) position(addr uint16) int {
+	var s = b.cpu
+	var module = int(s.read(addr+fcbModule) & 0x3f)
+	var extent = int(s.read(addr+fcbExtent) & 0x1f)
+	return (module*32+extent)*128 + int(s.read(addr+fcbRecord)&0x7f)
+}
+
+// setPosition moves the FCB at addr to record rec of a file of size records
+func (b *BIOS) setPosition(addr uint16, rec, size int) {
+	var s = b.cpu
+	s.write(addr+fcbModule, byte(rec/4096))
+	s.write(addr+fcbExtent, byte(rec/128%32))
+	s.write(addr+fcbRecord, byte(rec%128))
+	s.write(addr+fcbCount, extentRecords(size, rec/128))
+}
+
+// extentRecords is the number of records of a file of size records in its
+// extent of 16K, counted from 0
+func extentRecords(size, extent int) byte {
+	var n = size - extent*128
+	switch {
+	case n < 0:
+		return 0
+	case n > 128:
+		return 128
+	}
+	return byte(n)
+}
+
+func (b *BIOS) random(addr uint16) (int, bool) {
+	var s = b.cpu
+	var rec = int(s.read16(addr + fcbRandom))
+	return rec, s.read(addr+fcbRandom+2) == 0
+}
+
+func (b *BIOS) setRandom(addr uint16, rec int) {
+	b.cpu.write16(addr+fcbRandom, uint16(rec))
+	b.cpu.write(addr+fcbRandom+2, byte(rec>>16))
+}
+
+// searchFirst finds the directory entries matching the FCB at addr, and
+// returns the first one
+func (b *BIOS) searchFirst(h *HostDrive, addr uint16) byte {
+	var st = &b.host
+	var user = st.user
+	if b.cpu.read(addr+fcbDrive) == '?' {
+		user = -1
+	}
+	var extent = b.cpu.read(addr + fcbExtent)
+
+	st.search, st.found = true, nil
+	for _, f := range h.files(user, b.fcbName(addr)) {
+		var extents = (f.records() + 127) / 128
+		if extents == 0 {
+			extents = 1
+		}
+		for e := 0; e < extents; e++ {
+			if extent != '?' && int(extent&0x1f) != e%32 {
+				continue
+			}
+			var entry [32]byte
+			entry[0] = byte(f.user)
+			copy(entry[1:], f.name[:])
+			entry[12], entry[14], entry[15] = byte(e%32), byte(e/32), extentRecords(f.records(), e)
+			st.found = append(st.found, entry)
+		}
+	}
+	return b.nextEntry()
+}
+
+// nextEntry puts the next directory entry found at the DMA address
+func (b *BIOS) nextEntry() byte {
+	var st = &b.host
+	if len(st.found) == 0 {
+		st.search = false
+		return 0xff
+	}
+	b.cpu.Load(st.dma, st.found[0][:])
+	st.found = st.found[1:]
+	return 0
+}
+
+func (b *BIOS) open(h *HostDrive, addr uint16) byte {
+	var f = b.file(h, addr)
+	if f == nil {
+		return 0xff
+	}
+	var s = b.cpu
+	var extent = int(s.read(addr+fcbModule)&0x3f)*32 + int(s.read(addr+fcbExtent)&0x1f)
+	if extent > 0 && extent*128 >= f.records() {
+		return 0xff
+	}
+	s.Load(addr+fcbName, f.name[:])
+	s.write(addr+fcbCount, extentRecords(f.records(), extent))
+	return 0
+}
+
+func (b *BIOS) make(h *HostDrive, addr uint16) byte {
+	var name = b.fcbName(addr)
+	if !validName(name) {
+		return 0xff
+	}
+
+	var path = filepath.Join(h.userDir(b.host.user), hostName(name))
+	if f := h.find(b.host.user, name); f != nil {
+		path = f.path
+	} else if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0xff
+	}
+	var f, err = os.Create(path)
+	if err != nil {
+		return 0xff
+	}
+	f.Close()
+	b.forget(path)
+
+	b.cpu.write(addr+fcbCount, 0)
+	return 0
+}
+
+// rename renames the file named in the FCB at addr to the name 16 bytes
+// further
+func (b *BIOS) rename(h *HostDrive, addr uint16) byte {
+	var f = h.find(b.host.user, b.fcbName(addr))
+	var to = b.fcbName(addr + 16)
+	if f == nil || !validName(to) || h.find(b.host.user, to) != nil {
+		return 0xff
+	}
+	b.forget(f.path)
+	if os.Rename(f.path, filepath.Join(filepath.Dir(f.path), hostName(to))) != nil {
+		return 0xff
+	}
+	return 0
+}
+
+// readRecord reads the next record of the FCB at addr, or its random record,
+// to the DMA address. The end of the last record of a file is filled with
+// ^Z. It returns 1 at the end of the file.
+func (b *BIOS) readRecord(h *HostDrive, addr uint16, sequential bool) byte {
+	var f = b.file(h, addr)
+	if f == nil {
+		return 0xff
+	}
+
+	var rec = b.position(addr)
+	if !sequential {
+		var ok bool
+		if rec, ok = b.random(addr); !ok {
+			return 6
+		}
+		b.setPosition(addr, rec, f.records())
+	}
+	if rec >= f.records() {
+		return 1
+	}
+
+	var buf [cpmSectorSize]byte
+	var file, err = os.Open(f.path)
+	if err != nil {
+		return 1
+	}
+	var n, _ = file.ReadAt(buf[:], int64(rec)*cpmSectorSize)
+	file.Close()
+	for i := n; i < len(buf); i++ {
+		buf[i] = 0x1a
+	}
+
+	b.cpu.Load(b.host.dma, buf[:])
+	if sequential {
+		b.setPosition(addr, rec+1, f.records())
+	}
+	return 0
+}
+
+// writeRecord writes the DMA buffer to the next record of the FCB at addr,
+// or to its random record
+func (b *BIOS) writeRecord(h *HostDrive, addr uint16, sequential bool) byte {
+	var f = b.file(h, addr)
+	if f == nil {
+		return 0xff
+	}
+
+	var rec = b.position(addr)
+	if !sequential {
+		var ok bool
+		if rec, ok = b.random(addr); !ok {
+			return 6
+		}
+	}
+
+	var buf [cpmSectorSize]byte
+	for i := range buf {
+		buf[i] = b.cpu.read(b.host.dma + uint16(i))
+	}
+	var file, err = os.OpenFile(f.path, os.O_WRONLY, 0)
+	if err != nil {
+		return 1
+	}
+	_, err = file.WriteAt(buf[:], int64(rec)*cpmSectorSize)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 1
+	}
+
+	if end := int64(rec+1) * cpmSectorSize; end > f.size {
+		f.size = end
+	}
+	var size = f.records()
+	if sequential {
+		rec++
+	}
+	b.setPosition(addr, rec, size)
+	return 0
+}
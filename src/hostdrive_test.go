@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCPMName(t *testing.T) {
+	var table = []struct {
+		host string
+		name string
+		ok   bool
+	}{
+		{"hello.asm", "HELLO   ASM", true},
+		{"M80.COM", "M80     COM", true},
+		{"makefile", "MAKEFILE   ", true},
+		{"a_b.c", "A_B     C  ", true},
+		{"toolongname.txt", "", false},
+		{"file.text", "", false},
+		{"two.dots.x", "", false},
+		{".hidden", "", false},
+		{"sp ace.txt", "", false},
+		{"a*b", "", false},
+	}
+
+	for _, test := range table {
+		var name, ok = cpmName(test.host)
+		if ok != test.ok || ok && string(name[:]) != test.name {
+			t.Errorf("cpmName(%q) = %q, %v, expected %q, %v", test.host, name, ok, test.name, test.ok)
+		}
+		if ok && hostName(name) != strings.ToLower(test.host) {
+			t.Errorf("hostName(%q) = %q", name, hostName(name))
+		}
+	}
+}
+
+// hostCPM returns a CP/M computer with dir as drive B: and a BDOS at 3000
+func hostCPM(t *testing.T, dir string) *CPM {
+	var cpm, err = NewCPM(0xfa00, &bufLine{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpm.CPU.Load(0x0005, []byte{0xc3, 0x00, 0x30}) // JMP 3000H
+	if err := cpm.BIOS.MountDir(1, dir); err != nil {
+		t.Fatal(err)
+	}
+	cpm.BIOS.host.dma = 0x80
+	return cpm
+}
+
+// bdos calls BDOS function fn with de and returns A, or tells the call went
+// on to the BDOS
+func bdos(c *CPM, fn byte, de uint16) (byte, bool) {
+	var s = c.CPU
+	s.regC, s.regD, s.regE = fn, byte(de>>8), byte(de)
+	s.sp = 0x100
+	s.push(0x1234)
+	s.pc = 0x0005
+	s.Step()
+	return s.regA, s.pc == 0x3000
+}
+
+// setFCB puts a clean FCB for drive and name at 0x5c
+func setFCB(c *CPM, drive byte, name string) uint16 {
+	var fcb = make([]byte, 36)
+	fcb[0] = drive
+	copy(fcb[1:], name)
+	c.CPU.Load(0x5c, fcb)
+	return 0x5c
+}
+
+func TestHostDrive(t *testing.T) {
+	var dir = t.TempDir()
+	var readme = bytes.Repeat([]byte("0123456789abcdef"), 20) // 320 bytes
+	os.WriteFile(filepath.Join(dir, "readme.md"), readme, 0644)
+	os.WriteFile(filepath.Join(dir, "toolongname.txt"), nil, 0644)
+	os.Mkdir(filepath.Join(dir, "3"), 0755)
+	os.WriteFile(filepath.Join(dir, "3", "user3.txt"), []byte("x"), 0644)
+
+	var cpm = hostCPM(t, dir)
+	var s = cpm.CPU
+
+	// The calls for other drives go to the BDOS
+	if _, passed := bdos(cpm, bdosSelect, 0); !passed {
+		t.Errorf("selecting A: did not go to the BDOS")
+	}
+	var fcb = setFCB(cpm, 0, "README  MD ")
+	if _, passed := bdos(cpm, bdosOpen, fcb); !passed {
+		t.Errorf("opening a file on A: did not go to the BDOS")
+	}
+	if a, passed := bdos(cpm, bdosSelect, 1); passed || a != 0 {
+		t.Errorf("selecting B: returned %02x, passed %v", a, passed)
+	}
+	if a, _ := bdos(cpm, bdosCurrent, 0); a != 1 {
+		t.Errorf("the current drive is %d, expected 1", a)
+	}
+
+	// Read readme.md to the end
+	fcb = setFCB(cpm, 2, "readme  md ")
+	if a, passed := bdos(cpm, bdosOpen, fcb); passed || a != 0 {
+		t.Fatalf("open returned %02x, passed %v", a, passed)
+	}
+	if rc := s.mem[fcb+fcbCount]; rc != 3 {
+		t.Errorf("rc is %d after open, expected 3", rc)
+	}
+	var got []byte
+	for {
+		var a, _ = bdos(cpm, bdosRead, fcb)
+		if a != 0 {
+			if a != 1 {
+				t.Errorf("read returned %02x at the end, expected 01", a)
+			}
+			break
+		}
+		got = append(got, s.mem[0x80:0x100]...)
+	}
+	var exp = append(append([]byte(nil), readme...), bytes.Repeat([]byte{0x1a}, 64)...)
+	if !bytes.Equal(got, exp) {
+		t.Errorf("read %d bytes:\n%q\nexpected\n%q", len(got), got, exp)
+	}
+
+	// Random access
+	if a, _ := bdos(cpm, bdosFileSize, fcb); a != 0 || s.read16(fcb+fcbRandom) != 3 {
+		t.Errorf("file size is %d records, returned %02x", s.read16(fcb+fcbRandom), a)
+	}
+	s.write16(fcb+fcbRandom, 1)
+	if a, _ := bdos(cpm, bdosReadRand, fcb); a != 0 || !bytes.Equal(s.mem[0x80:0x100], readme[128:256]) {
+		t.Errorf("random read of record 1 returned %02x, % x", a, s.mem[0x80:0x84])
+	}
+	if a, _ := bdos(cpm, bdosRead, fcb); a != 0 || !bytes.Equal(s.mem[0x80:0x100], readme[128:256]) {
+		t.Errorf("the read after the random read returned %02x, % x", a, s.mem[0x80:0x84])
+	}
+	if a, _ := bdos(cpm, bdosSetRand, fcb); a != 0 || s.read16(fcb+fcbRandom) != 2 {
+		t.Errorf("set random record gave %d, expected 2", s.read16(fcb+fcbRandom))
+	}
+	s.write16(fcb+fcbRandom, 9)
+	if a, _ := bdos(cpm, bdosReadRand, fcb); a != 1 {
+		t.Errorf("random read past the end returned %02x, expected 01", a)
+	}
+	s.mem[fcb+fcbRandom+2] = 1
+	if a, _ := bdos(cpm, bdosReadRand, fcb); a != 6 {
+		t.Errorf("random read past 8M returned %02x, expected 06", a)
+	}
+
+	// Write a new file of 130 records, the last one at random
+	fcb = setFCB(cpm, 0, "NEW     TXT")
+	if a, _ := bdos(cpm, bdosMake, fcb); a != 0 {
+		t.Fatalf("make returned %02x", a)
+	}
+	for i := 0; i < 129; i++ {
+		s.mem[0x80] = byte(i)
+		if a, _ := bdos(cpm, bdosWrite, fcb); a != 0 {
+			t.Fatalf("write %d returned %02x", i, a)
+		}
+	}
+	if ex, rec := s.mem[fcb+fcbExtent], s.mem[fcb+fcbRecord]; ex != 1 || rec != 1 {
+		t.Errorf("at extent %d record %d after 129 writes, expected 1, 1", ex, rec)
+	}
+	s.write16(fcb+fcbRandom, 0x81)
+	s.mem[fcb+fcbRandom+2] = 0
+	s.mem[0x80] = 0xaa
+	if a, _ := bdos(cpm, bdosWriteRand, fcb); a != 0 {
+		t.Errorf("random write returned %02x", a)
+	}
+	if cpm.BIOS.host.opened[fcb] == nil {
+		t.Errorf("NEW.TXT is not kept for its FCB")
+	}
+	bdos(cpm, bdosClose, fcb)
+	if cpm.BIOS.host.opened[fcb] != nil {
+		t.Errorf("NEW.TXT is still kept after close")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "new.txt"))
+	if err != nil || len(data) != 130*128 || data[128*128] != 128 || data[129*128] != 0xaa {
+		t.Errorf("new.txt is %d bytes, %v", len(data), err)
+	}
+
+	// Search the directory
+	var search = func(drive byte, pattern string) []string {
+		var names []string
+		setFCB(cpm, drive, pattern)
+		for a, _ := bdos(cpm, bdosSearchFirst, 0x5c); a != 0xff; a, _ = bdos(cpm, bdosSearchNext, 0x5c) {
+			names = append(names, string(s.mem[0x81:0x8c])+string('0'+s.mem[0x80])+string('0'+s.mem[0x8c]))
+		}
+		return names
+	}
+	var table = []struct {
+		drive   byte
+		pattern string
+		exp     []string
+	}{
+		{0, "???????????", []string{"NEW     TXT00", "README  MD 00"}},
+		{0, "????????TXT", []string{"NEW     TXT00"}},
+		{'?', "???????????", []string{"NEW     TXT00", "README  MD 00", "USER3   TXT30"}},
+	}
+	for _, test := range table {
+		var names = search(test.drive, test.pattern)
+		if strings.Join(names, ",") != strings.Join(test.exp, ",") {
+			t.Errorf("search %q found %q, expected %q", test.pattern, names, test.exp)
+		}
+	}
+	setFCB(cpm, 0, "NEW     TXT")
+	s.mem[0x5c+fcbExtent] = '?'
+	bdos(cpm, bdosSearchFirst, 0x5c)
+	if a, _ := bdos(cpm, bdosSearchNext, 0x5c); a != 0 || s.mem[0x8c] != 1 || s.mem[0x8f] != 2 {
+		t.Errorf("the second extent of NEW.TXT is %d with %d records", s.mem[0x8c], s.mem[0x8f])
+	}
+
+	// User areas, rename and delete
+	bdos(cpm, bdosUser, 3)
+	fcb = setFCB(cpm, 0, "USER3   TXT")
+	if a, _ := bdos(cpm, bdosOpen, fcb); a != 0 {
+		t.Errorf("could not open USER3.TXT of user 3")
+	}
+	fcb = setFCB(cpm, 0, "USER3   TXT")
+	copy(s.mem[fcb+16:], "\x00RENAMED TXT")
+	if a, _ := bdos(cpm, bdosRename, fcb); a != 0 {
+		t.Errorf("rename returned %02x", a)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "3", "renamed.txt")); err != nil {
+		t.Error(err)
+	}
+	fcb = setFCB(cpm, 0, "RENAMED ???")
+	if a, _ := bdos(cpm, bdosDelete, fcb); a != 0 {
+		t.Errorf("delete returned %02x", a)
+	}
+	if a, _ := bdos(cpm, bdosDelete, fcb); a != 0xff {
+		t.Errorf("deleting again returned %02x", a)
+	}
+	bdos(cpm, bdosUser, 0)
+	fcb = setFCB(cpm, 0, "USER3   TXT")
+	if a, _ := bdos(cpm, bdosOpen, fcb); a != 0xff {
+		t.Errorf("opened USER3.TXT as user 0")
+	}
+}
+
+func TestHostDriveNames(t *testing.T) {
+	var root = t.TempDir()
+	var dir = filepath.Join(root, "b")
+	os.Mkdir(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "file.txt"), nil, 0644)
+	var cpm = hostCPM(t, dir)
+	var s = cpm.CPU
+
+	for _, name := range []string{"../ESC  TXT", "A/B     TXT", "A\\B     TXT", "..      TXT", "A\x01      TXT", "NEW     T?T"} {
+		var fcb = setFCB(cpm, 2, name)
+		if a, _ := bdos(cpm, bdosMake, fcb); a != 0xff {
+			t.Errorf("make %q returned %02x, expected 0FFH", name, a)
+		}
+		fcb = setFCB(cpm, 2, "FILE    TXT")
+		copy(s.mem[fcb+16:], "\x00"+name)
+		if a, _ := bdos(cpm, bdosRename, fcb); a != 0xff {
+			t.Errorf("rename to %q returned %02x, expected 0FFH", name, a)
+		}
+	}
+	for _, d := range []string{root, dir} {
+		var entries, _ = os.ReadDir(d)
+		if len(entries) != 1 {
+			t.Errorf("%s holds %d files, expected only the drive or FILE.TXT", d, len(entries))
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+// Ports are the devices answering the IN and OUT instructions
+type Ports interface {
+	In(port byte) byte
+	Out(port byte, v byte)
+}
+
+// Bus dispatches each port to the device attached to it. Ports with nothing
+// attached read 0xff.
+type Bus struct {
+	in  [256]func() byte
+	out [256]func(v byte)
+}
+
+// Attach connects port to a device. in or out may be nil when the device
+// does not answer that direction.
+func (b *Bus) Attach(port byte, in func() byte, out func(v byte)) {
+	b.in[port], b.out[port] = in, out
+}
+
+func (b *Bus) In(port byte) byte {
+	if b.in[port] == nil {
+		return 0xff
+	}
+	return b.in[port]()
+}
+
+func (b *Bus) Out(port byte, v byte) {
+	if b.out[port] != nil {
+		b.out[port](v)
+	}
+}
+
+// Interrupter requests interrupts from the CPU. When interrupts are enabled
+// and Pending is true, the CPU runs the instruction read from Acknowledge,
+// one byte per interrupt acknowledge cycle: RST n, or CALL and its address.
+type Interrupter interface {
+	Pending() bool
+	Acknowledge() byte
+}
+
+func (s *State) in(port byte) byte {
+	if s.ports == nil {
+		return 0xff
+	}
+	return s.ports.In(port)
+}
+
+func (s *State) out(port byte, v byte) {
+	if s.ports != nil {
+		s.ports.Out(port, v)
+	}
+}
+
+// Step runs one instruction, or accepts an interrupt, and returns the
+// states it took. A halted CPU spends 4 states waiting for an interrupt.
+func (s *State) Step() int {
+	var start = s.cycles
+	switch {
+	case s.intEnable != 0 && !s.eiDelay && s.intr != nil && s.intr.Pending():
+		s.interrupt()
+	case s.halted:
+		s.cycles += 4
+	case s.trapPages[s.pc>>8] && s.traps[s.pc] != nil:
+		s.eiDelay = false
+		s.traps[s.pc]()
+		s.cycles += 10
+	case s.code != nil && s.onRead == nil:
+		s.eiDelay = false
+		s.code.exec(s)
+	default:
+		s.eiDelay = false
+		s.ExecInstruction()
+	}
+	return int(s.cycles - start)
+}
+
+// run calls step, a step of cpu, until the CPU halts with interrupts
+// disabled or stop returns true. stop is called every few thousand steps.
+func run(cpu *State, step func() int, stop func() bool) {
+	for {
+		for i := 0; i < 4096; i++ {
+			step()
+		}
+		if cpu.Halted() && cpu.intEnable == 0 || stop() {
+			return
+		}
+	}
+}
+
+// Trap makes Step call f instead of running the instruction at addr, which
+// lets Go code stand in for a subroutine. f returns from it with s.ret(), or
+// leaves pc at addr to be called again at the next step, as a routine waiting
+// for a device would loop. A trap takes the 10 states of a RET.
+func (s *State) Trap(addr uint16, f func()) {
+	if s.traps == nil {
+		s.traps = map[uint16]func(){}
+	}
+	s.traps[addr] = f
+	s.trapPages[addr>>8] = true
+}
+
+// interrupt runs the instruction given by the interrupting device. Only RST
+// and CALL do something; the other ones are taken as NOP.
+func (s *State) interrupt() {
+	s.intEnable = 0
+	s.halted = false
+
+	var opcode = s.intr.Acknowledge()
+	switch {
+	case opcode&0b1100_0111 == 0b1100_0111: // RST n
+		s.push(s.pc)
+		s.pc = uint16(opcode & 0b0011_1000)
+		s.cycles += 11
+	case opcode == 0xcd: // CALL addr
+		var low = s.intr.Acknowledge()
+		var high = s.intr.Acknowledge()
+		s.push(s.pc)
+		s.pc = pairTo16(high, low)
+		s.cycles += 17
+	default:
+		s.cycles += 4
+	}
+}
+
+// Halted tells if the CPU stopped at a HLT and waits for an interrupt
+func (s *State) Halted() bool {
+	return s.halted
+}
+
+// Cycles returns the number of states run since the start
+func (s *State) Cycles() uint64 {
+	return s.cycles
+}
@@ -0,0 +1,141 @@
+package main
+
+import "testing"
+
+// rstLine requests RST n until it is acknowledged
+type rstLine struct {
+	pending bool
+	bytes   []byte
+}
+
+func (l *rstLine) Pending() bool {
+	return l.pending
+}
+
+func (l *rstLine) Acknowledge() byte {
+	var b = l.bytes[0]
+	l.bytes = l.bytes[1:]
+	l.pending = len(l.bytes) > 0
+	return b
+}
+
+func TestInOut(t *testing.T) {
+	var bus Bus
+	var written []byte
+	bus.Attach(0x10, func() byte { return 0x42 }, func(v byte) { written = append(written, v) })
+
+	var s = State{ports: &bus, mem: [65536]byte{
+		0xdb, 0x10, // IN 10H
+		0xd3, 0x10, // OUT 10H
+		0xdb, 0x11, // IN 11H
+		0xd3, 0x11, // OUT 11H
+	}}
+	for i := 0; i < 4; i++ {
+		s.Step()
+		if i == 0 && s.regA != 0x42 {
+			t.Errorf("IN 10H: A = %02x, expected 42", s.regA)
+		}
+	}
+	if s.regA != 0xff {
+		t.Errorf("IN 11H: A = %02x, expected ff from an empty port", s.regA)
+	}
+	if string(written) != "\x42" {
+		t.Errorf("OUT 10H wrote % x", written)
+	}
+	if s.Cycles() != 40 {
+		t.Errorf("Cycles() = %d, expected 40", s.Cycles())
+	}
+}
+
+func TestInterrupts(t *testing.T) {
+	var line = &rstLine{}
+	var s = State{intr: line, sp: 0x100, mem: [65536]byte{
+		0xfb, // EI
+		0x00, // NOP
+		0x76, // HLT
+		0x38: 0xfb, // EI
+		0x39: 0xc9, // RET
+	}}
+
+	s.Step() // EI
+	line.pending, line.bytes = true, []byte{0xff}
+	s.Step() // NOP: interrupts wait for the instruction after EI
+	if s.pc != 2 {
+		t.Fatalf("interrupt accepted right after EI: pc = %04x", s.pc)
+	}
+
+	s.Step() // RST 7
+	if s.pc != 0x38 || s.read16(s.sp) != 2 || s.intEnable != 0 {
+		t.Errorf("after RST 7: pc = %04x, return = %04x, intEnable = %d", s.pc, s.read16(s.sp), s.intEnable)
+	}
+
+	s.Step() // EI
+	s.Step() // RET
+	s.Step() // HLT
+	if !s.Halted() {
+		t.Fatalf("HLT did not halt")
+	}
+	if n := s.Step(); n != 4 || s.pc != 3 {
+		t.Errorf("halted Step() = %d at %04x, expected 4 at 0003", n, s.pc)
+	}
+
+	line.pending, line.bytes = true, []byte{0xcd, 0x34, 0x12}
+	if n := s.Step(); n != 17 || s.pc != 0x1234 || s.Halted() || s.read16(s.sp) != 3 {
+		t.Errorf("CALL interrupt: %d states, pc = %04x, halted = %v, return = %04x",
+			n, s.pc, s.Halted(), s.read16(s.sp))
+	}
+
+	line.pending, line.bytes = true, []byte{0xc7}
+	s.Step()
+	if s.pc == 0 {
+		t.Errorf("interrupt accepted with interrupts disabled")
+	}
+}
+
+func TestCycles(t *testing.T) {
+	var table = []struct {
+		code   []byte
+		flags  Flags
+		cycles int
+	}{
+		{[]byte{0x00}, 0, 4},
+		{[]byte{0x7e}, 0, 7},              // MOV A, M
+		{[]byte{0xcd, 0, 0}, 0, 17},       // CALL
+		{[]byte{0xc4, 0, 0}, 0b00001, 11}, // CNZ not taken
+		{[]byte{0xc4, 0, 0}, 0, 17},       // CNZ taken
+		{[]byte{0xc0}, 0b00001, 5},        // RNZ not taken
+		{[]byte{0xc0}, 0, 11},             // RNZ taken
+		{[]byte{0xe3}, 0, 18},             // XTHL
+		{[]byte{0xdd, 0, 0}, 0, 17},       // undocumented CALL
+	}
+
+	for _, test := range table {
+		var s = State{sp: 0x100, flags: test.flags}
+		s.Load(0, test.code)
+		if n := s.Step(); n != test.cycles {
+			t.Errorf("% x: Step() = %d, expected %d", test.code, n, test.cycles)
+		}
+	}
+}
+
+func TestTrap(t *testing.T) {
+	var s = State{sp: 0x100, mem: [65536]byte{
+		0xcd, 0x00, 0x10, // CALL 1000H
+		0x76, // HLT
+	}}
+	var calls = 0
+	s.Trap(0x1000, func() {
+		if calls++; calls == 2 {
+			s.regA = 0x42
+			s.ret()
+		}
+	})
+
+	var cycles = 0
+	for !s.Halted() {
+		cycles += s.Step()
+	}
+	if calls != 2 || s.regA != 0x42 || cycles != 17+10+10+7 {
+		t.Errorf("%d calls, A = %02x, %d states, expected 2 calls, 42, 44", calls, s.regA, cycles)
+	}
+}
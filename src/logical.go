@@ -1,6 +1,8 @@
 package main
 
 func (s *State) and(x byte) {
+	// The 8080 sets Aux carry to the OR of bit 3 of the operands
+	s.flags.SetValue(FlagAc, (s.regA|x)&0x08 != 0)
 	s.regA &= x
 	s.setFlagsNoCy(s.regA)
 	s.flags.Unset(FlagCy) // AND unsets carry
@@ -10,15 +12,16 @@ func (s *State) xor(x byte) {
 	s.regA ^= x
 	s.setFlagsNoCy(s.regA)
 	s.flags.Unset(FlagCy)
+	s.flags.Unset(FlagAc)
 }
 
 func (s *State) or(x byte) {
 	s.regA |= x
 	s.setFlagsNoCy(s.regA)
 	s.flags.Unset(FlagCy)
+	s.flags.Unset(FlagAc)
 }
 
 func (s *State) cmp(x byte) {
-	var result uint16 = uint16(s.regA) + (^uint16(x) + 1)
-	s.setFlags(result)
+	s.subtract(x, 0)
 }
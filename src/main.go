@@ -1,7 +1,503 @@
 package main
 
-import "fmt"
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+)
+
+var (
+	machine  = flag.String("machine", "altair", "the machine to emulate: altair or cpm")
+	loadAddr = flag.String("load", "0", "load the image at hex `address`")
+	startPC  = flag.String("start", "", "start running at hex `address` (default: the load address)")
+	memSize  = flag.Int("mem", 64, "`KiB` of RAM of the Altair")
+	switches = flag.String("switches", "0", "the sense switches A15-A8, in hex")
+	raw      = flag.Bool("raw", false, "put the terminal in raw mode; Ctrl-] quits")
+	romFile  = flag.String("rom", "", "put the boot ROM in `file` at -romaddr and start there")
+	romAddr  = flag.String("romaddr", "ff00", "the hex `address` of the boot ROM")
+	biosAddr = flag.String("bios", "fa00", "the hex `address` of the CP/M BIOS")
+	system   = flag.String("system", "", "boot CP/M with the CCP and BDOS in `file` instead of the system tracks of A:")
+	snapIn   = flag.String("restore", "", "restore the machine from the snapshot `file` before running, with the same flags it was saved with")
+	snapOut  = flag.String("save", "", "save a snapshot of the machine in `file` when it stops")
+	recFile  = flag.String("record", "", "record in `file` what the machine reads from outside, to replay the run")
+	playFile = flag.String("replay", "", "replay the run recorded in `file`, with the same flags it was recorded with")
+	verify   = flag.Bool("verify", false, "check the hashes of the frames while replaying and stop at the first difference")
+	frame    = flag.Uint64("frame", 33333, "the `states` of a frame: a hash of the machine is recorded at the end of each")
+	threaded = flag.Bool("threaded", false, "run the CPU from threaded code, decoded ahead, which is faster")
+	debug    = flag.Bool("debug", false, "run the machine under the debugger, on a cooked terminal; Ctrl-C stops a run")
+	tui      = flag.Bool("tui", false, "run the machine under the debugger on the full screen of the terminal; ? lists the keys")
+	apiAddr  = flag.String("api", "", "serve the machine under the debugger over HTTP with JSON at `address`, host:port; GET /schema describes the API")
+	history  = flag.Int("history", 100000, "the `steps` the debugger can step back")
+	symFile  = flag.String("symbols", "", "give the debugger and the profile the symbols of the map `file`")
+	profFile = flag.String("profile", "", "profile the run in `file`: a pprof profile, or a text report if it ends in .txt")
+	covFile  = flag.String("coverage", "", "record the instructions run in the coverage profile `file`, for cmd/coverage to report")
+	disks    diskList
+	usarts   usartList
+	picPort  = flag.String("pic", "", "add an 8259 to the Altair at hex `port`, with the OUT of counter 0 of the timer on IR0, the 8251s from IR1 and the bus on IR7")
+	pitSpec  = flag.String("pit", "", "add an 8254 timer to the Altair at `port[,div][,int]`: the hex port of counter 0, the CPU states per clock of the counters and int to interrupt on the OUT of counter 0")
+)
+
+func init() {
+	flag.Var(&usarts, "usart", "add an 8251 to the Altair at `port,line[,clock][,int]`: the hex port of its data, stdio, pty or tcp:[host]:port, the TxC in Hz that paces it and int to interrupt on receive")
+	flag.Var(&disks, "disk", "mount the disk image `file` in the next drive: up to 4 .dsk on the Altair, 16 .img, .dsk or host directories for CP/M")
+}
+
+// diskList is the value of the repeated -disk flag
+type diskList []string
+
+func (d *diskList) String() string {
+	return strings.Join(*d, ",")
+}
+
+func (d *diskList) Set(path string) error {
+	if len(*d) == cpmDrives {
+		return fmt.Errorf("at most %d drives", cpmDrives)
+	}
+	*d = append(*d, path)
+	return nil
+}
+
+// picUSARTs is the number of USARTs the PIC takes, on IR1 to IR6
+const picUSARTs = 6
+
+// usartList is the value of the repeated -usart flag
+type usartList []usartSpec
+
+// usartSpec is an 8251 to add: its ports, its line, the frequency of TxC
+// and whether it interrupts on receive
+type usartSpec struct {
+	port      byte
+	line      string
+	txc       int
+	interrupt bool
+}
+
+func (u *usartList) String() string {
+	var specs []string
+	for _, spec := range *u {
+		specs = append(specs, fmt.Sprintf("%02x,%s,%d,%v", spec.port, spec.line, spec.txc, spec.interrupt))
+	}
+	return strings.Join(specs, " ")
+}
+
+func (u *usartList) Set(s string) error {
+	var f = strings.Split(s, ",")
+	if len(f) < 2 {
+		return fmt.Errorf("expected port,line[,clock][,int]")
+	}
+	var port, err = strconv.ParseUint(strings.TrimSuffix(strings.ToUpper(f[0]), "H"), 16, 8)
+	if err != nil {
+		return fmt.Errorf("bad port %s", f[0])
+	}
+	if f[1] != "stdio" && f[1] != "pty" && !strings.HasPrefix(f[1], "tcp:") {
+		return fmt.Errorf("bad line %s", f[1])
+	}
+	if *picPort != "" && len(*u) == picUSARTs {
+		return fmt.Errorf("at most %d with -pic, on IR1 to IR%d", picUSARTs, picUSARTs)
+	}
+	var spec = usartSpec{port: byte(port), line: f[1]}
+	for _, opt := range f[2:] {
+		if opt == "int" {
+			spec.interrupt = true
+		} else if spec.txc, err = strconv.Atoi(opt); err != nil || spec.txc <= 0 {
+			return fmt.Errorf("bad clock %s", opt)
+		}
+	}
+	*u = append(*u, spec)
+	return nil
+}
+
+// openLine opens the line of a USART. stdio shares the terminal of the
+// console.
+func openLine(name string, term *Terminal) Line {
+	switch {
+	case name == "stdio":
+		return term
+	case name == "pty":
+		var l, err = OpenPTY()
+		if err != nil {
+			log.Fatalf("Error opening a pty: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "8251 on %s\n", l.Path)
+		return l
+	}
+	var l, err = ListenTCP(strings.TrimPrefix(name, "tcp:"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintf(os.Stderr, "8251 on tcp %s\n", l.Addr())
+	return l
+}
 
 func main() {
-	fmt.Println("vim-go")
+	log.SetFlags(0)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: 8080emu [flags] [image]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var ok bool
+	switch *machine {
+	case "altair":
+		ok = flag.NArg() == 1 || flag.NArg() == 0 && *romFile != ""
+		ok = ok && *memSize >= 1 && *memSize <= 64 && len(disks) <= dcddDrives
+	case "cpm":
+		ok = flag.NArg() == 0
+	}
+	if !ok {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *raw && *debug {
+		log.Fatal("-debug needs a cooked terminal")
+	}
+	if *tui && (*raw || *debug) {
+		log.Fatal("-tui sets the terminal itself and takes no -raw or -debug")
+	}
+	if *apiAddr != "" && (*debug || *tui) {
+		log.Fatal("-api takes no -debug or -tui")
+	}
+	if *picPort != "" && len(usarts) > picUSARTs {
+		log.Fatalf("-pic takes at most %d -usart, on IR1 to IR%d", picUSARTs, picUSARTs)
+	}
+	if *raw || *tui {
+		var restore, err = rawMode()
+		if err != nil {
+			log.Fatalf("Error setting raw mode: %v", err)
+		}
+		defer restore()
+	}
+
+	var term = NewTerminal(os.Stdin, os.Stdout, !*raw && !*tui)
+	if *machine == "cpm" {
+		runCPM(term)
+	} else {
+		runAltair(term)
+	}
+}
+
+func runAltair(term *Terminal) {
+	var image, rom []byte
+	var err error
+	if flag.NArg() == 1 {
+		if image, err = os.ReadFile(flag.Arg(0)); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *romFile != "" {
+		if rom, err = os.ReadFile(*romFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	var load = parseHex("-load", *loadAddr)
+	var start = load
+	if rom != nil {
+		start = parseHex("-romaddr", *romAddr)
+	}
+	if *startPC != "" {
+		start = parseHex("-start", *startPC)
+	}
+
+	var altair = NewAltair(*memSize, term)
+	altair.Switches = byte(parseHex("-switches", *switches))
+	var pic *PIC
+	if *picPort != "" {
+		pic = NewPIC()
+		altair.AttachPIC(pic, byte(parseHex("-pic", *picPort)))
+	}
+	for i, spec := range usarts {
+		var u = NewUSART(openLine(spec.line, term), altair.CPU.Cycles, altair.Hz)
+		u.TxC, u.RxInterrupt = spec.txc, spec.interrupt
+		u.Attach(altair.Bus, spec.port)
+		altair.Snapshot.Add(fmt.Sprintf("usart%d", i), u)
+		if pic != nil {
+			pic.Connect(1+i, u.IRQ)
+		} else {
+			altair.AddIRQ(u.IRQ)
+		}
+	}
+	if *pitSpec != "" {
+		var f = strings.Split(*pitSpec, ",")
+		var pit = NewPIT(altair.CPU.Cycles)
+		for _, opt := range f[1:] {
+			if opt == "int" {
+				pit.Interrupt[0] = true
+			} else if div, err := strconv.ParseUint(opt, 10, 32); err == nil && div > 0 {
+				pit.Div = [3]uint64{div, div, div}
+			} else {
+				log.Fatalf("-pit: bad option %s", opt)
+			}
+		}
+		var port = parseHex("-pit", f[0])
+		if port > 0xfc {
+			log.Fatalf("-pit: bad port %s", f[0])
+		}
+		pit.Attach(altair.Bus, byte(port))
+		altair.Snapshot.Add("pit", pit)
+		if pic != nil {
+			pic.Connect(0, func() bool { return pit.Level(0) })
+		} else {
+			altair.AddIRQ(pit.IRQ)
+		}
+	}
+	for i, path := range disks {
+		if err := altair.Disks.Mount(i, path); err != nil {
+			log.Fatal(err)
+		}
+	}
+	altair.CPU.Load(load, image)
+	if rom != nil {
+		altair.LoadROM(parseHex("-romaddr", *romAddr), rom)
+	}
+	altair.CPU.pc = start
+	restoreSnapshot(&altair.Snapshot)
+	var step, over, end = startSession(altair.CPU, &altair.Snapshot, nil)
+	runMachine(altair.CPU, &altair.Snapshot, step, func() bool { return term.Quit() || over() }, term)
+	end()
+	saveSnapshot(&altair.Snapshot)
+}
+
+func runCPM(term *Terminal) {
+	var cpm, err = NewCPM(parseHex("-bios", *biosAddr), term)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *system != "" {
+		if cpm.BIOS.System, err = os.ReadFile(*system); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for i, path := range disks {
+		if err := cpm.BIOS.Mount(i, path); err != nil {
+			log.Fatal(err)
+		}
+	}
+	cpm.Boot()
+	restoreSnapshot(&cpm.Snapshot)
+	var step, over, end = startSession(cpm.CPU, &cpm.Snapshot, &cpm.BIOS.Console)
+	runMachine(cpm.CPU, &cpm.Snapshot, step, func() bool { return term.Quit() || over() }, term)
+	end()
+	saveSnapshot(&cpm.Snapshot)
+	if err := cpm.BIOS.Err(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// restoreSnapshot restores the machine from the file of -restore, if any
+func restoreSnapshot(s *Snapshot) {
+	if *snapIn == "" {
+		return
+	}
+	var f, err = os.Open(*snapIn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	if err := s.Restore(f); err != nil {
+		log.Fatalf("%s: %v", *snapIn, err)
+	}
+}
+
+// startSession records or replays the run of the machine of cpu as the
+// flags say. console is the line the machine reads outside of its ports, if
+// any. It returns the step of the run, what tells the run is over and what
+// ends the session.
+func startSession(cpu *State, snap *Snapshot, console *Line) (step func() int, over func() bool, end func()) {
+	switch {
+	case *recFile != "":
+		var f, err = os.Create(*recFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var rec *Recorder
+		if rec, err = NewRecorder(f, cpu, snap, *frame); err != nil {
+			log.Fatal(err)
+		}
+		if console != nil {
+			*console = rec.Line(*console)
+		}
+		return rec.Step, func() bool { return false }, func() {
+			var err = rec.Close()
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+	case *playFile != "":
+		var f, err = os.Open(*playFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var p *Player
+		if p, err = NewPlayer(f, cpu, snap, *verify); err != nil {
+			log.Fatalf("%s: %v", *playFile, err)
+		}
+		if console != nil {
+			*console = p.Line(*console)
+		}
+		return p.Step, p.Done, func() {
+			f.Close()
+			if p.Err() != nil {
+				log.Fatalf("%s: %v", *playFile, p.Err())
+			}
+		}
+	}
+	return cpu.Step, func() bool { return false }, func() {}
+}
+
+// runMachine runs the machine of cpu until it halts or stop returns true, or
+// under the debugger with -debug, which reads its commands from term, with
+// -tui, which takes its keys, or with -api, which restores snap to reset
+// the machine. With -threaded it runs the CPU from threaded code, with
+// -profile it profiles the run, and with -coverage records its coverage.
+func runMachine(cpu *State, snap *Snapshot, step func() int, stop func() bool, term *Terminal) {
+	var syms = loadSymbols()
+	if *threaded {
+		cpu.UseThreadedCode()
+	}
+	if *covFile != "" {
+		var cov = NewCoverage(cpu, step)
+		step = cov.Step
+		defer writeFile(*covFile, cov.Profile.Write)
+	}
+	var prof *Profiler
+	if *profFile != "" {
+		prof = NewProfiler(cpu, step)
+		step = prof.Step
+		defer writeProfile(prof, syms)
+	}
+	if !*debug && !*tui && *apiAddr == "" {
+		run(cpu, step, stop)
+		return
+	}
+	var d = NewDebugger(cpu, step, *history)
+	d.Symbols = syms
+	if *tui {
+		var u = NewTUI(d, term, os.Stdout)
+		u.Size = termSize
+		u.Run()
+		return
+	}
+	if *apiAddr != "" {
+		serveAPI(d, snap, term)
+		return
+	}
+	var interrupts = make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	var repl = &REPL{D: d, Out: os.Stdout, Stop: func() bool {
+		select {
+		case <-interrupts:
+			return true
+		default:
+			return false
+		}
+	}}
+	repl.Run(term.Lines())
+}
+
+// serveAPI serves the API on -api until POST /quit or Ctrl-C
+func serveAPI(d *Debugger, snap *Snapshot, term *Terminal) {
+	var api, err = NewAPI(d, snap, term)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", *apiAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("serving the API on http://%s", ln.Addr())
+	var srv = &http.Server{Handler: api}
+	var interrupts = make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		select {
+		case <-interrupts:
+		case <-api.Done():
+		}
+		api.Stop()
+		srv.Shutdown(context.Background())
+	}()
+	if err := srv.Serve(ln); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+// loadSymbols loads the symbols of -symbols, if any
+func loadSymbols() *Symbols {
+	if *symFile == "" {
+		return NewSymbols()
+	}
+	var f, err = os.Open(*symFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	var syms *Symbols
+	if syms, err = LoadSymbols(f); err != nil {
+		log.Fatalf("%s: %v", *symFile, err)
+	}
+	return syms
+}
+
+// writeProfile writes the profile in the file of -profile
+func writeProfile(prof *Profiler, syms *Symbols) {
+	if strings.HasSuffix(*profFile, ".txt") {
+		writeFile(*profFile, func(w io.Writer) error { return prof.Report(w, syms, 30) })
+	} else {
+		writeFile(*profFile, func(w io.Writer) error { return prof.WritePprof(w, syms) })
+	}
+}
+
+// writeFile creates the file at path and writes it with write
+func writeFile(path string, write func(w io.Writer) error) {
+	var f, err = os.Create(path)
+	if err == nil {
+		err = write(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// saveSnapshot saves the machine in the file of -save, if any
+func saveSnapshot(s *Snapshot) {
+	if *snapOut == "" {
+		return
+	}
+	var f, err = os.Create(*snapOut)
+	if err == nil {
+		err = s.Save(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func parseHex(name, s string) uint16 {
+	var v, err = strconv.ParseUint(strings.TrimSuffix(strings.ToUpper(s), "H"), 16, 16)
+	if err != nil {
+		log.Fatalf("%s: bad number %s", name, s)
+	}
+	return uint16(v)
 }
@@ -0,0 +1,96 @@
+package main
+
+// page is what answers at a 256 byte page of the address space
+type page byte
+
+const (
+	pageRAM  page = iota
+	pageROM       // reads mem, ignores writes
+	pageNone      // nothing there: reads 0xff, ignores writes
+)
+
+// read returns the byte the CPU reads at addr
+func (s *State) read(addr uint16) byte {
+	var v = s.peek(addr)
+	if s.onRead != nil {
+		s.onRead(addr, v)
+	}
+	return v
+}
+
+// write stores v at addr when there is RAM there
+func (s *State) write(addr uint16, v byte) {
+	if s.onWrite != nil {
+		s.onWrite(addr, v)
+	}
+	if s.pages[addr>>8] == pageRAM {
+		s.poke(addr, v)
+	}
+}
+
+// poke stores v at addr whatever answers there
+func (s *State) poke(addr uint16, v byte) {
+	s.mem[addr] = v
+	if s.code != nil {
+		s.code.written(addr)
+	}
+}
+
+// peek returns the byte at addr as read does, unseen by onRead
+func (s *State) peek(addr uint16) byte {
+	if s.pages[addr>>8] == pageNone {
+		return 0xff
+	}
+	return s.mem[addr]
+}
+
+// read16 returns the little endian word at addr
+func (s *State) read16(addr uint16) uint16 {
+	return pairTo16(s.read(addr+1), s.read(addr))
+}
+
+func (s *State) write16(addr uint16, v uint16) {
+	s.write(addr, byte(v))
+	s.write(addr+1, byte(v>>8))
+}
+
+// Read returns the byte at addr as the CPU would read it
+func (s *State) Read(addr uint16) byte {
+	return s.read(addr)
+}
+
+// Write stores v at addr as the CPU would
+func (s *State) Write(addr uint16, v byte) {
+	s.write(addr, v)
+}
+
+// Load copies data to addr, ROM included, wrapping around at the top of memory
+func (s *State) Load(addr uint16, data []byte) {
+	for i, b := range data {
+		if s.onWrite != nil {
+			s.onWrite(addr+uint16(i), b)
+		}
+		s.poke(addr+uint16(i), b)
+	}
+}
+
+// MapROM makes the size bytes from addr read only. Both are rounded to
+// pages of 256 bytes.
+func (s *State) MapROM(addr uint16, size int) {
+	s.mapPages(addr, size, pageROM)
+}
+
+// Unmap removes the memory of the size bytes from addr
+func (s *State) Unmap(addr uint16, size int) {
+	s.mapPages(addr, size, pageNone)
+}
+
+func (s *State) mapPages(addr uint16, size int, p page) {
+	var first, end = int(addr >> 8), (int(addr) + size + 0xff) >> 8
+	for i := first; i < 256 && i < end; i++ {
+		s.pages[i] = p
+	}
+	if s.code != nil {
+		s.code.remapped(first, end-first)
+	}
+}
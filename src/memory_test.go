@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestMemoryMap(t *testing.T) {
+	var s State
+	s.Load(0xff00, []byte{1, 2, 3})
+	s.MapROM(0xff00, 0x100)
+	s.Unmap(0x8000, 0x4000)
+
+	s.Write(0xff00, 9)
+	if s.Read(0xff00) != 1 {
+		t.Errorf("ROM written: %02x", s.Read(0xff00))
+	}
+
+	s.Write(0x8000, 9)
+	s.Write(0xbfff, 9)
+	if s.Read(0x8000) != 0xff || s.Read(0xbfff) != 0xff {
+		t.Errorf("unmapped memory reads %02x %02x, expected ff", s.Read(0x8000), s.Read(0xbfff))
+	}
+
+	s.Write(0x7fff, 9)
+	s.Write(0xc000, 9)
+	if s.Read(0x7fff) != 9 || s.Read(0xc000) != 9 {
+		t.Errorf("RAM reads %02x %02x, expected 09", s.Read(0x7fff), s.Read(0xc000))
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import "errors"
+
+// PIC is an Intel 8259A programmable interrupt controller in the 8080 mode,
+// the CPU's Interrupter. Its ports are port and port+1, A0 low and high.
+// Eight request lines IR0 to IR7 come from the devices, pushed with SetIR or
+// sampled from the functions given to Connect. The PIC resolves their
+// priorities, fully nested or rotating, masks them and answers the
+// acknowledge cycles with CALL and the address of the routine of the level.
+// Cascading is not emulated: ICW3 is taken and ignored, as is ICW4 but for
+// AEOI.
+type PIC struct {
+	sources [8]func() bool // the levels sampled at each Pending
+
+	irr    byte // the interrupt requests
+	isr    byte // the levels in service
+	imr    byte // the masked levels
+	levels byte // the levels of the IR lines
+	lowest int  // the level of lowest priority
+
+	icw1, icw2 byte
+	init       int  // the ICW expected next, picReady once initialized
+	aeoi       bool // automatic end of interrupt
+	rotateAEOI bool // rotate the priorities on automatic ends of interrupt
+	special    bool // special mask mode
+	readISR    bool // reads at A0 low return the ISR instead of the IRR
+	poll       bool // the next read at A0 low is a poll
+
+	inta  int  // the acknowledge cycles so far
+	level byte // the level being acknowledged
+}
+
+// The expected initialization words
+const (
+	picReady = iota
+	picICW1
+	picICW2
+	picICW3
+	picICW4
+)
+
+// The fields of ICW1
+const (
+	picIC4    = 1 << 0 // ICW4 follows
+	picSingle = 1 << 1 // no ICW3
+	picADI    = 1 << 2 // call address interval of 4 bytes rather than 8
+	picLTIM   = 1 << 3 // level triggered
+	picInit   = 1 << 4 // this is ICW1
+)
+
+// The fields of the OCWs and of ICW4
+const (
+	picOCW3     = 1 << 3
+	picEOI      = 1 << 5
+	picSL       = 1 << 6 // the level is given
+	picRotate   = 1 << 7
+	picRead     = 1 << 1 // OCW3: RR
+	picRIS      = 1 << 0 // OCW3: read the ISR
+	picPoll     = 1 << 2
+	picSMM      = 1 << 5
+	picESMM     = 1 << 6
+	picAEOI     = 1 << 1 // ICW4
+	picCallOp   = 0xcd   // the CALL sent on the first acknowledge
+	picLevel    = 0b0000_0111
+	picSpurious = 7 // the level answered when the request went away
+)
+
+func NewPIC() *PIC {
+	return &PIC{lowest: 7, init: picICW1}
+}
+
+// Attach puts the PIC at port and port+1
+func (p *PIC) Attach(bus *Bus, port byte) {
+	bus.Attach(port, p.ReadLow, p.WriteLow)
+	bus.Attach(port+1, p.ReadHigh, p.WriteHigh)
+}
+
+// Connect makes the PIC sample IR n from level before each decision
+func (p *PIC) Connect(n int, level func() bool) {
+	p.sources[n] = level
+}
+
+// SetIR sets the level of the request line IR n. Edge triggered requests
+// are taken on the rising edges, level triggered ones while the line is
+// high.
+func (p *PIC) SetIR(n int, high bool) {
+	var bit = byte(1) << n
+	if high {
+		if p.levels&bit == 0 || p.icw1&picLTIM != 0 {
+			p.irr |= bit
+		}
+		p.levels |= bit
+	} else {
+		p.levels &^= bit
+		if p.icw1&picLTIM != 0 {
+			p.irr &^= bit
+		}
+	}
+}
+
+func (p *PIC) sample() {
+	for n, level := range p.sources {
+		if level != nil {
+			p.SetIR(n, level())
+		}
+	}
+}
+
+// priority is the rank of level n, 0 being the highest
+func (p *PIC) priority(n int) int {
+	return (n - p.lowest + 7) % 8
+}
+
+// request returns the level to serve, or -1
+func (p *PIC) request() int {
+	if p.init != picReady {
+		return -1
+	}
+	var pending = p.irr &^ p.imr
+	var blocking = p.isr
+	if p.special {
+		blocking &^= p.imr
+	}
+	for i := 0; i < 8; i++ {
+		var n = (p.lowest + 1 + i) % 8
+		var bit = byte(1) << n
+		if blocking&bit != 0 && !p.special {
+			return -1 // a level of higher priority is in service
+		}
+		if pending&bit != 0 && blocking&bit == 0 {
+			return n
+		}
+	}
+	return -1
+}
+
+// Pending tells if the PIC interrupts the CPU
+func (p *PIC) Pending() bool {
+	if p.inta > 0 {
+		return true
+	}
+	p.sample()
+	return p.request() >= 0
+}
+
+// Acknowledge answers the three acknowledge cycles with the CALL to the
+// routine of the level of highest priority
+func (p *PIC) Acknowledge() byte {
+	p.inta++
+	switch p.inta {
+	case 1:
+		p.sample()
+		var n = p.request()
+		if n < 0 {
+			n = picSpurious
+		} else {
+			p.isr |= 1 << n
+			p.irr &^= 1 << n
+		}
+		p.level = byte(n)
+		return picCallOp
+	case 2:
+		if p.icw1&picADI != 0 {
+			return p.icw1&0xe0 | p.level<<2
+		}
+		return p.icw1&0xc0 | p.level<<3
+	}
+	p.inta = 0
+	if p.aeoi {
+		p.endOfInterrupt(int(p.level), p.rotateAEOI)
+	}
+	return p.icw2
+}
+
+// endOfInterrupt takes level n out of service, and gives it the lowest
+// priority when rotate is set
+func (p *PIC) endOfInterrupt(n int, rotate bool) {
+	if n < 0 {
+		return
+	}
+	p.isr &^= 1 << n
+	if rotate {
+		p.lowest = n
+	}
+}
+
+// inService returns the level of highest priority in service, or -1
+func (p *PIC) inService() int {
+	for i := 0; i < 8; i++ {
+		var n = (p.lowest + 1 + i) % 8
+		if p.isr&(1<<n) != 0 && !(p.special && p.imr&(1<<n) != 0) {
+			return n
+		}
+	}
+	return -1
+}
+
+// WriteLow takes ICW1, OCW2 or OCW3
+func (p *PIC) WriteLow(v byte) {
+	switch {
+	case v&picInit != 0:
+		p.icw1, p.init = v, picICW2
+		p.imr, p.isr, p.irr, p.levels = 0, 0, 0, 0
+		p.lowest, p.special, p.readISR, p.poll, p.inta = 7, false, false, false, 0
+		if v&picIC4 == 0 {
+			p.aeoi = false
+		}
+	case v&picOCW3 != 0:
+		if v&picRead != 0 {
+			p.readISR = v&picRIS != 0
+		}
+		p.poll = v&picPoll != 0
+		if v&picESMM != 0 {
+			p.special = v&picSMM != 0
+		}
+	default: // OCW2
+		var level = int(v & picLevel)
+		switch v &^ picLevel {
+		case picEOI:
+			p.endOfInterrupt(p.inService(), false)
+		case picSL | picEOI:
+			p.endOfInterrupt(level, false)
+		case picRotate | picEOI:
+			p.endOfInterrupt(p.inService(), true)
+		case picRotate:
+			p.rotateAEOI = true
+		case 0:
+			p.rotateAEOI = false
+		case picRotate | picSL | picEOI:
+			p.endOfInterrupt(level, true)
+		case picRotate | picSL:
+			p.lowest = level
+		}
+	}
+}
+
+// WriteHigh takes ICW2 to ICW4, then OCW1, the mask
+func (p *PIC) WriteHigh(v byte) {
+	switch p.init {
+	case picICW2:
+		p.icw2, p.init = v, picReady
+		if p.icw1&picSingle == 0 {
+			p.init = picICW3
+		} else if p.icw1&picIC4 != 0 {
+			p.init = picICW4
+		}
+	case picICW3:
+		p.init = picReady
+		if p.icw1&picIC4 != 0 {
+			p.init = picICW4
+		}
+	case picICW4:
+		p.aeoi, p.init = v&picAEOI != 0, picReady
+	case picReady:
+		p.imr = v
+	}
+}
+
+// ReadLow returns the IRR or the ISR, as OCW3 chose, or answers a poll:
+// bit 7 set when a level is served, with the level in bits 0-2
+func (p *PIC) ReadLow() byte {
+	if p.poll {
+		p.poll = false
+		p.sample()
+		var n = p.request()
+		if n < 0 {
+			return 0
+		}
+		p.isr |= 1 << n
+		p.irr &^= 1 << n
+		return 0x80 | byte(n)
+	}
+	p.sample()
+	if p.readISR {
+		return p.isr
+	}
+	return p.irr
+}
+
+// ReadHigh returns the mask
+func (p *PIC) ReadHigh() byte {
+	return p.imr
+}
+
+func (p *PIC) SaveState(e *Encoder) {
+	for _, v := range []byte{p.irr, p.isr, p.imr, p.levels, p.icw1, p.icw2, p.level} {
+		e.Byte(v)
+	}
+	for _, n := range []int{p.lowest, p.init, p.inta} {
+		e.Int(n)
+	}
+	for _, b := range []bool{p.aeoi, p.rotateAEOI, p.special, p.readISR, p.poll} {
+		e.Bool(b)
+	}
+}
+
+func (p *PIC) LoadState(d *Decoder) {
+	for _, v := range []*byte{&p.irr, &p.isr, &p.imr, &p.levels, &p.icw1, &p.icw2, &p.level} {
+		*v = d.Byte()
+	}
+	for _, n := range []*int{&p.lowest, &p.init, &p.inta} {
+		*n = d.Int()
+	}
+	for _, b := range []*bool{&p.aeoi, &p.rotateAEOI, &p.special, &p.readISR, &p.poll} {
+		*b = d.Bool()
+	}
+	if p.lowest < 0 || p.lowest > 7 || p.init < picReady || p.init > picICW4 || p.inta < 0 || p.inta > 2 || p.level > 7 {
+		d.Fail(errors.New("bad state"))
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// ack runs the three acknowledge cycles and returns the bytes sent
+func ack(p *PIC) []byte {
+	return []byte{p.Acknowledge(), p.Acknowledge(), p.Acknowledge()}
+}
+
+// newPIC returns a PIC initialized with icw1, vectors at page 0x20, and
+// icw4 when icw1 asks for it
+func newPIC(icw1, icw4 byte) *PIC {
+	var p = NewPIC()
+	p.WriteLow(icw1)
+	p.WriteHigh(0x20)
+	if icw1&picIC4 != 0 {
+		p.WriteHigh(icw4)
+	}
+	return p
+}
+
+func TestPICPriorities(t *testing.T) {
+	var p = NewPIC()
+	p.SetIR(0, true)
+	if p.Pending() {
+		t.Errorf("interrupt before the initialization")
+	}
+
+	p = newPIC(0x16, 0) // interval 4, single, edge triggered
+	p.SetIR(3, true)
+	p.SetIR(5, true)
+
+	var table = []struct {
+		what    string
+		do      func()
+		pending bool
+		call    []byte
+		isr     byte
+	}{
+		{"IR3 and IR5", nil, true, []byte{0xcd, 0x0c, 0x20}, 0x08},
+		{"IR5 waits", nil, false, nil, 0x08},
+		{"IR1 nests", func() { p.SetIR(1, true) }, true, []byte{0xcd, 0x04, 0x20}, 0x0a},
+		{"EOI of IR1", func() { p.WriteLow(picEOI) }, false, nil, 0x08},
+		{"EOI of IR3", func() { p.WriteLow(picEOI) }, true, []byte{0xcd, 0x14, 0x20}, 0x20},
+		{"specific EOI", func() { p.WriteLow(picSL | picEOI | 5) }, false, nil, 0},
+		{"IR3 still high", nil, false, nil, 0},
+		{"masked", func() { p.WriteHigh(0x01); p.SetIR(0, true) }, false, nil, 0},
+		{"unmasked", func() { p.WriteHigh(0) }, true, []byte{0xcd, 0x00, 0x20}, 0x01},
+	}
+
+	for _, test := range table {
+		if test.do != nil {
+			test.do()
+		}
+		if pending := p.Pending(); pending != test.pending {
+			t.Errorf("%s: pending %v", test.what, pending)
+		}
+		if test.call != nil {
+			if call := ack(p); !bytes.Equal(call, test.call) {
+				t.Errorf("%s: acknowledged with % x, expected % x", test.what, call, test.call)
+			}
+		}
+		if p.isr != test.isr {
+			t.Errorf("%s: ISR %08b, expected %08b", test.what, p.isr, test.isr)
+		}
+	}
+}
+
+func TestPICModes(t *testing.T) {
+	// Interval 8, level triggered, AEOI
+	var p = newPIC(0xe0|picInit|picLTIM|picSingle|picIC4, picAEOI)
+	var level = true
+	p.Connect(2, func() bool { return level })
+	if call := ack(p); !bytes.Equal(call, []byte{0xcd, 0xd0, 0x20}) {
+		t.Errorf("acknowledged with % x, expected cd d0 20", call)
+	}
+	if p.isr != 0 || !p.Pending() {
+		t.Errorf("ISR %08b after AEOI; a level request is pending again", p.isr)
+	}
+	level = false
+	if p.Pending() {
+		t.Errorf("pending once the level went down")
+	}
+
+	// Rotation: IR0 goes to the lowest priority
+	p = newPIC(0x16, 0)
+	p.SetIR(0, true)
+	ack(p)
+	p.WriteLow(picRotate | picEOI)
+	p.SetIR(0, false)
+	p.SetIR(0, true)
+	p.SetIR(4, true)
+	if call := ack(p); call[1] != 0x10 {
+		t.Errorf("served level %d after rotating, expected 4", call[1]>>2)
+	}
+	p.WriteLow(picRotate | picSL | 3) // IR4 first
+	p.WriteLow(picEOI)
+	p.SetIR(7, true)
+	if call := ack(p); call[1] != 0x1c {
+		t.Errorf("served level %d with IR4 first, expected 7", call[1]>>2)
+	}
+
+	// Special mask mode lets lower levels in while IR7 is masked
+	p.WriteLow(picEOI)
+	p = newPIC(0x16, 0)
+	p.SetIR(1, true)
+	ack(p)
+	p.SetIR(6, true)
+	if p.Pending() {
+		t.Errorf("IR6 interrupts IR1")
+	}
+	p.WriteLow(picOCW3 | picESMM | picSMM)
+	p.WriteHigh(0x02)
+	if !p.Pending() {
+		t.Errorf("IR6 does not interrupt IR1 masked in special mask mode")
+	}
+
+	// Spurious request: gone before the acknowledge
+	p = newPIC(0x16|picLTIM, 0)
+	p.SetIR(2, true)
+	p.Pending()
+	p.SetIR(2, false)
+	if call := ack(p); call[1] != 0x1c {
+		t.Errorf("acknowledged level %d without request, expected 7", call[1]>>2)
+	}
+}
+
+func TestPICRead(t *testing.T) {
+	var p = newPIC(0x16, 0)
+	p.WriteHigh(0x81)
+	p.SetIR(3, true)
+	p.SetIR(7, true)
+	if irr := p.ReadLow(); irr != 0x88 {
+		t.Errorf("IRR %02x, expected 88", irr)
+	}
+	if imr := p.ReadHigh(); imr != 0x81 {
+		t.Errorf("IMR %02x, expected 81", imr)
+	}
+
+	p.WriteLow(picOCW3 | picPoll)
+	if poll := p.ReadLow(); poll != 0x83 {
+		t.Errorf("poll %02x, expected 83", poll)
+	}
+	p.WriteLow(picOCW3 | picRead | picRIS)
+	if isr := p.ReadLow(); isr != 0x08 {
+		t.Errorf("ISR %02x after the poll, expected 08", isr)
+	}
+	p.WriteLow(picOCW3 | picPoll)
+	if poll := p.ReadLow(); poll != 0 {
+		t.Errorf("poll %02x with IR3 in service, expected 00", poll)
+	}
+}
+
+func TestPICCPU(t *testing.T) {
+	var bus = &Bus{}
+	var p = NewPIC()
+	p.Attach(bus, 0x20)
+
+	var s = State{ports: bus, intr: p, sp: 0x100, mem: [65536]byte{
+		0x3e, 0x16, // MVI A, 16H: ICW1
+		0xd3, 0x20, // OUT 20H
+		0x3e, 0x02, // MVI A, 02H: ICW2, vectors at 0200H
+		0xd3, 0x21, // OUT 21H
+		0xfb,   // EI
+		0x76,   // HLT
+		0x76,   // HLT
+		0x0214: 0x3e, 0x20, // MVI A, 20H: EOI
+		0xd3, 0x20, // OUT 20H
+		0x3c, // INR A
+		0xfb, // EI
+		0xc9, // RET
+	}}
+
+	for i := 0; i < 6; i++ {
+		s.Step()
+	}
+	if !s.Halted() || s.pc != 0x000a {
+		t.Fatalf("halted %v at %04x, expected at 000a", s.Halted(), s.pc)
+	}
+
+	p.SetIR(5, true)
+	var cycles = 0
+	for i := 0; i < 7; i++ {
+		cycles += s.Step()
+	}
+	if s.regA != 0x21 || s.pc != 0x000b || p.isr != 0 || cycles != 17+7+10+5+4+10+7 {
+		t.Errorf("A = %02x, pc = %04x, ISR %02x, %d states", s.regA, s.pc, p.isr, cycles)
+	}
+}
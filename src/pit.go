@@ -0,0 +1,532 @@
+package main
+
+import "fmt"
+
+// PIT is an Intel 8254 programmable interval timer, a superset of the 8253
+// adding the read-back command: three 16 bit counters at port to port+2 and
+// the control word at port+3. The counters count down in binary or BCD in
+// one of six modes, at one clock every Div states of the CPU.
+//
+// The rising edges of the OUT of the counters with Interrupt set request an
+// interrupt until IRQ reports it. An interrupt controller samples OUT with
+// Level, and OnOut sees every change of OUT, to play tones.
+type PIT struct {
+	clock     func() uint64 // the states run by the CPU
+	counters  [3]pitCounter
+	Div       [3]uint64 // CPU states per clock of each counter
+	Interrupt [3]bool
+	irq       [3]bool
+	OnOut     func(counter int, high bool, cycle uint64)
+}
+
+// pitCounter is a counter of the PIT
+type pitCounter struct {
+	mode byte // 0 to 5
+	rw   byte // how the count is read and written: 1 LSB, 2 MSB, 3 LSB then MSB
+	bcd  bool
+
+	cr        int  // the count register
+	writeHigh bool // the LSB is written, the MSB is next
+	hasCount  bool // a count was written since the control word
+	nullCount bool // cr was written and is not loaded yet
+
+	ce       int  // the counting element
+	load     bool // cr goes to ce at the next clock
+	counting bool
+	armed    bool // the terminal count of the one shot modes is still to come
+	gate     bool
+	trigger  bool // the gate rose since the last clock
+	out      bool
+	fell     bool // out fell since Level last sampled it
+
+	latched   bool // ol holds the count latched
+	ol        int
+	readHigh  bool // the LSB was read, the MSB is next
+	hasStatus bool // status holds the status latched
+	status    byte
+
+	since uint64 // the CPU state of the last clock
+}
+
+// The fields of the control word
+const (
+	pitSelect   = 0b1100_0000 // the counter, or 3 for read-back
+	pitRW       = 0b0011_0000 // 0 to latch the count
+	pitMode     = 0b0000_1110
+	pitBCD      = 0b0000_0001
+	pitReadBack = 3
+
+	pitNoCount  = 1 << 5 // read-back: do not latch the count
+	pitNoStatus = 1 << 4 // read-back: do not latch the status
+)
+
+// The bits of the status of read-back
+const (
+	pitStatusOut  = 1 << 7
+	pitStatusNull = 1 << 6
+)
+
+// NewPIT returns a PIT clocked by clock, usually the Cycles method of the
+// CPU. The gates of the counters are high.
+func NewPIT(clock func() uint64) *PIT {
+	var p = &PIT{clock: clock, Div: [3]uint64{1, 1, 1}}
+	for i := range p.counters {
+		p.counters[i].gate = true
+	}
+	return p
+}
+
+// Attach puts the counters at port to port+2 and the control word at port+3
+func (p *PIT) Attach(bus *Bus, port byte) {
+	for i := 0; i < 3; i++ {
+		var n = i
+		bus.Attach(port+byte(i), func() byte { return p.ReadCounter(n) }, func(v byte) { p.WriteCounter(n, v) })
+	}
+	bus.Attach(port+3, nil, p.Control)
+}
+
+// update runs the counters up to the current state of the CPU
+func (p *PIT) update() {
+	var now = p.clock()
+	for i := range p.counters {
+		var c = &p.counters[i]
+		var div = p.Div[i]
+		if div == 0 {
+			div = 1
+		}
+		for now-c.since >= div {
+			var ticks = (now - c.since) / div
+			var n = c.idle()
+			if n == 0 {
+				c.since += div
+				p.tick(i)
+				continue
+			}
+			if n > ticks {
+				n = ticks
+			}
+			c.skip(n)
+			c.since += n * div
+		}
+	}
+}
+
+// tick runs a clock of counter i
+func (p *PIT) tick(i int) {
+	var c = &p.counters[i]
+	var was = c.out
+	c.tick()
+	if c.out != was {
+		c.fell = c.fell || !c.out
+		if c.out && p.Interrupt[i] {
+			p.irq[i] = true
+		}
+		if p.OnOut != nil {
+			p.OnOut(i, c.out, c.since)
+		}
+	}
+}
+
+// setOut changes OUT out of the clocks, on a control word or the gate
+func (p *PIT) setOut(i int, high bool) {
+	var c = &p.counters[i]
+	if c.out == high {
+		return
+	}
+	c.out = high
+	c.fell = c.fell || !high
+	if high && p.Interrupt[i] {
+		p.irq[i] = true
+	}
+	if p.OnOut != nil {
+		p.OnOut(i, high, p.clock())
+	}
+}
+
+// modulus is the number of values of the counter
+func (c *pitCounter) modulus() int {
+	if c.bcd {
+		return 10000
+	}
+	return 0x10000
+}
+
+// initial is the count loaded from cr, where 0 stands for the modulus
+func (c *pitCounter) initial() int {
+	if c.cr == 0 {
+		return c.modulus()
+	}
+	return c.cr
+}
+
+func (c *pitCounter) reload() {
+	c.ce, c.load, c.nullCount, c.counting = c.initial(), false, false, true
+}
+
+func (c *pitCounter) tick() {
+	switch c.mode {
+	case 0, 4:
+		if c.load {
+			c.reload()
+			c.armed = true
+			return
+		}
+		if !c.counting || !c.gate {
+			return
+		}
+		if c.mode == 4 && !c.out {
+			c.out = true // the strobe lasts one clock
+		}
+		c.decrement(1)
+		if c.ce == 0 && c.armed {
+			c.out, c.armed = c.mode == 0, false
+		}
+
+	case 1, 5:
+		if c.trigger {
+			c.trigger = false
+			if c.hasCount {
+				c.reload()
+				c.armed = true
+				c.out = c.mode == 5
+			}
+			return
+		}
+		if !c.counting {
+			return
+		}
+		if c.mode == 5 && !c.out {
+			c.out = true
+		}
+		c.decrement(1)
+		if c.ce == 0 && c.armed {
+			c.out, c.armed = c.mode == 1, false
+		}
+
+	case 2:
+		if !c.gate {
+			return
+		}
+		if c.trigger || c.load && !c.counting {
+			c.trigger = false
+			c.reload()
+			return
+		}
+		if !c.counting {
+			return
+		}
+		if c.ce == 1 {
+			c.out = true
+			c.reload()
+		} else if c.decrement(1); c.ce == 1 {
+			c.out = false
+		}
+
+	case 3:
+		if !c.gate {
+			return
+		}
+		if c.trigger || c.load && !c.counting {
+			c.trigger = false
+			c.reload()
+			return
+		}
+		if !c.counting {
+			return
+		}
+		// Odd counts take one more clock high than low
+		var step = 2
+		if c.ce%2 == 1 {
+			step = 3
+			if c.out {
+				step = 1
+			}
+		}
+		if c.ce -= step; c.ce <= 0 {
+			c.out = !c.out
+			c.reload()
+		}
+	}
+}
+
+func (c *pitCounter) decrement(n int) {
+	var m = c.modulus()
+	c.ce = ((c.ce-n)%m + m) % m
+}
+
+// idle is the number of clocks to come that change nothing but the count,
+// which skip runs at once
+func (c *pitCounter) idle() uint64 {
+	const forever = 1 << 40
+	switch {
+	case c.load || c.trigger:
+		return 0
+	case c.stopped():
+		return forever
+	}
+
+	switch c.mode {
+	case 4, 5:
+		if !c.out {
+			return 0
+		}
+		fallthrough
+	case 0, 1:
+		if !c.armed {
+			return forever
+		}
+		if c.ce > 1 {
+			return uint64(c.ce - 1)
+		}
+	case 2:
+		if c.ce > 2 {
+			return uint64(c.ce - 2)
+		}
+	case 3:
+		if c.ce%2 == 0 && c.ce > 2 {
+			return uint64(c.ce-2) / 2
+		}
+	}
+	return 0
+}
+
+// stopped tells if the counter does not count: it has no count, or its gate
+// holds it
+func (c *pitCounter) stopped() bool {
+	return !c.counting || !c.gate && c.mode != 1 && c.mode != 5
+}
+
+func (c *pitCounter) skip(n uint64) {
+	switch {
+	case c.stopped():
+	case c.mode == 3:
+		c.ce -= int(2 * n)
+	default:
+		c.decrement(int(n % uint64(c.modulus())))
+	}
+}
+
+// Control takes a control word: a mode, a latch or a read-back command
+func (p *PIT) Control(v byte) {
+	p.update()
+	var sel = int(v&pitSelect) >> 6
+	if sel == pitReadBack {
+		for i := range p.counters {
+			if v&(2<<i) == 0 {
+				continue
+			}
+			var c = &p.counters[i]
+			if v&pitNoStatus == 0 && !c.hasStatus {
+				c.hasStatus, c.status = true, c.statusByte()
+			}
+			if v&pitNoCount == 0 {
+				c.latch()
+			}
+		}
+		return
+	}
+
+	var c = &p.counters[sel]
+	if v&pitRW == 0 {
+		c.latch()
+		return
+	}
+
+	var mode = v & pitMode >> 1
+	if mode > 5 {
+		mode -= 4 // 6 and 7 are 2 and 3
+	}
+	var gate = c.gate
+	*c = pitCounter{mode: mode, rw: v & pitRW >> 4, bcd: v&pitBCD != 0, gate: gate, out: c.out, since: c.since, nullCount: true}
+	p.setOut(sel, mode != 0)
+}
+
+func (c *pitCounter) statusByte() byte {
+	var st = c.rw<<4 | c.mode<<1
+	if c.bcd {
+		st |= pitBCD
+	}
+	if c.out {
+		st |= pitStatusOut
+	}
+	if c.nullCount {
+		st |= pitStatusNull
+	}
+	return st
+}
+
+// latch keeps the count to read, unless one is already waiting
+func (c *pitCounter) latch() {
+	if !c.latched {
+		c.latched, c.ol, c.readHigh = true, c.ce, false
+	}
+}
+
+// WriteCounter writes a byte of the count of counter n
+func (p *PIT) WriteCounter(n int, v byte) {
+	p.update()
+	var c = &p.counters[n]
+	if c.rw == 0 {
+		return
+	}
+
+	var value = int(v)
+	if c.bcd {
+		value = int(v>>4)*10 + int(v&0x0f)
+	}
+	switch {
+	case c.rw == 1:
+		c.cr = value
+	case c.rw == 2:
+		c.cr = value * 100
+		if !c.bcd {
+			c.cr = value << 8
+		}
+	case !c.writeHigh:
+		c.cr, c.writeHigh = value, true
+		if c.mode == 0 {
+			c.counting = false // writing the first byte stops mode 0
+		}
+		return
+	default:
+		if c.bcd {
+			c.cr += value * 100
+		} else {
+			c.cr = c.cr&0xff | value<<8
+		}
+		c.writeHigh = false
+	}
+
+	c.hasCount, c.nullCount = true, true
+	switch c.mode {
+	case 0:
+		c.load = true
+		p.setOut(n, false)
+	case 4:
+		c.load = true
+	case 2, 3:
+		c.load = !c.counting
+	}
+}
+
+// ReadCounter reads a byte of the status latched, or of the count latched,
+// or of the count
+func (p *PIT) ReadCounter(n int) byte {
+	p.update()
+	var c = &p.counters[n]
+	if c.hasStatus {
+		c.hasStatus = false
+		return c.status
+	}
+
+	var value = c.ce
+	if c.latched {
+		value = c.ol
+	}
+	value %= c.modulus()
+	var low, high = byte(value), byte(value >> 8)
+	if c.bcd {
+		low, high = toBCD(value%100), toBCD(value/100)
+	}
+
+	var b byte
+	switch {
+	case c.rw == 1:
+		b, c.latched = low, false
+	case c.rw == 2:
+		b, c.latched = high, false
+	case !c.readHigh:
+		b, c.readHigh = low, true
+	default:
+		b, c.readHigh, c.latched = high, false, false
+	}
+	return b
+}
+
+func toBCD(v int) byte {
+	return byte(v/10<<4 | v%10)
+}
+
+// SetGate sets the GATE input of counter n. A rising gate starts the one
+// shots and restarts the rate and square wave generators; a low gate stops
+// the counters of modes 0, 2, 3 and 4 and drives OUT high in modes 2 and 3.
+func (p *PIT) SetGate(n int, high bool) {
+	p.update()
+	var c = &p.counters[n]
+	if high && !c.gate && c.mode != 0 && c.mode != 4 {
+		c.trigger = true
+	}
+	c.gate = high
+	if !high && (c.mode == 2 || c.mode == 3) {
+		p.setOut(n, true)
+	}
+}
+
+// Out returns the level of the OUT of counter n
+func (p *PIT) Out(n int) bool {
+	p.update()
+	return p.counters[n].out
+}
+
+// Level returns the level of the OUT of counter n for a device sampling it.
+// OUT reads low once after it fell, even if it rose again since the last
+// sample, so that the short pulses of modes 2, 4 and 5 show their edges.
+func (p *PIT) Level(n int) bool {
+	p.update()
+	var c = &p.counters[n]
+	if c.fell {
+		c.fell = false
+		return false
+	}
+	return c.out
+}
+
+// IRQ tells if a counter requested an interrupt, and forgets the request:
+// the CPU takes it as it sees it.
+func (p *PIT) IRQ() bool {
+	p.update()
+	for i, irq := range p.irq {
+		if irq {
+			p.irq[i] = false
+			return true
+		}
+	}
+	return false
+}
+
+func (p *PIT) SaveState(e *Encoder) {
+	for i := range p.counters {
+		var c = &p.counters[i]
+		e.Byte(c.mode)
+		e.Byte(c.rw)
+		e.Byte(c.status)
+		for _, n := range []int{c.cr, c.ce, c.ol} {
+			e.Int(n)
+		}
+		for _, b := range []bool{c.bcd, c.writeHigh, c.hasCount, c.nullCount, c.load, c.counting, c.armed,
+			c.gate, c.trigger, c.out, c.fell, c.latched, c.readHigh, c.hasStatus, p.irq[i]} {
+			e.Bool(b)
+		}
+		e.Uint64(c.since)
+	}
+}
+
+func (p *PIT) LoadState(d *Decoder) {
+	for i := range p.counters {
+		var c = &p.counters[i]
+		c.mode = d.Byte()
+		c.rw = d.Byte()
+		c.status = d.Byte()
+		for _, n := range []*int{&c.cr, &c.ce, &c.ol} {
+			*n = d.Int()
+		}
+		for _, b := range []*bool{&c.bcd, &c.writeHigh, &c.hasCount, &c.nullCount, &c.load, &c.counting, &c.armed,
+			&c.gate, &c.trigger, &c.out, &c.fell, &c.latched, &c.readHigh, &c.hasStatus, &p.irq[i]} {
+			*b = d.Bool()
+		}
+		c.since = d.Uint64()
+		if c.mode > 5 || c.rw > 3 {
+			d.Fail(fmt.Errorf("counter %d: bad mode", i))
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// pitEdges returns a PIT clocked by *now and the log of its OUT changes
+func pitEdges(now *uint64) (*PIT, *[]string) {
+	var log []string
+	var p = NewPIT(func() uint64 { return *now })
+	p.OnOut = func(n int, high bool, cycle uint64) {
+		var level = "L"
+		if high {
+			level = "H"
+		}
+		log = append(log, fmt.Sprintf("%d%s@%d", n, level, cycle))
+	}
+	return p, &log
+}
+
+func TestPITModes(t *testing.T) {
+	var table = []struct {
+		what    string
+		control byte
+		count   []byte
+		gate    func(p *PIT, now uint64) // changes the gate along the way
+		until   uint64
+		exp     string
+	}{
+		{"mode 0", 0b00_11_000_0, []byte{5, 0}, nil, 20, "0H@6"},
+		{"mode 1", 0b00_11_001_0, []byte{3, 0}, func(p *PIT, now uint64) {
+			if now == 4 {
+				p.SetGate(0, false)
+			} else if now == 5 {
+				p.SetGate(0, true)
+			}
+		}, 20, "0L@6 0H@9"},
+		{"mode 2", 0b00_11_010_0, []byte{4, 0}, nil, 13, "0L@4 0H@5 0L@8 0H@9 0L@12 0H@13"},
+		{"mode 3 even", 0b00_11_011_0, []byte{4, 0}, nil, 13, "0L@3 0H@5 0L@7 0H@9 0L@11 0H@13"},
+		{"mode 3 odd", 0b00_11_011_0, []byte{5, 0}, nil, 11, "0L@4 0H@6 0L@9 0H@11"},
+		{"mode 4", 0b00_11_100_0, []byte{3, 0}, nil, 20, "0L@4 0H@5"},
+		{"mode 5", 0b00_11_101_0, []byte{3, 0}, func(p *PIT, now uint64) {
+			if now == 2 {
+				p.SetGate(0, false)
+			} else if now == 3 {
+				p.SetGate(0, true)
+			}
+		}, 20, "0L@7 0H@8"},
+		{"mode 2 gated", 0b00_11_010_0, []byte{3, 0}, func(p *PIT, now uint64) {
+			if now == 3 {
+				p.SetGate(0, false)
+			} else if now == 6 {
+				p.SetGate(0, true)
+			}
+		}, 11, "0L@3 0H@3 0L@9 0H@10"},
+		{"LSB only", 0b00_01_010_0, []byte{2}, nil, 5, "0L@2 0H@3 0L@4 0H@5"},
+	}
+
+	for _, test := range table {
+		var now uint64
+		var p, log = pitEdges(&now)
+		p.Control(test.control)
+		*log = nil
+		for _, b := range test.count {
+			p.WriteCounter(0, b)
+		}
+		for now = 1; now <= test.until; now++ {
+			if test.gate != nil {
+				test.gate(p, now)
+			}
+			p.Out(0)
+		}
+		if got := strings.Join(*log, " "); got != test.exp {
+			t.Errorf("%s: OUT went %s, expected %s", test.what, got, test.exp)
+		}
+	}
+}
+
+func TestPITRead(t *testing.T) {
+	var now uint64
+	var p = NewPIT(func() uint64 { return now })
+
+	// Binary, LSB then MSB, with a latch
+	p.Control(0b01_11_000_0)
+	p.WriteCounter(1, 0x34)
+	p.WriteCounter(1, 0x12)
+	now = 3 // loaded, then two clocks
+	p.Control(0b01_00_000_0)
+	now = 10
+	if low, high := p.ReadCounter(1), p.ReadCounter(1); low != 0x32 || high != 0x12 {
+		t.Errorf("read %02x%02x latched, expected 1232", high, low)
+	}
+	if low, high := p.ReadCounter(1), p.ReadCounter(1); low != 0x2b || high != 0x12 {
+		t.Errorf("read %02x%02x, expected 122b", high, low)
+	}
+
+	// BCD from 0, which is 10000
+	p.Control(0b10_11_000_1)
+	p.WriteCounter(2, 0)
+	p.WriteCounter(2, 0)
+	now += 3
+	if low, high := p.ReadCounter(2), p.ReadCounter(2); low != 0x98 || high != 0x99 {
+		t.Errorf("read %02x%02x in BCD, expected 9998", high, low)
+	}
+	p.Control(0b10_10_000_1) // MSB only
+	p.WriteCounter(2, 0x12)
+	now += 2
+	if high := p.ReadCounter(2); high != 0x11 {
+		t.Errorf("read %02x as the MSB of 1200 in BCD less one, expected 11", high)
+	}
+
+	// Read-back of the status and the count of counter 0
+	p.Control(0b00_11_010_0)
+	p.WriteCounter(0, 0)
+	p.WriteCounter(0, 1)
+	p.Control(0b11_00_001_0)
+	if st := p.ReadCounter(0); st != 0xf4 {
+		t.Errorf("status %02x before the count is loaded, expected f4", st)
+	}
+	now++
+	if low, high := p.ReadCounter(0), p.ReadCounter(0); low != 0 || high != 0 {
+		t.Errorf("read %02x%02x, the count latched with the status", high, low)
+	}
+	p.Control(0b11_10_001_0) // the status only
+	if st := p.ReadCounter(0); st != 0xb4 {
+		t.Errorf("status %02x once the count is loaded, expected b4", st)
+	}
+	if low, high := p.ReadCounter(0), p.ReadCounter(0); low != 0 || high != 1 {
+		t.Errorf("read %02x%02x after the status, expected 0100", high, low)
+	}
+}
+
+func TestPITInterrupts(t *testing.T) {
+	var now uint64
+	var p = NewPIT(func() uint64 { return now })
+	p.Interrupt[0] = true
+	p.Div[0] = 100
+
+	p.Control(0b00_11_010_0) // a rate generator
+	p.WriteCounter(0, 0)
+	p.WriteCounter(0, 0) // 65536 clocks
+
+	// Run 1000 periods at once
+	var periods = 0
+	var edges = 0
+	p.OnOut = func(n int, high bool, cycle uint64) {
+		if high {
+			edges++
+		}
+	}
+	now = 1000*65536*100 + 100
+	if p.IRQ() {
+		periods++
+	}
+	if edges != 1000 || periods != 1 {
+		t.Errorf("%d rising edges, %d interrupts, expected 1000 and 1", edges, periods)
+	}
+	if p.IRQ() {
+		t.Errorf("the interrupt was requested again")
+	}
+
+	// Mode 0 interrupts once
+	p.Control(0b00_11_000_0)
+	p.WriteCounter(0, 10)
+	p.WriteCounter(0, 0)
+	now += 100 * 20
+	if !p.IRQ() || p.IRQ() {
+		t.Errorf("mode 0 did not interrupt once")
+	}
+	now += 100 * 0x20000
+	if p.IRQ() {
+		t.Errorf("mode 0 interrupted again as the count went around")
+	}
+}
+
+// TestPITGate checks that the gate of modes 0 and 4, which only holds the
+// count, leaves the counter skipping its idle clocks
+func TestPITGate(t *testing.T) {
+	var table = []struct {
+		mode byte
+		exp  string // the last change of OUT
+	}{
+		{0, "0H@4099"},
+		{4, "0H@4100"},
+	}
+	for _, test := range table {
+		var now uint64
+		var p, log = pitEdges(&now)
+		p.Control(0b00_11_000_0 | test.mode<<1)
+		p.WriteCounter(0, 0)
+		p.WriteCounter(0, 0x10)
+		now = 2
+		p.SetGate(0, false)
+		now = 4
+		p.SetGate(0, true) // holds the count 2 clocks
+		if n := p.counters[0].idle(); n == 0 {
+			t.Errorf("mode %d: no idle clocks after the gate rose", test.mode)
+		}
+		now = 0x10000
+		p.Out(0)
+		if len(*log) == 0 || (*log)[len(*log)-1] != test.exp {
+			t.Errorf("mode %d: OUT changed %v, expected last %s", test.mode, *log, test.exp)
+		}
+	}
+}
+
+func TestPITLevel(t *testing.T) {
+	var now uint64
+	var p = NewPIT(func() uint64 { return now })
+	p.Control(0b00_11_010_0) // a rate generator, low one clock in 4
+	p.WriteCounter(0, 4)
+	p.WriteCounter(0, 0)
+
+	var table = []struct {
+		now   uint64
+		level bool
+	}{
+		{2, true},
+		{10, false}, // the pulses at 4 and 8 went by
+		{11, true},
+		{12, false},
+		{13, true},
+	}
+	for _, test := range table {
+		now = test.now
+		if level := p.Level(0); level != test.level {
+			t.Errorf("level %v at %d, expected %v", level, now, test.level)
+		}
+	}
+}
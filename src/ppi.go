@@ -0,0 +1,354 @@
+package main
+
+import "errors"
+
+// PPI is an Intel 8255A programmable peripheral interface: ports A, B and C
+// at port to port+2 and the control word at port+3. Group A, port A and the
+// upper half of C, works in mode 0, simple I/O, mode 1, strobed I/O, or
+// mode 2, a strobed bidirectional bus on port A. Group B, port B and the
+// lower half of C, works in mode 0 or 1. In modes 1 and 2 bits of port C
+// carry the handshake.
+//
+// The devices on the other side of the ports, keypads, LEDs or test code,
+// set the input pins with SetInput, strobe bytes in with Strobe, take bytes
+// out with Acknowledge, and watch the output pins with OnOutput.
+type PPI struct {
+	control byte
+	latch   [3]byte // the output latches of A, B and C
+	pins    [3]byte // the levels the devices put on the pins
+	in      [2]byte // the bytes strobed in A and B
+
+	ibf   [2]bool // input buffer full
+	obf   [2]bool // output buffer full, low on the pin
+	inte  [2]bool // interrupt enable of A, or of its output in mode 2, and of B
+	inte2 bool    // interrupt enable of the input of A in mode 2
+
+	driven   [3]byte // the outputs last reported
+	OnOutput func(port int, v byte)
+}
+
+// The ports
+const (
+	ppiA = iota
+	ppiB
+	ppiC
+)
+
+// The fields of the mode control word
+const (
+	ppiModeSet = 1 << 7
+	ppiModeA   = 0b0110_0000
+	ppiAIn     = 1 << 4
+	ppiCHighIn = 1 << 3
+	ppiModeB   = 1 << 2
+	ppiBIn     = 1 << 1
+	ppiCLowIn  = 1 << 0
+)
+
+// The bits of port C for the handshake of modes 1 and 2
+const (
+	ppiIntrB = 1 << 0 // INTR B
+	ppiIBFB  = 1 << 1 // IBF B, or OBF B when B is an output
+	ppiSTBB  = 1 << 2 // STB B, or ACK B when B is an output
+	ppiIntrA = 1 << 3 // INTR A
+	ppiSTBA  = 1 << 4 // STB A
+	ppiIBFA  = 1 << 5 // IBF A
+	ppiACKA  = 1 << 6 // ACK A
+	ppiOBFA  = 1 << 7 // OBF A
+)
+
+// NewPPI returns an 8255 after a reset: every port an input in mode 0
+func NewPPI() *PPI {
+	var p = &PPI{}
+	p.Control(ppiModeSet | ppiAIn | ppiCHighIn | ppiBIn | ppiCLowIn)
+	return p
+}
+
+// Attach puts ports A, B and C at port to port+2 and the control word at
+// port+3
+func (p *PPI) Attach(bus *Bus, port byte) {
+	for i := 0; i < 3; i++ {
+		var n = i
+		bus.Attach(port+byte(i), func() byte { return p.Read(n) }, func(v byte) { p.Write(n, v) })
+	}
+	bus.Attach(port+3, nil, p.Control)
+}
+
+func (p *PPI) modeA() int {
+	var m = int(p.control&ppiModeA) >> 5
+	if m > 2 {
+		return 2
+	}
+	return m
+}
+
+func (p *PPI) modeB() int {
+	if p.control&ppiModeB != 0 {
+		return 1
+	}
+	return 0
+}
+
+// handshake is the mask of the bits of port C used by the handshake
+func (p *PPI) handshake() byte {
+	var mask byte
+	switch {
+	case p.modeA() == 2:
+		mask = ppiIntrA | ppiSTBA | ppiIBFA | ppiACKA | ppiOBFA
+	case p.modeA() == 1 && p.control&ppiAIn != 0:
+		mask = ppiIntrA | ppiSTBA | ppiIBFA
+	case p.modeA() == 1:
+		mask = ppiIntrA | ppiACKA | ppiOBFA
+	}
+	if p.modeB() == 1 {
+		mask |= ppiIntrB | ppiIBFB | ppiSTBB
+	}
+	return mask
+}
+
+// cInputs is the mask of the bits of port C that are inputs in mode 0
+func (p *PPI) cInputs() byte {
+	var mask byte
+	if p.control&ppiCHighIn != 0 {
+		mask |= 0xf0
+	}
+	if p.control&ppiCLowIn != 0 {
+		mask |= 0x0f
+	}
+	return mask
+}
+
+// intr tells if port A or B, 0 or 1, requests an interrupt
+func (p *PPI) intr(port int) bool {
+	var mode, input = p.modeA(), p.control&ppiAIn != 0
+	if port == ppiB {
+		mode, input = p.modeB(), p.control&ppiBIn != 0
+	}
+	switch {
+	case mode == 2:
+		return p.inte[port] && !p.obf[port] || p.inte2 && p.ibf[port]
+	case mode == 1 && input:
+		return p.inte[port] && p.ibf[port]
+	case mode == 1:
+		return p.inte[port] && !p.obf[port]
+	}
+	return false
+}
+
+// status is port C with the handshake bits as the CPU reads them: the
+// flags, with the INTE bits in place of the strobes and acknowledges
+func (p *PPI) status() byte {
+	var v = p.latch[ppiC]&^p.cInputs() | p.pins[ppiC]&p.cInputs()
+	var set = func(bit byte, on bool) {
+		if on {
+			v |= bit
+		} else {
+			v &^= bit
+		}
+	}
+
+	switch mode := p.modeA(); {
+	case mode == 2:
+		set(ppiOBFA, !p.obf[ppiA])
+		set(ppiACKA, p.inte[ppiA])
+		set(ppiIBFA, p.ibf[ppiA])
+		set(ppiSTBA, p.inte2)
+		set(ppiIntrA, p.intr(ppiA))
+	case mode == 1 && p.control&ppiAIn != 0:
+		set(ppiIBFA, p.ibf[ppiA])
+		set(ppiSTBA, p.inte[ppiA])
+		set(ppiIntrA, p.intr(ppiA))
+	case mode == 1:
+		set(ppiOBFA, !p.obf[ppiA])
+		set(ppiACKA, p.inte[ppiA])
+		set(ppiIntrA, p.intr(ppiA))
+	}
+	if p.modeB() == 1 {
+		if p.control&ppiBIn != 0 {
+			set(ppiIBFB, p.ibf[ppiB])
+		} else {
+			set(ppiIBFB, !p.obf[ppiB])
+		}
+		set(ppiSTBB, p.inte[ppiB])
+		set(ppiIntrB, p.intr(ppiB))
+	}
+	return v
+}
+
+// Output returns what the PPI drives on the pins of port. The pins of the
+// inputs read 0, and in mode 2 port A only drives its latch while the
+// device acknowledges.
+func (p *PPI) Output(port int) byte {
+	switch port {
+	case ppiA:
+		if p.modeA() != 2 && p.control&ppiAIn == 0 {
+			return p.latch[ppiA]
+		}
+	case ppiB:
+		if p.control&ppiBIn == 0 {
+			return p.latch[ppiB]
+		}
+	case ppiC:
+		var hs = p.handshake()
+		var out = ^p.cInputs()&^hs | hs&^(ppiSTBA|ppiACKA|ppiSTBB)
+		return p.status() & out
+	}
+	return 0
+}
+
+// notify reports the outputs that changed
+func (p *PPI) notify() {
+	for port := ppiA; port <= ppiC; port++ {
+		var v = p.Output(port)
+		if v != p.driven[port] {
+			p.driven[port] = v
+			if p.OnOutput != nil {
+				p.OnOutput(port, v)
+			}
+		}
+	}
+}
+
+// Control takes a mode word, which clears the latches and the flags, or
+// sets or resets a bit of port C. In modes 1 and 2 the bits of the strobes
+// and acknowledges set the interrupt enables.
+func (p *PPI) Control(v byte) {
+	if v&ppiModeSet != 0 {
+		p.control = v
+		p.latch = [3]byte{}
+		p.ibf, p.obf, p.inte, p.inte2 = [2]bool{}, [2]bool{}, [2]bool{}, false
+		p.notify()
+		return
+	}
+
+	var bit = byte(1) << (v >> 1 & 7)
+	var on = v&1 != 0
+	switch {
+	case bit == ppiSTBB && p.modeB() == 1:
+		p.inte[ppiB] = on
+	case bit == ppiSTBA && p.modeA() == 2:
+		p.inte2 = on
+	case bit == ppiSTBA && p.modeA() == 1 && p.control&ppiAIn != 0,
+		bit == ppiACKA && p.modeA() == 1 && p.control&ppiAIn == 0,
+		bit == ppiACKA && p.modeA() == 2:
+		p.inte[ppiA] = on
+	case on:
+		p.latch[ppiC] |= bit
+	default:
+		p.latch[ppiC] &^= bit
+	}
+	p.notify()
+}
+
+// Read is the CPU reading port. Reading a strobed input takes the byte and
+// clears IBF.
+func (p *PPI) Read(port int) byte {
+	var v byte
+	switch port {
+	case ppiA:
+		switch {
+		case p.modeA() == 2 || p.modeA() == 1 && p.control&ppiAIn != 0:
+			v, p.ibf[ppiA] = p.in[ppiA], false
+		case p.control&ppiAIn != 0:
+			v = p.pins[ppiA]
+		default:
+			v = p.latch[ppiA]
+		}
+	case ppiB:
+		switch {
+		case p.modeB() == 1 && p.control&ppiBIn != 0:
+			v, p.ibf[ppiB] = p.in[ppiB], false
+		case p.control&ppiBIn != 0:
+			v = p.pins[ppiB]
+		default:
+			v = p.latch[ppiB]
+		}
+	case ppiC:
+		return p.status()
+	}
+	p.notify()
+	return v
+}
+
+// Write is the CPU writing port. Writing a strobed output sets OBF. Only
+// the bits of port C outside of the handshake take a byte.
+func (p *PPI) Write(port int, v byte) {
+	switch port {
+	case ppiA:
+		p.latch[ppiA] = v
+		if p.modeA() == 2 || p.modeA() == 1 && p.control&ppiAIn == 0 {
+			p.obf[ppiA] = true
+		}
+	case ppiB:
+		p.latch[ppiB] = v
+		if p.modeB() == 1 && p.control&ppiBIn == 0 {
+			p.obf[ppiB] = true
+		}
+	case ppiC:
+		var hs = p.handshake()
+		p.latch[ppiC] = p.latch[ppiC]&hs | v&^hs
+	}
+	p.notify()
+}
+
+// SetInput puts v on the pins of port, for the inputs of mode 0
+func (p *PPI) SetInput(port int, v byte) {
+	p.pins[port] = v
+}
+
+// Strobe latches v in port A or B, an input of mode 1 or port A in mode 2,
+// as the device pulses STB. A byte not read yet is lost.
+func (p *PPI) Strobe(port int, v byte) {
+	p.in[port], p.ibf[port] = v, true
+	p.notify()
+}
+
+// Acknowledge is the device pulsing ACK to take the byte written to port A
+// or B, an output of mode 1 or port A in mode 2. It clears OBF.
+func (p *PPI) Acknowledge(port int) byte {
+	p.obf[port] = false
+	p.notify()
+	return p.latch[port]
+}
+
+// IBF tells if the byte strobed in port has not been read yet
+func (p *PPI) IBF(port int) bool {
+	return p.ibf[port]
+}
+
+// OBF tells if a byte written to port waits for the device
+func (p *PPI) OBF(port int) bool {
+	return p.obf[port]
+}
+
+// IRQ tells if INTR A or INTR B is high
+func (p *PPI) IRQ() bool {
+	return p.intr(ppiA) || p.intr(ppiB)
+}
+
+// SaveState saves the latches, the flags and the pins. The outputs reported
+// are not saved: OnOutput reports them all again after a restore.
+func (p *PPI) SaveState(e *Encoder) {
+	e.Byte(p.control)
+	e.Bytes(p.latch[:])
+	e.Bytes(p.pins[:])
+	e.Bytes(p.in[:])
+	for _, b := range []bool{p.ibf[0], p.ibf[1], p.obf[0], p.obf[1], p.inte[0], p.inte[1], p.inte2} {
+		e.Bool(b)
+	}
+}
+
+func (p *PPI) LoadState(d *Decoder) {
+	p.control = d.Byte()
+	d.Bytes(p.latch[:])
+	d.Bytes(p.pins[:])
+	d.Bytes(p.in[:])
+	for _, b := range []*bool{&p.ibf[0], &p.ibf[1], &p.obf[0], &p.obf[1], &p.inte[0], &p.inte[1], &p.inte2} {
+		*b = d.Bool()
+	}
+	if p.control&ppiModeSet == 0 {
+		d.Fail(errors.New("bad control word"))
+	}
+	p.driven = [3]byte{^p.Output(ppiA), ^p.Output(ppiB), ^p.Output(ppiC)}
+	p.notify()
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// ppiStep is an operation on a PPI: c writes the control word, w writes
+// the port, r reads it, i sets its input pins, s strobes v in, a
+// acknowledges, o checks its output pins and q the interrupt request
+type ppiStep struct {
+	op   byte
+	port int
+	v    byte
+}
+
+func TestPPI(t *testing.T) {
+	var table = []struct {
+		what  string
+		steps []ppiStep
+		exp   string // the OnOutput calls
+	}{
+		{"mode 0", []ppiStep{
+			{'c', 0, 0x82}, // A out, B in, C out
+			{'w', ppiA, 0x55}, {'r', ppiA, 0x55},
+			{'i', ppiB, 0x3c}, {'r', ppiB, 0x3c}, {'o', ppiB, 0},
+			{'c', 0, 0x0f}, {'c', 0, 0x03}, {'c', 0, 0x0e},
+			{'w', ppiC, 0x30}, {'r', ppiC, 0x30},
+			{'c', 0, 0x89}, // C in
+			{'i', ppiC, 0xa5}, {'r', ppiC, 0xa5}, {'o', ppiC, 0},
+		}, "A55 C80 C82 C02 C30 A00 C00"},
+		{"mode 0 split C", []ppiStep{
+			{'c', 0, 0x88}, // upper C in, lower out
+			{'w', ppiC, 0xff}, {'i', ppiC, 0x50},
+			{'r', ppiC, 0x5f}, {'o', ppiC, 0x0f},
+		}, "C0F"},
+		{"mode 1 input A", []ppiStep{
+			{'c', 0, 0xb0}, // A mode 1 in
+			{'q', 0, 0},
+			{'c', 0, 0x09}, // INTE A
+			{'r', ppiC, 0x10},
+			{'s', ppiA, 0x42}, {'q', 0, 1}, {'r', ppiC, 0x38}, {'o', ppiC, 0x28},
+			{'r', ppiA, 0x42}, {'q', 0, 0}, {'r', ppiC, 0x10}, {'o', ppiC, 0},
+		}, "C28 C00"},
+		{"mode 1 output A", []ppiStep{
+			{'c', 0, 0xa0}, // A mode 1 out
+			{'r', ppiC, 0x80},
+			{'c', 0, 0x0d}, // INTE A
+			{'q', 0, 1}, {'r', ppiC, 0xc8},
+			{'w', ppiA, 0x99}, {'q', 0, 0}, {'r', ppiC, 0x40},
+			{'a', ppiA, 0x99}, {'q', 0, 1},
+		}, "C80 C88 A99 C00 C88"},
+		{"mode 1 output B", []ppiStep{
+			{'c', 0, 0x84}, // B mode 1 out
+			{'c', 0, 0x05}, // INTE B
+			{'q', 0, 1}, {'r', ppiC, 0x07},
+			{'w', ppiB, 0x99}, {'q', 0, 0}, {'r', ppiC, 0x04},
+			{'a', ppiB, 0x99}, {'q', 0, 1}, {'r', ppiC, 0x07},
+		}, "C02 C03 B99 C00 C03"},
+		{"mode 1 input B", []ppiStep{
+			{'c', 0, 0x86}, // B mode 1 in
+			{'s', ppiB, 0x17}, {'q', 0, 0}, {'r', ppiC, 0x02},
+			{'r', ppiB, 0x17}, {'r', ppiC, 0x00},
+		}, "C02 C00"},
+		{"mode 2", []ppiStep{
+			{'c', 0, 0xc0},
+			{'c', 0, 0x0d}, {'c', 0, 0x09}, // INTE 1 and 2
+			{'q', 0, 1}, {'r', ppiC, 0xd8},
+			{'w', ppiA, 0x11}, {'o', ppiA, 0}, {'q', 0, 0}, {'r', ppiC, 0x50},
+			{'s', ppiA, 0x22}, {'q', 0, 1}, {'r', ppiC, 0x78},
+			{'a', ppiA, 0x11}, {'r', ppiA, 0x22}, {'r', ppiC, 0xd8},
+		}, "C80 C88 C00 C28 CA8 C88"},
+	}
+
+	for _, test := range table {
+		var p = NewPPI()
+		var log []string
+		p.OnOutput = func(port int, v byte) {
+			log = append(log, fmt.Sprintf("%c%02X", 'A'+port, v))
+		}
+		for i, s := range test.steps {
+			var got byte
+			switch s.op {
+			case 'c':
+				p.Control(s.v)
+				continue
+			case 'w':
+				p.Write(s.port, s.v)
+				continue
+			case 'i':
+				p.SetInput(s.port, s.v)
+				continue
+			case 's':
+				p.Strobe(s.port, s.v)
+				continue
+			case 'r':
+				got = p.Read(s.port)
+			case 'a':
+				got = p.Acknowledge(s.port)
+			case 'o':
+				got = p.Output(s.port)
+			case 'q':
+				if p.IRQ() {
+					got = 1
+				}
+			}
+			if got != s.v {
+				t.Errorf("%s: step %d %c%c: %02x, expected %02x", test.what, i, s.op, 'A'+s.port, got, s.v)
+			}
+		}
+		if got := strings.Join(log, " "); got != test.exp {
+			t.Errorf("%s: outputs %q, expected %q", test.what, got, test.exp)
+		}
+	}
+}
+
+func TestPPIBus(t *testing.T) {
+	var bus = &Bus{}
+	var p = NewPPI()
+	p.Attach(bus, 0x40)
+	var leds byte
+	p.OnOutput = func(port int, v byte) {
+		if port == ppiA {
+			leds = v
+		}
+	}
+
+	bus.Out(0x43, 0x8a) // A out, B in, upper C in
+	p.SetInput(ppiB, 0x12)
+	p.SetInput(ppiC, 0x70)
+	bus.Out(0x40, bus.In(0x41)|bus.In(0x42))
+	if leds != 0x72 {
+		t.Errorf("port A %02x, expected 72", leds)
+	}
+	if v := bus.In(0x43); v != 0xff {
+		t.Errorf("control read %02x, expected ff", v)
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Profiler counts the instructions run and the states they took, by
+// address and by routine. It follows the calls as the debugger does, and
+// keeps the counts of each path of calls apart to write them as a pprof
+// profile.
+type Profiler struct {
+	cpu   *State
+	step  func() int
+	calls callStack
+	root  *profNode
+	nodes []*profNode // the path of the routines entered, root first
+}
+
+// profNode is a path of calls: the routine entered last and the counts of
+// the instructions it ran before it entered another
+type profNode struct {
+	parent   *profNode
+	routine  uint16
+	from     uint16 // the call in the parent
+	children map[uint16]*profNode
+	counts   map[uint16]*profCount
+	calls    uint64
+}
+
+type profCount struct {
+	runs, states uint64
+}
+
+// NewProfiler profiles the machine of cpu, whose step is step. The code
+// running outside of any routine entered since is taken for a routine at
+// the current pc.
+func NewProfiler(cpu *State, step func() int) *Profiler {
+	var p = &Profiler{cpu: cpu, step: step}
+	p.root = newProfNode(nil, cpu.pc, cpu.pc)
+	p.nodes = []*profNode{p.root}
+	return p
+}
+
+func newProfNode(parent *profNode, routine, from uint16) *profNode {
+	return &profNode{parent: parent, routine: routine, from: from,
+		children: map[uint16]*profNode{}, counts: map[uint16]*profCount{}}
+}
+
+// Step runs a step of the machine and counts it. The states of a halted
+// CPU count for the HLT, and those of accepting an interrupt for the
+// handler.
+func (p *Profiler) Step() int {
+	var s = p.cpu
+	var pc, sp, op, halted = s.pc, s.sp, s.opcode(s.pc), s.halted
+	var n = p.step()
+	var depth = len(p.calls.frames)
+	p.calls.track(s, pc, sp, op)
+
+	var node = p.nodes[len(p.nodes)-1]
+	var runs uint64 = 1
+	switch {
+	case len(p.calls.frames) > depth && p.calls.frames[depth].Kind == FrameInterrupt:
+		node = p.enter(p.calls.frames[depth])
+		pc, runs = node.routine, 0
+	case halted:
+		pc, runs = pc-1, 0
+	}
+	var c = node.counts[pc]
+	if c == nil {
+		c = &profCount{}
+		node.counts[pc] = c
+	}
+	c.runs += runs
+	c.states += uint64(n)
+
+	if len(p.calls.frames) >= len(p.nodes) {
+		p.enter(p.calls.frames[len(p.calls.frames)-1])
+	}
+	p.nodes = p.nodes[:len(p.calls.frames)+1]
+	return n
+}
+
+// enter enters the routine of f from the path of calls running
+func (p *Profiler) enter(f Frame) *profNode {
+	var parent = p.nodes[len(p.nodes)-1]
+	var key = f.From
+	var node = parent.children[key]
+	if node == nil || node.routine != f.To {
+		node = newProfNode(parent, f.To, f.From)
+		parent.children[key] = node
+	}
+	node.calls++
+	p.nodes = append(p.nodes, node)
+	return node
+}
+
+// walk calls f on each node under n
+func (n *profNode) walk(f func(n *profNode)) {
+	f(n)
+	for _, child := range n.children {
+		child.walk(f)
+	}
+}
+
+// total returns the states of n and the nodes under it
+func (n *profNode) total() uint64 {
+	var states uint64
+	n.walk(func(n *profNode) {
+		for _, c := range n.counts {
+			states += c.states
+		}
+	})
+	return states
+}
+
+// RoutineProfile is what a routine ran
+type RoutineProfile struct {
+	Addr  uint16
+	Calls uint64 // the times it was entered
+	Flat  uint64 // the states of its own instructions
+	Cum   uint64 // and of the routines it called
+}
+
+// AddressProfile is what the instruction at an address ran
+type AddressProfile struct {
+	Addr   uint16
+	Runs   uint64
+	States uint64
+}
+
+// Routines returns the profile of each routine, the most states first
+func (p *Profiler) Routines() []RoutineProfile {
+	var byAddr = map[uint16]*RoutineProfile{}
+	var cum func(n *profNode, on map[uint16]bool)
+	cum = func(n *profNode, on map[uint16]bool) {
+		var r = byAddr[n.routine]
+		if r == nil {
+			r = &RoutineProfile{Addr: n.routine}
+			byAddr[n.routine] = r
+		}
+		r.Calls += n.calls
+		for _, c := range n.counts {
+			r.Flat += c.states
+		}
+		// a recursive routine counts once on a path
+		if !on[n.routine] {
+			r.Cum += n.total()
+			on[n.routine] = true
+			defer delete(on, n.routine)
+		}
+		for _, child := range n.children {
+			cum(child, on)
+		}
+	}
+	cum(p.root, map[uint16]bool{})
+
+	var routines []RoutineProfile
+	for _, r := range byAddr {
+		routines = append(routines, *r)
+	}
+	sort.Slice(routines, func(i, j int) bool {
+		var a, b = routines[i], routines[j]
+		if a.Flat != b.Flat {
+			return a.Flat > b.Flat
+		}
+		return a.Addr < b.Addr
+	})
+	return routines
+}
+
+// Addresses returns the profile of each address run, the most states first
+func (p *Profiler) Addresses() []AddressProfile {
+	var byAddr = map[uint16]*AddressProfile{}
+	p.root.walk(func(n *profNode) {
+		for pc, c := range n.counts {
+			var a = byAddr[pc]
+			if a == nil {
+				a = &AddressProfile{Addr: pc}
+				byAddr[pc] = a
+			}
+			a.Runs += c.runs
+			a.States += c.states
+		}
+	})
+	var addrs []AddressProfile
+	for _, a := range byAddr {
+		addrs = append(addrs, *a)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		var a, b = addrs[i], addrs[j]
+		if a.States != b.States {
+			return a.States > b.States
+		}
+		return a.Addr < b.Addr
+	})
+	return addrs
+}
+
+// Report writes the top routines and addresses, with the names of syms
+func (p *Profiler) Report(w io.Writer, syms *Symbols, top int) error {
+	var total = p.root.total()
+	var percent = func(n uint64) float64 {
+		if total == 0 {
+			return 0
+		}
+		return 100 * float64(n) / float64(total)
+	}
+	var b = bufio.NewWriter(w)
+	fmt.Fprintf(b, "%d states\n\n", total)
+	fmt.Fprintf(b, "%-16s %8s %12s %6s %12s %6s\n", "routine", "calls", "flat", "flat%", "cum", "cum%")
+	for i, r := range p.Routines() {
+		if i == top {
+			break
+		}
+		fmt.Fprintf(b, "%-16s %8d %12d %5.1f%% %12d %5.1f%%\n",
+			syms.Name(r.Addr), r.Calls, r.Flat, percent(r.Flat), r.Cum, percent(r.Cum))
+	}
+	fmt.Fprintf(b, "\n%-4s %-16s %10s %12s %6s  %s\n", "addr", "", "runs", "states", "%", "instruction")
+	for i, a := range p.Addresses() {
+		if i == top {
+			break
+		}
+		var op = p.cpu.opcode(a.Addr)
+		var text = strings.TrimRight(op.Text(p.cpu.peek(a.Addr+1), p.cpu.peek(a.Addr+2)), " ")
+		fmt.Fprintf(b, "%04x %-16s %10d %12d %5.1f%%  %s\n",
+			a.Addr, syms.Label(a.Addr), a.Runs, a.States, percent(a.States), text)
+	}
+	return b.Flush()
+}
+
+// WritePprof writes the profile in the gzipped protocol buffer format of
+// pprof. Each routine is a function, named from syms, and each sample a
+// path of calls with the runs and the states of an instruction.
+func (p *Profiler) WritePprof(w io.Writer, syms *Symbols) error {
+	var pb protoBuffer
+	var strs = map[string]int{}
+	var str = func(s string) int {
+		if i, ok := strs[s]; ok {
+			return i
+		}
+		strs[s] = len(strs)
+		pb.bytes(6, []byte(s)) // string_table
+		return strs[s]
+	}
+	str("")
+
+	var valueType = func(field int, typ, unit string) {
+		var m protoBuffer
+		m.int(1, int64(str(typ)))
+		m.int(2, int64(str(unit)))
+		pb.bytes(field, m.b)
+	}
+	valueType(1, "instructions", "count") // sample_type
+	valueType(1, "states", "count")
+
+	var functions = map[uint16]uint64{}
+	var function = func(routine uint16) uint64 {
+		if id, ok := functions[routine]; ok {
+			return id
+		}
+		var id = uint64(len(functions) + 1)
+		functions[routine] = id
+		var m protoBuffer
+		m.int(1, int64(id))
+		m.int(2, int64(str(syms.Name(routine))))
+		m.int(5, int64(routine)) // start_line
+		pb.bytes(5, m.b)
+		return id
+	}
+	type place struct{ addr, routine uint16 }
+	var locations = map[place]uint64{}
+	var location = func(addr, routine uint16) uint64 {
+		var key = place{addr, routine}
+		if id, ok := locations[key]; ok {
+			return id
+		}
+		var id = uint64(len(locations) + 1)
+		locations[key] = id
+		var line protoBuffer
+		line.int(1, int64(function(routine)))
+		line.int(2, int64(addr))
+		var m protoBuffer
+		m.int(1, int64(id))
+		m.int(3, int64(addr))
+		m.bytes(4, line.b)
+		pb.bytes(4, m.b)
+		return id
+	}
+
+	p.root.walk(func(n *profNode) {
+		var pcs []uint16
+		for pc := range n.counts {
+			pcs = append(pcs, pc)
+		}
+		sort.Slice(pcs, func(i, j int) bool { return pcs[i] < pcs[j] })
+		for _, pc := range pcs {
+			var stack = []uint64{location(pc, n.routine)}
+			for c := n; c.parent != nil; c = c.parent {
+				stack = append(stack, location(c.from, c.parent.routine))
+			}
+			var m protoBuffer
+			m.packed(1, stack)
+			m.packed(2, []uint64{n.counts[pc].runs, n.counts[pc].states})
+			pb.bytes(2, m.b)
+		}
+	})
+
+	var z = gzip.NewWriter(w)
+	if _, err := z.Write(pb.b); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+// protoBuffer encodes a protocol buffer message
+type protoBuffer struct {
+	b []byte
+}
+
+func (pb *protoBuffer) varint(v uint64) {
+	for v >= 0x80 {
+		pb.b = append(pb.b, byte(v)|0x80)
+		v >>= 7
+	}
+	pb.b = append(pb.b, byte(v))
+}
+
+// int writes a varint field
+func (pb *protoBuffer) int(field int, v int64) {
+	pb.varint(uint64(field) << 3)
+	pb.varint(uint64(v))
+}
+
+// bytes writes a length delimited field
+func (pb *protoBuffer) bytes(field int, b []byte) {
+	pb.varint(uint64(field)<<3 | 2)
+	pb.varint(uint64(len(b)))
+	pb.b = append(pb.b, b...)
+}
+
+// packed writes a packed repeated varint field
+func (pb *protoBuffer) packed(field int, vs []uint64) {
+	var m protoBuffer
+	for _, v := range vs {
+		m.varint(v)
+	}
+	pb.bytes(field, m.b)
+}
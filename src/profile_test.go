@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+)
+
+// profiled returns a profile of the calling program run until it halted
+// and waited 2 steps
+func profiled() (*Profiler, *Symbols) {
+	var d = calling(0)
+	var p = NewProfiler(d.CPU, d.CPU.Step)
+	for !d.CPU.halted {
+		p.Step()
+	}
+	p.Step()
+	p.Step()
+	return p, d.Symbols
+}
+
+func TestProfiler(t *testing.T) {
+	var p, _ = profiled()
+	var exp = []RoutineProfile{
+		{Addr: 0x30, Calls: 1, Flat: 48, Cum: 93},
+		{Addr: 0x00, Calls: 0, Flat: 42, Cum: 162},
+		{Addr: 0x40, Calls: 1, Flat: 35, Cum: 35},
+		{Addr: 0x20, Calls: 1, Flat: 27, Cum: 120},
+		{Addr: 0x38, Calls: 1, Flat: 10, Cum: 10},
+	}
+	var routines = p.Routines()
+	if len(routines) != len(exp) {
+		t.Fatalf("routines %+v, expected %+v", routines, exp)
+	}
+	for i, r := range routines {
+		if r != exp[i] {
+			t.Errorf("routine %d: %+v, expected %+v", i, r, exp[i])
+		}
+	}
+
+	var addrs = map[uint16]AddressProfile{}
+	for _, a := range p.Addresses() {
+		addrs[a.Addr] = a
+	}
+	for _, a := range []AddressProfile{
+		{Addr: 0x23, Runs: 2, States: 20}, // RET from TWO and from ONE
+		{Addr: 0x06, Runs: 1, States: 15}, // HLT and 2 steps halted
+		{Addr: 0x41, Runs: 1, States: 5},
+	} {
+		if addrs[a.Addr] != a {
+			t.Errorf("address %04x: %+v, expected %+v", a.Addr, addrs[a.Addr], a)
+		}
+	}
+}
+
+func TestProfilerInterrupt(t *testing.T) {
+	var d = calling(0)
+	var intr = &interrupter{}
+	d.CPU.intr = intr
+	d.CPU.Load(0x08, []byte{0xc9}) // RET
+	d.CPU.intEnable = 1
+	var p = NewProfiler(d.CPU, d.CPU.Step)
+	p.Step()
+	p.Step()
+	intr.pending = true
+	p.Step()
+	p.Step()
+	var addrs = p.Addresses()
+	if len(addrs) != 3 || addrs[0] != (AddressProfile{Addr: 0x08, Runs: 1, States: 21}) {
+		t.Errorf("addresses %+v, expected the RST 1 and RET at 0008", addrs)
+	}
+	for _, r := range p.Routines() {
+		if r.Addr == 0x20 && r.Cum != 21 {
+			t.Errorf("ONE took %d states with its interrupt, expected 21", r.Cum)
+		}
+	}
+}
+
+func TestProfileReport(t *testing.T) {
+	var p, syms = profiled()
+	var out bytes.Buffer
+	if err := p.Report(&out, syms, 2); err != nil {
+		t.Fatal(err)
+	}
+	var exp = `162 states
+
+routine             calls         flat  flat%          cum   cum%
+TWO                     1           48  29.6%           93  57.4%
+0000                    0           42  25.9%          162 100.0%
+
+addr                        runs       states      %  instruction
+0023 ONE+3                     2           20  12.3%  RET
+0003                           1           17  10.5%  CALL   $0020
+`
+	if out.String() != exp {
+		t.Errorf("reported\n%s\nexpected\n%s", out.String(), exp)
+	}
+}
+
+// protoFields returns the length delimited fields of a protocol buffer
+// message by number, skipping the others
+func protoFields(t *testing.T, b []byte) map[int][][]byte {
+	var fields = map[int][][]byte{}
+	var varint = func() uint64 {
+		var v uint64
+		for shift := uint(0); len(b) > 0; shift += 7 {
+			var c = b[0]
+			b = b[1:]
+			v |= uint64(c&0x7f) << shift
+			if c < 0x80 {
+				break
+			}
+		}
+		return v
+	}
+	for len(b) > 0 {
+		var key = varint()
+		switch key & 7 {
+		case 0:
+			varint()
+		case 2:
+			var n = varint()
+			if n > uint64(len(b)) {
+				t.Fatalf("field %d of %d bytes, %d left", key>>3, n, len(b))
+			}
+			fields[int(key>>3)] = append(fields[int(key>>3)], b[:n])
+			b = b[n:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return fields
+}
+
+func TestWritePprof(t *testing.T) {
+	var p, syms = profiled()
+	var out bytes.Buffer
+	if err := p.WritePprof(&out, syms); err != nil {
+		t.Fatal(err)
+	}
+	var z, err = gzip.NewReader(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b []byte
+	if b, err = io.ReadAll(z); err != nil {
+		t.Fatal(err)
+	}
+	var fields = protoFields(t, b)
+	var strs []string
+	for _, s := range fields[6] {
+		strs = append(strs, string(s))
+	}
+	var names = strings.Join(strs, " ")
+	if len(strs) == 0 || strs[0] != "" || !strings.Contains(names, "instructions count states") ||
+		!strings.Contains(names, "TWO") || !strings.Contains(names, "INLINE") {
+		t.Errorf("strings %q, expected the types, then the routines", strs)
+	}
+	// a sample by address run in each path of calls
+	if len(fields[2]) != 15 || len(fields[1]) != 2 || len(fields[5]) != 5 {
+		t.Errorf("%d samples of %d types in %d functions, expected 15 of 2 in 5",
+			len(fields[2]), len(fields[1]), len(fields[5]))
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// PTYLine is a Line on a new pseudo terminal, for a terminal emulator such
+// as screen or minicom to open at Path
+type PTYLine struct {
+	streamLine
+	Path   string
+	master *os.File
+	slave  *os.File // kept open so the line lives on between clients
+	out    chan byte
+}
+
+// OpenPTY makes a raw pseudo terminal
+func OpenPTY() (*PTYLine, error) {
+	var master, err = os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var unlock int32
+	var n uint32
+	if err := ioctl(master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		master.Close()
+		return nil, err
+	}
+	if err := ioctl(master, syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	var path = fmt.Sprintf("/dev/pts/%d", n)
+	slave, err := os.OpenFile(path, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	// Make it raw, as cfmakeraw does
+	var t syscall.Termios
+	if err := ioctl(slave, syscall.TCGETS, unsafe.Pointer(&t)); err != nil {
+		master.Close()
+		slave.Close()
+		return nil, err
+	}
+	t.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	t.Oflag &^= syscall.OPOST
+	t.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	t.Cflag &^= syscall.CSIZE | syscall.PARENB
+	t.Cflag |= syscall.CS8
+	if err := ioctl(slave, syscall.TCSETS, unsafe.Pointer(&t)); err != nil {
+		master.Close()
+		slave.Close()
+		return nil, err
+	}
+
+	var l = &PTYLine{streamLine: newStreamLine(), Path: path, master: master, slave: slave, out: make(chan byte, 4096)}
+	go l.feed(master)
+	go func() {
+		for b := range l.out {
+			master.Write([]byte{b})
+		}
+	}()
+	return l, nil
+}
+
+func ioctl(f *os.File, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Write sends b, or drops it when the pseudo terminal is full because
+// nobody reads it
+func (l *PTYLine) Write(b byte) {
+	select {
+	case l.out <- b:
+	default:
+	}
+}
+
+func (l *PTYLine) Close() error {
+	close(l.out)
+	l.slave.Close()
+	return l.master.Close()
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPTYLine(t *testing.T) {
+	var l, err = OpenPTY()
+	if err != nil {
+		t.Skip(err)
+	}
+	defer l.Close()
+
+	client, err := os.OpenFile(l.Path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	client.Write([]byte("a\n"))
+	var got []byte
+	for deadline := time.Now().Add(5 * time.Second); len(got) < 2 && time.Now().Before(deadline); {
+		if l.Ready() {
+			got = append(got, l.Read())
+		}
+	}
+	if string(got) != "a\n" {
+		t.Errorf("received %q, expected %q: the pty is not raw", got, "a\n")
+	}
+
+	l.Write('z')
+	var buf = make([]byte, 1)
+	if n, err := client.Read(buf); n != 1 || buf[0] != 'z' {
+		t.Errorf("sent %q, %v, expected z", buf[:n], err)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+// PTYLine is a Line on a new pseudo terminal, only on Linux
+type PTYLine struct {
+	streamLine
+	Path string
+}
+
+// OpenPTY makes a raw pseudo terminal, only on Linux
+func OpenPTY() (*PTYLine, error) {
+	return nil, errors.New("pseudo terminals are only supported on Linux")
+}
+
+func (l *PTYLine) Write(b byte) {}
+
+func (l *PTYLine) Close() error {
+	return nil
+}
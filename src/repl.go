@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// REPL is the command line of the debugger. An empty line repeats the last
+// command.
+type REPL struct {
+	D    *Debugger
+	Out  io.Writer
+	Stop func() bool // tells the runs to stop, as Ctrl-C does, or nil
+
+	last string
+}
+
+// replHelp lists the commands
+const replHelp = `step [n]      s   run n instructions, 1 by default
+continue      c   run until a breakpoint or the CPU halts
+rstep [n]     rs  step back n instructions
+rcontinue     rc  step back until a breakpoint or the oldest step kept
+out           o   run until the routine running returns
+finish [n]        run until the last n routines entered return, 1 by
+                  default, and show the registers they return
+backtrace     bt  list the routines entered and not returned from
+break [addr [if expr]]
+              b   set a breakpoint, or list them
+delete addr   d   clear a breakpoint
+watch [addr[-end] [rwx] [=v] [if expr]]
+              w   stop at the reads, writes or runs from addr to end,
+                  of v only if given; writes by default. Or list them
+watch change expr
+                  stop when the value of expr changes
+unwatch n         remove the watchpoint n of the list
+trace [if expr]   print the steps run, those before which expr is true
+trace off         stop printing them
+print expr    p   print the value of expr
+regs          r   show the registers
+mem addr [n]  x   dump n bytes of memory, 64 by default
+list [addr]   l   disassemble from addr, pc by default
+quit          q   leave the debugger
+addr is in hex, a symbol or an expression without spaces. expr reads the
+registers, the flags Z S P CY AC, [addr] and word[addr] in memory, symbols
+and numbers in decimal or hex after 0x, with the operators of C, & | and ^
+before the comparisons.
+`
+
+// Run reads commands from in until quit or the end of in
+func (r *REPL) Run(in io.Reader) {
+	var sc = bufio.NewScanner(in)
+	fmt.Fprintln(r.Out, r.D.Where(r.D.CPU.pc))
+	for {
+		fmt.Fprint(r.Out, "(8080) ")
+		if !sc.Scan() || !r.Exec(sc.Text()) {
+			return
+		}
+	}
+}
+
+// Exec runs a command. It returns false to quit.
+func (r *REPL) Exec(line string) bool {
+	var f = strings.Fields(line)
+	if len(f) == 0 {
+		f = strings.Fields(r.last)
+	} else {
+		r.last = line
+	}
+	if len(f) == 0 {
+		return true
+	}
+	if err := r.exec(f[0], f[1:]); err == errQuit {
+		return false
+	} else if err != nil {
+		fmt.Fprintln(r.Out, err)
+	}
+	return true
+}
+
+var errQuit = fmt.Errorf("quit")
+
+func (r *REPL) exec(cmd string, args []string) error {
+	var d = r.D
+	switch cmd {
+	case "s", "step", "rs", "rstep":
+		var n, err = r.count(args, 1)
+		if err != nil {
+			return err
+		}
+		if cmd[0] == 'r' {
+			r.stopped(d.Back(n))
+		} else {
+			r.stopped(d.Run(n, r.stop()))
+		}
+	case "c", "continue":
+		r.stopped(d.Run(-1, r.stop()))
+	case "rc", "rcontinue":
+		r.stopped(d.Back(-1))
+	case "o", "out", "finish":
+		var n, err = r.count(args, 1)
+		if err != nil {
+			return err
+		}
+		if n > len(d.Backtrace()) {
+			return fmt.Errorf("cannot step out of %d routines, %d entered", n, len(d.Backtrace()))
+		}
+		var stop = d.StepOut(n, r.stop())
+		r.stopped(stop)
+		if cmd == "finish" && stop.Reason == StopReturn {
+			fmt.Fprintln(r.Out, d.Registers())
+		}
+	case "bt", "backtrace":
+		fmt.Fprintf(r.Out, "#0  %s\n", d.Where(d.CPU.pc))
+		for i, f := range d.Backtrace() {
+			var line = fmt.Sprintf("#%d  %s", i+1, d.Where(f.From))
+			if f.Kind == FrameInterrupt {
+				line += fmt.Sprintf("  interrupted, to %s", d.Symbols.Name(f.To))
+			}
+			fmt.Fprintln(r.Out, line)
+		}
+	case "b", "break":
+		if len(args) == 0 {
+			for _, addr := range d.Breakpoints() {
+				if cond := d.Condition(addr); cond != nil {
+					fmt.Fprintf(r.Out, "%s  if %s\n", d.Where(addr), cond)
+				} else {
+					fmt.Fprintln(r.Out, d.Where(addr))
+				}
+			}
+			return nil
+		}
+		var args, cond, err = r.cond(args)
+		if err != nil {
+			return err
+		}
+		if len(args) != 1 {
+			return fmt.Errorf("usage: break addr [if expr]")
+		}
+		var addr uint16
+		if addr, err = r.D.Addr(args[0]); err != nil {
+			return err
+		}
+		d.SetBreakpoint(addr, cond)
+	case "d", "delete":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: delete addr")
+		}
+		var addr, err = r.D.Addr(args[0])
+		if err != nil {
+			return err
+		}
+		d.ClearBreakpoint(addr)
+	case "w", "watch":
+		if len(args) == 0 {
+			for i, w := range d.Watchpoints() {
+				fmt.Fprintf(r.Out, "%d: %s\n", i+1, w)
+			}
+			return nil
+		}
+		var w Watchpoint
+		var err error
+		if args[0] == "change" {
+			w.Change, err = ParseExpr(strings.Join(args[1:], " "), d.Symbols)
+		} else {
+			w, err = r.watchpoint(args)
+		}
+		if err != nil {
+			return err
+		}
+		d.AddWatchpoint(w)
+	case "unwatch":
+		var i, err = r.count(args, -1)
+		if err != nil || i < 1 || i > len(d.Watchpoints()) {
+			return fmt.Errorf("usage: unwatch n, n from 1 to the number of watchpoints")
+		}
+		d.ClearWatchpoint(i - 1)
+	case "trace":
+		if len(args) == 1 && args[0] == "off" {
+			d.Trace, d.TraceIf = nil, nil
+			return nil
+		}
+		var args, cond, err = r.cond(args)
+		if err != nil {
+			return err
+		}
+		if len(args) != 0 {
+			return fmt.Errorf("usage: trace [if expr] or trace off")
+		}
+		d.Trace, d.TraceIf = r.Out, cond
+	case "p", "print":
+		var e, err = ParseExpr(strings.Join(args, " "), d.Symbols)
+		if err != nil {
+			return err
+		}
+		var v = e.Eval(d.CPU)
+		fmt.Fprintf(r.Out, "%d 0x%x\n", v, v)
+	case "r", "regs":
+		fmt.Fprintln(r.Out, d.Registers())
+	case "x", "mem":
+		if len(args) == 0 {
+			return fmt.Errorf("usage: mem addr [n]")
+		}
+		var addr, err = r.D.Addr(args[0])
+		if err != nil {
+			return err
+		}
+		var n int
+		if n, err = r.count(args[1:], 64); err != nil {
+			return err
+		}
+		r.dump(addr, n)
+	case "l", "list":
+		var addr = d.CPU.pc
+		if len(args) > 0 {
+			var err error
+			if addr, err = r.D.Addr(args[0]); err != nil {
+				return err
+			}
+		}
+		for i := 0; i < 10; i++ {
+			fmt.Fprintln(r.Out, d.Where(addr))
+			var _, size = d.Disassemble(addr)
+			addr += uint16(size)
+		}
+	case "q", "quit":
+		return errQuit
+	case "h", "help":
+		fmt.Fprint(r.Out, replHelp)
+	default:
+		return fmt.Errorf("unknown command %s, try help", cmd)
+	}
+	return nil
+}
+
+// stop returns the stop of a run, dropping a request made at the prompt
+func (r *REPL) stop() func() bool {
+	if r.Stop != nil {
+		r.Stop()
+	}
+	return r.Stop
+}
+
+// stopped tells where a run stopped and why, when it stopped early
+func (r *REPL) stopped(s Stop) {
+	if why := r.D.Why(s); why != "" {
+		fmt.Fprintln(r.Out, why)
+	}
+	fmt.Fprintln(r.Out, r.D.Where(r.D.CPU.pc))
+}
+
+// cond splits args at "if" and parses the condition after it, if any
+func (r *REPL) cond(args []string) ([]string, *Expr, error) {
+	for i, arg := range args {
+		if arg == "if" {
+			var e, err = ParseExpr(strings.Join(args[i+1:], " "), r.D.Symbols)
+			return args[:i], e, err
+		}
+	}
+	return args, nil, nil
+}
+
+// watchpoint reads the arguments of watch
+func (r *REPL) watchpoint(args []string) (Watchpoint, error) {
+	var w = Watchpoint{Access: AccessWrite}
+	var err error
+	if args, w.If, err = r.cond(args); err != nil {
+		return w, err
+	}
+	if len(args) == 0 {
+		return w, fmt.Errorf("usage: watch addr[-end] [rwx] [=v] [if expr]")
+	}
+	var start, end = args[0], args[0]
+	if i := strings.IndexByte(args[0], '-'); i >= 0 {
+		start, end = args[0][:i], args[0][i+1:]
+	}
+	if w.Start, err = r.D.Addr(start); err != nil {
+		return w, err
+	}
+	if w.End, err = r.D.Addr(end); err != nil {
+		return w, err
+	}
+	if w.End < w.Start {
+		return w, fmt.Errorf("bad range %s", args[0])
+	}
+	for _, arg := range args[1:] {
+		if strings.HasPrefix(arg, "=") {
+			var v, err = strconv.ParseUint(strings.TrimSuffix(strings.ToUpper(arg[1:]), "H"), 16, 8)
+			if err != nil {
+				return w, fmt.Errorf("bad value %s", arg)
+			}
+			w.Cond, w.Value = true, byte(v)
+			continue
+		}
+		w.Access = 0
+		for _, c := range arg {
+			var i = strings.IndexRune("rwx", c)
+			if i < 0 {
+				return w, fmt.Errorf("bad access %s, expected r, w or x", arg)
+			}
+			w.Access |= 1 << i
+		}
+	}
+	return w, nil
+}
+
+// count reads the optional count in args
+func (r *REPL) count(args []string, def int) (int, error) {
+	if len(args) == 0 {
+		return def, nil
+	}
+	var n, err = strconv.Atoi(args[0])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("bad count %s", args[0])
+	}
+	return n, nil
+}
+
+// dump prints n bytes from addr, 16 by line with their ASCII
+func (r *REPL) dump(addr uint16, n int) {
+	for i := 0; i < n; i += 16 {
+		var m = n - i
+		if m > 16 {
+			m = 16
+		}
+		fmt.Fprintln(r.Out, r.D.Dump(addr+uint16(i), m))
+	}
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+)
+
+// A recording is gzip compressed:
+//
+//	"8080RLOG" version frame snapshot
+//	event ...
+//
+// The version is a little endian word, frame the states between two hashes
+// and snapshot the machine at the start, its length first. Each event is a
+// kind, the states since the last event and the kind's payload. The numbers
+// other than the version are unsigned varints.
+const recordMagic = "8080RLOG"
+
+// recordVersion changes with the format of the events
+const recordVersion = 1
+
+// The kinds of events
+const (
+	recIn        = 'I' // IN: the port and the byte read
+	recInterrupt = 'N' // an interrupt accepted
+	recAck       = 'A' // an interrupt acknowledge cycle: the byte read
+	recReady     = 'R' // a line polled: 1 if a byte came in
+	recRead      = 'D' // a byte read from a line
+	recHash      = 'H' // the end of a frame: the hash of the machine
+	recEnd       = 'E' // the end of the recording
+)
+
+// event is an event of a recording
+type event struct {
+	kind  byte
+	cycle uint64
+	port  byte
+	v     byte
+	hash  uint64
+}
+
+func (e event) String() string {
+	switch e.kind {
+	case recIn:
+		return fmt.Sprintf("IN %02x read %02x", e.port, e.v)
+	case recInterrupt:
+		return "an interrupt"
+	case recAck:
+		return fmt.Sprintf("an acknowledge of %02x", e.v)
+	case recReady:
+		return fmt.Sprintf("a line polled with %d", e.v)
+	case recRead:
+		return fmt.Sprintf("%02x read from a line", e.v)
+	case recHash:
+		return "the end of a frame"
+	}
+	return "the end"
+}
+
+// stateHash is the FNV-1a hash of the registers and the memory
+func stateHash(s *State) uint64 {
+	var h = fnv.New64a()
+	h.Write([]byte{s.regA, s.regB, s.regC, s.regD, s.regE, s.regH, s.regL, byte(s.flags),
+		byte(s.sp), byte(s.sp >> 8), byte(s.pc), byte(s.pc >> 8)})
+	h.Write(s.mem[:])
+	return h.Sum64()
+}
+
+// Recorder logs what the CPU gets from outside while it runs: the bytes read
+// from the ports and from the lines given to Line, and the interrupts. It
+// stands between the CPU and its devices from NewRecorder to Close. Every
+// frame states it also logs a hash of the machine.
+type Recorder struct {
+	cpu   *State
+	ports Ports
+	intr  Interrupter
+	frame uint64
+	next  uint64 // the end of the frame
+
+	z    *gzip.Writer
+	w    *bufio.Writer
+	last uint64 // the state of the last event
+}
+
+// NewRecorder saves snap, the machine of cpu, to w and starts recording
+func NewRecorder(w io.Writer, cpu *State, snap *Snapshot, frame uint64) (*Recorder, error) {
+	var saved bytes.Buffer
+	if err := snap.Save(&saved); err != nil {
+		return nil, err
+	}
+	var r = &Recorder{cpu: cpu, ports: cpu.ports, intr: cpu.intr, frame: frame, next: cpu.cycles + frame, last: cpu.cycles}
+	r.z = gzip.NewWriter(w)
+	r.w = bufio.NewWriter(r.z)
+	r.w.WriteString(recordMagic)
+	binary.Write(r.w, binary.LittleEndian, uint16(recordVersion))
+	r.uvarint(frame)
+	r.uvarint(uint64(saved.Len()))
+	r.w.Write(saved.Bytes())
+	cpu.ports, cpu.intr = r, r
+	return r, nil
+}
+
+func (r *Recorder) uvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	r.w.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (r *Recorder) log(kind byte, payload ...byte) {
+	r.w.WriteByte(kind)
+	r.uvarint(r.cpu.cycles - r.last)
+	r.w.Write(payload)
+	r.last = r.cpu.cycles
+}
+
+// Step runs a step of the CPU and ends the frames it reaches
+func (r *Recorder) Step() int {
+	var n = r.cpu.Step()
+	for r.frame != 0 && r.cpu.cycles >= r.next {
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], stateHash(r.cpu))
+		r.log(recHash, b[:]...)
+		r.next += r.frame
+	}
+	return n
+}
+
+// Close ends the recording and gives the devices back to the CPU
+func (r *Recorder) Close() error {
+	r.log(recEnd)
+	r.cpu.ports, r.cpu.intr = r.ports, r.intr
+	if err := r.w.Flush(); err != nil {
+		return err
+	}
+	return r.z.Close()
+}
+
+func (r *Recorder) In(port byte) byte {
+	var v byte = 0xff
+	if r.ports != nil {
+		v = r.ports.In(port)
+	}
+	r.log(recIn, port, v)
+	return v
+}
+
+func (r *Recorder) Out(port byte, v byte) {
+	if r.ports != nil {
+		r.ports.Out(port, v)
+	}
+}
+
+func (r *Recorder) Pending() bool {
+	if r.intr == nil || !r.intr.Pending() {
+		return false
+	}
+	r.log(recInterrupt)
+	return true
+}
+
+func (r *Recorder) Acknowledge() byte {
+	var v = r.intr.Acknowledge()
+	r.log(recAck, v)
+	return v
+}
+
+// Line returns l with what it reads recorded
+func (r *Recorder) Line(l Line) Line {
+	return recordedLine{r, l}
+}
+
+type recordedLine struct {
+	r *Recorder
+	Line
+}
+
+func (l recordedLine) Ready() bool {
+	var ready = l.Line.Ready()
+	if ready {
+		l.r.log(recReady, 1)
+	} else {
+		l.r.log(recReady, 0)
+	}
+	return ready
+}
+
+func (l recordedLine) Read() byte {
+	var v = l.Line.Read()
+	l.r.log(recRead, v)
+	return v
+}
+
+// Player replays a recording: the CPU gets what it read from outside from
+// the log, at the same states, while what it writes still goes to the
+// devices. When verifying it compares the hashes of the frames. At the end
+// of the log, or once the run diverged, the machine goes on live.
+type Player struct {
+	cpu    *State
+	ports  Ports
+	intr   Interrupter
+	verify bool
+
+	r    *bufio.Reader
+	next event // the next event of the log
+	done bool  // the log is over
+	err  error // the first divergence
+}
+
+// NewPlayer restores snap, the machine of cpu, from the start of the
+// recording in r and starts replaying
+func NewPlayer(r io.Reader, cpu *State, snap *Snapshot, verify bool) (*Player, error) {
+	var z, err = gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("recording: %v", err)
+	}
+	var p = &Player{cpu: cpu, ports: cpu.ports, intr: cpu.intr, verify: verify, r: bufio.NewReader(z)}
+	var head [len(recordMagic) + 2]byte
+	if _, err := io.ReadFull(p.r, head[:]); err != nil || string(head[:len(recordMagic)]) != recordMagic {
+		return nil, errors.New("recording: not a recording")
+	}
+	if v := binary.LittleEndian.Uint16(head[len(recordMagic):]); v != recordVersion {
+		return nil, fmt.Errorf("recording: version %d, expected %d", v, recordVersion)
+	}
+	var size uint64
+	if _, err = binary.ReadUvarint(p.r); err == nil {
+		size, err = binary.ReadUvarint(p.r)
+	}
+	if err != nil || size > 1<<24 {
+		return nil, errors.New("recording: truncated")
+	}
+	var saved = make([]byte, size)
+	if _, err := io.ReadFull(p.r, saved); err != nil {
+		return nil, errors.New("recording: truncated")
+	}
+	if err := snap.Restore(bytes.NewReader(saved)); err != nil {
+		return nil, fmt.Errorf("recording: %v", err)
+	}
+
+	p.next.cycle = cpu.cycles
+	if err := p.read(); err != nil {
+		return nil, err
+	}
+	cpu.ports, cpu.intr = p, p
+	return p, nil
+}
+
+// read reads the next event
+func (p *Player) read() error {
+	var kind, err = p.r.ReadByte()
+	var delta uint64
+	if err == nil {
+		delta, err = binary.ReadUvarint(p.r)
+	}
+	if err != nil {
+		return errors.New("recording: truncated")
+	}
+	var e = event{kind: kind, cycle: p.next.cycle + delta}
+	switch kind {
+	case recIn:
+		if e.port, err = p.r.ReadByte(); err == nil {
+			e.v, err = p.r.ReadByte()
+		}
+	case recAck, recReady, recRead:
+		e.v, err = p.r.ReadByte()
+	case recHash:
+		var b [8]byte
+		_, err = io.ReadFull(p.r, b[:])
+		e.hash = binary.LittleEndian.Uint64(b[:])
+	case recInterrupt, recEnd:
+	default:
+		return fmt.Errorf("recording: bad event %02x", kind)
+	}
+	if err != nil {
+		return errors.New("recording: truncated")
+	}
+	p.next = e
+	return nil
+}
+
+// take returns the next event if it is of kind and due now, and reads the
+// one after it. Otherwise the run diverged from the recording.
+func (p *Player) take(kind byte, what string) (event, bool) {
+	var e = p.next
+	if p.live() {
+		return e, false
+	}
+	if e.kind != kind || e.cycle != p.cpu.cycles {
+		p.diverge(fmt.Sprintf("%s, recorded %s at state %d", what, e, e.cycle))
+		return e, false
+	}
+	if err := p.read(); err != nil {
+		p.err = err
+	}
+	return e, true
+}
+
+func (p *Player) diverge(why string) {
+	p.err = fmt.Errorf("diverged at state %d, pc %04x: %s", p.cpu.cycles, p.cpu.pc, why)
+}
+
+// live tells if the replay is over
+func (p *Player) live() bool {
+	if !p.done && (p.err != nil || p.next.kind == recEnd && p.cpu.cycles >= p.next.cycle) {
+		p.done = true
+	}
+	return p.done
+}
+
+// Done tells if the replay is over: the log ended or the run diverged
+func (p *Player) Done() bool {
+	return p.live()
+}
+
+// Err returns the divergence, or nil
+func (p *Player) Err() error {
+	return p.err
+}
+
+// Step runs a step of the CPU and checks the hashes of the frames it ends.
+// Events due at the state reached belong to the next step.
+func (p *Player) Step() int {
+	var n = p.cpu.Step()
+	for !p.live() && p.next.kind == recHash && p.next.cycle == p.cpu.cycles {
+		var e, _ = p.take(recHash, "")
+		if p.verify && e.hash != stateHash(p.cpu) {
+			p.diverge("the machine differs at the end of the frame")
+		}
+	}
+	if !p.live() && p.next.cycle < p.cpu.cycles {
+		p.diverge(fmt.Sprintf("missed %s at state %d", p.next, p.next.cycle))
+	}
+	return n
+}
+
+func (p *Player) In(port byte) byte {
+	if p.live() && p.ports != nil {
+		return p.ports.In(port)
+	} else if p.live() {
+		return 0xff
+	}
+	var e, ok = p.take(recIn, fmt.Sprintf("IN %02x", port))
+	if !ok || e.port != port {
+		if ok {
+			p.diverge(fmt.Sprintf("IN %02x, recorded %s", port, e))
+		}
+		return 0xff
+	}
+	return e.v
+}
+
+func (p *Player) Out(port byte, v byte) {
+	if p.ports != nil {
+		p.ports.Out(port, v)
+	}
+}
+
+func (p *Player) Pending() bool {
+	if p.live() {
+		return p.intr != nil && p.intr.Pending()
+	}
+	if p.next.kind != recInterrupt || p.next.cycle != p.cpu.cycles {
+		return false
+	}
+	var _, ok = p.take(recInterrupt, "")
+	return ok
+}
+
+func (p *Player) Acknowledge() byte {
+	if p.live() {
+		return p.intr.Acknowledge()
+	}
+	var e, _ = p.take(recAck, "an acknowledge")
+	return e.v
+}
+
+// Line returns l with what it reads replayed. What is written still goes
+// to l.
+func (p *Player) Line(l Line) Line {
+	return playedLine{p, l}
+}
+
+type playedLine struct {
+	p *Player
+	Line
+}
+
+func (l playedLine) Ready() bool {
+	if l.p.live() {
+		return l.Line.Ready()
+	}
+	var e, _ = l.p.take(recReady, "a line polled")
+	return e.v != 0
+}
+
+func (l playedLine) Read() byte {
+	if l.p.live() {
+		return l.Line.Read()
+	}
+	var e, _ = l.p.take(recRead, "a line read")
+	return e.v
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// typingAltair returns an Altair storing from 1000 what its console reads,
+// while timedAltair's interrupts count at 0100
+func typingAltair(input string) *Altair {
+	var a = timedAltair(true)
+	a.SIO[0].line = &bufLine{in: input}
+	a.CPU.Load(0x17, []byte{
+		0x21, 0x00, 0x10, // LXI H, 1000H
+		0xdb, 0x10, // LOOP: IN 10H
+		0x0f,             // RRC
+		0xd2, 0x1a, 0x00, // JNC LOOP
+		0xdb, 0x11, // IN 11H
+		0x77,             // MOV M, A
+		0x23,             // INX H
+		0xc3, 0x1a, 0x00, // JMP LOOP
+	})
+	return a
+}
+
+// record records n steps of a and returns the recording
+func record(t *testing.T, a *Altair, n int) []byte {
+	var buf bytes.Buffer
+	var rec, err = NewRecorder(&buf, a.CPU, &a.Snapshot, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		rec.Step()
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReplay(t *testing.T) {
+	var a = typingAltair("hello")
+	var log = record(t, a, 20000)
+	if string(a.CPU.mem[0x1000:0x1005]) != "hello" || a.CPU.Read(0x100) < 10 {
+		t.Fatalf("recorded %q with %d interrupts", a.CPU.mem[0x1000:0x1005], a.CPU.Read(0x100))
+	}
+
+	var b = typingAltair("")
+	var p, err = NewPlayer(bytes.NewReader(log), b.CPU, &b.Snapshot, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20000; i++ {
+		if p.Done() {
+			t.Fatalf("done after %d steps: %v", i, p.Err())
+		}
+		p.Step()
+	}
+	if !p.Done() || p.Err() != nil {
+		t.Errorf("done %v with %v at the end of the log", p.Done(), p.Err())
+	}
+	if stateHash(b.CPU) != stateHash(a.CPU) {
+		t.Errorf("replayed %q with %d interrupts, expected the same machine", b.CPU.mem[0x1000:0x1005], b.CPU.Read(0x100))
+	}
+}
+
+func TestReplayDivergence(t *testing.T) {
+	var log = record(t, typingAltair("hello"), 20000)
+
+	var table = []struct {
+		what   string
+		change func(s *State)
+		verify bool
+		exp    string // in the error
+	}{
+		{"same", func(s *State) {}, true, ""},
+		{"data", func(s *State) { s.mem[0x3000] = 1 }, true, "the machine differs at the end of the frame"},
+		{"data unchecked", func(s *State) { s.mem[0x3000] = 1 }, false, ""},
+		{"port", func(s *State) { s.mem[0x1b] = 0x12 }, false, "IN 12, recorded IN 10 read"},
+		{"no interrupts", func(s *State) { s.mem[0x16] = 0 }, false, "IN 10, recorded an interrupt"},
+	}
+
+	for _, test := range table {
+		var b = typingAltair("")
+		var p, err = NewPlayer(bytes.NewReader(log), b.CPU, &b.Snapshot, test.verify)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.change(b.CPU)
+		for i := 0; i < 20000 && !p.Done(); i++ {
+			p.Step()
+		}
+		var got = ""
+		if p.Err() != nil {
+			got = p.Err().Error()
+		}
+		if test.exp == "" && got != "" || !strings.Contains(got, test.exp) {
+			t.Errorf("%s: error %q, expected %q", test.what, got, test.exp)
+		}
+	}
+}
+
+func TestReplayLine(t *testing.T) {
+	var cpu = &State{}
+	var snap = &Snapshot{}
+	snap.Add("cpu", cpu)
+
+	var buf bytes.Buffer
+	var rec, _ = NewRecorder(&buf, cpu, snap, 0)
+	var l = rec.Line(&bufLine{in: "ok"})
+	var got []byte
+	for i := 0; i < 4; i++ {
+		if l.Ready() {
+			got = append(got, l.Read())
+		}
+		rec.Step()
+	}
+	rec.Close()
+
+	var p, err = NewPlayer(&buf, cpu, snap, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var replayed []byte
+	l = p.Line(&bufLine{})
+	for i := 0; i < 4; i++ {
+		if l.Ready() {
+			replayed = append(replayed, l.Read())
+		}
+		p.Step()
+	}
+	if string(got) != "ok" || string(replayed) != "ok" || p.Err() != nil {
+		t.Errorf("read %q, replayed %q with %v, expected \"ok\"", got, replayed, p.Err())
+	}
+}
+
+func TestReplayErrors(t *testing.T) {
+	var log = record(t, typingAltair("hello"), 10)
+	var table = []struct {
+		what string
+		data []byte
+		exp  string
+	}{
+		{"snapshot", log, "recording: snapshot: pic is not in this machine"},
+		{"not gzip", []byte("8080RLOG is not compressed"), "recording: gzip: invalid header"},
+		{"truncated", log[:len(log)/2], "recording: truncated"},
+	}
+
+	for _, test := range table {
+		var b = timedAltair(false)
+		var _, err = NewPlayer(bytes.NewReader(test.data), b.CPU, &b.Snapshot, false)
+		if err == nil || err.Error() != test.exp {
+			t.Errorf("%s: error %v, expected %s", test.what, err, test.exp)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Line is the far end of a serial port: the host terminal, a file or a
+// socket. The CPU polls it, so Ready and Read never block.
+type Line interface {
+	Ready() bool  // a byte came in
+	Read() byte   // takes the byte that came in, or returns 0
+	Write(b byte) // sends b
+}
+
+// quitKey is Ctrl-], which stops the emulator when the terminal is raw
+const quitKey = 0x1d
+
+// Terminal is a Line reading from r in the background and writing to w.
+// Cooked terminals send LF at the end of lines, which become CR as the
+// 8080 programs of the time expect.
+type Terminal struct {
+	in     chan byte
+	next   int // the byte taken from in by Ready, or -1
+	w      io.Writer
+	cooked bool
+	quit   bool
+	eof    bool
+}
+
+func NewTerminal(r io.Reader, w io.Writer, cooked bool) *Terminal {
+	var t = &Terminal{in: make(chan byte, 256), next: -1, w: w, cooked: cooked}
+	var in = t.in
+	go func() {
+		var buf [1]byte
+		for {
+			if n, err := r.Read(buf[:]); n == 1 {
+				in <- buf[0]
+			} else if err != nil {
+				close(in)
+				return
+			}
+		}
+	}()
+	return t
+}
+
+// divert hands the keys typed on t to the front end taking the terminal,
+// which returns what the machine should read through typed. The machine
+// writes to w instead.
+func (t *Terminal) divert(w io.Writer) (keys <-chan byte, typed chan<- byte) {
+	var in = make(chan byte, 256)
+	keys, t.in, t.w, t.cooked = t.in, in, w, false
+	return keys, in
+}
+
+func (t *Terminal) Ready() bool {
+	if t.next >= 0 {
+		return true
+	}
+
+	select {
+	case b, ok := <-t.in:
+		switch {
+		case !ok:
+			t.eof, t.in = true, nil
+		case b == quitKey && !t.cooked:
+			t.quit = true
+		case b == '\n' && t.cooked:
+			t.next = '\r'
+		default:
+			t.next = int(b)
+		}
+	default:
+	}
+	return t.next >= 0
+}
+
+func (t *Terminal) Read() byte {
+	if !t.Ready() {
+		return 0
+	}
+	var b = byte(t.next)
+	t.next = -1
+	return b
+}
+
+func (t *Terminal) Write(b byte) {
+	t.w.Write([]byte{b})
+}
+
+// EOF tells if the input ended and every byte of it was read
+func (t *Terminal) EOF() bool {
+	return t.eof && !t.Ready()
+}
+
+// Lines returns a reader of the lines typed on t, for the commands given
+// to the emulator itself while the machine is stopped
+func (t *Terminal) Lines() io.Reader {
+	return termLines{t}
+}
+
+type termLines struct{ t *Terminal }
+
+// Read waits for a line and returns it with LF at the end
+func (l termLines) Read(p []byte) (int, error) {
+	for {
+		var n int
+		for n < len(p) && l.t.Ready() {
+			p[n] = l.t.Read()
+			if p[n] == '\r' {
+				p[n] = '\n'
+			}
+			n++
+			if p[n-1] == '\n' {
+				return n, nil
+			}
+		}
+		if n > 0 {
+			return n, nil
+		}
+		if l.t.EOF() {
+			return 0, io.EOF
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Quit tells if the user typed the quit key
+func (t *Terminal) Quit() bool {
+	return t.quit
+}
+
+// rawMode puts the terminal of stdin in raw mode with stty and returns the
+// function restoring it
+func rawMode() (func(), error) {
+	var saved, err = stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+	return func() { stty(strings.TrimSpace(saved)) }, nil
+}
+
+// termSize returns the columns and rows of the terminal, 80 by 24 when
+// stty cannot tell
+func termSize() (int, int) {
+	var out, err = stty("size")
+	var f = strings.Fields(out)
+	if err != nil || len(f) != 2 {
+		return 80, 24
+	}
+	var rows, _ = strconv.Atoi(f[0])
+	var cols, _ = strconv.Atoi(f[1])
+	if rows < 16 || cols < 64 {
+		return 80, 24
+	}
+	return cols, rows
+}
+
+func stty(args ...string) (string, error) {
+	var cmd = exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	var out, err = cmd.Output()
+	return string(out), err
+}
+
+// streamLine is the receiving half of a Line fed by host streams in the
+// background
+type streamLine struct {
+	in   chan byte
+	next int // the byte taken from in by Ready, or -1
+}
+
+func newStreamLine() streamLine {
+	return streamLine{in: make(chan byte, 256), next: -1}
+}
+
+// feed passes the bytes of r to the line until r fails
+func (l *streamLine) feed(r io.Reader) {
+	var buf [256]byte
+	for {
+		var n, err = r.Read(buf[:])
+		for _, b := range buf[:n] {
+			l.in <- b
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (l *streamLine) Ready() bool {
+	if l.next < 0 {
+		select {
+		case b := <-l.in:
+			l.next = int(b)
+		default:
+		}
+	}
+	return l.next >= 0
+}
+
+func (l *streamLine) Read() byte {
+	if !l.Ready() {
+		return 0
+	}
+	var b = byte(l.next)
+	l.next = -1
+	return b
+}
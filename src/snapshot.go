@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// A snapshot is gzip compressed:
+//
+//	"8080SNAP" version
+//	name payload ...
+//	0
+//
+// The version is a little endian word. Each part of the machine saves its
+// payload under its name: a byte of length then the name, a little endian
+// double word of length then the payload. A name of length 0 ends the
+// snapshot.
+const snapshotMagic = "8080SNAP"
+
+// snapshotVersion changes with the payload of any part
+const snapshotVersion = 1
+
+// Stateful is a part of a machine whose state goes in snapshots: the CPU or
+// a device. Its configuration, the lines and the images of its disks do
+// not: a snapshot is restored in a machine built the same way.
+type Stateful interface {
+	SaveState(e *Encoder)
+	LoadState(d *Decoder)
+}
+
+// Snapshot saves and restores the state of the parts of a machine
+type Snapshot struct {
+	names []string
+	parts []Stateful
+}
+
+// Add puts p in the snapshots under name
+func (s *Snapshot) Add(name string, p Stateful) {
+	s.names = append(s.names, name)
+	s.parts = append(s.parts, p)
+}
+
+// Save writes the state of every part to w
+func (s *Snapshot) Save(w io.Writer) error {
+	var z = gzip.NewWriter(w)
+	var bw = bufio.NewWriter(z)
+	bw.WriteString(snapshotMagic)
+	binary.Write(bw, binary.LittleEndian, uint16(snapshotVersion))
+	for i, p := range s.parts {
+		var e = &Encoder{}
+		p.SaveState(e)
+		bw.WriteByte(byte(len(s.names[i])))
+		bw.WriteString(s.names[i])
+		binary.Write(bw, binary.LittleEndian, uint32(e.buf.Len()))
+		bw.Write(e.buf.Bytes())
+	}
+	bw.WriteByte(0)
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+// Restore reads a snapshot saved by a machine with the same parts. On
+// error the machine is left as it was.
+func (s *Snapshot) Restore(r io.Reader) error {
+	var payloads, err = readSnapshot(r)
+	if err != nil {
+		return err
+	}
+	for _, name := range s.names {
+		if _, ok := payloads[name]; !ok {
+			return fmt.Errorf("snapshot: no %s", name)
+		}
+	}
+	if len(payloads) != len(s.names) {
+		for name := range payloads {
+			if !s.has(name) {
+				return fmt.Errorf("snapshot: %s is not in this machine", name)
+			}
+		}
+	}
+
+	var before bytes.Buffer
+	s.Save(&before)
+	for i, p := range s.parts {
+		var d = &Decoder{r: bytes.NewReader(payloads[s.names[i]])}
+		p.LoadState(d)
+		if d.err == nil && d.r.Len() != 0 {
+			d.err = errors.New("bytes left over")
+		}
+		if d.err != nil {
+			s.Restore(&before)
+			return fmt.Errorf("snapshot: %s: %v", s.names[i], d.err)
+		}
+	}
+	return nil
+}
+
+func (s *Snapshot) has(name string) bool {
+	for _, n := range s.names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// readSnapshot returns the payloads of a snapshot by name
+func readSnapshot(r io.Reader) (map[string][]byte, error) {
+	var z, err = gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot: %v", err)
+	}
+	var br = bufio.NewReader(z)
+	var head [len(snapshotMagic) + 2]byte
+	if _, err := io.ReadFull(br, head[:]); err != nil || string(head[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, errors.New("snapshot: not a snapshot")
+	}
+	if v := binary.LittleEndian.Uint16(head[len(snapshotMagic):]); v != snapshotVersion {
+		return nil, fmt.Errorf("snapshot: version %d, expected %d", v, snapshotVersion)
+	}
+
+	var payloads = map[string][]byte{}
+	for {
+		var n, err = br.ReadByte()
+		if err != nil {
+			return nil, errors.New("snapshot: truncated")
+		}
+		if n == 0 {
+			return payloads, nil
+		}
+		var name = make([]byte, n)
+		var size uint32
+		if _, err := io.ReadFull(br, name); err != nil {
+			return nil, errors.New("snapshot: truncated")
+		}
+		if err := binary.Read(br, binary.LittleEndian, &size); err != nil {
+			return nil, errors.New("snapshot: truncated")
+		}
+		var payload = make([]byte, size)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return nil, errors.New("snapshot: truncated")
+		}
+		payloads[string(name)] = payload
+	}
+}
+
+// SaveState saves the registers, the memory and its map, and where the CPU
+// is in its run
+func (s *State) SaveState(e *Encoder) {
+	for _, r := range []byte{s.regA, s.regB, s.regC, s.regD, s.regE, s.regH, s.regL, byte(s.flags), s.intEnable} {
+		e.Byte(r)
+	}
+	e.Uint16(s.sp)
+	e.Uint16(s.pc)
+	e.Uint64(s.cycles)
+	e.Bool(s.halted)
+	e.Bool(s.eiDelay)
+	for _, p := range s.pages {
+		e.Byte(byte(p))
+	}
+	e.Bytes(s.mem[:])
+}
+
+func (s *State) LoadState(d *Decoder) {
+	for _, r := range []*byte{&s.regA, &s.regB, &s.regC, &s.regD, &s.regE, &s.regH, &s.regL, (*byte)(&s.flags), &s.intEnable} {
+		*r = d.Byte()
+	}
+	s.sp = d.Uint16()
+	s.pc = d.Uint16()
+	s.cycles = d.Uint64()
+	s.halted = d.Bool()
+	s.eiDelay = d.Bool()
+	for i := range s.pages {
+		if s.pages[i] = page(d.Byte()); s.pages[i] > pageNone {
+			d.Fail(fmt.Errorf("bad page %02x", i))
+		}
+	}
+	d.Bytes(s.mem[:])
+	if s.code != nil {
+		s.code.remapped(0, 256)
+	}
+}
+
+// Encoder builds the payload of a part, with numbers little endian
+type Encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *Encoder) Byte(v byte) {
+	e.buf.WriteByte(v)
+}
+
+func (e *Encoder) Bool(v bool) {
+	if v {
+		e.Byte(1)
+	} else {
+		e.Byte(0)
+	}
+}
+
+func (e *Encoder) Uint16(v uint16) {
+	e.Byte(byte(v))
+	e.Byte(byte(v >> 8))
+}
+
+func (e *Encoder) Uint64(v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	e.buf.Write(b[:])
+}
+
+// Int saves an int as 64 bits
+func (e *Encoder) Int(v int) {
+	e.Uint64(uint64(int64(v)))
+}
+
+// Bytes saves b as it is, its length known to the decoder
+func (e *Encoder) Bytes(b []byte) {
+	e.buf.Write(b)
+}
+
+// Decoder reads the payload of a part. After an error it returns zeros, so
+// parts only check Err to refuse values they can not take.
+type Decoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (d *Decoder) Byte() byte {
+	var v, err = d.r.ReadByte()
+	if err != nil && d.err == nil {
+		d.err = errors.New("truncated")
+	}
+	return v
+}
+
+func (d *Decoder) Bool() bool {
+	return d.Byte() != 0
+}
+
+func (d *Decoder) Uint16() uint16 {
+	var low = d.Byte()
+	return pairTo16(d.Byte(), low)
+}
+
+func (d *Decoder) Uint64() uint64 {
+	var b [8]byte
+	d.Bytes(b[:])
+	return binary.LittleEndian.Uint64(b[:])
+}
+
+func (d *Decoder) Int() int {
+	return int(int64(d.Uint64()))
+}
+
+// Bytes fills b
+func (d *Decoder) Bytes(b []byte) {
+	if _, err := io.ReadFull(d.r, b); err != nil && d.err == nil {
+		d.err = errors.New("truncated")
+	}
+}
+
+// Fail records err, unless there is one already
+func (d *Decoder) Fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+// Err returns the first error met
+func (d *Decoder) Err() error {
+	return d.err
+}
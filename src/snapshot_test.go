@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+)
+
+// timedAltair returns an Altair counting at 0100 the interrupts of counter
+// 0 of an 8254, through an 8259, while it counts in BC
+func timedAltair(pic bool) *Altair {
+	var a = NewAltair(64, &bufLine{})
+	var pit = NewPIT(a.CPU.Cycles)
+	pit.Attach(a.Bus, 0x40)
+	a.Snapshot.Add("pit", pit)
+	if pic {
+		var p = NewPIC()
+		a.AttachPIC(p, 0x20)
+		p.Connect(0, func() bool { return pit.Level(0) })
+	}
+	a.CPU.Load(0, []byte{
+		0x3e, 0x16, // MVI A, 16H: ICW1, interval 4, single
+		0xd3, 0x20, // OUT 20H
+		0x3e, 0x02, // MVI A, 02H: ICW2, vectors at 0200H
+		0xd3, 0x21, // OUT 21H
+		0x3e, 0x36, // MVI A, 36H: counter 0, mode 3
+		0xd3, 0x43, // OUT 43H
+		0xaf,       // XRA A
+		0xd3, 0x40, // OUT 40H
+		0x3e, 0x02, // MVI A, 2: a count of 512
+		0xd3, 0x40, // OUT 40H
+		0x31, 0x00, 0x01, // LXI SP, 100H
+		0xfb,             // EI
+		0x03,             // LOOP: INX B
+		0xc3, 0x17, 0x00, // JMP LOOP
+	})
+	a.CPU.Load(0x200, []byte{
+		0xf5,             // PUSH PSW
+		0x3a, 0x00, 0x01, // LDA 100H
+		0x3c,             // INR A
+		0x32, 0x00, 0x01, // STA 100H
+		0x3e, 0x20, // MVI A, 20H: EOI
+		0xd3, 0x20, // OUT 20H
+		0xf1, // POP PSW
+		0xfb, // EI
+		0xc9, // RET
+	})
+	return a
+}
+
+func save(t *testing.T, s *Snapshot) []byte {
+	var buf bytes.Buffer
+	if err := s.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSnapshot(t *testing.T) {
+	var a = timedAltair(true)
+	for i := 0; i < 5000; i++ {
+		a.CPU.Step()
+	}
+	var middle = save(t, &a.Snapshot)
+	for i := 0; i < 5000; i++ {
+		a.CPU.Step()
+	}
+	var end = save(t, &a.Snapshot)
+	if a.CPU.Read(0x100) < 10 {
+		t.Fatalf("%d interrupts, expected more", a.CPU.Read(0x100))
+	}
+
+	var b = timedAltair(true)
+	b.CPU.Load(0, make([]byte, 0x300))
+	if err := b.Snapshot.Restore(bytes.NewReader(middle)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5000; i++ {
+		b.CPU.Step()
+	}
+	if !bytes.Equal(save(t, &b.Snapshot), end) {
+		t.Errorf("the restored machine went elsewhere: %d interrupts and BC = %02x%02x, expected %d and %02x%02x",
+			b.CPU.Read(0x100), b.CPU.regB, b.CPU.regC, a.CPU.Read(0x100), a.CPU.regB, a.CPU.regC)
+	}
+}
+
+func TestSnapshotErrors(t *testing.T) {
+	var a = timedAltair(true)
+	a.CPU.Step()
+	var good = save(t, &a.Snapshot)
+
+	var gz = func(s string) []byte {
+		var buf bytes.Buffer
+		var z = gzip.NewWriter(&buf)
+		z.Write([]byte(s))
+		z.Close()
+		return buf.Bytes()
+	}
+	var cut = func(n int) []byte {
+		var z, _ = gzip.NewReader(bytes.NewReader(good))
+		var buf bytes.Buffer
+		buf.ReadFrom(z)
+		return gz(buf.String()[:n])
+	}
+
+	var table = []struct {
+		what string
+		data []byte
+		pic  bool
+		exp  string
+	}{
+		{"not gzip", []byte("8080SNAP, not compressed"), true, "snapshot: gzip: invalid header"},
+		{"not a snapshot", gz("8080SNAQ\x01\x00\x00"), true, "snapshot: not a snapshot"},
+		{"version", gz("8080SNAP\x02\x00\x00"), true, "snapshot: version 2, expected 1"},
+		{"empty", gz("8080SNAP\x01\x00\x00"), true, "snapshot: no cpu"},
+		{"truncated", cut(20), true, "snapshot: truncated"},
+		{"extra part", good, false, "snapshot: pic is not in this machine"},
+		{"bad part", gz("8080SNAP\x01\x00\x04sio0\x01\x00\x00\x00\x00\x00"), true, "snapshot: no cpu"},
+	}
+
+	for _, test := range table {
+		var b = timedAltair(test.pic)
+		var before = save(t, &b.Snapshot)
+		var err = b.Snapshot.Restore(bytes.NewReader(test.data))
+		if err == nil || err.Error() != test.exp {
+			t.Errorf("%s: error %v, expected %s", test.what, err, test.exp)
+		}
+		if !bytes.Equal(save(t, &b.Snapshot), before) {
+			t.Errorf("%s: the machine changed", test.what)
+		}
+	}
+
+	// a part too short is only found while restoring
+	var b = timedAltair(false)
+	var s = Snapshot{}
+	s.Add("cpu", b.CPU)
+	s.Add("sio0", b.SIO[0])
+	var short = Snapshot{}
+	short.Add("cpu", b.CPU)
+	short.Add("sio0", &PPI{})
+	var before = save(t, &s)
+	b.CPU.pc = 0x1234
+	var data = save(t, &short)
+	b.CPU.pc = 0
+	if err := s.Restore(bytes.NewReader(data)); err == nil || !strings.Contains(err.Error(), "sio0: bytes left over") {
+		t.Errorf("error %v, expected bytes left over", err)
+	}
+	if !bytes.Equal(save(t, &s), before) {
+		t.Errorf("the CPU changed: pc = %04x", b.CPU.pc)
+	}
+}
+
+func TestSnapshotDevices(t *testing.T) {
+	var cpu = &State{}
+	var bios, _ = NewBIOS(cpu, 0xfa00, &bufLine{})
+	var table = []struct {
+		what  string
+		fresh func() Stateful
+		use   func(p Stateful)
+	}{
+		{"acia", func() Stateful { return NewACIA(&bufLine{in: "x"}) }, func(p Stateful) {
+			p.(*ACIA).Control(0x95)
+			p.(*ACIA).ReadData()
+		}},
+		{"usart", func() Stateful { return NewUSART(&bufLine{in: "xy"}, cpu.Cycles, altairHz) }, func(p Stateful) {
+			p.(*USART).Control(0x4e)
+			p.(*USART).Control(0x27)
+			p.(*USART).Status()
+			p.(*USART).WriteData('a')
+		}},
+		{"pit", func() Stateful { return NewPIT(cpu.Cycles) }, func(p Stateful) {
+			p.(*PIT).Control(0x36)
+			p.(*PIT).WriteCounter(0, 7)
+			p.(*PIT).Control(0x00)
+		}},
+		{"pic", func() Stateful { return NewPIC() }, func(p Stateful) {
+			p.(*PIC).WriteLow(0x16)
+			p.(*PIC).WriteHigh(0x02)
+			p.(*PIC).SetIR(3, true)
+		}},
+		{"ppi", func() Stateful { return NewPPI() }, func(p Stateful) {
+			p.(*PPI).Control(0xb4)
+			p.(*PPI).Strobe(ppiA, 0x42)
+			p.(*PPI).SetInput(ppiC, 0x5a)
+		}},
+		{"dcdd", func() Stateful {
+			var c = NewDiskController()
+			c.MountImage(1, make(memImage, dcddTracks*dcddSectors*dcddSectorSize), false)
+			return c
+		}, func(p Stateful) {
+			p.(*DiskController).Select(1)
+			p.(*DiskController).Command(dcddHeadLoad | dcddStepIn)
+			p.(*DiskController).ReadData()
+		}},
+		{"bios", func() Stateful { return bios }, func(p Stateful) {
+			p.(*BIOS).host.found = [][32]byte{{1, 'A'}, {1, 'B'}}
+			p.(*BIOS).disk, p.(*BIOS).dma = 1, 0x1234
+		}},
+	}
+
+	for _, test := range table {
+		var p = test.fresh()
+		test.use(p)
+		var e = &Encoder{}
+		p.SaveState(e)
+
+		var q = test.fresh()
+		var d = &Decoder{r: bytes.NewReader(e.buf.Bytes())}
+		q.LoadState(d)
+		if d.Err() != nil || d.r.Len() != 0 {
+			t.Errorf("%s: error %v with %d bytes left", test.what, d.Err(), d.r.Len())
+		}
+		var again = &Encoder{}
+		q.SaveState(again)
+		if !bytes.Equal(again.buf.Bytes(), e.buf.Bytes()) {
+			t.Errorf("%s: restored % x, expected % x", test.what, again.buf.Bytes(), e.buf.Bytes())
+		}
+	}
+}
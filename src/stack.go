@@ -0,0 +1,45 @@
+package main
+
+// push stores v on the stack. Stack goes "down"
+func (s *State) push(v uint16) {
+	s.sp -= 2
+	s.write16(s.sp, v)
+}
+
+func (s *State) pop() uint16 {
+	var v = s.read16(s.sp)
+	s.sp += 2
+	return v
+}
+
+// pswBits are where PUSH PSW stores each flag
+var pswBits = []struct {
+	bit  uint
+	flag Flag
+}{{7, FlagS}, {6, FlagZ}, {4, FlagAc}, {2, FlagP}, {0, FlagCy}}
+
+// psw returns A and the flags the way PUSH PSW stores them:
+// |S|Z|0|Ac|0|P|1|Cy|
+func (s *State) psw() uint16 {
+	var f byte = 0b0000_0010
+	for _, b := range pswBits {
+		if s.flags.IsSet(b.flag) {
+			f |= 1 << b.bit
+		}
+	}
+	return pairTo16(s.regA, f)
+}
+
+func (s *State) setPsw(v uint16) {
+	s.regA = byte(v >> 8)
+	for _, b := range pswBits {
+		s.flags.SetValue(b.flag, v&(1<<b.bit) != 0)
+	}
+}
+
+// xthl exchanges HL with the top of the stack
+func (s *State) xthl() {
+	var top = s.read16(s.sp)
+	s.write16(s.sp, s.hl())
+	s.regH, s.regL = byte(top>>8), byte(top)
+}
@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestStack(t *testing.T) {
+	var table = []Pair{
+		Pair{ // PUSH B
+			State{regB: 0x12, regC: 0x34, sp: 0x100, pc: 0, mem: [65536]byte{0xc5}},
+			State{regB: 0x12, regC: 0x34, sp: 0xfe, pc: 1, mem: [65536]byte{0: 0xc5, 0xfe: 0x34, 0xff: 0x12}},
+		},
+		Pair{ // POP H
+			State{sp: 0xfe, pc: 0, mem: [65536]byte{0: 0xe1, 0xfe: 0x34, 0xff: 0x12}},
+			State{regH: 0x12, regL: 0x34, sp: 0x100, pc: 1, mem: [65536]byte{0: 0xe1, 0xfe: 0x34, 0xff: 0x12}},
+		},
+		Pair{ // PUSH PSW ... S Z 0 Ac 0 P 1 Cy
+			State{regA: 0x80, sp: 0x100, pc: 0, mem: [65536]byte{0xf5}, flags: 0b00011111},
+			State{regA: 0x80, sp: 0xfe, pc: 1, mem: [65536]byte{0: 0xf5, 0xfe: 0b11010111, 0xff: 0x80}, flags: 0b00011111},
+		},
+		Pair{ // POP PSW
+			State{sp: 0xfe, pc: 0, mem: [65536]byte{0: 0xf1, 0xfe: 0b01000001, 0xff: 0x80}},
+			State{regA: 0x80, sp: 0x100, pc: 1, mem: [65536]byte{0: 0xf1, 0xfe: 0b01000001, 0xff: 0x80}, flags: 0b00001001},
+		},
+		Pair{ // XTHL
+			State{regH: 0x12, regL: 0x34, sp: 0xfe, pc: 0, mem: [65536]byte{0: 0xe3, 0xfe: 0x78, 0xff: 0x56}},
+			State{regH: 0x56, regL: 0x78, sp: 0xfe, pc: 1, mem: [65536]byte{0: 0xe3, 0xfe: 0x34, 0xff: 0x12}},
+		},
+		Pair{ // SPHL
+			State{regH: 0x12, regL: 0x34, pc: 0, mem: [65536]byte{0xf9}},
+			State{regH: 0x12, regL: 0x34, sp: 0x1234, pc: 1, mem: [65536]byte{0xf9}},
+		},
+		Pair{ // RST 1 pushes the address after it
+			State{sp: 0x100, pc: 0x10, mem: [65536]byte{0x10: 0xcf}},
+			State{sp: 0xfe, pc: 0x08, mem: [65536]byte{0x10: 0xcf, 0xfe: 0x11}},
+		},
+		Pair{ // RET
+			State{sp: 0xfe, pc: 0, mem: [65536]byte{0: 0xc9, 0xfe: 0x34, 0xff: 0x12}},
+			State{sp: 0x100, pc: 0x1234, mem: [65536]byte{0: 0xc9, 0xfe: 0x34, 0xff: 0x12}},
+		},
+		Pair{ // RZ when Z is not set
+			State{sp: 0xfe, pc: 0, mem: [65536]byte{0xc8}},
+			State{sp: 0xfe, pc: 1, mem: [65536]byte{0xc8}},
+		},
+	}
+
+	doTest(t, table)
+}
@@ -1,6 +1,8 @@
 package main
 
-import "fmt"
+import (
+	"8080emu/isa"
+)
 
 type Flags byte
 
@@ -12,7 +14,7 @@ const (
 	FlagS              // Sign flag: set to 1 when bit 7 is set
 	FlagP              // Parity flag: set to 1 when the result has even parity
 	FlagCy             // Carry flag: set to 1 when the result has a carry
-	FlagAc             // Aux carry flag: used for BCD math (Unimplemented)
+	FlagAc             // Aux carry flag: set on a carry out of bit 3, used by DAA
 )
 
 func (f *Flags) SetValue(bit Flag, set bool) {
@@ -48,362 +50,306 @@ type State struct {
 	mem       [65536]byte // 32 K = 2^16 = 65536
 	flags     Flags
 	intEnable byte
-}
 
-var instrSz = map[byte]byte{
-	0x00: 1,
-	0x01: 3,
-	0x02: 1,
-	0x03: 1,
-	0x04: 1,
-	0x05: 1,
-	0x06: 2,
-	0x07: 1,
-	0x08: 1,
-	0x09: 1,
-	0x0a: 1,
-	0x0b: 1,
-	0x0c: 1,
-	0x0d: 1,
-	0x0e: 2,
-	0x0f: 1,
-	0x10: 1,
-	0x11: 3,
-	0x12: 1,
-	0x13: 1,
-	0x14: 1,
-	0x15: 1,
-	0x16: 2,
-	0x17: 1,
-	0x18: 1,
-	0x19: 1,
-	0x1a: 1,
-	0x1b: 1,
-	0x1c: 1,
-	0x1d: 1,
-	0x1e: 2,
-	0x1f: 1,
-	0x20: 1,
-	0x21: 3,
-	0x22: 3,
-	0x23: 1,
-	0x24: 1,
-	0x25: 1,
-	0x26: 2,
-	0x27: 1,
-	0x28: 1,
-	0x29: 1,
-	0x2a: 3,
-	0x2b: 1,
-	0x2c: 1,
-	0x2d: 1,
-	0x2e: 2,
-	0x2f: 1,
-	0x30: 1,
-	0x31: 3,
-	0x32: 3,
-	0x33: 1,
-	0x34: 1,
-	0x35: 1,
-	0x36: 2,
-	0x37: 1,
-	0x38: 1,
-	0x39: 1,
-	0x3a: 3,
-	0x3b: 1,
-	0x3c: 1,
-	0x3d: 1,
-	0x3e: 2,
-	0x3f: 1,
-	0x40: 1,
-	0x41: 1,
-	0x42: 1,
-	0x43: 1,
-	0x44: 1,
-	0x45: 1,
-	0x46: 1,
-	0x47: 1,
-	0x48: 1,
-	0x49: 1,
-	0x4a: 1,
-	0x4b: 1,
-	0x4c: 1,
-	0x4d: 1,
-	0x4e: 1,
-	0x4f: 1,
-	0x50: 1,
-	0x51: 1,
-	0x52: 1,
-	0x53: 1,
-	0x54: 1,
-	0x55: 1,
-	0x56: 1,
-	0x57: 1,
-	0x58: 1,
-	0x59: 1,
-	0x5a: 1,
-	0x5b: 1,
-	0x5c: 1,
-	0x5d: 1,
-	0x5e: 1,
-	0x5f: 1,
-	0x60: 1,
-	0x61: 1,
-	0x62: 1,
-	0x63: 1,
-	0x64: 1,
-	0x65: 1,
-	0x66: 1,
-	0x67: 1,
-	0x68: 1,
-	0x69: 1,
-	0x6a: 1,
-	0x6b: 1,
-	0x6c: 1,
-	0x6d: 1,
-	0x6e: 1,
-	0x6f: 1,
-	0x70: 1,
-	0x71: 1,
-	0x72: 1,
-	0x73: 1,
-	0x74: 1,
-	0x75: 1,
-	0x76: 1,
-	0x77: 1,
-	0x78: 1,
-	0x79: 1,
-	0x7a: 1,
-	0x7b: 1,
-	0x7c: 1,
-	0x7d: 1,
-	0x7e: 1,
-	0x7f: 1,
-	0x80: 1,
-	0x81: 1,
-	0x82: 1,
-	0x83: 1,
-	0x84: 1,
-	0x85: 1,
-	0x86: 1,
-	0x87: 1,
-	0x88: 1,
-	0x89: 1,
-	0x8a: 1,
-	0x8b: 1,
-	0x8c: 1,
-	0x8d: 1,
-	0x8e: 1,
-	0x8f: 1,
-	0x90: 1,
-	0x91: 1,
-	0x92: 1,
-	0x93: 1,
-	0x94: 1,
-	0x95: 1,
-	0x96: 1,
-	0x97: 1,
-	0x98: 1,
-	0x99: 1,
-	0x9a: 1,
-	0x9b: 1,
-	0x9c: 1,
-	0x9d: 1,
-	0x9e: 1,
-	0x9f: 1,
-	0xa0: 1,
-	0xa1: 1,
-	0xa2: 1,
-	0xa3: 1,
-	0xa4: 1,
-	0xa5: 1,
-	0xa6: 1,
-	0xa7: 1,
-	0xa8: 1,
-	0xa9: 1,
-	0xaa: 1,
-	0xab: 1,
-	0xac: 1,
-	0xad: 1,
-	0xae: 1,
-	0xaf: 1,
-	0xb0: 1,
-	0xb1: 1,
-	0xb2: 1,
-	0xb3: 1,
-	0xb4: 1,
-	0xb5: 1,
-	0xb6: 1,
-	0xb7: 1,
-	0xb8: 1,
-	0xb9: 1,
-	0xba: 1,
-	0xbb: 1,
-	0xbc: 1,
-	0xbd: 1,
-	0xbe: 1,
-	0xbf: 1,
-	0xc0: 0,
-	0xc1: 1,
-	0xc2: 0, // JNZ ... I'll advance the pc manually in case Zero is set
-	0xc3: 0, // JMP do not advance pc
-	0xc4: 0,
-	0xc5: 1,
-	0xc6: 2,
-	0xc7: 0,
-	0xc8: 0,
-	0xc9: 0, // RET do not advance pc
-	0xca: 0, // JZ ... I'll advance the pc manually in case Zero is not set
+	pages   [256]page // what answers at each page of mem, RAM by default
+	ports   Ports
+	intr    Interrupter
+	cycles  uint64 // states run since the start
+	halted  bool
+	eiDelay bool // EI was the last instruction, so interrupts wait one more
 
-	0xcc: 0, // CZ ... I'll advance the pc manually
-	0xcd: 0, // CALL do not advance pc
-	0xce: 2,
-	0xcf: 0,
-	0xd0: 0,
-	0xd1: 1,
-	0xd2: 0, // JNC ... I'll advance the pc manually in case Cy is set
-	0xd3: 2,
-	0xd4: 0,
-	0xd5: 1,
-	0xd6: 2,
-	0xd7: 0,
-	0xd8: 0,
+	traps     map[uint16]func() // run instead of the instruction at their address
+	trapPages [256]bool         // the pages with traps, to keep Step fast
 
-	0xda: 0, // JC ... I'll advance the pc manually in case Cy is not set
-	0xdb: 2,
-	0xdc: 0,
+	onWrite func(addr uint16, v byte) // sees each write to memory before it lands
+	onRead  func(addr uint16, v byte) // sees each read of memory
 
-	0xde: 2,
-	0xdf: 0,
-	0xe0: 0,
-	0xe1: 1,
-	0xe2: 0, // JPO ... I'll advance the pc manually in case Parity is even
-	0xe3: 1,
-	0xe4: 0,
-	0xe5: 1,
-	0xe6: 2,
-	0xe7: 0,
-	0xe8: 0,
-	0xe9: 0,
-	0xea: 0, // JPE ... I'll advance the pc manually in case Parity is odd
-	0xeb: 1,
-	0xec: 0,
+	code *threadedCode // the instructions decoded, or nil to decode each time
+}
 
-	0xee: 2,
-	0xef: 0,
-	0xf0: 0,
-	0xf1: 1,
-	0xf2: 0, // JP ... I'll advance the pc manually in case the result is negative
-	0xf3: 1,
-	0xf4: 0,
-	0xf5: 1,
-	0xf6: 2,
-	0xf7: 0,
-	0xf8: 0,
-	0xf9: 1,
-	0xfa: 0, // JM ... I'll advance the pc manually in case the result is positive
-	0xfb: 1,
-	0xfc: 0,
+// undocumented are the opcodes missing from isa.Opcodes, which the 8080
+// runs as the documented ones they alias
+var undocumented = map[byte]byte{0xcb: 0xc3, 0xd9: 0xc9, 0xdd: 0xcd, 0xed: 0xcd, 0xfd: 0xcd}
 
-	0xfe: 2,
-	0xff: 0,
+// opcode returns the instruction at addr, the undocumented opcodes as the
+// ones they alias
+func (s *State) opcode(addr uint16) isa.Opcode {
+	var op = isa.Opcodes[s.peek(addr)]
+	if op.Size == 0 {
+		op = isa.Opcodes[undocumented[s.peek(addr)]]
+	}
+	return op
 }
 
 func (s *State) ExecInstruction() {
-	var opcode = s.mem[s.pc]
+	var opcode = s.read(s.pc)
+	var op = isa.Opcodes[opcode]
+	if op.Size == 0 {
+		op = isa.Opcodes[undocumented[opcode]]
+	}
+	s.cycles += uint64(op.Cycles)
 	switch opcode {
-	case 0x00:
+	case 0x00: // NOP
 		/* NOP */
 	case 0x01: // LXI B, D16
-		s.regC, s.regB = s.mem[s.pc+1], s.mem[s.pc+2]
-
+		s.regC, s.regB = s.read(s.pc+1), s.read(s.pc+2)
+	case 0x02: // STAX B
+		s.write(pairTo16(s.regB, s.regC), s.regA)
 	case 0x03: // INX B
 		s.inx(&s.regB, &s.regC)
 	case 0x04: // INR B
 		s.inc(&s.regB)
 	case 0x05: // DCR B
 		s.dec(&s.regB)
-
+	case 0x06: // MVI B, D8
+		s.regB = s.read(s.pc + 1)
 	case 0x07: // RLC
 		s.rlc()
-
+	case 0x08: // NOP (undocumented)
+		/* NOP */
 	case 0x09: // DAD B
 		s.dad(pairTo16(s.regB, s.regC))
-
+	case 0x0a: // LDAX B
+		s.regA = s.read(pairTo16(s.regB, s.regC))
 	case 0x0b: // DCX B
 		s.dcx(&s.regB, &s.regC)
-	case 0x0C: // INR C
+	case 0x0c: // INR C
 		s.inc(&s.regC)
-	case 0x0D: // DCR C
+	case 0x0d: // DCR C
 		s.dec(&s.regC)
-
-	case 0x0F: // RRC
+	case 0x0e: // MVI C, D8
+		s.regC = s.read(s.pc + 1)
+	case 0x0f: // RRC
 		s.rrc()
-
+	case 0x10: // NOP (undocumented)
+		/* NOP */
+	case 0x11: // LXI D, D16
+		s.regE, s.regD = s.read(s.pc+1), s.read(s.pc+2)
+	case 0x12: // STAX D
+		s.write(pairTo16(s.regD, s.regE), s.regA)
 	case 0x13: // INX D
 		s.inx(&s.regD, &s.regE)
 	case 0x14: // INR D
 		s.inc(&s.regD)
 	case 0x15: // DCR D
 		s.dec(&s.regD)
-
+	case 0x16: // MVI D, D8
+		s.regD = s.read(s.pc + 1)
 	case 0x17: // RAL
 		s.ral()
-
+	case 0x18: // NOP (undocumented)
+		/* NOP */
 	case 0x19: // DAD D
 		s.dad(pairTo16(s.regD, s.regE))
-
+	case 0x1a: // LDAX D
+		s.regA = s.read(pairTo16(s.regD, s.regE))
 	case 0x1b: // DCX D
 		s.dcx(&s.regD, &s.regE)
 	case 0x1c: // INR E
 		s.inc(&s.regE)
 	case 0x1d: // DCR E
 		s.dec(&s.regE)
-
+	case 0x1e: // MVI E, D8
+		s.regE = s.read(s.pc + 1)
 	case 0x1f: // RAR
 		s.rar()
-
+	case 0x20: // NOP (undocumented)
+		/* NOP */
+	case 0x21: // LXI H, D16
+		s.regL, s.regH = s.read(s.pc+1), s.read(s.pc+2)
+	case 0x22: // SHLD addr
+		s.write16(s.read16(s.pc+1), s.hl())
 	case 0x23: // INX H
 		s.inx(&s.regH, &s.regL)
 	case 0x24: // INR H
 		s.inc(&s.regH)
 	case 0x25: // DCR H
 		s.dec(&s.regH)
-
+	case 0x26: // MVI H, D8
+		s.regH = s.read(s.pc + 1)
+	case 0x27: // DAA
+		s.daa()
+	case 0x28: // NOP (undocumented)
+		/* NOP */
 	case 0x29: // DAD H
 		s.dad(pairTo16(s.regH, s.regL))
-
+	case 0x2a: // LHLD addr
+		var v = s.read16(s.read16(s.pc + 1))
+		s.regH, s.regL = byte(v>>8), byte(v)
 	case 0x2b: // DCX H
 		s.dcx(&s.regH, &s.regL)
 	case 0x2c: // INR L
 		s.inc(&s.regL)
 	case 0x2d: // DCR L
 		s.dec(&s.regL)
-
+	case 0x2e: // MVI L, D8
+		s.regL = s.read(s.pc + 1)
+	case 0x2f: // CMA
+		s.regA = ^s.regA
+	case 0x30: // NOP (undocumented)
+		/* NOP */
+	case 0x31: // LXI SP, D16
+		s.sp = s.read16(s.pc + 1)
+	case 0x32: // STA addr
+		s.write(s.read16(s.pc+1), s.regA)
 	case 0x33: // INX SP
 		s.sp++
 	case 0x34: // INR M
-		s.inc(&s.mem[s.hl()])
+		var m = s.read(s.hl())
+		s.inc(&m)
+		s.write(s.hl(), m)
 	case 0x35: // DCR M
-		s.dec(&s.mem[s.hl()])
-
+		var m = s.read(s.hl())
+		s.dec(&m)
+		s.write(s.hl(), m)
+	case 0x36: // MVI M, D8
+		s.write(s.hl(), s.read(s.pc+1))
+	case 0x37: // STC
+		s.flags.Set(FlagCy)
+	case 0x38: // NOP (undocumented)
+		/* NOP */
 	case 0x39: // DAD SP
 		s.dad(s.sp)
-
+	case 0x3a: // LDA addr
+		s.regA = s.read(s.read16(s.pc + 1))
 	case 0x3b: // DCX SP
 		s.sp--
 	case 0x3c: // INR A
 		s.inc(&s.regA)
 	case 0x3d: // DCR A
 		s.dec(&s.regA)
-
+	case 0x3e: // MVI A, D8
+		s.regA = s.read(s.pc + 1)
+	case 0x3f: // CMC
+		s.flags.SetValue(FlagCy, !s.flags.IsSet(FlagCy))
+	case 0x40: // MOV B, B
+		/* MOV B, B does nothing */
 	case 0x41: // MOV B, C
 		s.regB = s.regC
 	case 0x42: // MOV B, D
 		s.regB = s.regD
 	case 0x43: // MOV B, E
 		s.regB = s.regE
-
+	case 0x44: // MOV B, H
+		s.regB = s.regH
+	case 0x45: // MOV B, L
+		s.regB = s.regL
+	case 0x46: // MOV B, M
+		s.regB = s.read(s.hl())
+	case 0x47: // MOV B, A
+		s.regB = s.regA
+	case 0x48: // MOV C, B
+		s.regC = s.regB
+	case 0x49: // MOV C, C
+		/* MOV C, C does nothing */
+	case 0x4a: // MOV C, D
+		s.regC = s.regD
+	case 0x4b: // MOV C, E
+		s.regC = s.regE
+	case 0x4c: // MOV C, H
+		s.regC = s.regH
+	case 0x4d: // MOV C, L
+		s.regC = s.regL
+	case 0x4e: // MOV C, M
+		s.regC = s.read(s.hl())
+	case 0x4f: // MOV C, A
+		s.regC = s.regA
+	case 0x50: // MOV D, B
+		s.regD = s.regB
+	case 0x51: // MOV D, C
+		s.regD = s.regC
+	case 0x52: // MOV D, D
+		/* MOV D, D does nothing */
+	case 0x53: // MOV D, E
+		s.regD = s.regE
+	case 0x54: // MOV D, H
+		s.regD = s.regH
+	case 0x55: // MOV D, L
+		s.regD = s.regL
+	case 0x56: // MOV D, M
+		s.regD = s.read(s.hl())
+	case 0x57: // MOV D, A
+		s.regD = s.regA
+	case 0x58: // MOV E, B
+		s.regE = s.regB
+	case 0x59: // MOV E, C
+		s.regE = s.regC
+	case 0x5a: // MOV E, D
+		s.regE = s.regD
+	case 0x5b: // MOV E, E
+		/* MOV E, E does nothing */
+	case 0x5c: // MOV E, H
+		s.regE = s.regH
+	case 0x5d: // MOV E, L
+		s.regE = s.regL
+	case 0x5e: // MOV E, M
+		s.regE = s.read(s.hl())
+	case 0x5f: // MOV E, A
+		s.regE = s.regA
+	case 0x60: // MOV H, B
+		s.regH = s.regB
+	case 0x61: // MOV H, C
+		s.regH = s.regC
+	case 0x62: // MOV H, D
+		s.regH = s.regD
+	case 0x63: // MOV H, E
+		s.regH = s.regE
+	case 0x64: // MOV H, H
+		/* MOV H, H does nothing */
+	case 0x65: // MOV H, L
+		s.regH = s.regL
+	case 0x66: // MOV H, M
+		s.regH = s.read(s.hl())
+	case 0x67: // MOV H, A
+		s.regH = s.regA
+	case 0x68: // MOV L, B
+		s.regL = s.regB
+	case 0x69: // MOV L, C
+		s.regL = s.regC
+	case 0x6a: // MOV L, D
+		s.regL = s.regD
+	case 0x6b: // MOV L, E
+		s.regL = s.regE
+	case 0x6c: // MOV L, H
+		s.regL = s.regH
+	case 0x6d: // MOV L, L
+		/* MOV L, L does nothing */
+	case 0x6e: // MOV L, M
+		s.regL = s.read(s.hl())
+	case 0x6f: // MOV L, A
+		s.regL = s.regA
+	case 0x70: // MOV M, B
+		s.write(s.hl(), s.regB)
+	case 0x71: // MOV M, C
+		s.write(s.hl(), s.regC)
+	case 0x72: // MOV M, D
+		s.write(s.hl(), s.regD)
+	case 0x73: // MOV M, E
+		s.write(s.hl(), s.regE)
+	case 0x74: // MOV M, H
+		s.write(s.hl(), s.regH)
+	case 0x75: // MOV M, L
+		s.write(s.hl(), s.regL)
+	case 0x76: // HLT
+		s.halted = true
+	case 0x77: // MOV M, A
+		s.write(s.hl(), s.regA)
+	case 0x78: // MOV A, B
+		s.regA = s.regB
+	case 0x79: // MOV A, C
+		s.regA = s.regC
+	case 0x7a: // MOV A, D
+		s.regA = s.regD
+	case 0x7b: // MOV A, E
+		s.regA = s.regE
+	case 0x7c: // MOV A, H
+		s.regA = s.regH
+	case 0x7d: // MOV A, L
+		s.regA = s.regL
+	case 0x7e: // MOV A, M
+		s.regA = s.read(s.hl())
+	case 0x7f: // MOV A, A
+		/* MOV A, A does nothing */
 	case 0x80: // ADD B
 		s.add(s.regB)
 	case 0x81: // ADD C
@@ -417,7 +363,7 @@ func (s *State) ExecInstruction() {
 	case 0x85: // ADD L
 		s.add(s.regL)
 	case 0x86: // ADD M
-		s.add(s.mem[s.hl()])
+		s.add(s.read(s.hl()))
 	case 0x87: // ADD A
 		s.add(s.regA)
 	case 0x88: // ADC B
@@ -433,7 +379,7 @@ func (s *State) ExecInstruction() {
 	case 0x8d: // ADC L
 		s.addCy(s.regL)
 	case 0x8e: // ADC M
-		s.addCy(s.mem[s.hl()])
+		s.addCy(s.read(s.hl()))
 	case 0x8f: // ADC A
 		s.addCy(s.regA)
 	case 0x90: // SUB B
@@ -449,7 +395,7 @@ func (s *State) ExecInstruction() {
 	case 0x95: // SUB L
 		s.sub(s.regL)
 	case 0x96: // SUB M
-		s.sub(s.mem[s.hl()])
+		s.sub(s.read(s.hl()))
 	case 0x97: // SUB A
 		s.sub(s.regA)
 	case 0x98: // SBB B
@@ -465,7 +411,7 @@ func (s *State) ExecInstruction() {
 	case 0x9d: // SBB L
 		s.subCy(s.regL)
 	case 0x9e: // SBB M
-		s.subCy(s.mem[s.hl()])
+		s.subCy(s.read(s.hl()))
 	case 0x9f: // SBB A
 		s.subCy(s.regA)
 	case 0xa0: // ANA B
@@ -481,7 +427,7 @@ func (s *State) ExecInstruction() {
 	case 0xa5: // ANA L
 		s.and(s.regL)
 	case 0xa6: // ANA M
-		s.and(s.mem[s.hl()])
+		s.and(s.read(s.hl()))
 	case 0xa7: // ANA A
 		s.and(s.regA)
 	case 0xa8: // XRA B
@@ -497,7 +443,7 @@ func (s *State) ExecInstruction() {
 	case 0xad: // XRA L
 		s.xor(s.regL)
 	case 0xae: // XRA M
-		s.xor(s.mem[s.hl()])
+		s.xor(s.read(s.hl()))
 	case 0xaf: // XRA A
 		s.xor(s.regA)
 	case 0xb0: // ORA B
@@ -513,7 +459,7 @@ func (s *State) ExecInstruction() {
 	case 0xb5: // ORA L
 		s.or(s.regL)
 	case 0xb6: // ORA M
-		s.or(s.mem[s.hl()])
+		s.or(s.read(s.hl()))
 	case 0xb7: // ORA A
 		s.or(s.regA)
 	case 0xb8: // CMP B
@@ -529,21 +475,24 @@ func (s *State) ExecInstruction() {
 	case 0xbd: // CMP L
 		s.cmp(s.regL)
 	case 0xbe: // CMP M
-		s.cmp(s.mem[s.hl()])
+		s.cmp(s.read(s.hl()))
 	case 0xbf: // CMP A
 		s.cmp(s.regA)
-
 	case 0xc0: // RNZ
 		s.retOnFlag(FlagZ, false)
-
+	case 0xc1: // POP B
+		var v = s.pop()
+		s.regB, s.regC = byte(v>>8), byte(v)
 	case 0xc2: // JNZ addr
 		s.jmpOnFlag(FlagZ, false)
 	case 0xc3: // JMP addr
 		s.jmp()
 	case 0xc4: // CNZ addr
 		s.callOnFlag(FlagZ, false)
+	case 0xc5: // PUSH B
+		s.push(pairTo16(s.regB, s.regC))
 	case 0xc6: // ADI D8
-		s.add(s.mem[s.pc+1])
+		s.add(s.read(s.pc + 1))
 	case 0xc7: // RST 0
 		s.rst(0x00)
 	case 0xc8: // RZ
@@ -552,101 +501,121 @@ func (s *State) ExecInstruction() {
 		s.ret()
 	case 0xca: // JZ addr
 		s.jmpOnFlag(FlagZ, true)
-
+	case 0xcb: // JMP addr (undocumented)
+		s.jmp()
 	case 0xcc: // CZ addr
 		s.callOnFlag(FlagZ, true)
 	case 0xcd: // CALL addr
 		s.call()
 	case 0xce: // ACI D8
-		s.addCy(s.mem[s.pc+1])
+		s.addCy(s.read(s.pc + 1))
 	case 0xcf: // RST 1
 		s.rst(0x08)
 	case 0xd0: // RNC
 		s.retOnFlag(FlagCy, false)
-
+	case 0xd1: // POP D
+		var v = s.pop()
+		s.regD, s.regE = byte(v>>8), byte(v)
 	case 0xd2: // JNC addr
 		s.jmpOnFlag(FlagCy, false)
-
+	case 0xd3: // OUT D8
+		s.out(s.read(s.pc+1), s.regA)
 	case 0xd4: // CNC addr
 		s.callOnFlag(FlagCy, false)
-
+	case 0xd5: // PUSH D
+		s.push(pairTo16(s.regD, s.regE))
 	case 0xd6: // SUI D8
-		s.sub(s.mem[s.pc+1])
+		s.sub(s.read(s.pc + 1))
 	case 0xd7: // RST 2
 		s.rst(0x10)
 	case 0xd8: // RC
 		s.retOnFlag(FlagCy, true)
-
+	case 0xd9: // RET (undocumented)
+		s.ret()
 	case 0xda: // JC addr
 		s.jmpOnFlag(FlagCy, true)
-
+	case 0xdb: // IN D8
+		s.regA = s.in(s.read(s.pc + 1))
 	case 0xdc: // CC addr
 		s.callOnFlag(FlagCy, true)
-
+	case 0xdd: // CALL addr (undocumented)
+		s.call()
 	case 0xde: // SBI D8
-		s.subCy(s.mem[s.pc+1])
+		s.subCy(s.read(s.pc + 1))
 	case 0xdf: // RST 3
 		s.rst(0x18)
-	case 0xe0: // RPO addr
+	case 0xe0: // RPO
 		s.retOnFlag(FlagP, false)
-
+	case 0xe1: // POP H
+		var v = s.pop()
+		s.regH, s.regL = byte(v>>8), byte(v)
 	case 0xe2: // JPO addr
 		s.jmpOnFlag(FlagP, false)
-
+	case 0xe3: // XTHL
+		s.xthl()
 	case 0xe4: // CPO addr
 		s.callOnFlag(FlagP, false)
-
+	case 0xe5: // PUSH H
+		s.push(pairTo16(s.regH, s.regL))
 	case 0xe6: // ANI D8
-		s.and(s.mem[s.pc+1])
+		s.and(s.read(s.pc + 1))
 	case 0xe7: // RST 4
 		s.rst(0x20)
-
 	case 0xe8: // RPE
 		s.retOnFlag(FlagP, true)
-
 	case 0xe9: // PCHL
 		s.pc = s.hl()
 	case 0xea: // JPE addr
 		s.jmpOnFlag(FlagP, true)
-
+	case 0xeb: // XCHG
+		s.regD, s.regE, s.regH, s.regL = s.regH, s.regL, s.regD, s.regE
 	case 0xec: // CPE addr
 		s.callOnFlag(FlagP, true)
-
+	case 0xed: // CALL addr (undocumented)
+		s.call()
 	case 0xee: // XRI D8
-		s.xor(s.mem[s.pc+1])
+		s.xor(s.read(s.pc + 1))
 	case 0xef: // RST 5
 		s.rst(0x28)
-	case 0xf0: // JP addr
+	case 0xf0: // RP
 		s.retOnFlag(FlagS, false)
-
+	case 0xf1: // POP PSW
+		s.setPsw(s.pop())
 	case 0xf2: // JP addr
 		s.jmpOnFlag(FlagS, false)
-
+	case 0xf3: // DI
+		s.intEnable = 0
 	case 0xf4: // CP addr
 		s.callOnFlag(FlagS, false)
-
+	case 0xf5: // PUSH PSW
+		s.push(s.psw())
 	case 0xf6: // ORI D8
-		s.or(s.mem[s.pc+1])
+		s.or(s.read(s.pc + 1))
 	case 0xf7: // RST 6
 		s.rst(0x30)
 	case 0xf8: // RM
 		s.retOnFlag(FlagS, true)
-
-	case 0xfa: // JM addr ... Jump minus = Jump if negative = Jump when the Sign is set
+	case 0xf9: // SPHL
+		s.sp = s.hl()
+	case 0xfa: // JM addr
 		s.jmpOnFlag(FlagS, true)
-
+	case 0xfb: // EI
+		s.intEnable = 1
+		s.eiDelay = true
 	case 0xfc: // CM addr
 		s.callOnFlag(FlagS, true)
-
+	case 0xfd: // CALL addr (undocumented)
+		s.call()
 	case 0xfe: // CPI D8
-		s.cmp(s.mem[s.pc+1])
+		s.cmp(s.read(s.pc + 1))
 	case 0xff: // RST 7
 		s.rst(0x38)
-	default:
-		panic(fmt.Sprintf("unimplemented instruction: 0x%02x", opcode))
 	}
 
-	s.pc += uint16(instrSz[opcode])
+	// Jumps, calls and returns leave pc where it has to be
+	if op.Flow == 0 {
+		s.pc += uint16(op.Size)
+	}
 }
 
 // hl returns the value (usually used as an address) formed by hl
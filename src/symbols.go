@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Symbols are the names of addresses, read from the map file of the linker:
+// comments start with ; and every other line is
+//
+//	ADDR NAME
+//
+// with ADDR in hex
+type Symbols struct {
+	addrs  map[string]uint16
+	names  map[uint16]string // the first name given to each address
+	sorted []uint16          // the addresses with a name
+}
+
+// NewSymbols returns an empty table
+func NewSymbols() *Symbols {
+	return &Symbols{addrs: map[string]uint16{}, names: map[uint16]string{}}
+}
+
+// LoadSymbols reads a map file
+func LoadSymbols(r io.Reader) (*Symbols, error) {
+	var syms = NewSymbols()
+	var sc = bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		var text = strings.TrimSpace(sc.Text())
+		if i := strings.IndexByte(text, ';'); i >= 0 {
+			text = strings.TrimSpace(text[:i])
+		}
+		if text == "" {
+			continue
+		}
+
+		var f = strings.Fields(text)
+		if len(f) != 2 {
+			return nil, fmt.Errorf("line %d: expected an address and a name", line)
+		}
+		var addr, err = strconv.ParseUint(f[0], 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad address %s", line, f[0])
+		}
+		syms.Add(f[1], uint16(addr))
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return syms, nil
+}
+
+// Add names addr. An address keeps the first name it was given.
+func (s *Symbols) Add(name string, addr uint16) {
+	s.addrs[name] = addr
+	if _, ok := s.names[addr]; !ok {
+		s.names[addr] = name
+		var i = sort.Search(len(s.sorted), func(i int) bool { return s.sorted[i] >= addr })
+		s.sorted = append(s.sorted, 0)
+		copy(s.sorted[i+1:], s.sorted[i:])
+		s.sorted[i] = addr
+	}
+}
+
+// Addr returns the address called name
+func (s *Symbols) Addr(name string) (uint16, bool) {
+	var addr, ok = s.addrs[name]
+	return addr, ok
+}
+
+// Name describes addr as the closest symbol at or below it plus an offset,
+// as in LOOP+3, or in hex when there is none
+func (s *Symbols) Name(addr uint16) string {
+	if label := s.Label(addr); label != "" {
+		return label
+	}
+	return fmt.Sprintf("%04x", addr)
+}
+
+// Label is Name without the hex: "" when there is no symbol at or below
+// addr
+func (s *Symbols) Label(addr uint16) string {
+	var i = sort.Search(len(s.sorted), func(i int) bool { return s.sorted[i] > addr })
+	if i == 0 {
+		return ""
+	}
+	var base = s.sorted[i-1]
+	if base == addr {
+		return s.names[base]
+	}
+	return fmt.Sprintf("%s+%d", s.names[base], addr-base)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"8080emu/asm"
+	"8080emu/obj"
+)
+
+func TestLoadSymbols(t *testing.T) {
+	var syms, err = LoadSymbols(strings.NewReader(`; MODULE  CSEG
+; main    0100 0010
+0100 START
+0100 main.START ; a second name
+0105 LOOP
+2000 BUF
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names = []struct {
+		addr uint16
+		name string
+	}{
+		{0x0000, "0000"},
+		{0x0100, "START"},
+		{0x0103, "START+3"},
+		{0x0105, "LOOP"},
+		{0x1000, "LOOP+3835"},
+		{0xffff, "BUF+57343"},
+	}
+	for _, test := range names {
+		if name := syms.Name(test.addr); name != test.name {
+			t.Errorf("Name(%04x) = %s, expected %s", test.addr, name, test.name)
+		}
+	}
+
+	if addr, ok := syms.Addr("main.START"); !ok || addr != 0x100 {
+		t.Errorf("Addr(main.START) = %04x, %v", addr, ok)
+	}
+	if _, ok := syms.Addr("NOPE"); ok {
+		t.Errorf("Addr(NOPE) found")
+	}
+
+	for _, bad := range []string{"0100\n", "START 0100\n", "10000 BIG\n"} {
+		if _, err := LoadSymbols(strings.NewReader(bad)); err == nil {
+			t.Errorf("LoadSymbols(%q) did not fail", bad)
+		}
+	}
+}
+
+// The map written by the linker names the labels of every module
+func TestLinkerMap(t *testing.T) {
+	var mods []*obj.Module
+	for _, src := range []string{
+		"\tEXTRN PUTS\n\tCSEG\nSTART:\tCALL PUTS\nLOOP:\tJMP LOOP\n\tEND START\n",
+		"\tPUBLIC PUTS\n\tCSEG\nPUTS:\tRET\n",
+	} {
+		var prog, err = asm.Assemble("m.asm", []byte(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mods = append(mods, prog.Object("m"+string(rune('0'+len(mods)))))
+	}
+
+	var im, err = obj.Link(mods, 0x100, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := im.WriteMap(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	syms, err := LoadSymbols(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for addr, name := range map[uint16]string{0x100: "m0.START", 0x103: "m0.LOOP", 0x106: "PUTS", 0x104: "m0.LOOP+1"} {
+		if syms.Name(addr) != name {
+			t.Errorf("Name(%04x) = %s, expected %s", addr, syms.Name(addr), name)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net"
+	"sync"
+)
+
+// TCPLine is a Line served on a TCP socket, for telnet or nc. It talks to
+// one client at a time: a new one takes the line over. What is written with
+// nobody connected is lost.
+type TCPLine struct {
+	streamLine
+	ln   net.Listener
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// ListenTCP listens on addr, host:port, where the host defaults to localhost
+func ListenTCP(addr string) (*TCPLine, error) {
+	if host, port, err := net.SplitHostPort(addr); err == nil && host == "" {
+		addr = net.JoinHostPort("localhost", port)
+	}
+	var ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var l = &TCPLine{streamLine: newStreamLine(), ln: ln}
+	go func() {
+		for {
+			var conn, err = ln.Accept()
+			if err != nil {
+				return
+			}
+			l.mu.Lock()
+			if l.conn != nil {
+				l.conn.Close()
+			}
+			l.conn = conn
+			l.mu.Unlock()
+			go l.feed(conn)
+		}
+	}()
+	return l, nil
+}
+
+// Addr is the address the line listens on
+func (l *TCPLine) Addr() net.Addr {
+	return l.ln.Addr()
+}
+
+func (l *TCPLine) Write(b byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn != nil {
+		if _, err := l.conn.Write([]byte{b}); err != nil {
+			l.conn.Close()
+			l.conn = nil
+		}
+	}
+}
+
+// Close stops listening and hangs up on the client
+func (l *TCPLine) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn != nil {
+		l.conn.Close()
+	}
+	return l.ln.Close()
+}
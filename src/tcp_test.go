@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTCPLine(t *testing.T) {
+	var l, err = ListenTCP(":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	l.Write('!') // nobody is connected: lost
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("hi"))
+
+	var got []byte
+	for deadline := time.Now().Add(5 * time.Second); len(got) < 2 && time.Now().Before(deadline); {
+		if l.Ready() {
+			got = append(got, l.Read())
+		}
+	}
+	if string(got) != "hi" {
+		t.Errorf("received %q, expected %q", got, "hi")
+	}
+
+	l.Write('o')
+	l.Write('k')
+	var buf = make([]byte, 2)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if n, err := conn.Read(buf); err != nil || string(buf[:n]) != "ok" {
+		// the two bytes may come in two reads
+		if n == 1 {
+			var m, _ = conn.Read(buf[1:])
+			n += m
+		}
+		if string(buf[:n]) != "ok" {
+			t.Errorf("sent %q, %v, expected %q", buf[:n], err, "ok")
+		}
+	}
+}
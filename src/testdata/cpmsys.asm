@@ -0,0 +1,77 @@
+; Stands in for the CCP and the BDOS of CP/M 2.2 under a BIOS at 0FA00H.
+; Prints C, reads the first directory sector of A: and prints the name of
+; its first file, writes the sector again as the second one and warm boots
+; to print W and halt.
+BIOS	EQU	0FA00H
+CONOUT	EQU	BIOS+12
+SELDSK	EQU	BIOS+27
+SETTRK	EQU	BIOS+30
+SETSEC	EQU	BIOS+33
+SETDMA	EQU	BIOS+36
+READ	EQU	BIOS+39
+WRITE	EQU	BIOS+42
+SECTRAN	EQU	BIOS+48
+
+	ORG	BIOS-1600H
+	JMP	COLD
+	JMP	WARM
+
+COLD:	MVI	C,'C'
+	CALL	CONOUT
+	MVI	C,0
+	MVI	E,0
+	CALL	SELDSK
+	MOV	A,H
+	ORA	L
+	JZ	FAIL
+	MOV	E,M		; the skew table
+	INX	H
+	MOV	D,M
+	PUSH	D
+	LXI	B,2		; the directory track
+	CALL	SETTRK
+	LXI	B,80H
+	CALL	SETDMA
+
+	POP	D
+	PUSH	D
+	LXI	B,0
+	CALL	SECTRAN
+	MOV	B,H
+	MOV	C,L
+	CALL	SETSEC
+	CALL	READ
+	ORA	A
+	JNZ	FAIL
+
+	LXI	H,81H		; the name of the first entry
+	MVI	B,11
+NAME:	MOV	C,M
+	PUSH	B
+	PUSH	H
+	CALL	CONOUT
+	POP	H
+	POP	B
+	INX	H
+	DCR	B
+	JNZ	NAME
+
+	POP	D
+	LXI	B,1
+	CALL	SECTRAN
+	MOV	B,H
+	MOV	C,L
+	CALL	SETSEC
+	MVI	C,0
+	CALL	WRITE
+	ORA	A
+	JNZ	FAIL
+	JMP	0		; warm boot
+
+WARM:	MVI	C,'W'
+	CALL	CONOUT
+	HLT
+
+FAIL:	MVI	C,'?'
+	CALL	CONOUT
+	HLT
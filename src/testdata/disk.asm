@@ -0,0 +1,71 @@
+; Reads sector 5 of track 2 of drive 0, then writes it back to sector 7 of
+; track 0 with every byte incremented. Runs on the Altair 88-DCDD.
+DSTAT	EQU	08H		; drive select and status
+DCTRL	EQU	09H		; control and sector position
+DDATA	EQU	0AH		; data
+
+	ORG	0
+	LXI	SP,STACK
+	XRA	A
+	OUT	DSTAT		; select drive 0
+	MVI	A,04H		; load the head
+	OUT	DCTRL
+
+	MVI	B,2
+STEP:	IN	DSTAT
+	ANI	02H		; the head may move
+	JNZ	STEP
+	MVI	A,01H		; step in
+	OUT	DCTRL
+	DCR	B
+	JNZ	STEP
+
+	MVI	C,5
+	CALL	SEEK
+	LXI	H,BUF
+	MVI	B,137
+READ:	IN	DSTAT
+	ORA	A		; a byte is ready
+	JM	READ
+	IN	DDATA
+	MOV	M,A
+	INX	H
+	DCR	B
+	JNZ	READ
+
+HOME:	IN	DSTAT
+	ANI	40H		; track 0
+	JZ	BACK
+	MVI	A,02H		; step out
+	OUT	DCTRL
+	JMP	HOME
+
+BACK:	MVI	C,7
+	CALL	SEEK
+	MVI	A,80H		; write enable
+	OUT	DCTRL
+	LXI	H,BUF
+	MVI	B,137
+WRITE:	IN	DSTAT
+	RRC			; ready for a byte
+	JC	WRITE
+	MOV	A,M
+	INR	A
+	OUT	DDATA
+	INX	H
+	DCR	B
+	JNZ	WRITE
+	HLT
+
+; Waits for the start of sector C
+SEEK:	IN	DCTRL
+	RRC			; sector true
+	JC	SEEK
+	ANI	1FH
+	CMP	C
+	JNZ	SEEK
+	RET
+
+BUF:	DS	137
+	DS	32
+STACK:
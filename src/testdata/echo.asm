@@ -0,0 +1,70 @@
+; Prints the sense switches and the size of memory in pages, then echoes
+; the console in upper case until a dot. Runs on the Altair 88-2SIO.
+SIOC	EQU	10H		; 2SIO control and status
+SIOD	EQU	11H		; 2SIO data
+
+	ORG	0
+	LXI	SP,STACK
+	MVI	A,3		; master reset
+	OUT	SIOC
+	MVI	A,15H		; 8 bits, 1 stop bit, divide by 16
+	OUT	SIOC
+
+	IN	0FFH		; sense switches
+	CALL	HEX
+
+; Find the first page that does not keep what is written to it
+	LXI	H,PROBE
+SIZE:	MVI	M,55H
+	MOV	A,M
+	CPI	55H
+	JNZ	FOUND
+	INR	H
+	JNZ	SIZE
+FOUND:	MOV	A,H
+	CALL	HEX
+
+ECHO:	IN	SIOC
+	RRC			; RDRF
+	JNC	ECHO
+	IN	SIOD
+	CPI	'a'
+	JC	UPPER
+	CPI	'z'+1
+	JNC	UPPER
+	SUI	20H
+UPPER:	CALL	PUTC
+	CPI	'.'
+	JNZ	ECHO
+	HLT
+
+; HEX prints A in two hex digits and a space
+HEX:	PUSH	PSW
+	RRC
+	RRC
+	RRC
+	RRC
+	CALL	DIGIT
+	POP	PSW
+	CALL	DIGIT
+	MVI	A,' '
+	JMP	PUTC
+
+DIGIT:	ANI	0FH
+	ADI	90H		; the DAA trick turns 0-15 into '0'-'F'
+	DAA
+	ACI	40H
+	DAA
+
+PUTC:	PUSH	PSW
+WAIT:	IN	SIOC
+	ANI	2		; TDRE
+	JZ	WAIT
+	POP	PSW
+	OUT	SIOD
+	RET
+
+	DS	32
+STACK:
+PROBE	EQU	($+0FFH) AND 0FF00H
+	END
@@ -0,0 +1,559 @@
+; Exercises the 8080 instructions the way 8080EXER does, as a CP/M program.
+; Each test runs an instruction from the states made of its base state with
+; any combination of the bits of its counter mask flipped, and one or none
+; of the bits of its shift mask, and prints the CRC-32 of the states left:
+; the memory around SP, the registers, the flags and SP. The instructions
+; are written before they run, as code that modifies itself. HLT, RST, EI,
+; DI, IN, OUT and the instructions loading SP with a new value are left out.
+BDOS	EQU	5
+SIZE	EQU	15		; the bytes of a state
+
+; The bytes of a state, as the tests list them
+INSN	EQU	0		; the instruction and its operands
+BLOCK	EQU	3		; the words at SP-2 and SP
+REGC	EQU	7
+REGB	EQU	8
+REGE	EQU	9
+REGD	EQU	10
+REGL	EQU	11
+REGH	EQU	12
+REGF	EQU	13		; as PUSH PSW stores it
+REGA	EQU	14
+
+	ORG	100H
+	LXI	SP,STACK
+	CALL	MKCRC
+	LXI	H,TESTS
+NEXT:	MOV	E,M		; the name
+	INX	H
+	MOV	D,M
+	INX	H
+	MOV	A,D
+	ORA	E
+	JZ	0
+	SHLD	TEST
+	MVI	C,9
+	CALL	BDOS
+	CALL	RUN
+	CALL	PRCRC
+	LHLD	TEST
+	LXI	D,3*SIZE
+	DAD	D
+	JMP	NEXT
+
+; RUN runs the test at TEST and leaves the CRC of the states in CRC
+RUN:	LXI	H,0FFFFH
+	SHLD	CRC
+	SHLD	CRC+2
+	LXI	H,CUR
+	MVI	B,SIZE
+	XRA	A
+RU1:	MOV	M,A
+	INX	H
+	DCR	B
+	JNZ	RU1
+	CALL	MKSH
+RU2:	CALL	MKST
+	CALL	EXEC
+	LXI	H,SHLIST
+RU3:	MOV	A,M
+	ORA	A
+	JZ	RU4
+	MOV	C,A		; the bit
+	INX	H
+	MOV	E,M		; its byte in STATE
+	INX	H
+	MOV	D,M
+	INX	H
+	LDAX	D
+	XRA	C
+	STAX	D
+	PUSH	H
+	PUSH	D
+	PUSH	B
+	CALL	EXEC
+	POP	B
+	POP	D
+	POP	H
+	LDAX	D
+	XRA	C
+	STAX	D
+	JMP	RU3
+RU4:	CALL	INCCNT
+	JNC	RU2
+	RET
+
+; MKSH lists in SHLIST the bits of the shift mask of the test, each as the
+; bit and the address of its byte in STATE, then a 0
+MKSH:	LHLD	TEST
+	LXI	D,2*SIZE
+	DAD	D
+	LXI	D,SHLIST
+	LXI	B,STATE
+MS1:	MOV	A,M
+	PUSH	H
+	MVI	L,1
+MS2:	MOV	H,A
+	ANA	L
+	JZ	MS3
+	MOV	A,L
+	STAX	D
+	INX	D
+	MOV	A,C
+	STAX	D
+	INX	D
+	MOV	A,B
+	STAX	D
+	INX	D
+MS3:	MOV	A,L
+	ADD	A		; the next bit, Z after the last one
+	MOV	L,A
+	MOV	A,H
+	JNZ	MS2
+	POP	H
+	INX	H
+	INX	B
+	MOV	A,C
+	CPI	LOW (STATE+SIZE)
+	JNZ	MS1
+	XRA	A
+	STAX	D
+	RET
+
+; MKST sets STATE to the base state of the test with the bits of CUR flipped
+MKST:	LHLD	TEST
+	XCHG
+	LXI	H,CUR
+	LXI	B,STATE
+	REPT	SIZE
+	LDAX	D
+	XRA	M
+	STAX	B
+	INX	B
+	INX	D
+	INX	H
+	ENDM
+	RET
+
+; INCCNT moves CUR to the next combination of the bits of the counter mask.
+; It sets the carry after the last one, as CUR goes back to 0.
+INCCNT:	LHLD	TEST
+	LXI	D,SIZE
+	DAD	D
+	LXI	D,CUR
+	MVI	B,SIZE
+	STC
+IC1:	PUSH	PSW		; the carry in
+	MOV	A,M
+	CMA
+	MOV	C,A
+	LDAX	D
+	ORA	C		; the bits out of the mask pass the carry on
+	MOV	C,A
+	POP	PSW
+	MOV	A,C
+	ACI	0
+	MOV	C,A
+	PUSH	PSW		; the carry out
+	MOV	A,C
+	ANA	M
+	STAX	D
+	POP	PSW
+	INX	H
+	INX	D
+	DCR	B
+	JNZ	IC1
+	RET
+
+; EXEC runs the instruction of STATE from STATE and adds the state it
+; leaves to CRC
+EXEC:	LDA	STATE+INSN
+	CPI	76H		; HLT
+	RZ
+	LHLD	STATE+INSN
+	SHLD	SLOT
+	LDA	STATE+INSN+2
+	STA	SLOT+2
+	LHLD	STATE+BLOCK
+	SHLD	MEM-2
+	LHLD	STATE+BLOCK+2
+	SHLD	MEM
+	LXI	H,0
+	DAD	SP
+	SHLD	SAVESP
+	LHLD	STATE+REGC
+	MOV	B,H
+	MOV	C,L
+	LHLD	STATE+REGE
+	XCHG
+	LXI	SP,STATE+REGF
+	POP	PSW
+	LXI	SP,MEM
+	LHLD	STATE+REGL
+SLOT:	DB	0,0,0
+DONE:	SHLD	RES+REGL
+	XCHG
+	SHLD	RES+REGE
+	MOV	H,B
+	MOV	L,C
+	SHLD	RES+REGC
+	LHLD	MEM-2
+	SHLD	RES+BLOCK
+	LHLD	MEM
+	SHLD	RES+BLOCK+2
+	PUSH	PSW
+	POP	H
+	SHLD	RES+REGF
+	LXI	H,0
+	DAD	SP
+	SHLD	RES+SIZE
+	LHLD	SAVESP
+	SPHL
+	LXI	H,RES+BLOCK
+	MVI	B,SIZE+2-BLOCK
+EX1:	MOV	A,M
+	PUSH	H
+	PUSH	B
+	CALL	UPDCRC
+	POP	B
+	POP	H
+	INX	H
+	DCR	B
+	JNZ	EX1
+	RET
+
+; TAKEN is where the jumps, calls and returns go. It moves SP down a byte
+; to tell them from those not taken.
+TAKEN:	DCX	SP
+	JMP	DONE
+
+; UPDCRC adds the byte in A to CRC
+UPDCRC:	LXI	H,CRC
+	XRA	M
+	MOV	L,A
+	MVI	H,0
+	DAD	H
+	DAD	H
+	LXI	D,CRCTAB
+	DAD	D
+	XCHG
+	LXI	H,CRC+1
+	LDAX	D
+	XRA	M
+	DCX	H
+	MOV	M,A
+	INX	H
+	INX	H
+	INX	D
+	LDAX	D
+	XRA	M
+	DCX	H
+	MOV	M,A
+	INX	H
+	INX	H
+	INX	D
+	LDAX	D
+	XRA	M
+	DCX	H
+	MOV	M,A
+	INX	H
+	INX	D
+	LDAX	D
+	MOV	M,A
+	RET
+
+; MKCRC fills CRCTAB with the CRC-32 of each byte
+MKCRC:	LXI	H,CRCTAB
+	MVI	B,0
+MK1:	MOV	A,B
+	STA	WORD
+	XRA	A
+	STA	WORD+1
+	STA	WORD+2
+	STA	WORD+3
+	MVI	C,8
+MK2:	PUSH	H
+	LXI	H,WORD+3
+	ORA	A
+	MOV	A,M
+	RAR
+	MOV	M,A
+	DCX	H
+	MOV	A,M
+	RAR
+	MOV	M,A
+	DCX	H
+	MOV	A,M
+	RAR
+	MOV	M,A
+	DCX	H
+	MOV	A,M
+	RAR
+	MOV	M,A
+	POP	H
+	JNC	MK3
+	LDA	WORD		; the polynomial EDB88320H
+	XRI	20H
+	STA	WORD
+	LDA	WORD+1
+	XRI	83H
+	STA	WORD+1
+	LDA	WORD+2
+	XRI	0B8H
+	STA	WORD+2
+	LDA	WORD+3
+	XRI	0EDH
+	STA	WORD+3
+MK3:	DCR	C
+	JNZ	MK2
+	LDA	WORD
+	MOV	M,A
+	INX	H
+	LDA	WORD+1
+	MOV	M,A
+	INX	H
+	LDA	WORD+2
+	MOV	M,A
+	INX	H
+	LDA	WORD+3
+	MOV	M,A
+	INX	H
+	INR	B
+	JNZ	MK1
+	RET
+
+; PRCRC prints the CRC-32 in CRC and a new line
+PRCRC:	LXI	H,CRC+3
+	MVI	B,4
+PC1:	MOV	A,M
+	CMA
+	PUSH	H
+	PUSH	B
+	CALL	HEX
+	POP	B
+	POP	H
+	DCX	H
+	DCR	B
+	JNZ	PC1
+	LXI	D,CRLF
+	MVI	C,9
+	JMP	BDOS
+
+; HEX prints A in hex
+HEX:	PUSH	PSW
+	RRC
+	RRC
+	RRC
+	RRC
+	CALL	DIGIT
+	POP	PSW
+DIGIT:	ANI	0FH
+	ADI	90H
+	DAA
+	ACI	40H
+	DAA
+	MOV	E,A
+	MVI	C,2
+	JMP	BDOS
+
+; The tests: the name, then the base state, the counter mask and the shift
+; mask, each as the instruction, the words at SP-2 and SP, C B E D L H, F A
+TESTS:	DW	N1
+	DB	80H,0,0,	12H,34H,0A5H,3CH,	2FH,91H,0E8H,5CH
+	DW	MEM
+	DB	02H,6BH
+	DB	3FH,0,0,	0,0,0,0,	0,0,0,0,0,0,	01H,0
+	DB	0,0,0,		0,0,0FFH,0,	0FFH,0FFH,0FFH,0FFH,0,0,	0,0FFH
+
+	DW	N2
+	DB	0C6H,0D4H,0,	12H,34H,56H,78H,	9AH,0BCH,0DEH,0F0H,11H,22H,	0,0
+	DB	38H,0,0,	0,0,0,0,	0,0,0,0,0,0,	01H,0FFH
+	DB	0,0FFH,0,	0,0,0,0,	0,0,0,0,0,0,	0,0
+
+	DW	N3
+	DB	27H,0,0,	0,0,0,0,	0C7H,4AH,1DH,0E2H,30H,5FH,	0,0
+	DB	18H,0,0,	0,0,0,0,	0,0,0,0,0,0,	11H,0FFH
+	DB	0,0,0,		0,0,0,0,	0,0,0,0,0,0,	0,0
+
+	DW	N4
+	DB	04H,0,0,	0,0,7FH,80H,	81H,0FEH,0FH,10H
+	DW	MEM
+	DB	0C4H,0F0H
+	DB	39H,0,0,	0,0,0,0,	0,0,0,0,0,0,	01H,0
+	DB	0,0,0,		0,0,0FFH,0,	0FFH,0FFH,0FFH,0FFH,0,0,	0,0FFH
+
+	DW	N5
+	DB	3CH,0,0,	0,0,0,0,	0,0,0,0,0,0,	0,0
+	DB	01H,0,0,	0,0,0,0,	0,0,0,0,0,0,	11H,0FFH
+	DB	0,0,0,		0,0,0,0,	0,0,0,0,0,0,	0,0
+
+	DW	N6
+	DB	07H,0,0,	0,0,0,0,	55H,0AAH,33H,0CCH,0F0H,0FH,	0,0
+	DB	18H,0,0,	0,0,0,0,	0,0,0,0,0,0,	01H,0FFH
+	DB	0,0,0,		0,0,0,0,	0,0,0,0,0,0,	0,0
+
+	DW	N7
+	DB	09H,0,0,	0,0,0,0,	0FH,0F0H,0C3H,7EH,81H,38H,	0,0
+	DB	30H,0,0,	0,0,0,0,	0,0,0,0,0,0C0H,	01H,0
+	DB	0,0,0,		0,0,0,0,	0FFH,0FFH,0FFH,0FFH,0FFH,0FFH,	0,0
+
+	DW	N8
+	DB	03H,0,0,	0,0,0,0,	0FFH,0FFH,0FFH,0,0,0FFH,	0D7H,0
+	DB	38H,0,0,	0,0,0,0,	0,0,0,0,0,0,	0,0
+	DB	0,0,0,		0,0,0,0,	0FFH,0FFH,0FFH,0FFH,0FFH,0FFH,	0,0
+
+	DW	N9
+	DB	40H,0,0,	0,0,96H,69H,	3AH,0A3H,5BH,0B5H
+	DW	MEM
+	DB	0,0E1H
+	DB	3FH,0,0,	0,0,0,0,	0,0,0,0,0,0,	0,0
+	DB	0,0,0,		0,0,0FFH,0,	0FFH,0FFH,0FFH,0FFH,0,0,	0,0FFH
+
+	DW	N10
+	DB	06H,5AH,0,	0,0,0,0,	0,0,0,0
+	DW	MEM
+	DB	0,0
+	DB	38H,0,0,	0,0,0,0,	0,0,0,0,0,0,	0,0
+	DB	0,0FFH,0,	0,0,0,0,	0,0,0,0,0,0,	0,0
+
+	DW	N11
+	DB	01H,34H,12H,	0,0,0,0,	0,0,0,0,0,0,	0,0
+	DB	10H,0,0,	0,0,0,0,	0,0,0,0,0,0,	0,0
+	DB	0,0FFH,0FFH,	0,0,0,0,	0,0,0,0,0,0,	0,0
+
+	DW	N12
+	DB	21H,0CDH,0ABH,	0,0,0,0,	0,0,0,0,0,0,	0,0
+	DB	0,0,0,		0,0,0,0,	0,0,0,0,0,0,	0,0
+	DB	0,0FFH,0FFH,	0,0,0,0,	0,0,0,0,0,0,	0,0
+
+	DW	N13
+	DB	02H,0,0,	0,0,3CH,0C3H
+	DW	MEM,MEM
+	DB	0,0,	0,0A5H
+	DB	18H,0,0,	0,0,0,0,	0,0,0,0,0,0,	0,0
+	DB	0,0,0,		0,0,0FFH,0,	0,0,0,0,0,0,	0,0FFH
+
+	DW	N14
+	DB	32H
+	DW	MEM
+	DB	0,0,0C3H,3CH,	0,0,0,0,0,0,	0,5AH
+	DB	08H,0,0,	0,0,0,0,	0,0,0,0,0,0,	0,0
+	DB	0,0,0,		0,0,0FFH,0,	0,0,0,0,0,0,	0,0FFH
+
+	DW	N15
+	DB	22H
+	DW	MEM
+	DB	0,0,1EH,0E1H,	0,0,0,0,0F0H,0FH,	0,0
+	DB	08H,0,0,	0,0,0,0,	0,0,0,0,0,0,	0,0
+	DB	0,0,0,		0,0,0FFH,0FFH,	0,0,0,0,0FFH,0FFH,	0,0
+
+	DW	N16
+	DB	0E3H,0,0,	0,0,0B4H,4BH,	0,0,12H,34H,56H,78H,	0,0
+	DB	08H,0,0,	0,0,0,0,	0,0,0,0,0,0,	0,0
+	DB	0,0,0,		0,0,0FFH,0FFH,	0,0,0FFH,0FFH,0FFH,0FFH,	0,0
+
+	DW	N17
+	DB	0C1H,0,0,	0,0,0D5H,0AAH,	8EH,3FH,0C2H,61H,9DH,07H,	0,0
+	DB	34H,0,0,	0,0,0,0,	0,0,0,0,0,0,	0,0
+	DB	0,0,0,		0,0,0FFH,0FFH,	0FFH,0FFH,0FFH,0FFH,0FFH,0FFH,	0FFH,0FFH
+
+	DW	N18
+	DB	0C2H
+	DW	TAKEN
+	DB	0,0,0,0,	0,0,0,0,0,0,	0,0
+	DB	38H,0,0,	0,0,0,0,	0,0,0,0,0,0,	0C5H,0
+	DB	0,0,0,		0,0,0,0,	0,0,0,0,0,0,	0,0
+
+	DW	N19
+	DB	0C4H
+	DW	TAKEN
+	DB	0,0,0,0,	0,0,0,0,0,0,	0,0
+	DB	38H,0,0,	0,0,0,0,	0,0,0,0,0,0,	0C5H,0
+	DB	0,0,0,		0,0,0,0,	0,0,0,0,0,0,	0,0
+
+	DW	N20
+	DB	0C0H,0,0,	0,0
+	DW	TAKEN
+	DB	0,0,0,0,0,0,	0,0
+	DB	38H,0,0,	0,0,0,0,	0,0,0,0,0,0,	0C5H,0
+	DB	0,0,0,		0,0,0,0,	0,0,0,0,0,0,	0,0
+
+	DW	N21
+	DB	0C3H
+	DW	TAKEN
+	DB	0,0,0,0,	0,0,0,0,0,0,	0,0
+	DB	08H,0,0,	0,0,0,0,	0,0,0,0,0,0,	0,0
+	DB	0,0,0,		0,0,0,0,	0,0,0,0,0,0,	0FFH,0
+
+	DW	N22
+	DB	0CDH
+	DW	TAKEN
+	DB	0,0,0,0,	0,0,0,0,0,0,	0,0
+	DB	30H,0,0,	0,0,0,0,	0,0,0,0,0,0,	0,0
+	DB	0,0,0,		0,0,0,0,	0,0,0,0,0,0,	0FFH,0
+
+	DW	N23
+	DB	0C9H,0,0,	0,0
+	DW	TAKEN
+	DB	0,0,0,0,0,0,	0,0
+	DB	10H,0,0,	0,0,0,0,	0,0,0,0,0,0,	0,0
+	DB	0,0,0,		0,0,0,0,	0,0,0,0,0,0,	0FFH,0
+
+	DW	N24
+	DB	0E9H,0,0,	0,0,0,0,	0,0,0,0
+	DW	TAKEN
+	DB	0,0
+	DB	0,0,0,		0,0,0,0,	0,0,0,0,0,0,	0,0
+	DB	0,0,0,		0,0,0,0,	0,0,0,0,0,0,	0FFH,0
+
+	DW	N25
+	DB	00H,0,0,	0,0,0,0,	0,0,0,0,0,0,	0,0
+	DB	38H,0,0,	0,0,0,0,	0,0,0,0,0,0,	0,0
+	DB	0,0,0,		0,0,0,0,	0,0,0,0,0,0,	0FFH,0FFH
+
+	DW	0
+
+N1:	DB	'alu r            $'
+N2:	DB	'alu n            $'
+N3:	DB	'daa cma stc cmc  $'
+N4:	DB	'inr dcr r        $'
+N5:	DB	'inr dcr a        $'
+N6:	DB	'rlc rrc ral rar  $'
+N7:	DB	'dad              $'
+N8:	DB	'inx dcx          $'
+N9:	DB	'mov              $'
+N10:	DB	'mvi              $'
+N11:	DB	'lxi b d          $'
+N12:	DB	'lxi h            $'
+N13:	DB	'ldax stax        $'
+N14:	DB	'lda sta          $'
+N15:	DB	'lhld shld        $'
+N16:	DB	'xthl xchg        $'
+N17:	DB	'push pop         $'
+N18:	DB	'jcc              $'
+N19:	DB	'ccc              $'
+N20:	DB	'rcc              $'
+N21:	DB	'jmp              $'
+N22:	DB	'call             $'
+N23:	DB	'ret              $'
+N24:	DB	'pchl             $'
+N25:	DB	'nop              $'
+CRLF:	DB	13,10,'$'
+
+TEST:	DS	2		; the test running
+CUR:	DS	SIZE		; the bits of the counter mask flipped
+STATE:	DS	SIZE		; the state the instruction runs from
+RES	EQU	$-BLOCK		; the state it left, laid out as STATE, and SP
+	DS	SIZE+2-BLOCK
+CRC:	DS	4
+WORD:	DS	4
+SAVESP:	DS	2
+	DS	6		; room for PUSH PSW after a CALL taken
+	DS	2		; SP-2
+MEM:	DS	2		; SP
+	DS	2
+SHLIST:	DS	3*8*SIZE+1
+	DS	64
+STACK:
+CRCTAB:	DS	1024
+	END
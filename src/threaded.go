@@ -0,0 +1,331 @@
+package main
+
+import "8080emu/isa"
+
+// threadedCode runs the instructions from threaded code: each address
+// holds, decoded ahead, the handler of the instruction starting there with
+// its operands and states, so that a step is an index in an array and a
+// call. An address is decoded the first time it runs, and dropped when a
+// byte of its instruction is written.
+type threadedCode struct {
+	code  [65536]thread
+	pages [256]bool // the pages holding decoded instructions
+}
+
+// thread is a decoded instruction
+type thread struct {
+	run    threadFunc // nil until decoded
+	imm    uint16     // the operand: the byte or the word after the opcode
+	cycles uint8
+}
+
+// threadFunc runs the instruction t at pc, leaving pc at the next one. The
+// states of t are counted already.
+type threadFunc func(s *State, t *thread)
+
+// UseThreadedCode makes Step run the instructions from threaded code
+// instead of decoding them each time, which is faster for the same results.
+// A CPU watched by onRead still decodes each instruction, to show the reads
+// of its operands.
+func (s *State) UseThreadedCode() {
+	if s.code == nil {
+		s.code = &threadedCode{}
+	}
+}
+
+// exec runs the instruction at pc, decoding it if needed
+func (c *threadedCode) exec(s *State) {
+	var t = &c.code[s.pc]
+	if t.run == nil {
+		c.decode(s, s.pc)
+	}
+	s.cycles += uint64(t.cycles)
+	t.run(s, t)
+}
+
+// decode decodes the instruction at addr
+func (c *threadedCode) decode(s *State, addr uint16) {
+	var opcode = s.peek(addr)
+	var op = threadOpcodes[opcode]
+	var t = &c.code[addr]
+	t.run, t.cycles = threadFuncs[opcode], op.Cycles
+	t.imm = uint16(s.peek(addr + 1))
+	if op.Size == 3 {
+		t.imm |= uint16(s.peek(addr+2)) << 8
+	}
+	if threadFuncs[opcode] == nil {
+		// ExecInstruction counts the states
+		t.run, t.cycles = threadExec, 0
+	}
+	for i := uint16(0); i < uint16(op.Size); i++ {
+		c.pages[(addr+i)>>8] = true
+	}
+}
+
+// written drops the instructions with a byte at addr
+func (c *threadedCode) written(addr uint16) {
+	if c.pages[addr>>8] {
+		c.code[addr].run = nil
+		c.code[addr-1].run = nil
+		c.code[addr-2].run = nil
+	}
+}
+
+// remapped drops the instructions of the n pages from page p, whose bytes
+// changed all at once
+func (c *threadedCode) remapped(p, n int) {
+	for addr := p << 8; addr < (p+n)<<8 && addr < 0x10000; addr++ {
+		if c.pages[addr>>8] {
+			c.written(uint16(addr))
+		}
+	}
+}
+
+// threadOpcodes are the instructions of the opcodes, the undocumented ones
+// as those they alias
+var threadOpcodes [256]isa.Opcode
+
+// threadFuncs are the handlers of the opcodes. The rare ones have none and
+// run with ExecInstruction.
+var threadFuncs [256]threadFunc
+
+// threadSZP are the Zero, Sign and Parity flags of the results
+var threadSZP [256]Flags
+
+// the flags of the arithmetic
+const (
+	flagsZSP = Flags(1<<FlagZ | 1<<FlagS | 1<<FlagP)
+	flagsALU = flagsZSP | Flags(1<<FlagCy|1<<FlagAc)
+)
+
+// the registers in the order of their codes in the opcodes: B C D E H L M A
+var (
+	threadGet = [8]func(s *State) byte{
+		func(s *State) byte { return s.regB },
+		func(s *State) byte { return s.regC },
+		func(s *State) byte { return s.regD },
+		func(s *State) byte { return s.regE },
+		func(s *State) byte { return s.regH },
+		func(s *State) byte { return s.regL },
+		func(s *State) byte { return s.read(s.hl()) },
+		func(s *State) byte { return s.regA },
+	}
+	threadSet = [8]func(s *State, v byte){
+		func(s *State, v byte) { s.regB = v },
+		func(s *State, v byte) { s.regC = v },
+		func(s *State, v byte) { s.regD = v },
+		func(s *State, v byte) { s.regE = v },
+		func(s *State, v byte) { s.regH = v },
+		func(s *State, v byte) { s.regL = v },
+		func(s *State, v byte) { s.write(s.hl(), v) },
+		func(s *State, v byte) { s.regA = v },
+	}
+)
+
+// the pairs in the order of their codes in the opcodes: BC DE HL SP, with
+// PSW for SP in PUSH and POP
+var (
+	threadPair = [4]func(s *State) uint16{
+		func(s *State) uint16 { return pairTo16(s.regB, s.regC) },
+		func(s *State) uint16 { return pairTo16(s.regD, s.regE) },
+		func(s *State) uint16 { return pairTo16(s.regH, s.regL) },
+		func(s *State) uint16 { return s.sp },
+	}
+	threadSetPair = [4]func(s *State, v uint16){
+		func(s *State, v uint16) { s.regB, s.regC = byte(v>>8), byte(v) },
+		func(s *State, v uint16) { s.regD, s.regE = byte(v>>8), byte(v) },
+		func(s *State, v uint16) { s.regH, s.regL = byte(v>>8), byte(v) },
+		func(s *State, v uint16) { s.sp = v },
+	}
+)
+
+// threadALU are the operations of A with a byte: ADD ADC SUB SBB ANA XRA
+// ORA CMP, and the immediate ones
+var threadALU = [8]func(s *State, x byte){
+	func(s *State, x byte) { s.regA = threadAdd(s, x, 0) },
+	func(s *State, x byte) { s.regA = threadAdd(s, x, s.carry()) },
+	func(s *State, x byte) { s.regA = threadSub(s, x, 0) },
+	func(s *State, x byte) { s.regA = threadSub(s, x, s.carry()) },
+	func(s *State, x byte) {
+		var ac Flags
+		if (s.regA|x)&0x08 != 0 {
+			ac = 1 << FlagAc
+		}
+		s.regA &= x
+		s.flags = s.flags&^flagsALU | threadSZP[s.regA] | ac
+	},
+	func(s *State, x byte) {
+		s.regA ^= x
+		s.flags = s.flags&^flagsALU | threadSZP[s.regA]
+	},
+	func(s *State, x byte) {
+		s.regA |= x
+		s.flags = s.flags&^flagsALU | threadSZP[s.regA]
+	},
+	func(s *State, x byte) { threadSub(s, x, 0) },
+}
+
+// threadAdd returns A + x + cy and sets the flags
+func threadAdd(s *State, x, cy byte) byte {
+	var r = uint16(s.regA) + uint16(x) + uint16(cy)
+	var f = threadSZP[byte(r)]
+	if r > 0xff {
+		f |= 1 << FlagCy
+	}
+	if s.regA&0xf+x&0xf+cy > 0xf {
+		f |= 1 << FlagAc
+	}
+	s.flags = s.flags&^flagsALU | f
+	return byte(r)
+}
+
+// threadSub returns A - x - cy and sets the flags as subtract does
+func threadSub(s *State, x, cy byte) byte {
+	var r = uint16(s.regA) - uint16(x) - uint16(cy)
+	var f = threadSZP[byte(r)]
+	if r > 0xff {
+		f |= 1 << FlagCy
+	}
+	if s.regA&0xf+^x&0xf+(1-cy) > 0xf {
+		f |= 1 << FlagAc
+	}
+	s.flags = s.flags&^flagsALU | f
+	return byte(r)
+}
+
+// threadCond returns the condition of the code cc in the opcodes: NZ Z NC
+// C PO PE P M
+func threadCond(cc byte) (Flags, bool) {
+	var flags = [4]Flag{FlagZ, FlagCy, FlagP, FlagS}
+	return Flags(1 << flags[cc>>1]), cc&1 != 0
+}
+
+func threadExec(s *State, t *thread) {
+	s.ExecInstruction()
+}
+
+func init() {
+	for i := range threadOpcodes {
+		var op = isa.Opcodes[i]
+		if op.Size == 0 {
+			op = isa.Opcodes[undocumented[byte(i)]]
+		}
+		threadOpcodes[i] = op
+	}
+	for i := range threadSZP {
+		var f Flags
+		f.SetValue(FlagZ, i == 0)
+		f.SetValue(FlagS, i&0x80 != 0)
+		f.SetValue(FlagP, isParityEven(byte(i)))
+		threadSZP[i] = f
+	}
+
+	var f = &threadFuncs
+	for i := 0; i < 8; i++ {
+		// NOP and the undocumented ones
+		f[i<<3] = func(s *State, t *thread) { s.pc++ }
+	}
+	for rp := 0; rp < 4; rp++ {
+		var get, set = threadPair[rp], threadSetPair[rp]
+		var op = byte(rp << 4)
+		f[op|0x01] = func(s *State, t *thread) { set(s, t.imm); s.pc += 3 } // LXI
+		f[op|0x03] = func(s *State, t *thread) { set(s, get(s)+1); s.pc++ } // INX
+		f[op|0x0b] = func(s *State, t *thread) { set(s, get(s)-1); s.pc++ } // DCX
+		f[op|0x09] = func(s *State, t *thread) { s.dad(get(s)); s.pc++ }    // DAD
+		f[op|0xc1] = func(s *State, t *thread) { set(s, s.pop()); s.pc++ }  // POP
+		f[op|0xc5] = func(s *State, t *thread) { s.push(get(s)); s.pc++ }   // PUSH
+		if rp < 2 {
+			f[op|0x02] = func(s *State, t *thread) { s.write(get(s), s.regA); s.pc++ } // STAX
+			f[op|0x0a] = func(s *State, t *thread) { s.regA = s.read(get(s)); s.pc++ } // LDAX
+		}
+	}
+	f[0xf1] = func(s *State, t *thread) { s.setPsw(s.pop()); s.pc++ } // POP PSW
+	f[0xf5] = func(s *State, t *thread) { s.push(s.psw()); s.pc++ }   // PUSH PSW
+
+	for r := 0; r < 8; r++ {
+		var get, set = threadGet[r], threadSet[r]
+		var op = byte(r << 3)
+		f[op|0x04] = func(s *State, t *thread) { // INR
+			var v = get(s) + 1
+			var ac Flags
+			if v&0xf == 0 {
+				ac = 1 << FlagAc
+			}
+			s.flags = s.flags&^(flagsZSP|1<<FlagAc) | threadSZP[v] | ac
+			set(s, v)
+			s.pc++
+		}
+		f[op|0x05] = func(s *State, t *thread) { // DCR
+			var v = get(s) - 1
+			var ac Flags
+			if v&0xf != 0xf {
+				ac = 1 << FlagAc
+			}
+			s.flags = s.flags&^(flagsZSP|1<<FlagAc) | threadSZP[v] | ac
+			set(s, v)
+			s.pc++
+		}
+		f[op|0x06] = func(s *State, t *thread) { set(s, byte(t.imm)); s.pc += 2 } // MVI
+		for src := 0; src < 8; src++ {
+			var from = threadGet[src]
+			if r != 6 || src != 6 { // MOV M, M is HLT
+				f[0x40|op|byte(src)] = func(s *State, t *thread) { set(s, from(s)); s.pc++ }
+			}
+		}
+		var alu = threadALU[r]
+		for src := 0; src < 8; src++ {
+			var from = threadGet[src]
+			f[0x80|op|byte(src)] = func(s *State, t *thread) { alu(s, from(s)); s.pc++ }
+		}
+		f[0xc6|op] = func(s *State, t *thread) { alu(s, byte(t.imm)); s.pc += 2 }
+
+		var mask, want = threadCond(byte(r))
+		var callTaken = uint64(isa.Opcodes[0xc4|op].CyclesTaken - isa.Opcodes[0xc4|op].Cycles)
+		var retTaken = uint64(isa.Opcodes[0xc0|op].CyclesTaken - isa.Opcodes[0xc0|op].Cycles)
+		f[0xc2|op] = func(s *State, t *thread) { // Jcc
+			if s.flags&mask != 0 == want {
+				s.pc = t.imm
+			} else {
+				s.pc += 3
+			}
+		}
+		f[0xc4|op] = func(s *State, t *thread) { // Ccc
+			if s.flags&mask != 0 == want {
+				s.cycles += callTaken
+				s.push(s.pc + 3)
+				s.pc = t.imm
+			} else {
+				s.pc += 3
+			}
+		}
+		f[0xc0|op] = func(s *State, t *thread) { // Rcc
+			if s.flags&mask != 0 == want {
+				s.cycles += retTaken
+				s.pc = s.pop()
+			} else {
+				s.pc++
+			}
+		}
+	}
+
+	f[0x07] = func(s *State, t *thread) { s.rlc(); s.pc++ }
+	f[0x0f] = func(s *State, t *thread) { s.rrc(); s.pc++ }
+	f[0x17] = func(s *State, t *thread) { s.ral(); s.pc++ }
+	f[0x1f] = func(s *State, t *thread) { s.rar(); s.pc++ }
+	f[0x22] = func(s *State, t *thread) { s.write16(t.imm, s.hl()); s.pc += 3 } // SHLD
+	f[0x2a] = func(s *State, t *thread) {                                       // LHLD
+		var v = s.read16(t.imm)
+		s.regH, s.regL = byte(v>>8), byte(v)
+		s.pc += 3
+	}
+	f[0x32] = func(s *State, t *thread) { s.write(t.imm, s.regA); s.pc += 3 } // STA
+	f[0x3a] = func(s *State, t *thread) { s.regA = s.read(t.imm); s.pc += 3 } // LDA
+	f[0xc3] = func(s *State, t *thread) { s.pc = t.imm }                      // JMP
+	f[0xcd] = func(s *State, t *thread) { s.push(s.pc + 3); s.pc = t.imm }    // CALL
+	f[0xc9] = func(s *State, t *thread) { s.pc = s.pop() }                    // RET
+	f[0xeb] = func(s *State, t *thread) {                                     // XCHG
+		s.regD, s.regE, s.regH, s.regL = s.regH, s.regL, s.regD, s.regE
+		s.pc++
+	}
+	f[0xe9] = func(s *State, t *thread) { s.pc = s.hl() } // PCHL
+}
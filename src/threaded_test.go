@@ -0,0 +1,144 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// TestThreadedOpcodes runs every opcode from random states, decoded each
+// time and from threaded code, and compares what they changed
+func TestThreadedOpcodes(t *testing.T) {
+	var rnd = rand.New(rand.NewSource(8080))
+	var init State
+	rnd.Read(init.mem[:])
+	for op := 0; op < 256; op++ {
+		for i := 0; i < 20; i++ {
+			var s = init
+			s.regA, s.regB, s.regC, s.regD = byte(rnd.Intn(256)), byte(rnd.Intn(256)), byte(rnd.Intn(256)), byte(rnd.Intn(256))
+			s.regE, s.regH, s.regL = byte(rnd.Intn(256)), byte(rnd.Intn(256)), byte(rnd.Intn(256))
+			s.flags = Flags(rnd.Intn(32))
+			s.sp, s.pc = uint16(rnd.Intn(0x10000)), uint16(rnd.Intn(0x10000))
+			s.mem[s.pc] = byte(op)
+
+			var threaded = s
+			threaded.UseThreadedCode()
+			var n, tn = s.Step(), threaded.Step()
+			if n != tn || frozenOf(&s) != frozenOf(&threaded) {
+				t.Errorf("[0x%02x] at %04x: threaded %+v in %d states, expected %+v in %d", op, s.pc,
+					threaded.regs(), tn, s.regs(), n)
+				break
+			}
+		}
+	}
+}
+
+func TestThreadedWrites(t *testing.T) {
+	var s = &State{}
+	s.UseThreadedCode()
+	s.Load(0, []byte{
+		0x3e, 0x01, // LOOP: MVI A, 1
+		0x3c,             // INR A
+		0x32, 0x01, 0x00, // STA LOOP+1
+		0xc3, 0x00, 0x00, // JMP LOOP
+	})
+	for i := 0; i < 4*4; i++ {
+		s.Step()
+	}
+	if s.regA != 5 {
+		t.Errorf("A = %d after 4 loops changing their MVI, expected 5", s.regA)
+	}
+
+	s.Load(2, []byte{0x3d}) // DCR A
+	s.Step()
+	s.Step()
+	if s.regA != 4 {
+		t.Errorf("A = %d after DCR loaded over INR, expected 4", s.regA)
+	}
+
+	var d = NewDebugger(s, s.Step, 10)
+	d.Run(4, nil)
+	d.Back(4)
+	d.Run(2, nil)
+	if s.regA != 4 {
+		t.Errorf("A = %d after stepping back over the STA, expected 4", s.regA)
+	}
+
+	s.MapROM(0, 0x100)
+	s.Unmap(0, 0x100)
+	s.pc = 0
+	s.Step()
+	if s.pc != 0x38 {
+		t.Errorf("ran to %04x, expected the RST 7 read where memory was unmapped", s.pc)
+	}
+}
+
+// benchmarkProgram sums the bytes of a page, a loop of moves, arithmetic,
+// an increment and a conditional jump, and calls a routine pushing and
+// popping between the sums
+var benchmarkProgram = []byte{
+	0x31, 0x00, 0x00, // LXI SP, 0
+	0x21, 0x00, 0x10, // START: LXI H, 1000H
+	0xaf,       // XRA A
+	0x47,       // MOV B, A
+	0x86,       // SUM: ADD M
+	0x4f,       // MOV C, A
+	0x78,       // MOV A, B
+	0xce, 0x00, // ACI 0
+	0x47,             // MOV B, A
+	0x79,             // MOV A, C
+	0x2c,             // INR L
+	0xc2, 0x08, 0x00, // JNZ SUM
+	0xcd, 0x19, 0x00, // CALL SAVE
+	0xc3, 0x03, 0x00, // JMP START
+	0xc5,             // SAVE: PUSH B
+	0xe1,             // POP H
+	0x22, 0x00, 0x20, // SHLD 2000H
+	0xc9, // RET
+}
+
+// benchmarkWrites counts in memory right after its loop, and writes the
+// count in the operand of an MVI it then runs, so each loop drops decoded
+// instructions and decodes one again
+var benchmarkWrites = []byte{
+	0x3a, 0x0f, 0x00, // LOOP: LDA COUNT
+	0x3c,             // INR A
+	0x32, 0x0f, 0x00, // STA COUNT
+	0x32, 0x0b, 0x00, // STA MOD+1
+	0x06, 0x00, // MOD: MVI B, 0
+	0xc3, 0x00, 0x00, // JMP LOOP
+	0x00, // COUNT
+}
+
+func benchmarkEngine(b *testing.B, program []byte, threaded bool) {
+	var s = &State{}
+	if threaded {
+		s.UseThreadedCode()
+	}
+	s.Load(0, program)
+	for i := 0; i < 256; i++ {
+		s.mem[0x1000+i] = byte(i)
+	}
+	b.ResetTimer()
+	var start = time.Now()
+	for i := 0; i < b.N; i++ {
+		s.Step()
+	}
+	b.ReportMetric(float64(s.cycles)/time.Since(start).Seconds()/1e6, "MHz")
+}
+
+func BenchmarkDecoding(b *testing.B) {
+	benchmarkEngine(b, benchmarkProgram, false)
+}
+
+func BenchmarkThreaded(b *testing.B) {
+	benchmarkEngine(b, benchmarkProgram, true)
+}
+
+func BenchmarkDecodingWrites(b *testing.B) {
+	benchmarkEngine(b, benchmarkWrites, false)
+}
+
+func BenchmarkThreadedWrites(b *testing.B) {
+	benchmarkEngine(b, benchmarkWrites, true)
+}
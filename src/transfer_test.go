@@ -0,0 +1,105 @@
+package main
+
+import "testing"
+
+func TestTransfer(t *testing.T) {
+	var table = []Pair{
+		Pair{ // MOV D, A
+			State{regA: 7, pc: 0, mem: [65536]byte{0x57}},
+			State{regA: 7, regD: 7, pc: 1, mem: [65536]byte{0x57}},
+		},
+		Pair{ // MOV E, M
+			State{regH: 0x10, regL: 0x01, pc: 0, mem: [65536]byte{0: 0x5e, 0x1001: 9}},
+			State{regE: 9, regH: 0x10, regL: 0x01, pc: 1, mem: [65536]byte{0: 0x5e, 0x1001: 9}},
+		},
+		Pair{ // MOV M, C
+			State{regC: 4, regH: 0x10, regL: 0x01, pc: 0, mem: [65536]byte{0x71}},
+			State{regC: 4, regH: 0x10, regL: 0x01, pc: 1, mem: [65536]byte{0: 0x71, 0x1001: 4}},
+		},
+		Pair{ // MVI L, D8
+			State{pc: 0, mem: [65536]byte{0x2e, 0x42}},
+			State{regL: 0x42, pc: 2, mem: [65536]byte{0x2e, 0x42}},
+		},
+		Pair{ // MVI M, D8
+			State{regH: 0x10, pc: 0, mem: [65536]byte{0x36, 0x42}},
+			State{regH: 0x10, pc: 2, mem: [65536]byte{0: 0x36, 0x42, 0x1000: 0x42}},
+		},
+		Pair{ // LXI D, D16
+			State{pc: 0, mem: [65536]byte{0x11, 0x34, 0x12}},
+			State{regD: 0x12, regE: 0x34, pc: 3, mem: [65536]byte{0x11, 0x34, 0x12}},
+		},
+		Pair{ // LXI SP, D16
+			State{pc: 0, mem: [65536]byte{0x31, 0x00, 0xf0}},
+			State{sp: 0xf000, pc: 3, mem: [65536]byte{0x31, 0x00, 0xf0}},
+		},
+		Pair{ // STAX B
+			State{regA: 5, regB: 0x20, regC: 0x02, pc: 0, mem: [65536]byte{0x02}},
+			State{regA: 5, regB: 0x20, regC: 0x02, pc: 1, mem: [65536]byte{0: 0x02, 0x2002: 5}},
+		},
+		Pair{ // LDAX D
+			State{regD: 0x20, regE: 0x02, pc: 0, mem: [65536]byte{0: 0x1a, 0x2002: 5}},
+			State{regA: 5, regD: 0x20, regE: 0x02, pc: 1, mem: [65536]byte{0: 0x1a, 0x2002: 5}},
+		},
+		Pair{ // SHLD addr
+			State{regH: 0xab, regL: 0xcd, pc: 0, mem: [65536]byte{0x22, 0x00, 0x30}},
+			State{regH: 0xab, regL: 0xcd, pc: 3, mem: [65536]byte{0: 0x22, 0x00, 0x30, 0x3000: 0xcd, 0xab}},
+		},
+		Pair{ // LHLD addr
+			State{pc: 0, mem: [65536]byte{0: 0x2a, 0x00, 0x30, 0x3000: 0xcd, 0xab}},
+			State{regH: 0xab, regL: 0xcd, pc: 3, mem: [65536]byte{0: 0x2a, 0x00, 0x30, 0x3000: 0xcd, 0xab}},
+		},
+		Pair{ // STA addr
+			State{regA: 0x77, pc: 0, mem: [65536]byte{0x32, 0x10, 0x30}},
+			State{regA: 0x77, pc: 3, mem: [65536]byte{0: 0x32, 0x10, 0x30, 0x3010: 0x77}},
+		},
+		Pair{ // LDA addr
+			State{pc: 0, mem: [65536]byte{0: 0x3a, 0x10, 0x30, 0x3010: 0x77}},
+			State{regA: 0x77, pc: 3, mem: [65536]byte{0: 0x3a, 0x10, 0x30, 0x3010: 0x77}},
+		},
+		Pair{ // XCHG
+			State{regD: 1, regE: 2, regH: 3, regL: 4, pc: 0, mem: [65536]byte{0xeb}},
+			State{regD: 3, regE: 4, regH: 1, regL: 2, pc: 1, mem: [65536]byte{0xeb}},
+		},
+	}
+
+	doTest(t, table)
+}
+
+func TestSpecial(t *testing.T) {
+	var table = []Pair{
+		Pair{ // CMA does not change flags
+			State{regA: 0b01010001, pc: 0, mem: [65536]byte{0x2f}},
+			State{regA: 0b10101110, pc: 1, mem: [65536]byte{0x2f}},
+		},
+		Pair{ // STC
+			State{pc: 0, mem: [65536]byte{0x37}},
+			State{pc: 1, mem: [65536]byte{0x37}, flags: 0b00001000},
+		},
+		Pair{ // CMC
+			State{pc: 0, mem: [65536]byte{0x3f}, flags: 0b00001000},
+			State{pc: 1, mem: [65536]byte{0x3f}},
+		},
+		Pair{ // DAA ... 0x9B: both nibbles adjusted, from the Intel manual
+			State{regA: 0x9b, pc: 0, mem: [65536]byte{0x27}},
+			State{regA: 0x01, pc: 1, mem: [65536]byte{0x27}, flags: 0b00011000},
+		},
+		Pair{ // DAA after ADD 0x38 + 0x29 = 0x61 with Aux carry -> 0x67
+			State{regA: 0x61, pc: 0, mem: [65536]byte{0x27}, flags: 0b00010000},
+			State{regA: 0x67, pc: 1, mem: [65536]byte{0x27}},
+		},
+		Pair{ // ADC with 0xff and Cy carries out
+			State{regA: 0x01, regB: 0xff, pc: 0, mem: [65536]byte{0x88}, flags: 0b00001000},
+			State{regA: 0x01, regB: 0xff, pc: 1, mem: [65536]byte{0x88}, flags: 0b00011000},
+		},
+		Pair{ // SBB with 0xff and Cy borrows
+			State{regA: 0x01, regB: 0xff, pc: 0, mem: [65536]byte{0x98}, flags: 0b00001000},
+			State{regA: 0x01, regB: 0xff, pc: 1, mem: [65536]byte{0x98}, flags: 0b00001000},
+		},
+		Pair{ // HLT stops after it
+			State{pc: 0, mem: [65536]byte{0x76}},
+			State{pc: 1, mem: [65536]byte{0x76}},
+		},
+	}
+
+	doTest(t, table)
+}
@@ -0,0 +1,649 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// TUI is the debugger on the full screen of an ANSI terminal in raw mode.
+// It shows the disassembly around pc, the registers, the stack, memory and
+// the console of the machine, and refreshes them while the machine runs.
+// Keys step, run and set breakpoints, : takes the commands of the REPL and
+// Tab gives the keys to the machine until Ctrl-].
+type TUI struct {
+	D             *Debugger
+	Out           io.Writer // the terminal
+	Width, Height int
+	Size          func() (int, int) // the size of the terminal, or nil
+
+	keys    <-chan byte // typed on the terminal
+	typed   chan<- byte // read by the machine
+	console tuiConsole
+	repl    *REPL
+	screen  canvas
+
+	top, cursor uint16 // the first line of the disassembly and the one keys act on
+	mem         uint16 // the first address of the memory pane
+	typing      bool   // the keys go to the machine
+	running     bool
+	until       func() bool // when a run stops on its own, or nil
+	status      string
+	prompt      *tuiPrompt
+}
+
+// tuiPrompt reads a line on the status line
+type tuiPrompt struct {
+	label, text string
+	done        func(text string)
+}
+
+// tuiRefresh is how often the screen is drawn while the machine runs
+const tuiRefresh = 50 * time.Millisecond
+
+// tuiHelp lists the keys
+const tuiHelp = "s step  n over  o out  c run  p pause  r/R back  b break  arrows/g move  [ ] m memory  : command  Tab console  q quit"
+
+// NewTUI returns the front end of d on the terminal of term, whose keys it
+// takes and whose output it shows in the console pane. It draws on out.
+func NewTUI(d *Debugger, term *Terminal, out io.Writer) *TUI {
+	var u = &TUI{D: d, Out: out, Width: 80, Height: 24}
+	u.keys, u.typed = term.divert(&u.console)
+	u.repl = &REPL{D: d, Out: tuiNotes{&u.console}, Stop: u.interrupted}
+	u.cursor = d.CPU.pc
+	u.top = d.CPU.pc
+	u.status = "? lists the keys"
+	return u
+}
+
+// Run shows the screen and takes keys until q or the end of the input
+func (u *TUI) Run() {
+	if u.Size != nil {
+		u.Width, u.Height = u.Size()
+	}
+	fmt.Fprint(u.Out, "\x1b[?1049h\x1b[?25l\x1b[2J")
+	defer fmt.Fprint(u.Out, "\x1b[0m\x1b[?25h\x1b[?1049l")
+	for {
+		u.draw()
+		if u.running {
+			u.slice(tuiRefresh)
+		}
+		var key, ok = u.readKey(!u.running)
+		for ok && key != "" {
+			if !u.Key(key) {
+				return
+			}
+			key, ok = u.readKey(false)
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+// slice runs the machine for d at most, and tells why it stopped before
+func (u *TUI) slice(d time.Duration) {
+	var end = time.Now().Add(d)
+	var stop = u.D.run(-1, func() bool { return time.Now().After(end) }, u.until)
+	if stop.Reason != StopUser {
+		u.stopped(stop)
+	}
+}
+
+// stopped shows where and why the machine stopped
+func (u *TUI) stopped(s Stop) {
+	u.running, u.until = false, nil
+	u.status = u.D.Why(s)
+	u.cursor = u.D.CPU.pc
+}
+
+// interrupted tells a command of the REPL to stop at Ctrl-C or Esc, taking
+// the keys typed in the meantime
+func (u *TUI) interrupted() bool {
+	for {
+		select {
+		case b, ok := <-u.keys:
+			if !ok || b == 0x03 || b == 0x1b {
+				return true
+			}
+		default:
+			return false
+		}
+	}
+}
+
+// tuiKeyNames name the keys sending escape sequences
+var tuiKeyNames = map[string]string{
+	"\x1b[A": "up", "\x1b[B": "down", "\x1b[C": "right", "\x1b[D": "left",
+	"\x1b[5~": "pgup", "\x1b[6~": "pgdn", "\x1b": "esc",
+}
+
+// readKey returns the next key typed: the byte, or the name of the key
+// sending an escape sequence. It returns "" when there is none and block is
+// false, and false at the end of the input.
+func (u *TUI) readKey(block bool) (string, bool) {
+	var b byte
+	var ok bool
+	if block {
+		b, ok = <-u.keys
+	} else {
+		select {
+		case b, ok = <-u.keys:
+		default:
+			return "", true
+		}
+	}
+	if !ok {
+		return "", false
+	}
+	if b != 0x1b {
+		return string([]byte{b}), true
+	}
+
+	// the rest of the sequence follows at once
+	var seq = []byte{b}
+	for len(seq) < 8 {
+		select {
+		case b, ok = <-u.keys:
+		case <-time.After(25 * time.Millisecond):
+			ok = false
+		}
+		if !ok {
+			break
+		}
+		seq = append(seq, b)
+		if len(seq) > 2 && b >= 0x40 && b <= 0x7e || len(seq) == 2 && b != '[' {
+			break
+		}
+	}
+	if name, known := tuiKeyNames[string(seq)]; known {
+		return name, true
+	}
+	return string(seq), true
+}
+
+// Key acts on a key, named as readKey does. It returns false to quit.
+func (u *TUI) Key(key string) bool {
+	switch {
+	case u.typing:
+		u.typeKey(key)
+	case u.prompt != nil:
+		u.promptKey(key)
+	case u.running:
+		switch key {
+		case "p", " ", "esc", "\x03":
+			u.running, u.until = false, nil
+			u.status = "paused"
+			u.cursor = u.D.CPU.pc
+		case "\t":
+			u.typing = true
+		case "q":
+			return false
+		}
+	default:
+		return u.command(key)
+	}
+	return true
+}
+
+// typeKey sends a key to the machine, but Ctrl-] which gives the keys back
+// to the debugger
+func (u *TUI) typeKey(key string) {
+	if key == string([]byte{quitKey}) {
+		u.typing = false
+		return
+	}
+	for seq, name := range tuiKeyNames {
+		if name == key {
+			key = seq
+		}
+	}
+	for _, b := range []byte(key) {
+		select {
+		case u.typed <- b:
+		default:
+		}
+	}
+}
+
+// promptKey edits the line of the prompt
+func (u *TUI) promptKey(key string) {
+	var p = u.prompt
+	switch key {
+	case "\r", "\n":
+		u.prompt = nil
+		p.done(p.text)
+	case "esc", "\x03":
+		u.prompt = nil
+	case "\x7f", "\b":
+		if p.text != "" {
+			p.text = p.text[:len(p.text)-1]
+		}
+	default:
+		if len(key) == 1 && key[0] >= ' ' && key[0] <= '~' {
+			p.text += key
+		}
+	}
+}
+
+// command acts on a key of the debugger while the machine is stopped
+func (u *TUI) command(key string) bool {
+	var d = u.D
+	u.status = ""
+	switch key {
+	case "s":
+		u.stopped(d.Run(1, nil))
+	case "n":
+		var depth = len(d.calls.frames)
+		u.stopped(d.Run(1, nil))
+		if len(d.calls.frames) > depth && u.status == "" {
+			u.run(func() bool { return len(d.calls.frames) <= depth })
+		}
+	case "o":
+		if len(d.calls.frames) == 0 {
+			u.status = "no routine to step out of"
+			break
+		}
+		var depth = len(d.calls.frames) - 1
+		u.run(func() bool { return len(d.calls.frames) <= depth })
+	case "c":
+		u.run(nil)
+	case "r":
+		u.stopped(d.Back(1))
+	case "R":
+		u.stopped(d.Back(-1))
+	case "b":
+		if u.hasBreakpoint(u.cursor) {
+			d.ClearBreakpoint(u.cursor)
+		} else {
+			d.SetBreakpoint(u.cursor, nil)
+		}
+	case "up":
+		u.cursor = u.before(u.cursor, 1)
+	case "down":
+		var _, size = d.Disassemble(u.cursor)
+		u.cursor += uint16(size)
+	case "pgup":
+		u.cursor = u.before(u.cursor, u.layout().codeRows-1)
+	case "pgdn":
+		for i := 1; i < u.layout().codeRows; i++ {
+			var _, size = d.Disassemble(u.cursor)
+			u.cursor += uint16(size)
+		}
+	case ".":
+		u.cursor = d.CPU.pc
+	case "[":
+		u.mem -= 16
+	case "]":
+		u.mem += 16
+	case "g":
+		u.ask("go to: ", func(text string) {
+			if addr, err := u.D.Addr(text); err != nil {
+				u.status = err.Error()
+			} else {
+				u.cursor = addr
+			}
+		})
+	case "m":
+		u.ask("memory at: ", func(text string) {
+			if addr, err := u.D.Addr(text); err != nil {
+				u.status = err.Error()
+			} else {
+				u.mem = addr
+			}
+		})
+	case ":":
+		u.ask(":", func(text string) {
+			var pc = d.CPU.pc
+			fmt.Fprintf(u.repl.Out, ": %s\n", text)
+			if !u.repl.Exec(text) {
+				u.status = "quit leaves with q"
+			}
+			if d.CPU.pc != pc {
+				u.cursor = d.CPU.pc
+			}
+		})
+	case "\t":
+		u.typing = true
+	case "\x0c":
+		if u.Size != nil {
+			u.Width, u.Height = u.Size()
+		}
+		fmt.Fprint(u.Out, "\x1b[2J")
+	case "?", "h":
+		u.status = tuiHelp
+	case "q":
+		return false
+	default:
+		u.status = "unknown key, ? lists the keys"
+	}
+	return true
+}
+
+// run runs the machine until it stops, or until until returns true if not
+// nil
+func (u *TUI) run(until func() bool) {
+	u.running, u.until = true, until
+	u.status = "running"
+}
+
+func (u *TUI) ask(label string, done func(text string)) {
+	u.prompt = &tuiPrompt{label: label, done: done}
+}
+
+func (u *TUI) hasBreakpoint(addr uint16) bool {
+	var _, ok = u.D.breaks[addr]
+	return ok
+}
+
+// before returns the address n instructions before addr, for a decoding
+// of the bytes before it that lands on it
+func (u *TUI) before(addr uint16, n int) uint16 {
+	for back := 3 * n; back > 0; back-- {
+		var starts []int
+		var off = -back
+		for off < 0 {
+			starts = append(starts, off)
+			var _, size = u.D.Disassemble(addr + uint16(off))
+			off += size
+		}
+		if off == 0 && len(starts) >= n {
+			return addr + uint16(starts[len(starts)-n])
+		}
+	}
+	return addr
+}
+
+// tuiLayout are the rows and columns of the panes
+type tuiLayout struct {
+	split               int // the column between the disassembly and the registers and stack
+	codeRows, stackRows int
+	memTop, memRows     int
+	consoleTop, conRows int
+	status              int
+}
+
+func (u *TUI) layout() tuiLayout {
+	var l tuiLayout
+	l.status = u.Height - 1
+	l.conRows = (u.Height-1)/4 - 1
+	if l.conRows < 3 {
+		l.conRows = 3
+	}
+	l.consoleTop = l.status - l.conRows - 1
+	l.memRows = 4
+	l.memTop = l.consoleTop - l.memRows - 1
+	l.codeRows = l.memTop - 1
+	l.stackRows = l.memTop - 7
+	l.split = u.Width - 32
+	return l
+}
+
+// tuiRegisterRows are the rows of the registers pane
+const tuiRegisterRows = 4
+
+// render draws the panes on the screen
+func (u *TUI) render() {
+	var d, s, c = u.D, u.D.CPU, &u.screen
+	var l = u.layout()
+	c.reset(u.Width, u.Height)
+
+	// the disassembly, scrolled to show the cursor
+	var addrs []uint16
+	for pass := 0; pass < 2; pass++ {
+		addrs = addrs[:0]
+		var addr = u.top
+		for i := 0; i < l.codeRows; i++ {
+			addrs = append(addrs, addr)
+			var _, size = d.Disassemble(addr)
+			addr += uint16(size)
+		}
+		if u.cursor-u.top < addr-u.top && (u.cursor != addr || addr == u.top) {
+			break
+		}
+		u.top = u.before(u.cursor, l.codeRows/3)
+	}
+	c.title(0, 0, l.split, "Disassembly")
+	for i, addr := range addrs {
+		var style byte
+		var mark = []byte("  ")
+		if u.hasBreakpoint(addr) {
+			mark[0], style = '*', style|tuiRed
+		}
+		if addr == s.pc {
+			mark[1], style = '>', style|tuiBold|tuiGreen
+		}
+		if addr == u.cursor && !u.typing {
+			style |= tuiReverse
+		}
+		c.text(0, 1+i, l.split, style, string(mark)+d.Where(addr))
+	}
+
+	// the registers and the stack
+	var x, w = l.split + 1, u.Width - l.split - 1
+	for y := 0; y < l.memTop; y++ {
+		c.text(l.split, y, 1, 0, "|")
+	}
+	c.title(x, 0, w, "Registers")
+	var regs = []string{
+		fmt.Sprintf("A  %02x    %s %s", s.regA, d.Flags(), d.Interrupts()),
+		fmt.Sprintf("BC %02x%02x  DE %02x%02x  HL %02x%02x", s.regB, s.regC, s.regD, s.regE, s.regH, s.regL),
+		fmt.Sprintf("SP %04x  PC %04x", s.sp, s.pc),
+		fmt.Sprintf("states %d", s.cycles),
+	}
+	for i, text := range regs {
+		c.text(x, 1+i, w, 0, text)
+	}
+	c.title(x, 1+tuiRegisterRows, w, "Stack")
+	var returns = map[uint16]uint16{}
+	for _, f := range d.calls.frames {
+		returns[f.SP] = f.To
+	}
+	for i := 0; i < l.stackRows; i++ {
+		var addr = s.sp + uint16(2*i)
+		var word = pairTo16(s.peek(addr+1), s.peek(addr))
+		var text = fmt.Sprintf("%04x  %04x  %s", addr, word, d.Symbols.Label(word))
+		if to, ok := returns[addr]; ok {
+			text += " < " + d.Symbols.Name(to)
+		}
+		c.text(x, 2+tuiRegisterRows+i, w, 0, text)
+	}
+
+	// memory
+	c.title(0, l.memTop, u.Width, "Memory")
+	for i := 0; i < l.memRows; i++ {
+		c.text(0, l.memTop+1+i, u.Width, 0, d.Dump(u.mem+uint16(16*i), 16))
+	}
+
+	// the console, its last lines wrapped
+	var title = "Console"
+	if u.typing {
+		title += ": typing to the machine, Ctrl-] to leave"
+	}
+	c.title(0, l.consoleTop, u.Width, title)
+	var rows []tuiLine
+	for i := len(u.console.lines) - 1; i >= 0 && len(rows) < l.conRows; i-- {
+		var line = u.console.lines[i]
+		var end = len(line.text)
+		for start := end - end%u.Width; len(rows) < l.conRows; start -= u.Width {
+			if start == end && start > 0 {
+				end = start
+				continue
+			}
+			rows = append(rows, tuiLine{line.text[start:end], line.note})
+			if start == 0 {
+				break
+			}
+			end = start
+		}
+	}
+	for i := range rows {
+		var row = rows[len(rows)-1-i]
+		var style byte
+		if row.note {
+			style = tuiCyan
+		}
+		c.text(0, l.consoleTop+1+i, u.Width, style, string(row.text))
+	}
+
+	// the status line
+	var status = u.status
+	if u.prompt != nil {
+		status = u.prompt.label + u.prompt.text + "_"
+	} else if u.running && status == "running" {
+		status = "running, p pauses"
+	}
+	c.title(0, l.status, u.Width, status)
+}
+
+// draw renders the screen and sends it to the terminal
+func (u *TUI) draw() {
+	u.render()
+	io.WriteString(u.Out, u.screen.ansi())
+}
+
+// tuiConsole is the console pane: what the machine wrote, with the notes
+// of the debugger commands in between
+type tuiConsole struct {
+	lines []tuiLine
+	open  bool // the last line goes on
+}
+
+type tuiLine struct {
+	text []byte
+	note bool // written by the debugger
+}
+
+// the lines kept, and the length they go on to the next at
+const (
+	tuiConsoleLines = 1000
+	tuiLineLength   = 4096
+)
+
+// Write takes what the machine writes: the printable characters, new lines
+// and backspaces
+func (c *tuiConsole) Write(p []byte) (int, error) {
+	for _, b := range p {
+		c.put(b, false)
+	}
+	return len(p), nil
+}
+
+func (c *tuiConsole) put(b byte, note bool) {
+	var n = len(c.lines)
+	if !c.open || c.lines[n-1].note != note {
+		if b == '\r' || b == '\b' || b == 0x7f {
+			return
+		}
+		c.lines = append(c.lines, tuiLine{note: note})
+		if len(c.lines) > tuiConsoleLines {
+			c.lines = c.lines[1:]
+		}
+		n, c.open = len(c.lines), true
+	}
+	var l = &c.lines[n-1]
+	switch {
+	case b == '\n':
+		c.open = false
+	case (b == '\b' || b == 0x7f) && len(l.text) > 0:
+		l.text = l.text[:len(l.text)-1]
+	case b >= ' ' && b <= '~' && len(l.text) == tuiLineLength:
+		c.open = false
+		c.put(b, note)
+	case b >= ' ' && b <= '~':
+		l.text = append(l.text, b)
+	}
+}
+
+// tuiNotes writes the notes of the debugger in the console
+type tuiNotes struct{ c *tuiConsole }
+
+func (n tuiNotes) Write(p []byte) (int, error) {
+	for _, b := range p {
+		n.c.put(b, true)
+	}
+	return len(p), nil
+}
+
+// the styles of the cells, which combine
+const (
+	tuiBold byte = 1 << iota
+	tuiReverse
+	tuiRed
+	tuiGreen
+	tuiCyan
+)
+
+// canvas is the screen, a character and a style by cell
+type canvas struct {
+	w, h  int
+	chars []byte
+	style []byte
+}
+
+func (c *canvas) reset(w, h int) {
+	c.w, c.h = w, h
+	c.chars = make([]byte, w*h)
+	c.style = make([]byte, w*h)
+	for i := range c.chars {
+		c.chars[i] = ' '
+	}
+}
+
+// text writes s at x, y, cut to n columns, and gives them style
+func (c *canvas) text(x, y, n int, style byte, s string) {
+	if y < 0 || y >= c.h {
+		return
+	}
+	for i := 0; i < n && x+i < c.w; i++ {
+		if i < len(s) {
+			c.chars[y*c.w+x+i] = s[i]
+		}
+		c.style[y*c.w+x+i] = style
+	}
+}
+
+// title writes the title of a pane, over n columns in reverse video
+func (c *canvas) title(x, y, n int, s string) {
+	c.text(x, y, n, tuiReverse, " "+s)
+}
+
+// line returns the characters of row y
+func (c *canvas) line(y int) string {
+	return strings.TrimRight(string(c.chars[y*c.w:(y+1)*c.w]), " ")
+}
+
+// ansi returns the escape sequences drawing the screen from the top left
+// corner
+func (c *canvas) ansi() string {
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[0m")
+	var last byte
+	for y := 0; y < c.h; y++ {
+		if y > 0 {
+			b.WriteString("\r\n")
+		}
+		for x := 0; x < c.w; x++ {
+			var i = y*c.w + x
+			if c.style[i] != last {
+				last = c.style[i]
+				b.WriteString(tuiStyle(last))
+			}
+			b.WriteByte(c.chars[i])
+		}
+	}
+	b.WriteString("\x1b[0m")
+	return b.String()
+}
+
+// tuiStyle returns the escape sequence of style
+func tuiStyle(style byte) string {
+	var codes = []string{"0"}
+	for i, code := range []string{"1", "7", "31", "32", "36"} {
+		if style&(1<<i) != 0 {
+			codes = append(codes, code)
+		}
+	}
+	return "\x1b[" + strings.Join(codes, ";") + "m"
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tuied returns the TUI of the debugged machine on a terminal whose keys
+// are written to the pipe returned
+func tuied() (*TUI, *io.PipeWriter, *bytes.Buffer) {
+	var r, w = io.Pipe()
+	var out bytes.Buffer
+	var term = NewTerminal(r, &out, false)
+	return NewTUI(debugged(100), term, &out), w, &out
+}
+
+// screen returns the rows of the screen the TUI draws
+func screen(u *TUI) []string {
+	u.render()
+	var rows []string
+	for y := 0; y < u.Height; y++ {
+		rows = append(rows, u.screen.line(y))
+	}
+	return rows
+}
+
+// keys acts on keys, and on the runs they start until they stop
+func keys(u *TUI, keys ...string) {
+	for _, key := range keys {
+		u.Key(key)
+		for i := 0; u.running && i < 100; i++ {
+			u.slice(time.Millisecond)
+		}
+	}
+}
+
+func TestTUIScreen(t *testing.T) {
+	var u, _, _ = tuied()
+	var rows = screen(u)
+	var expected = []struct {
+		row  int
+		text string
+	}{
+		{0, " Disassembly"},
+		{1, " >0000"},
+		{2, "  0003"},
+		{3, "  LOOP"},
+		{0, "| Registers"},
+		{1, "|A  00    ----- DI"},
+		{2, "|BC 0000  DE 0000  HL 0000"},
+		{3, "|SP 0000  PC 0000"},
+		{4, "|states 0"},
+		{5, "| Stack"},
+		{6, "|0000  0031"},
+		{13, " Memory"},
+		{14, "0000  31 00 20 21"},
+		{18, " Console"},
+		{23, " ? lists the keys"},
+	}
+	for _, e := range expected {
+		if !strings.Contains(rows[e.row], e.text) {
+			t.Errorf("row %d is %q, expected it to hold %q", e.row, rows[e.row], e.text)
+		}
+	}
+	if len(rows[0]) > 80 {
+		t.Errorf("row 0 is %d columns wide", len(rows[0]))
+	}
+}
+
+func TestTUIKeys(t *testing.T) {
+	var u, _, _ = tuied()
+	var d = u.D
+
+	keys(u, "s", "s")
+	if d.CPU.pc != 0x06 || u.cursor != 0x06 {
+		t.Errorf("stepped to %04x, cursor at %04x, expected 0006", d.CPU.pc, u.cursor)
+	}
+
+	keys(u, "g", "S", "U", "B", "\r", "b")
+	if _, ok := d.breaks[0x10]; !ok || u.cursor != 0x10 {
+		t.Errorf("breakpoints %v, cursor at %04x, expected a breakpoint at SUB", d.Breakpoints(), u.cursor)
+	}
+	keys(u, "c")
+	if d.CPU.pc != 0x10 || u.running || u.status != "breakpoint" {
+		t.Errorf("stopped at %04x, running %v, status %q, expected the breakpoint at SUB", d.CPU.pc, u.running, u.status)
+	}
+	var rows = strings.Join(screen(u), "\n")
+	if !strings.Contains(rows, "*>0010  SUB ") {
+		t.Errorf("no breakpoint and pc at SUB on the screen:\n%s", rows)
+	}
+	if !strings.Contains(rows, "|1ffe  000a  LOOP+4 < SUB") {
+		t.Errorf("no return address of SUB on the screen:\n%s", rows)
+	}
+
+	keys(u, "o")
+	if d.CPU.pc != 0x0a || u.running {
+		t.Errorf("stepped out to %04x, running %v, expected 000a", d.CPU.pc, u.running)
+	}
+	keys(u, "r")
+	if d.CPU.pc != 0x13 {
+		t.Errorf("stepped back to %04x, expected the RET at 0013", d.CPU.pc)
+	}
+	keys(u, "g", "S", "U", "B", "\r", "b", "n")
+	if d.CPU.pc != 0x0a || len(d.Breakpoints()) != 0 {
+		t.Errorf("stepped over to %04x with breakpoints %v, expected 000a and none", d.CPU.pc, d.Breakpoints())
+	}
+	keys(u, "n", "n", "n")
+	if d.CPU.pc != 0x0a {
+		t.Errorf("stepped over the CALL to %04x, expected 000a", d.CPU.pc)
+	}
+
+	keys(u, ":", "p", " ", "H", "L", "\r")
+	var last = u.console.lines[len(u.console.lines)-1]
+	if !last.note || !strings.Contains(string(last.text), "1000") {
+		t.Errorf("the console ends with %q, expected the HL of the p command", last.text)
+	}
+
+	keys(u, "m", "1", "0", "0", "0", "\r")
+	if u.mem != 0x1000 || !strings.HasPrefix(screen(u)[14], "1000  02 ") {
+		t.Errorf("memory at %04x, row 14 %q, expected COUNT at 1000", u.mem, screen(u)[14])
+	}
+
+	if !u.Key("?") || u.status != tuiHelp {
+		t.Errorf("status %q, expected the help", u.status)
+	}
+	if u.Key("q") {
+		t.Errorf("q did not quit")
+	}
+}
+
+func TestTUIRunning(t *testing.T) {
+	var u, _, _ = tuied()
+	u.Key("c")
+	u.slice(time.Millisecond)
+	if !u.running || u.D.CPU.cycles == 0 {
+		t.Errorf("running %v after %d states, expected a run going on", u.running, u.D.CPU.cycles)
+	}
+	u.Key("x")
+	if !u.running {
+		t.Errorf("x stopped the run")
+	}
+	u.Key("p")
+	if u.running || u.status != "paused" || u.cursor != u.D.CPU.pc {
+		t.Errorf("running %v, status %q, expected a pause", u.running, u.status)
+	}
+}
+
+func TestTUIConsole(t *testing.T) {
+	var u, _, _ = tuied()
+	var c = &u.console
+	io.WriteString(c, "hello\r\nwor")
+	io.WriteString(tuiNotes{c}, "note\n")
+	io.WriteString(c, "ldd\bx\x07\n\n")
+	var expected = []tuiLine{{[]byte("hello"), false}, {[]byte("wor"), false}, {[]byte("note"), true}, {[]byte("ldx"), false}, {nil, false}}
+	if len(c.lines) != len(expected) {
+		t.Fatalf("%d lines, expected %d", len(c.lines), len(expected))
+	}
+	for i, l := range expected {
+		if string(c.lines[i].text) != string(l.text) || c.lines[i].note != l.note {
+			t.Errorf("line %d is %q, note %v, expected %q, %v", i, c.lines[i].text, c.lines[i].note, l.text, l.note)
+		}
+	}
+
+	io.WriteString(c, strings.Repeat("0123456789", 17))
+	var rows = screen(u)[19:23]
+	var wrapped = []string{"", strings.Repeat("0123456789", 8), strings.Repeat("0123456789", 8), "0123456789"}
+	for i, row := range rows {
+		if row != wrapped[i] {
+			t.Errorf("console row %d is %q, expected %q", i, row, wrapped[i])
+		}
+	}
+}
+
+func TestTUITyping(t *testing.T) {
+	var r, w = io.Pipe()
+	var out bytes.Buffer
+	var term = NewTerminal(r, &out, false)
+	var u = NewTUI(debugged(100), term, &out)
+
+	term.Write('A')
+	if len(u.console.lines) != 1 || string(u.console.lines[0].text) != "A" || out.Len() != 0 {
+		t.Errorf("the machine wrote %d console lines and %q to the terminal, expected A to the console", len(u.console.lines), out.String())
+	}
+
+	go w.Write([]byte("\tx\x1b[A\x1d"))
+	var got []string
+	for len(got) < 4 {
+		var key, _ = u.readKey(true)
+		got = append(got, key)
+		u.Key(key)
+	}
+	if strings.Join(got, ",") != "\t,x,up,\x1d" {
+		t.Errorf("read keys %q", got)
+	}
+	if u.typing {
+		t.Errorf("Ctrl-] left the keys to the machine")
+	}
+	var typed []byte
+	for term.Ready() {
+		typed = append(typed, term.Read())
+	}
+	if string(typed) != "x\x1b[A" {
+		t.Errorf("the machine read %q, expected x and the up key", typed)
+	}
+
+	go w.Write([]byte{0x1b})
+	if key, _ := u.readKey(true); key != "esc" {
+		t.Errorf("read %q, expected esc", key)
+	}
+	w.Close()
+	if _, ok := u.readKey(true); ok {
+		t.Errorf("read a key after the end of the input")
+	}
+}
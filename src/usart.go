@@ -0,0 +1,224 @@
+package main
+
+// USART is an Intel 8251A serial interface on a pair of ports: data at the
+// first one and control and status at the second one. After a reset the
+// control port takes a mode instruction, then the sync characters of the
+// synchronous modes, then commands. The bytes move at the bit rate of TxC,
+// paced by the cycles of the CPU, or at once when TxC is 0. Bytes from the
+// host wait on the line rather than overrun the receiver and can not be
+// garbled, so the error bits of the status stay clear.
+type USART struct {
+	line  Line          // nil when nothing is connected
+	clock func() uint64 // the states run by the CPU
+
+	CPUHz       int  // the clock of the CPU
+	TxC         int  // the clock of the transmitter and the receiver, in Hz
+	RxInterrupt bool // RxRDY requests interrupts
+
+	expect  byte // what the next control byte is
+	mode    byte
+	command byte
+
+	rx     byte
+	rxFull bool
+	rxNext uint64 // when the receiver may take the next byte
+	tx     byte
+	txFull bool
+	txDone uint64 // when the transmitter has shifted out its byte
+}
+
+// What the control port expects
+const (
+	usartExpectMode = iota
+	usartExpectSync1
+	usartExpectSync2
+	usartExpectCommand
+)
+
+// The fields of the mode instruction
+const (
+	usartFactor  = 0b0000_0011 // 0 for synchronous, else x1, x16 or x64
+	usartLength  = 0b0000_1100 // 5 to 8 bits
+	usartParity  = 0b0001_0000 // parity enabled
+	usartStop    = 0b1100_0000 // 1, 1.5 or 2 stop bits
+	usartOneSync = 0b1000_0000 // synchronous: a single sync character
+)
+
+// The bits of the command instruction
+const (
+	usartTxEnable = 1 << 0
+	usartDTR      = 1 << 1
+	usartRxEnable = 1 << 2
+	usartBreak    = 1 << 3
+	usartErrReset = 1 << 4
+	usartRTS      = 1 << 5
+	usartReset    = 1 << 6
+	usartHunt     = 1 << 7
+)
+
+// The bits of the status
+const (
+	usartTxRDY   = 1 << 0
+	usartRxRDY   = 1 << 1
+	usartTxEmpty = 1 << 2
+	usartPE      = 1 << 3
+	usartOE      = 1 << 4
+	usartFE      = 1 << 5
+	usartSynDet  = 1 << 6
+	usartDSR     = 1 << 7
+)
+
+// NewUSART returns an 8251 connected to line, timed by clock, which is
+// usually the Cycles method of a CPU running at cpuHz. clock may be nil to
+// leave the bytes unpaced.
+func NewUSART(line Line, clock func() uint64, cpuHz int) *USART {
+	return &USART{line: line, clock: clock, CPUHz: cpuHz}
+}
+
+// Attach puts the data port at port and the control port at port+1
+func (u *USART) Attach(bus *Bus, port byte) {
+	bus.Attach(port, u.ReadData, u.WriteData)
+	bus.Attach(port+1, u.Status, u.Control)
+}
+
+func (u *USART) now() uint64 {
+	if u.clock == nil {
+		return 0
+	}
+	return u.clock()
+}
+
+// charTime is the number of CPU states a character takes on the line
+func (u *USART) charTime() uint64 {
+	if u.clock == nil || u.TxC <= 0 {
+		return 0
+	}
+
+	var factor = []uint64{1, 1, 16, 64}[u.mode&usartFactor]
+	var halfBits = 2 * uint64(1+u.bits())
+	if u.mode&usartParity != 0 {
+		halfBits += 2
+	}
+	if u.mode&usartFactor != 0 {
+		halfBits += []uint64{2, 2, 3, 4}[u.mode&usartStop>>6]
+	}
+	return halfBits * uint64(u.CPUHz) * factor / (2 * uint64(u.TxC))
+}
+
+// bits is the number of data bits of a character
+func (u *USART) bits() int {
+	return 5 + int(u.mode&usartLength>>2)
+}
+
+func (u *USART) mask() byte {
+	return byte(0xff >> (8 - u.bits()))
+}
+
+// update moves the bytes between the buffers and the line as far as the
+// clock allows
+func (u *USART) update() {
+	var now = u.now()
+	if u.txFull && u.command&usartTxEnable != 0 && now >= u.txDone {
+		if u.line != nil {
+			u.line.Write(u.tx & u.mask())
+		}
+		u.txFull, u.txDone = false, now+u.charTime()
+	}
+	if !u.rxFull && u.command&usartRxEnable != 0 && now >= u.rxNext && u.line != nil && u.line.Ready() {
+		u.rx, u.rxFull = u.line.Read()&u.mask(), true
+		u.rxNext = now + u.charTime()
+	}
+}
+
+func (u *USART) Status() byte {
+	u.update()
+	var st byte
+	if !u.txFull {
+		st |= usartTxRDY
+		if u.now() >= u.txDone {
+			st |= usartTxEmpty
+		}
+	}
+	if u.rxFull {
+		st |= usartRxRDY
+	}
+	if u.line != nil {
+		st |= usartDSR
+	}
+	return st
+}
+
+func (u *USART) Control(v byte) {
+	switch u.expect {
+	case usartExpectMode:
+		u.mode, u.expect = v, usartExpectCommand
+		if v&usartFactor == 0 {
+			u.expect = usartExpectSync1
+		}
+	case usartExpectSync1:
+		u.expect = usartExpectSync2
+		if u.mode&usartOneSync != 0 {
+			u.expect = usartExpectCommand
+		}
+	case usartExpectSync2:
+		u.expect = usartExpectCommand
+	default:
+		if v&usartReset != 0 {
+			u.Reset()
+			return
+		}
+		u.command = v
+		u.update()
+	}
+}
+
+// Reset is the internal reset: the USART waits for a mode instruction
+func (u *USART) Reset() {
+	u.expect, u.command = usartExpectMode, 0
+	u.rxFull, u.txFull = false, false
+}
+
+// ReadData takes the byte received. Reading twice without a new byte
+// returns the same one.
+func (u *USART) ReadData() byte {
+	u.update()
+	u.rxFull = false
+	return u.rx
+}
+
+// WriteData gives the transmitter a byte. A byte written while the buffer
+// is full replaces the one waiting.
+func (u *USART) WriteData(v byte) {
+	u.tx, u.txFull = v, true
+	u.update()
+}
+
+// IRQ tells if the USART requests an interrupt: RxRDY when RxInterrupt is
+// set
+func (u *USART) IRQ() bool {
+	if !u.RxInterrupt {
+		return false
+	}
+	u.update()
+	return u.rxFull
+}
+
+func (u *USART) SaveState(e *Encoder) {
+	for _, v := range []byte{u.expect, u.mode, u.command, u.rx, u.tx} {
+		e.Byte(v)
+	}
+	e.Bool(u.rxFull)
+	e.Bool(u.txFull)
+	e.Uint64(u.rxNext)
+	e.Uint64(u.txDone)
+}
+
+func (u *USART) LoadState(d *Decoder) {
+	for _, v := range []*byte{&u.expect, &u.mode, &u.command, &u.rx, &u.tx} {
+		*v = d.Byte()
+	}
+	u.rxFull = d.Bool()
+	u.txFull = d.Bool()
+	u.rxNext = d.Uint64()
+	u.txDone = d.Uint64()
+}
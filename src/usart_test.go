@@ -0,0 +1,121 @@
+package main
+
+import "testing"
+
+func TestUSART(t *testing.T) {
+	var line = &bufLine{in: "\xc1B"}
+	var now uint64
+	var u = NewUSART(line, func() uint64 { return now }, 2000000)
+	u.TxC = 153600 // 9600 baud at x16
+
+	u.Control(0b01_00_10_10) // 1 stop bit, no parity, 7 bits, x16
+	if st := u.Status(); st != usartTxRDY|usartTxEmpty|usartDSR {
+		t.Errorf("status %08b before the command, expected TxRDY, TxEMPTY and DSR", st)
+	}
+	u.Control(usartTxEnable | usartRxEnable | usartDTR | usartRTS)
+
+	// 9 bits at 9600 baud are 1875 states of a 2 MHz CPU
+	if n := u.charTime(); n != 1875 {
+		t.Errorf("a character takes %d states, expected 1875", n)
+	}
+	u.CPUHz = 3000000
+	if n := u.charTime(); n != 2812 {
+		t.Errorf("a character takes %d states of a 3 MHz CPU, expected 2812", n)
+	}
+	u.CPUHz = 2000000
+
+	var table = []struct {
+		what   string
+		now    uint64
+		do     func()
+		status byte
+	}{
+		{"received", 0, nil, usartTxRDY | usartTxEmpty | usartRxRDY | usartDSR},
+		{"write", 10, func() { u.WriteData('x') }, usartTxRDY | usartRxRDY | usartDSR},
+		{"write again", 20, func() { u.WriteData('y') }, usartRxRDY | usartDSR},
+		{"read", 30, func() { u.ReadData() }, usartDSR},
+		{"next received", 1880, nil, usartRxRDY | usartDSR},
+		{"sent", 1885, nil, usartTxRDY | usartRxRDY | usartDSR},
+		{"empty", 3760, nil, usartTxRDY | usartTxEmpty | usartRxRDY | usartDSR},
+	}
+	for _, test := range table {
+		now = test.now
+		if test.do != nil {
+			test.do()
+		}
+		if st := u.Status(); st != test.status {
+			t.Errorf("%s: status %08b, expected %08b", test.what, st, test.status)
+		}
+	}
+	if string(line.out) != "xy" {
+		t.Errorf("sent %q, expected %q", line.out, "xy")
+	}
+	if b := u.ReadData(); b != 'B' {
+		t.Errorf("received %02x, expected 42", b)
+	}
+}
+
+func TestUSARTModes(t *testing.T) {
+	var line = &bufLine{in: "\xff"}
+	var u = NewUSART(line, nil, 2000000)
+
+	// Synchronous with two sync characters, then 5 bits
+	u.Control(0b0000_0000)
+	u.Control(0x16)
+	if u.expect != usartExpectSync2 {
+		t.Errorf("expects %d after the first sync character", u.expect)
+	}
+	u.Control(0x16)
+	u.Control(usartReset)
+	if u.expect != usartExpectMode {
+		t.Errorf("expects %d after the reset, expected the mode", u.expect)
+	}
+
+	// Single sync character
+	u.Control(usartOneSync)
+	u.Control(0x16)
+	if u.expect != usartExpectCommand {
+		t.Errorf("expects %d after the single sync character", u.expect)
+	}
+	u.Control(usartReset)
+
+	u.Control(0b11_11_00_01) // 2 stop bits, even parity, 5 bits, x1
+	u.Control(usartRxEnable | usartTxEnable)
+	if b := u.ReadData(); b != 0x1f {
+		t.Errorf("received %02x with 5 bits, expected 1f", b)
+	}
+	u.WriteData(0xff)
+	if string(line.out) != "\x1f" {
+		t.Errorf("sent %q with 5 bits", line.out)
+	}
+
+	// Without TxEN the byte waits
+	u.Control(0)
+	u.WriteData('a')
+	if st := u.Status(); st&usartTxRDY != 0 || len(line.out) != 1 {
+		t.Errorf("sent with the transmitter disabled")
+	}
+	u.Control(usartTxEnable)
+	if st := u.Status(); st&usartTxRDY == 0 || len(line.out) != 2 {
+		t.Errorf("did not send once the transmitter was enabled")
+	}
+}
+
+func TestUSARTInterrupts(t *testing.T) {
+	var line = &bufLine{in: "a"}
+	var u = NewUSART(line, nil, 2000000)
+	u.Control(0b01_00_11_10) // 8 bits, x16
+	u.Control(usartRxEnable)
+
+	if u.IRQ() {
+		t.Errorf("interrupt requested with RxInterrupt clear")
+	}
+	u.RxInterrupt = true
+	if !u.IRQ() {
+		t.Errorf("no interrupt with a byte received")
+	}
+	u.ReadData()
+	if u.IRQ() {
+		t.Errorf("interrupt requested after reading the byte")
+	}
+}